@@ -0,0 +1,47 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tbxark/mcp-proxy/pkg/proxy"
+)
+
+// runGenerate implements `mcp-proxy generate`, which builds a proxy config
+// from the MCP servers of a docker compose file.
+func runGenerate(args []string) error {
+	flags := flag.NewFlagSet("generate", flag.ExitOnError)
+	compose := flags.String("compose", "", "docker compose file whose services labeled mcp-proxy.enable=true become servers")
+	out := flags.String("out", "", "path to write the proxy config to (default stdout)")
+	baseURL := flags.String("base-url", "http://localhost:9090", "public base URL of the proxy")
+	addr := flags.String("addr", ":9090", "address the proxy listens on")
+	token := flags.String("token", "", "auth token for every route (default: a random token)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: mcp-proxy generate --compose docker-compose.yml [flags]")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if *compose == "" || flags.NArg() != 0 {
+		flags.Usage()
+		return fmt.Errorf("expected --compose")
+	}
+
+	data, err := os.ReadFile(*compose)
+	if err != nil {
+		return err
+	}
+	proxyConfig, err := newGeneratedProxyConfig(*baseURL, *addr, *token)
+	if err != nil {
+		return err
+	}
+	config, notes, err := proxy.ImportComposeConfig(data, proxyConfig)
+	if err != nil {
+		// The notes explain why services were skipped.
+		for _, note := range notes {
+			fmt.Fprintf(os.Stderr, "- %s\n", note)
+		}
+		return err
+	}
+	return writeGeneratedConfig(*out, config, notes)
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// runHealthcheck implements `mcp-proxy healthcheck`, which probes a running
+// proxy so container images need no curl or wget for HEALTHCHECK lines and
+// exec probes. It fails on a non-2xx answer and, unless -allow-degraded is
+// set, on a JSON body whose status is not "ok".
+func runHealthcheck(args []string) error {
+	flags := flag.NewFlagSet("healthcheck", flag.ExitOnError)
+	url := flags.String("url", "http://localhost:9090/status", "endpoint to probe")
+	token := flags.String("token", "", "bearer token for a protected endpoint")
+	timeout := flags.Duration("timeout", 5*time.Second, "time to wait for the answer")
+	allowDegraded := flags.Bool("allow-degraded", false, "succeed while some servers are unhealthy")
+	_ = flags.Parse(args)
+
+	req, err := http.NewRequest(http.MethodGet, *url, nil)
+	if err != nil {
+		return err
+	}
+	if *token != "" {
+		req.Header.Set("Authorization", "Bearer "+*token)
+	}
+	resp, err := (&http.Client{Timeout: *timeout}).Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("%s answered %s", *url, resp.Status)
+	}
+	var status struct {
+		Status string `json:"status"`
+	}
+	if json.Unmarshal(body, &status) == nil && status.Status != "" && status.Status != "ok" && !*allowDegraded {
+		return fmt.Errorf("%s reports status %q", *url, status.Status)
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tbxark/mcp-proxy/pkg/proxy"
+)
+
+// runImportClaude implements `mcp-proxy import-claude`, which turns the
+// servers of a Claude Desktop config into a proxy config.
+func runImportClaude(args []string) error {
+	flags := flag.NewFlagSet("import-claude", flag.ExitOnError)
+	out := flags.String("out", "", "path to write the proxy config to (default stdout)")
+	baseURL := flags.String("base-url", "http://localhost:9090", "public base URL of the proxy")
+	addr := flags.String("addr", ":9090", "address the proxy listens on")
+	token := flags.String("token", "", "auth token for every route (default: a random token)")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: mcp-proxy import-claude [flags] <claude_desktop_config.json>")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 {
+		flags.Usage()
+		return fmt.Errorf("expected the path of a Claude Desktop config")
+	}
+
+	data, err := os.ReadFile(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	proxyConfig, err := newGeneratedProxyConfig(*baseURL, *addr, *token)
+	if err != nil {
+		return err
+	}
+	config, notes, err := proxy.ImportClaudeDesktopConfig(data, proxyConfig)
+	if err != nil {
+		return err
+	}
+	return writeGeneratedConfig(*out, config, notes)
+}
+
+// newGeneratedProxyConfig is the mcpProxy section of generated configs. All
+// routes are protected by token, or by a random token when it is empty.
+func newGeneratedProxyConfig(baseURL, addr, token string) (*proxy.MCPProxyConfigV2, error) {
+	if token == "" {
+		var err error
+		if token, err = randomToken(); err != nil {
+			return nil, err
+		}
+		fmt.Fprintln(os.Stderr, "- generated a random auth token, see mcpProxy.options.authTokens")
+	}
+	return &proxy.MCPProxyConfigV2{
+		BaseURL: baseURL,
+		Addr:    addr,
+		Name:    "MCP Proxy",
+		Version: "1.0.0",
+		Type:    proxy.MCPServerTypeStreamable,
+		Options: &proxy.OptionsV2{AuthTokens: []proxy.AuthToken{{Token: token}}},
+	}, nil
+}
+
+func randomToken() (string, error) {
+	buf := make([]byte, 24)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// writeGeneratedConfig prints notes to stderr and writes config to out,
+// or to stdout when out is empty.
+func writeGeneratedConfig(out string, config *proxy.Config, notes []string) error {
+	for _, note := range notes {
+		fmt.Fprintf(os.Stderr, "- %s\n", note)
+	}
+	output, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	output = append(output, '\n')
+	if out == "" {
+		_, err = os.Stdout.Write(output)
+		return err
+	}
+	if err = os.WriteFile(out, output, 0o600); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s with %d servers\n", out, len(config.McpServers))
+	return nil
+}
@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/tbxark/mcp-proxy/pkg/proxy"
+)
+
+// initServer is a popular server the init wizard offers to add.
+type initServer struct {
+	name        string
+	description string
+	build       func(w *wizard) (*proxy.MCPClientConfigV2, error)
+}
+
+var initServers = []initServer{
+	{
+		name:        "filesystem",
+		description: "read and write files in a directory",
+		build: func(w *wizard) (*proxy.MCPClientConfigV2, error) {
+			cwd, _ := os.Getwd()
+			dir, err := w.ask("Directory the filesystem server may access", cwd)
+			if err != nil {
+				return nil, err
+			}
+			if dir, err = filepath.Abs(dir); err != nil {
+				return nil, err
+			}
+			return &proxy.MCPClientConfigV2{Command: "npx", Args: []string{"-y", "@modelcontextprotocol/server-filesystem", dir}}, nil
+		},
+	},
+	{
+		name:        "fetch",
+		description: "fetch web pages as markdown",
+		build: func(w *wizard) (*proxy.MCPClientConfigV2, error) {
+			return &proxy.MCPClientConfigV2{Command: "uvx", Args: []string{"mcp-server-fetch"}}, nil
+		},
+	},
+	{
+		name:        "github",
+		description: "issues, pull requests and code search",
+		build: func(w *wizard) (*proxy.MCPClientConfigV2, error) {
+			// The default is expanded from the environment when the proxy
+			// loads the config, which keeps the token out of the file.
+			token, err := w.ask("GitHub personal access token", "${GITHUB_PERSONAL_ACCESS_TOKEN}")
+			if err != nil {
+				return nil, err
+			}
+			return &proxy.MCPClientConfigV2{
+				Command: "npx",
+				Args:    []string{"-y", "@modelcontextprotocol/server-github"},
+				Env:     map[string]string{"GITHUB_PERSONAL_ACCESS_TOKEN": token},
+			}, nil
+		},
+	},
+}
+
+// runInit implements `mcp-proxy init`, which asks for the basics of a
+// proxy and writes a config that passes validation.
+func runInit(args []string) error {
+	flags := flag.NewFlagSet("init", flag.ExitOnError)
+	out := flags.String("out", "config.json", "path to write the proxy config to")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: mcp-proxy init [flags]")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+
+	w := &wizard{in: bufio.NewReader(os.Stdin), out: os.Stderr}
+	if _, err := os.Stat(*out); err == nil {
+		overwrite, cErr := w.confirm(fmt.Sprintf("%s exists, overwrite it?", *out), false)
+		if cErr != nil {
+			return cErr
+		}
+		if !overwrite {
+			return errors.New("not overwriting " + *out)
+		}
+	}
+	config, token, err := w.run()
+	if err != nil {
+		return err
+	}
+	if err = config.Validate(); err != nil {
+		return fmt.Errorf("generated config is invalid: %w", err)
+	}
+	if err = writeGeneratedConfig(*out, config, nil); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w.out, "\nStart the proxy with: mcp-proxy --config %s\n", *out)
+	endpoint := "mcp"
+	if config.McpProxy.Type == proxy.MCPServerTypeSSE {
+		endpoint = "sse"
+	}
+	for _, name := range slices.Sorted(maps.Keys(config.McpServers)) {
+		fmt.Fprintf(w.out, "  %s: %s/%s/%s\n", name, strings.TrimSuffix(config.McpProxy.BaseURL, "/"), name, endpoint)
+	}
+	if token != "" {
+		fmt.Fprintf(w.out, "Clients authenticate with: Authorization: Bearer %s\n", token)
+	}
+	return nil
+}
+
+// run asks the questions and returns the config and its auth token, if
+// any.
+func (w *wizard) run() (*proxy.Config, string, error) {
+	baseURL, err := w.askValid("Public base URL of the proxy", "http://localhost:9090", func(answer string) error {
+		u, pErr := url.Parse(answer)
+		if pErr != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return errors.New("enter an http(s) URL such as https://mcp.example.com")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	addr, err := w.ask("Address to listen on", ":9090")
+	if err != nil {
+		return nil, "", err
+	}
+	transport, err := w.choose("Transport clients connect with", []string{string(proxy.MCPServerTypeStreamable), string(proxy.MCPServerTypeSSE)})
+	if err != nil {
+		return nil, "", err
+	}
+	auth, err := w.choose("Authentication", []string{"token", "none"})
+	if err != nil {
+		return nil, "", err
+	}
+	options := &proxy.OptionsV2{}
+	var token string
+	if auth == "token" {
+		generated, tErr := randomToken()
+		if tErr != nil {
+			return nil, "", tErr
+		}
+		if token, err = w.ask("Auth token (Enter for a random one)", generated); err != nil {
+			return nil, "", err
+		}
+		options.AuthTokens = []proxy.AuthToken{{Token: token}}
+	}
+
+	names := make([]string, len(initServers))
+	for i, server := range initServers {
+		names[i] = server.name
+		fmt.Fprintf(w.out, "  %-10s %s\n", server.name, server.description)
+	}
+	selected, err := w.askValid("Servers to add, comma separated", "fetch", func(answer string) error {
+		for _, name := range splitList(answer) {
+			if !slices.Contains(names, name) {
+				return fmt.Errorf("unknown server %q, choose from %s", name, strings.Join(names, ", "))
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, "", err
+	}
+	config := &proxy.Config{
+		McpProxy: &proxy.MCPProxyConfigV2{
+			BaseURL: baseURL,
+			Addr:    addr,
+			Name:    "MCP Proxy",
+			Version: "1.0.0",
+			Type:    proxy.MCPServerType(transport),
+			Options: options,
+		},
+		McpServers: make(map[string]*proxy.MCPClientConfigV2),
+	}
+	for _, server := range initServers {
+		if !slices.Contains(splitList(selected), server.name) {
+			continue
+		}
+		clientConfig, bErr := server.build(w)
+		if bErr != nil {
+			return nil, "", bErr
+		}
+		if _, lErr := exec.LookPath(clientConfig.Command); lErr != nil {
+			fmt.Fprintf(w.out, "  note: %s is not on PATH here, install it where the proxy runs\n", clientConfig.Command)
+		}
+		config.McpServers[server.name] = clientConfig
+	}
+	return config, token, nil
+}
+
+func splitList(s string) []string {
+	var items []string
+	for item := range strings.SplitSeq(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// wizard asks questions on a terminal. Answers can also be piped in, one
+// per line; an empty line or the end of input takes the default.
+type wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func (w *wizard) ask(question, def string) (string, error) {
+	if def != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", question, def)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", question)
+	}
+	line, err := w.in.ReadString('\n')
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", err
+	}
+	if errors.Is(err, io.EOF) {
+		fmt.Fprintln(w.out)
+	}
+	if answer := strings.TrimSpace(line); answer != "" {
+		return answer, nil
+	}
+	if def == "" && errors.Is(err, io.EOF) {
+		return "", io.ErrUnexpectedEOF
+	}
+	return def, nil
+}
+
+// askValid asks until check accepts the answer.
+func (w *wizard) askValid(question, def string, check func(string) error) (string, error) {
+	for {
+		answer, err := w.ask(question, def)
+		if err != nil {
+			return "", err
+		}
+		cErr := check(answer)
+		if cErr == nil {
+			return answer, nil
+		}
+		fmt.Fprintf(w.out, "  %v\n", cErr)
+		if _, err = w.in.Peek(1); err != nil {
+			return "", cErr
+		}
+	}
+}
+
+// choose asks for one of options; the first is the default.
+func (w *wizard) choose(question string, options []string) (string, error) {
+	return w.askValid(question+" ("+strings.Join(options, "/")+")", options[0], func(answer string) error {
+		if !slices.Contains(options, answer) {
+			return fmt.Errorf("choose one of %s", strings.Join(options, ", "))
+		}
+		return nil
+	})
+}
+
+func (w *wizard) confirm(question string, def bool) (bool, error) {
+	options := []string{"y", "n"}
+	if !def {
+		options = []string{"n", "y"}
+	}
+	answer, err := w.choose(question, options)
+	return answer == "y", err
+}
@@ -1,19 +1,61 @@
 package main
 
 import (
+	"context"
 	"flag"
 	"fmt"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"github.com/tbxark/mcp-proxy/pkg/proxy"
 )
 
 var BuildVersion = "dev"
 
 func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "migrate-config":
+			if err := runMigrateConfig(os.Args[2:]); err != nil {
+				log.Fatalf("Failed to migrate config: %v", err)
+			}
+			return
+		case "healthcheck":
+			if err := runHealthcheck(os.Args[2:]); err != nil {
+				log.Fatalf("Health check failed: %v", err)
+			}
+			return
+		case "selftest":
+			if err := runSelftest(os.Args[2:]); err != nil {
+				log.Fatalf("Self-test failed: %v", err)
+			}
+			return
+		case "init":
+			if err := runInit(os.Args[2:]); err != nil {
+				log.Fatalf("Failed to create config: %v", err)
+			}
+			return
+		case "generate":
+			if err := runGenerate(os.Args[2:]); err != nil {
+				log.Fatalf("Failed to generate config: %v", err)
+			}
+			return
+		case "import-claude":
+			if err := runImportClaude(os.Args[2:]); err != nil {
+				log.Fatalf("Failed to import config: %v", err)
+			}
+			return
+		}
+	}
 	conf := flag.String("config", "config.json", "path to config file or a http(s) url")
 	insecure := flag.Bool("insecure", false, "allow insecure HTTPS connections by skipping TLS certificate verification")
 	expandEnv := flag.Bool("expand-env", true, "expand environment variables in config file")
 	httpHeaders := flag.String("http-headers", "", "optional HTTP headers for config URL, format: 'Key1:Value1;Key2:Value2'")
 	httpTimeout := flag.Int("http-timeout", 10, "HTTP timeout in seconds when fetching config from URL")
+	strict := flag.Bool("strict", true, "reject unknown keys in the config file instead of only warning about them")
 
 	version := flag.Bool("version", false, "print version and exit")
 	help := flag.Bool("help", false, "print help and exit")
@@ -26,12 +68,33 @@ func main() {
 		fmt.Println(BuildVersion)
 		return
 	}
-	config, err := load(*conf, *insecure, *expandEnv, *httpHeaders, *httpTimeout)
+	proxy.BuildVersion = BuildVersion
+	config, err := proxy.LoadConfig(*conf, *insecure, *expandEnv, *httpHeaders, *httpTimeout, *strict)
 	if err != nil {
 		log.Fatalf("Failed to load config: %v", err)
 	}
-	err = startHTTPServer(config)
+	p, err := proxy.New(config)
+	if err != nil {
+		log.Fatalf("Failed to start server: %v", err)
+	}
+	err = p.Start()
 	if err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	select {
+	case <-sigChan:
+		log.Println("Shutdown signal received")
+	case err = <-p.Err():
+		log.Fatalf("%v", err)
+	}
+
+	shutdownCtx, shutdownCancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer shutdownCancel()
+	err = p.Stop(shutdownCtx)
+	if err != nil {
+		log.Fatalf("Failed to stop server: %v", err)
+	}
 }
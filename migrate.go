@@ -0,0 +1,50 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tbxark/mcp-proxy/pkg/proxy"
+)
+
+// runMigrateConfig implements `mcp-proxy migrate-config`, which rewrites a
+// v1 config in the v2 layout instead of relying on the conversion at
+// startup.
+func runMigrateConfig(args []string) error {
+	flags := flag.NewFlagSet("migrate-config", flag.ExitOnError)
+	in := flags.String("in", "", "path to the v1 config file")
+	out := flags.String("out", "", "path to write the v2 config to (default stdout)")
+	_ = flags.Parse(args)
+	if *in == "" {
+		flags.Usage()
+		return fmt.Errorf("-in is required")
+	}
+
+	data, err := os.ReadFile(*in)
+	if err != nil {
+		return err
+	}
+	config, notes, err := proxy.MigrateConfig(data)
+	for _, note := range notes {
+		fmt.Fprintf(os.Stderr, "- %s\n", note)
+	}
+	if err != nil {
+		return err
+	}
+	output, err := json.MarshalIndent(config, "", "  ")
+	if err != nil {
+		return err
+	}
+	output = append(output, '\n')
+	if *out == "" {
+		_, err = os.Stdout.Write(output)
+		return err
+	}
+	if err = os.WriteFile(*out, output, 0o600); err != nil {
+		return err
+	}
+	fmt.Fprintf(os.Stderr, "Wrote %s\n", *out)
+	return nil
+}
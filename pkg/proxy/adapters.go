@@ -0,0 +1,68 @@
+package proxy
+
+import (
+	"net/http"
+	"path"
+)
+
+type langChainTool struct {
+	Name        string `json:"name"`
+	Description string `json:"description"`
+	ArgsSchema  any    `json:"args_schema"`
+	Server      string `json:"server"`
+	Endpoint    string `json:"endpoint"`
+}
+
+// handleLangChainTools lists every tool with its REST endpoint so that a
+// LangChain loader can build a StructuredTool per entry.
+func (a *apiServer) handleLangChainTools(w http.ResponseWriter, r *http.Request) {
+	tools := make([]langChainTool, 0)
+	for _, item := range a.catalog(r.Context()) {
+		tools = append(tools, langChainTool{
+			Name:        item.server + openAIToolSeparator + item.tool.Name,
+			Description: item.tool.Description,
+			ArgsSchema:  toolInputSchema(item.tool),
+			Server:      item.server,
+			Endpoint:    a.toolEndpoint(item.server, item.tool.Name),
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"tools": tools})
+}
+
+type agentSkill struct {
+	ID          string   `json:"id"`
+	Name        string   `json:"name"`
+	Description string   `json:"description,omitempty"`
+	Tags        []string `json:"tags"`
+}
+
+// handleAgentCard publishes an A2A agent card that describes the proxied
+// tools as skills of a single agent.
+func (a *apiServer) handleAgentCard(w http.ResponseWriter, r *http.Request) {
+	skills := make([]agentSkill, 0)
+	for _, item := range a.catalog(r.Context()) {
+		skills = append(skills, agentSkill{
+			ID:          item.server + openAIToolSeparator + item.tool.Name,
+			Name:        item.tool.Name,
+			Description: item.tool.Description,
+			Tags:        []string{item.server},
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"name":               a.info.Name,
+		"description":        "Tools aggregated by " + a.info.Name,
+		"url":                a.baseURL + path.Join("/", "api"),
+		"version":            a.info.Version,
+		"capabilities":       map[string]any{"streaming": false, "pushNotifications": false},
+		"defaultInputModes":  []string{"application/json"},
+		"defaultOutputModes": []string{"application/json"},
+		"securitySchemes": map[string]any{
+			"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+		},
+		"skills": skills,
+	})
+}
+
+func (a *apiServer) toolEndpoint(server, tool string) string {
+	return a.baseURL + path.Join("/", "api", server, "tools", tool)
+}
@@ -0,0 +1,281 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/tbxark/mcp-proxy/pkg/adminpb"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+const defaultWatchInterval = 5 * time.Second
+
+// adminGRPCServer serves adminpb.AdminService, the gRPC counterpart of the
+// REST admin API, on its own listener.
+type adminGRPCServer struct {
+	adminpb.UnimplementedAdminServiceServer
+	proxy  *Proxy
+	auth   *routeAuth
+	server *grpc.Server
+	// stopping ends the watch streams, which would otherwise keep a
+	// graceful stop waiting.
+	stopping chan struct{}
+}
+
+// startAdminGRPC listens on conf.GRPC.Addr and serves the admin service
+// until stop.
+func startAdminGRPC(p *Proxy, conf *AdminConfig) (*adminGRPCServer, error) {
+	a := &adminGRPCServer{
+		proxy:    p,
+		auth:     newRouteAuth("", newAuthTokens(conf.AuthTokens...), nil),
+		stopping: make(chan struct{}),
+	}
+	options := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(a.authorizeUnary),
+		grpc.ChainStreamInterceptor(a.authorizeStream),
+	}
+	if conf.GRPC.CertFile != "" {
+		creds, err := credentials.NewServerTLSFromFile(conf.GRPC.CertFile, conf.GRPC.KeyFile)
+		if err != nil {
+			return nil, err
+		}
+		options = append(options, grpc.Creds(creds))
+	}
+	listener, err := net.Listen("tcp", conf.GRPC.Addr)
+	if err != nil {
+		return nil, err
+	}
+	a.server = grpc.NewServer(options...)
+	adminpb.RegisterAdminServiceServer(a.server, a)
+	go func() {
+		log.Printf("Admin gRPC API listening on %s", conf.GRPC.Addr)
+		if sErr := a.server.Serve(listener); sErr != nil && !errors.Is(sErr, grpc.ErrServerStopped) {
+			p.fail(sErr)
+		}
+	}()
+	return a, nil
+}
+
+// stop lets calls in progress finish, or cuts them off once ctx is done.
+func (a *adminGRPCServer) stop(ctx context.Context) {
+	if a == nil {
+		return
+	}
+	close(a.stopping)
+	stopped := make(chan struct{})
+	go func() {
+		a.server.GracefulStop()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-ctx.Done():
+		a.server.Stop()
+	}
+}
+
+// authorize checks the bearer token in the call's metadata against the
+// admin tokens, like the admin middleware does for HTTP requests.
+func (a *adminGRPCServer) authorize(ctx context.Context, method string) error {
+	r, _ := http.NewRequestWithContext(ctx, http.MethodPost, method, nil)
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		for _, value := range md.Get("authorization") {
+			r.Header.Add("Authorization", value)
+		}
+	}
+	_, _, outcome := a.auth.check(r)
+	if outcome != authOutcomeSuccess {
+		return status.Error(codes.Unauthenticated, "unauthorized")
+	}
+	log.Printf("<admin> gRPC %s", method)
+	return nil
+}
+
+func (a *adminGRPCServer) authorizeUnary(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	if err := a.authorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (a *adminGRPCServer) authorizeStream(srv any, stream grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+	if err := a.authorize(stream.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, stream)
+}
+
+func (a *adminGRPCServer) lookup(name string) (*Client, error) {
+	c, ok := a.proxy.registry.get(name)
+	if !ok {
+		return nil, status.Error(codes.NotFound, "server not found")
+	}
+	return c, nil
+}
+
+func (a *adminGRPCServer) ListServers(context.Context, *adminpb.ListServersRequest) (*adminpb.ListServersResponse, error) {
+	response := &adminpb.ListServersResponse{}
+	for _, name := range a.proxy.registry.names() {
+		if c, ok := a.proxy.registry.get(name); ok {
+			response.Servers = append(response.Servers, serverStatusProto(serverStatus(name, c)))
+		}
+	}
+	return response, nil
+}
+
+func (a *adminGRPCServer) GetServer(_ context.Context, request *adminpb.GetServerRequest) (*adminpb.ServerStatus, error) {
+	c, err := a.lookup(request.GetName())
+	if err != nil {
+		return nil, err
+	}
+	return serverStatusProto(serverStatus(request.GetName(), c)), nil
+}
+
+func (a *adminGRPCServer) SetMaintenance(_ context.Context, request *adminpb.SetMaintenanceRequest) (*adminpb.ServerStatus, error) {
+	name := request.GetName()
+	c, err := a.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	if c.setMaintenance(request.GetEnabled()) {
+		if request.GetEnabled() {
+			log.Printf("<%s> Entering maintenance mode", name)
+		} else {
+			log.Printf("<%s> Leaving maintenance mode", name)
+		}
+	}
+	return serverStatusProto(serverStatus(name, c)), nil
+}
+
+func (a *adminGRPCServer) RestartServer(ctx context.Context, request *adminpb.RestartServerRequest) (*adminpb.ServerStatus, error) {
+	name := request.GetName()
+	c, err := a.lookup(name)
+	if err != nil {
+		return nil, err
+	}
+	if err = c.restart(ctx, nil); err != nil {
+		log.Printf("<%s> Restart requested via admin gRPC API failed: %v", name, err)
+		if errors.Is(err, errRestartUnsupported) {
+			return nil, status.Error(codes.FailedPrecondition, err.Error())
+		}
+		return nil, status.Error(codes.Unavailable, err.Error())
+	}
+	return serverStatusProto(serverStatus(name, c)), nil
+}
+
+// WatchServers polls the servers and sends those whose status changed
+// since the last poll, starting with all of them.
+func (a *adminGRPCServer) WatchServers(request *adminpb.WatchServersRequest, stream adminpb.AdminService_WatchServersServer) error {
+	interval := time.Duration(request.GetIntervalMs()) * time.Millisecond
+	if interval <= 0 {
+		interval = defaultWatchInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	sent := make(map[string]*adminpb.ServerStatus)
+	for {
+		current := make(map[string]bool)
+		for _, name := range a.proxy.registry.names() {
+			c, ok := a.proxy.registry.get(name)
+			if !ok {
+				continue
+			}
+			current[name] = true
+			serverState := serverStatusProto(serverStatus(name, c))
+			if proto.Equal(sent[name], serverState) {
+				continue
+			}
+			if err := stream.Send(&adminpb.ServerEvent{Server: serverState}); err != nil {
+				return err
+			}
+			sent[name] = serverState
+		}
+		for name := range sent {
+			if current[name] {
+				continue
+			}
+			if err := stream.Send(&adminpb.ServerEvent{Server: &adminpb.ServerStatus{Name: name}, Removed: true}); err != nil {
+				return err
+			}
+			delete(sent, name)
+		}
+		select {
+		case <-stream.Context().Done():
+			return nil
+		case <-a.stopping:
+			return status.Error(codes.Unavailable, "proxy is shutting down")
+		case <-ticker.C:
+		}
+	}
+}
+
+func (a *adminGRPCServer) GetConfig(context.Context, *adminpb.GetConfigRequest) (*adminpb.Config, error) {
+	a.proxy.mu.Lock()
+	data, err := json.Marshal(a.proxy.config)
+	a.proxy.mu.Unlock()
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	var decoded any
+	if err = json.Unmarshal(data, &decoded); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	if data, err = json.Marshal(maskSecrets("", decoded)); err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return &adminpb.Config{Json: string(data)}, nil
+}
+
+// ApplyConfig reconciles the servers with a pushed config. Servers that
+// fail to connect are reported in the error field rather than failing the
+// call, since the others were applied.
+func (a *adminGRPCServer) ApplyConfig(ctx context.Context, request *adminpb.ApplyConfigRequest) (*adminpb.ApplyConfigResponse, error) {
+	target, err := parseConfig([]byte(request.GetJson()))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	result, err := a.proxy.applyConfig(ctx, target, "config pushed via admin gRPC API")
+	response := &adminpb.ApplyConfigResponse{
+		Added:           result.Added,
+		Removed:         result.Removed,
+		Replaced:        result.Replaced,
+		RestartRequired: result.RestartRequired,
+	}
+	if err != nil {
+		log.Printf("<admin> Config pushed via gRPC was applied incompletely: %v", err)
+		response.Error = err.Error()
+	}
+	return response, nil
+}
+
+func serverStatusProto(s adminServerStatus) *adminpb.ServerStatus {
+	message := &adminpb.ServerStatus{
+		Name:                s.Name,
+		Tools:               int32(s.Tools),
+		Maintenance:         s.Maintenance,
+		TraceWire:           s.TraceWire,
+		Scheduled:           s.Scheduled,
+		Active:              s.Active,
+		Healthy:             s.Health.Healthy,
+		ConsecutiveFailures: int32(s.Health.ConsecutiveFailures),
+		LastError:           s.Health.LastError,
+	}
+	if s.Standby != nil {
+		message.Standby = proto.Int32(int32(*s.Standby))
+	}
+	if s.Upstream != nil {
+		message.UpstreamName = s.Upstream.Name
+		message.UpstreamVersion = s.Upstream.Version
+	}
+	return message
+}
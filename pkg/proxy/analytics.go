@@ -0,0 +1,253 @@
+package proxy
+
+import (
+	"cmp"
+	"context"
+	"log"
+	"net/http"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	defaultAnalyticsWindow = 7 * 24 * time.Hour
+	analyticsSaveInterval  = time.Minute
+)
+
+// toolUsage records how often and when each tool was last called, so that
+// /admin/analytics can point out the tools nobody uses. Large tool catalogs
+// make models pick tools worse, and unused tools are the easiest to drop.
+type toolUsage struct {
+	mu     sync.Mutex
+	window time.Duration
+	file   string
+	state  toolUsageState
+	dirty  bool
+	done   chan struct{}
+}
+
+// toolUsageState is what toolUsage keeps in analytics.file.
+type toolUsageState struct {
+	// Since is when usage started being recorded.
+	Since time.Time                              `json:"since"`
+	Tools map[string]map[string]*toolUsageRecord `json:"tools"`
+}
+
+type toolUsageRecord struct {
+	Calls      int64     `json:"calls"`
+	LastCalled time.Time `json:"lastCalled"`
+}
+
+// newToolUsage loads the usage saved in conf.File, if any, and saves it
+// back periodically until Close.
+func newToolUsage(conf *AnalyticsConfig) (*toolUsage, error) {
+	u := &toolUsage{
+		window: defaultAnalyticsWindow,
+		state:  toolUsageState{Since: time.Now()},
+		done:   make(chan struct{}),
+	}
+	if conf != nil {
+		if conf.Window > 0 {
+			u.window = conf.Window
+		}
+		u.file = conf.File
+	}
+	if u.file != "" {
+		if err := loadStateFile(u.file, &u.state); err != nil {
+			return nil, err
+		}
+		go u.saveLoop()
+	}
+	if u.state.Tools == nil {
+		u.state.Tools = make(map[string]map[string]*toolUsageRecord)
+	}
+	return u, nil
+}
+
+// countCalls records the tool calls of next, whether or not they succeed:
+// what matters is that a model picked the tool.
+func (u *toolUsage) countCalls(next ToolCallFunc) ToolCallFunc {
+	return func(ctx context.Context, serverName string, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		u.mu.Lock()
+		tools := u.state.Tools[serverName]
+		if tools == nil {
+			tools = make(map[string]*toolUsageRecord)
+			u.state.Tools[serverName] = tools
+		}
+		record := tools[request.Params.Name]
+		if record == nil {
+			record = &toolUsageRecord{}
+			tools[request.Params.Name] = record
+		}
+		record.Calls++
+		record.LastCalled = time.Now()
+		u.dirty = true
+		u.mu.Unlock()
+		return next(ctx, serverName, request)
+	}
+}
+
+func (u *toolUsage) saveLoop() {
+	ticker := time.NewTicker(analyticsSaveInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			u.save()
+		case <-u.done:
+			return
+		}
+	}
+}
+
+func (u *toolUsage) save() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !u.dirty {
+		return
+	}
+	if err := saveStateFile(u.file, u.state); err != nil {
+		log.Printf("Failed to save tool usage to %s: %v", u.file, err)
+		return
+	}
+	u.dirty = false
+}
+
+// Close saves the usage recorded since the last save.
+func (u *toolUsage) Close() error {
+	if u == nil || u.file == "" {
+		return nil
+	}
+	close(u.done)
+	u.save()
+	return nil
+}
+
+// toolUsageReport is the response of /admin/analytics.
+type toolUsageReport struct {
+	WindowHours float64   `json:"windowHours"`
+	Since       time.Time `json:"since"`
+	// Complete is set once usage has been recorded for the whole window;
+	// before that, tools listed as unused may just not have been needed yet.
+	Complete bool                `json:"complete"`
+	Servers  []serverUsageReport `json:"servers"`
+}
+
+type serverUsageReport struct {
+	Name   string                 `json:"name"`
+	Tools  []toolUsageReportEntry `json:"tools"`
+	Unused []string               `json:"unused"`
+	// Suggestion is the server's toolFilter with the unused tools filtered
+	// out, to paste into its options.
+	Suggestion *ToolFilterConfig `json:"suggestion,omitempty"`
+}
+
+type toolUsageReportEntry struct {
+	Name       string     `json:"name"`
+	Calls      int64      `json:"calls"`
+	LastCalled *time.Time `json:"lastCalled,omitempty"`
+	Unused     bool       `json:"unused,omitempty"`
+}
+
+// report lists the tools each server offers with their usage, and the
+// tools not called within window. filters are the servers' configured
+// toolFilter options, which the suggestions extend.
+func (u *toolUsage) report(registry *clientRegistry, filters map[string]*ToolFilterConfig, window time.Duration) toolUsageReport {
+	now := time.Now()
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	report := toolUsageReport{
+		WindowHours: window.Hours(),
+		Since:       u.state.Since,
+		Complete:    now.Sub(u.state.Since) >= window,
+		Servers:     make([]serverUsageReport, 0),
+	}
+	for _, name := range registry.names() {
+		c, ok := registry.get(name)
+		if !ok {
+			continue
+		}
+		tools := c.toolList()
+		server := serverUsageReport{Name: name, Tools: make([]toolUsageReportEntry, 0, len(tools)), Unused: make([]string, 0)}
+		seen := make(map[string]bool)
+		for _, tool := range tools {
+			if seen[tool.Name] {
+				continue
+			}
+			seen[tool.Name] = true
+			entry := toolUsageReportEntry{Name: tool.Name}
+			if record := u.state.Tools[name][tool.Name]; record != nil {
+				entry.Calls = record.Calls
+				lastCalled := record.LastCalled
+				entry.LastCalled = &lastCalled
+			}
+			if entry.LastCalled == nil || now.Sub(*entry.LastCalled) > window {
+				entry.Unused = true
+				server.Unused = append(server.Unused, tool.Name)
+			}
+			server.Tools = append(server.Tools, entry)
+		}
+		// Most used first, so the unused tools end up at the bottom.
+		slices.SortStableFunc(server.Tools, func(a, b toolUsageReportEntry) int {
+			return cmp.Compare(b.Calls, a.Calls)
+		})
+		// A server none of whose tools are used is better removed entirely.
+		if len(server.Unused) > 0 && len(server.Unused) < len(server.Tools) {
+			server.Suggestion = suggestToolFilter(filters[name], server.Tools)
+		}
+		report.Servers = append(report.Servers, server)
+	}
+	return report
+}
+
+// suggestToolFilter returns current with the unused tools filtered out:
+// removed from an allow list, or added to a block list.
+func suggestToolFilter(current *ToolFilterConfig, tools []toolUsageReportEntry) *ToolFilterConfig {
+	if current != nil && current.Mode == ToolFilterModeAllow {
+		suggestion := &ToolFilterConfig{Mode: ToolFilterModeAllow}
+		for _, tool := range tools {
+			if !tool.Unused {
+				suggestion.List = append(suggestion.List, tool.Name)
+			}
+		}
+		slices.Sort(suggestion.List)
+		return suggestion
+	}
+	suggestion := &ToolFilterConfig{Mode: ToolFilterModeBlock}
+	if current != nil {
+		suggestion.List = slices.Clone(current.List)
+	}
+	for _, tool := range tools {
+		if tool.Unused && !slices.Contains(suggestion.List, tool.Name) {
+			suggestion.List = append(suggestion.List, tool.Name)
+		}
+	}
+	slices.Sort(suggestion.List)
+	return suggestion
+}
+
+// handleAnalytics reports tool usage. ?window= overrides the configured
+// window, e.g. ?window=720h.
+func (a *adminServer) handleAnalytics(w http.ResponseWriter, r *http.Request) {
+	window := a.proxy.usage.window
+	if value := r.URL.Query().Get("window"); value != "" {
+		parsed, err := time.ParseDuration(value)
+		if err != nil || parsed <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "window must be a positive duration such as 720h")
+			return
+		}
+		window = parsed
+	}
+	filters := make(map[string]*ToolFilterConfig)
+	a.proxy.mu.Lock()
+	for name, clientConfig := range a.proxy.config.McpServers {
+		if clientConfig.Options != nil {
+			filters[name] = clientConfig.Options.ToolFilter
+		}
+	}
+	a.proxy.mu.Unlock()
+	writeJSON(w, http.StatusOK, a.proxy.usage.report(a.registry, filters, window))
+}
@@ -0,0 +1,282 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// maxAPIBodyBytes caps the JSON arguments of a REST call, like the caps on
+// the bodies read by the signature and resumability middlewares.
+const maxAPIBodyBytes = 10 << 20
+
+// apiServer exposes the proxied tools as a plain REST facade so that non-MCP
+// clients can invoke them with a single JSON request.
+type apiServer struct {
+	mu       sync.RWMutex
+	baseURL  string
+	basePath string
+	info     mcp.Implementation
+	servers  map[string]*apiServerEntry
+	// jobs runs calls made with ?async=1; nil when async calls are off.
+	jobs *asyncQueue
+	// middlewares guard the routes not tied to a server.
+	middlewares []MiddlewareFunc
+}
+
+type apiServerEntry struct {
+	client      *Client
+	auth        *routeAuth
+	middlewares []MiddlewareFunc
+}
+
+// serve runs handler behind the server's own middlewares so that every
+// bridge enforces the same auth as the server's MCP route.
+func (e *apiServerEntry) serve(w http.ResponseWriter, r *http.Request, handler http.HandlerFunc) {
+	chainMiddleware(handler, e.middlewares...).ServeHTTP(w, r)
+}
+
+func newAPIServer(baseURL *url.URL, info mcp.Implementation) *apiServer {
+	return &apiServer{
+		baseURL:  strings.TrimSuffix(baseURL.String(), "/"),
+		basePath: path.Join("/", baseURL.Path),
+		info:     info,
+		servers:  make(map[string]*apiServerEntry),
+	}
+}
+
+func (a *apiServer) addClient(name string, mcpClient *Client, auth *routeAuth, middlewares ...MiddlewareFunc) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.servers[name] = &apiServerEntry{
+		client:      mcpClient,
+		auth:        auth,
+		middlewares: middlewares,
+	}
+}
+
+func (a *apiServer) removeClient(name string) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	delete(a.servers, name)
+}
+
+func (a *apiServer) lookup(name string) (*apiServerEntry, bool) {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	entry, ok := a.servers[name]
+	return entry, ok
+}
+
+func (a *apiServer) sortedNames() []string {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	names := make([]string, 0, len(a.servers))
+	for name := range a.servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (a *apiServer) register(mux *http.ServeMux, config *APIConfig, middlewares ...MiddlewareFunc) {
+	a.middlewares = middlewares
+	mux.Handle("POST "+path.Join(a.basePath, "api", "{server}", "tools", "{tool}"), http.HandlerFunc(a.serveCallTool))
+	if a.jobs != nil {
+		mux.Handle("GET "+path.Join(a.basePath, "api", "jobs", "{id}"), http.HandlerFunc(a.serveJob))
+		mux.Handle("DELETE "+path.Join(a.basePath, "api", "jobs", "{id}"), http.HandlerFunc(a.serveJob))
+	}
+	mux.Handle("GET "+path.Join(a.basePath, "api", "openapi.json"), chainMiddleware(http.HandlerFunc(a.handleOpenAPI), middlewares...))
+	if config.OpenAI {
+		mux.Handle("GET "+path.Join(a.basePath, "api", "openai", "tools"), chainMiddleware(http.HandlerFunc(a.handleOpenAITools), middlewares...))
+		mux.Handle("POST "+path.Join(a.basePath, "api", "openai", "call"), chainMiddleware(http.HandlerFunc(a.handleOpenAICall), middlewares...))
+	}
+	if config.LangChain {
+		mux.Handle("GET "+path.Join(a.basePath, "api", "langchain", "tools"), chainMiddleware(http.HandlerFunc(a.handleLangChainTools), middlewares...))
+	}
+	if config.A2A {
+		mux.Handle("GET "+path.Join(a.basePath, ".well-known", "agent.json"), chainMiddleware(http.HandlerFunc(a.handleAgentCard), middlewares...))
+	}
+}
+
+func (a *apiServer) serveCallTool(w http.ResponseWriter, r *http.Request) {
+	entry, ok := a.lookup(r.PathValue("server"))
+	if !ok {
+		// Authenticated like the routes not tied to a server, so that
+		// unauthenticated callers cannot tell which servers exist.
+		chainMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			writeJSONError(w, http.StatusNotFound, "server not found")
+		}), a.middlewares...).ServeHTTP(w, r)
+		return
+	}
+	entry.serve(w, r, func(w http.ResponseWriter, r *http.Request) {
+		a.handleCallTool(w, r, entry)
+	})
+}
+
+func (a *apiServer) handleCallTool(w http.ResponseWriter, r *http.Request, entry *apiServerEntry) {
+	name := r.PathValue("server")
+	toolName := r.PathValue("tool")
+	// Tools the caller may not use are reported like unknown ones, as
+	// they are left out of the listings.
+	tool, ok := entry.client.findTool(toolName)
+	if !ok || !toolAllowed(r.Context(), entry.client.access(), tool) {
+		writeJSONError(w, http.StatusNotFound, "tool not found")
+		return
+	}
+	var arguments map[string]any
+	if r.ContentLength != 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, maxAPIBodyBytes)
+		if err := json.NewDecoder(r.Body).Decode(&arguments); err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				writeJSONError(w, http.StatusRequestEntityTooLarge, "request body is too large")
+				return
+			}
+			writeJSONError(w, http.StatusBadRequest, "invalid JSON arguments: "+err.Error())
+			return
+		}
+	}
+	if value := r.URL.Query().Get("async"); value != "" {
+		async, err := strconv.ParseBool(value)
+		switch {
+		case err != nil:
+			writeJSONError(w, http.StatusBadRequest, "async must be 1 or 0")
+			return
+		case async && a.jobs == nil:
+			writeJSONError(w, http.StatusBadRequest, "async calls are not enabled")
+			return
+		case async:
+			a.handleAsyncCall(w, r, name, toolName, arguments)
+			return
+		}
+	}
+	request := mcp.CallToolRequest{}
+	request.Params.Name = toolName
+	request.Params.Arguments = arguments
+	result, err := entry.client.callTool(r.Context(), request)
+	if err != nil {
+		log.Printf("<%s> REST call to tool %s failed: %v", name, toolName, err)
+		classifyToolError(name, err).writeHTTP(w)
+		return
+	}
+	writeJSON(w, http.StatusOK, result)
+}
+
+func (a *apiServer) handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	paths := make(map[string]any)
+	for _, item := range a.catalog(r.Context()) {
+		name, tool := item.server, item.tool
+		operation := map[string]any{
+			"operationId": name + "__" + tool.Name,
+			"summary":     tool.Name,
+			"description": tool.Description,
+			"tags":        []string{name},
+			"requestBody": map[string]any{
+				"required": false,
+				"content": map[string]any{
+					"application/json": map[string]any{
+						"schema": toolInputSchema(tool),
+					},
+				},
+			},
+			"responses": map[string]any{
+				"200": map[string]any{"description": "Tool result"},
+				"404": map[string]any{"description": "Unknown server or tool"},
+				"502": map[string]any{"description": "Upstream call failed"},
+			},
+		}
+		if a.jobs != nil {
+			operation["parameters"] = []map[string]any{{
+				"name":        "async",
+				"in":          "query",
+				"description": "Queue the call and poll the returned statusUrl for its outcome",
+				"schema":      map[string]any{"type": "boolean"},
+			}}
+			operation["responses"].(map[string]any)["202"] = map[string]any{"description": "Call queued"}
+		}
+		paths[path.Join(a.basePath, "api", name, "tools", tool.Name)] = map[string]any{"post": operation}
+	}
+
+	writeJSON(w, http.StatusOK, map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":   a.info.Name,
+			"version": a.info.Version,
+		},
+		"components": map[string]any{
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer"},
+			},
+		},
+		"security": []map[string]any{{"bearerAuth": []string{}}},
+		"paths":    paths,
+	})
+}
+
+// catalogTool is a tool listed in one of the bridge catalogs.
+type catalogTool struct {
+	server string
+	entry  *apiServerEntry
+	tool   mcp.Tool
+}
+
+// catalog returns the tools the request may call, ordered by server. It
+// backs every catalog the bridges publish, so that none of them lists a
+// server whose own route would turn the caller away.
+func (a *apiServer) catalog(ctx context.Context) []catalogTool {
+	token := authTokenFromContext(ctx)
+	var tools []catalogTool
+	for _, name := range a.sortedNames() {
+		entry, ok := a.lookup(name)
+		if !ok || !entry.auth.accepts(token) {
+			continue
+		}
+		for _, tool := range visibleTools(ctx, name, entry.client) {
+			tools = append(tools, catalogTool{server: name, entry: entry, tool: tool})
+		}
+	}
+	return tools
+}
+
+// visibleTools returns the tools of a server that the request may use, so
+// catalogs only advertise what the caller can actually invoke.
+func visibleTools(ctx context.Context, name string, c *Client) []mcp.Tool {
+	token := authTokenFromContext(ctx)
+	if token != nil && !token.allowsServer(name) {
+		return nil
+	}
+	if !c.access().allowsServer(token) {
+		return nil
+	}
+	return scopedTools(ctx, c.access(), c.toolList())
+}
+
+func toolInputSchema(tool mcp.Tool) any {
+	if len(tool.RawInputSchema) > 0 {
+		return tool.RawInputSchema
+	}
+	return tool.InputSchema
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Printf("Failed to write JSON response: %v", err)
+	}
+}
+
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, map[string]string{"error": message})
+}
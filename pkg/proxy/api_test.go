@@ -0,0 +1,269 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// newTestClient connects a Client to an in-process upstream serving an
+// echo and a delete tool.
+func newTestClient(t *testing.T, name string) *Client {
+	t.Helper()
+	upstream := server.NewMCPServer("upstream", "1.0.0")
+	echo := mcp.NewTool("echo", mcp.WithString("text"))
+	upstream.AddTool(echo, func(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText(request.GetString("text", "")), nil
+	})
+	remove := mcp.NewTool("delete")
+	upstream.AddTool(remove, func(context.Context, mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return mcp.NewToolResultText("deleted"), nil
+	})
+	mcpClient, err := client.NewInProcessClient(upstream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = mcpClient.Start(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = mcpClient.Close() })
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	if _, err = mcpClient.Initialize(context.Background(), initRequest); err != nil {
+		t.Fatal(err)
+	}
+	return &Client{name: name, client: mcpClient, tools: []mcp.Tool{echo, remove}}
+}
+
+// newTestAPI serves a REST bridge for a "github" server that accepts the
+// tokens "full" and "scoped", the latter limited to the echo tool.
+func newTestAPI(t *testing.T) *http.ServeMux {
+	t.Helper()
+	return newTestAPIWithJobs(t, nil)
+}
+
+// newTestAPIWithJobs is newTestAPI with async calls queued as set by conf.
+func newTestAPIWithJobs(t *testing.T, conf *AsyncCallConfig) *http.ServeMux {
+	t.Helper()
+	tokens := []AuthToken{{Token: "full"}, {Token: "scoped", Tools: []string{"echo"}}}
+	baseURL, _ := url.Parse("http://localhost/")
+	api := newAPIServer(baseURL, mcp.Implementation{Name: "test", Version: "1.0.0"})
+	api.addClient("github", newTestClient(t, "github"), newRouteAuth("github", tokens, nil), newAuthMiddleware("github", tokens, nil))
+	if conf != nil {
+		jobs, err := newAsyncQueue(conf, api)
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = jobs.Close() })
+		api.jobs = jobs
+	}
+	mux := http.NewServeMux()
+	api.register(mux, &APIConfig{Enabled: true}, newAuthMiddleware("", tokens, nil))
+	return mux
+}
+
+func serveTestRequest(handler http.Handler, method, target, token, body string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, target, strings.NewReader(body))
+	if token != "" {
+		r.Header.Set("Authorization", "Bearer "+token)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return w
+}
+
+func TestRESTCallTool(t *testing.T) {
+	mux := newTestAPI(t)
+	tests := []struct {
+		name       string
+		path       string
+		token      string
+		wantStatus int
+		wantBody   string
+	}{
+		{name: "call", path: "/api/github/tools/echo", token: "full", wantStatus: http.StatusOK, wantBody: `"text":"hi"`},
+		{name: "scoped call", path: "/api/github/tools/echo", token: "scoped", wantStatus: http.StatusOK, wantBody: `"text":"hi"`},
+		{name: "no credentials", path: "/api/github/tools/echo", wantStatus: http.StatusUnauthorized},
+		{name: "unknown tool", path: "/api/github/tools/missing", token: "full", wantStatus: http.StatusNotFound, wantBody: "tool not found"},
+		{name: "tool outside scope", path: "/api/github/tools/delete", token: "scoped", wantStatus: http.StatusNotFound, wantBody: "tool not found"},
+		{name: "unknown server", path: "/api/gitlab/tools/echo", token: "full", wantStatus: http.StatusNotFound, wantBody: "server not found"},
+		{name: "unknown server without credentials", path: "/api/gitlab/tools/echo", wantStatus: http.StatusUnauthorized},
+		{name: "unknown server with wrong credentials", path: "/api/gitlab/tools/echo", token: "guess", wantStatus: http.StatusUnauthorized},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveTestRequest(mux, http.MethodPost, tt.path, tt.token, `{"text":"hi"}`)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", w.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRESTCallToolInvalidArguments(t *testing.T) {
+	w := serveTestRequest(newTestAPI(t), http.MethodPost, "/api/github/tools/echo", "full", `{"text":`)
+	if w.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+	}
+}
+
+func TestRESTCallToolBodyTooLarge(t *testing.T) {
+	body := `{"text":"` + strings.Repeat("a", maxAPIBodyBytes) + `"}`
+	w := serveTestRequest(newTestAPI(t), http.MethodPost, "/api/github/tools/echo", "full", body)
+	if w.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusRequestEntityTooLarge, w.Body)
+	}
+}
+
+func TestRESTOpenAPIScoped(t *testing.T) {
+	w := serveTestRequest(newTestAPI(t), http.MethodGet, "/api/openapi.json", "scoped", "")
+	if w.Code != http.StatusOK {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var spec struct {
+		Paths map[string]any `json:"paths"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := spec.Paths["/api/github/tools/echo"]; !ok || len(spec.Paths) != 1 {
+		t.Errorf("paths = %v, want only the echo tool", spec.Paths)
+	}
+}
+
+func TestRESTCallToolAsyncParameter(t *testing.T) {
+	mux := newTestAPI(t)
+	tests := []struct {
+		name     string
+		path     string
+		wantBody string
+	}{
+		{name: "invalid", path: "/api/github/tools/echo?async=maybe", wantBody: "async must be 1 or 0"},
+		{name: "not enabled", path: "/api/github/tools/echo?async=1", wantBody: "async calls are not enabled"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveTestRequest(mux, http.MethodPost, tt.path, "full", `{"text":"hi"}`)
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusBadRequest, w.Body)
+			}
+			if !strings.Contains(w.Body.String(), tt.wantBody) {
+				t.Errorf("body = %s, want it to contain %s", w.Body, tt.wantBody)
+			}
+		})
+	}
+}
+
+func TestRESTJobs(t *testing.T) {
+	mux := newTestAPIWithJobs(t, &AsyncCallConfig{Database: filepath.Join(t.TempDir(), "jobs.db")})
+	w := serveTestRequest(mux, http.MethodPost, "/api/github/tools/echo?async=1", "full", `{"text":"hi"}`)
+	if w.Code != http.StatusAccepted {
+		t.Fatalf("status = %d, want %d: %s", w.Code, http.StatusAccepted, w.Body)
+	}
+	var job struct {
+		ID string `json:"id"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &job); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		id         string
+		token      string
+		wantStatus int
+	}{
+		{name: "owner", id: job.ID, token: "full", wantStatus: http.StatusOK},
+		{name: "no credentials", id: job.ID, wantStatus: http.StatusUnauthorized},
+		{name: "unknown job without credentials", id: "missing", wantStatus: http.StatusUnauthorized},
+		{name: "unknown job", id: "missing", token: "full", wantStatus: http.StatusNotFound},
+		{name: "other caller", id: job.ID, token: "scoped", wantStatus: http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveTestRequest(mux, http.MethodGet, "/api/jobs/"+tt.id, tt.token, "")
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+		})
+	}
+}
+
+// TestRESTOpenAPIServerTokens covers a server whose tokens differ from the
+// proxy-wide ones: it is listed only for callers its own route accepts.
+func TestRESTOpenAPIServerTokens(t *testing.T) {
+	baseURL, _ := url.Parse("http://localhost/")
+	api := newAPIServer(baseURL, mcp.Implementation{Name: "test", Version: "1.0.0"})
+	serverTokens := []AuthToken{{Token: "github-only"}}
+	api.addClient("github", newTestClient(t, "github"), newRouteAuth("github", serverTokens, nil), newAuthMiddleware("github", serverTokens, nil))
+	api.addClient("public", newTestClient(t, "public"), newRouteAuth("public", nil, nil))
+	tests := []struct {
+		name        string
+		proxyTokens []AuthToken
+		token       string
+		wantGitHub  bool
+		wantPublic  bool
+	}{
+		{name: "no proxy tokens, no credentials", wantPublic: true},
+		{name: "no proxy tokens, server token", token: "github-only", wantPublic: true},
+		{name: "proxy token only", proxyTokens: []AuthToken{{Token: "proxy"}}, token: "proxy", wantPublic: true},
+		{name: "proxy and server token", proxyTokens: []AuthToken{{Token: "github-only"}}, token: "github-only", wantGitHub: true, wantPublic: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			mux := http.NewServeMux()
+			var middlewares []MiddlewareFunc
+			if tt.proxyTokens != nil {
+				middlewares = append(middlewares, newAuthMiddleware("", tt.proxyTokens, nil))
+			}
+			api.register(mux, &APIConfig{Enabled: true}, middlewares...)
+			w := serveTestRequest(mux, http.MethodGet, "/api/openapi.json", tt.token, "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var spec struct {
+				Paths map[string]any `json:"paths"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &spec); err != nil {
+				t.Fatal(err)
+			}
+			if _, ok := spec.Paths["/api/github/tools/echo"]; ok != tt.wantGitHub {
+				t.Errorf("github listed = %v, want %v", ok, tt.wantGitHub)
+			}
+			if _, ok := spec.Paths["/api/public/tools/echo"]; ok != tt.wantPublic {
+				t.Errorf("public listed = %v, want %v", ok, tt.wantPublic)
+			}
+		})
+	}
+}
+
+func TestCatalogsServerTokens(t *testing.T) {
+	baseURL, _ := url.Parse("http://localhost/")
+	api := newAPIServer(baseURL, mcp.Implementation{Name: "test", Version: "1.0.0"})
+	serverTokens := []AuthToken{{Token: "github-only"}}
+	api.addClient("github", newTestClient(t, "github"), newRouteAuth("github", serverTokens, nil), newAuthMiddleware("github", serverTokens, nil))
+	mux := http.NewServeMux()
+	api.register(mux, &APIConfig{Enabled: true, OpenAI: true, LangChain: true, A2A: true}, newAuthMiddleware("", []AuthToken{{Token: "proxy"}}, nil))
+	for _, target := range []string{"/api/openapi.json", "/api/openai/tools", "/api/langchain/tools", "/.well-known/agent.json"} {
+		t.Run(target, func(t *testing.T) {
+			w := serveTestRequest(mux, http.MethodGet, target, "proxy", "")
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			if strings.Contains(w.Body.String(), "github") {
+				t.Errorf("body = %s, want the github server left out", w.Body)
+			}
+		})
+	}
+}
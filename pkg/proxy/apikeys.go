@@ -0,0 +1,330 @@
+package proxy
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const apiKeyPrefix = "mcpp_"
+
+var errAPIKeyNotFound = errors.New("api key not found")
+
+// apiKey is a managed credential. Only the SHA-256 of the secret is stored;
+// the secret itself is shown once, when the key is created or rotated.
+type apiKey struct {
+	ID        string     `json:"id"`
+	Label     string     `json:"label,omitempty"`
+	Hint      string     `json:"hint"`
+	Hash      string     `json:"hash"`
+	Servers   []string   `json:"servers,omitempty"`
+	Tools     []string   `json:"tools,omitempty"`
+	ReadOnly  bool       `json:"readOnly,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	RotatedAt *time.Time `json:"rotatedAt,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	RevokedAt *time.Time `json:"revokedAt,omitempty"`
+}
+
+func (k *apiKey) active(now time.Time) bool {
+	return k.RevokedAt == nil && (k.ExpiresAt == nil || now.Before(*k.ExpiresAt))
+}
+
+// authToken presents the key as a scoped token to the auth middleware.
+func (k *apiKey) authToken() *AuthToken {
+	name := k.Label
+	if name == "" {
+		name = k.ID
+	}
+	return &AuthToken{
+		Name:     name,
+		Servers:  k.Servers,
+		Tools:    k.Tools,
+		ReadOnly: k.ReadOnly,
+	}
+}
+
+// apiKeyStore holds the managed API keys and persists them to a JSON file
+// after every change.
+type apiKeyStore struct {
+	mu   sync.RWMutex
+	path string
+	keys []*apiKey
+}
+
+func newAPIKeyStore(path string) (*apiKeyStore, error) {
+	store := &apiKeyStore{path: path}
+	if err := loadStateFile(path, &store.keys); err != nil {
+		return nil, fmt.Errorf("api key file: %w", err)
+	}
+	return store, nil
+}
+
+func (s *apiKeyStore) saveLocked() error {
+	return saveStateFile(s.path, s.keys)
+}
+
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+func newAPIKeySecret() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return apiKeyPrefix + base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func newAPIKeyID() (string, error) {
+	buf := make([]byte, 8)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// lookup returns the scope of an active key matching secret.
+func (s *apiKeyStore) lookup(secret string) (*AuthToken, bool) {
+	hash := hashAPIKey(secret)
+	now := time.Now()
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	for _, key := range s.keys {
+		if key.Hash == hash && key.active(now) {
+			return key.authToken(), true
+		}
+	}
+	return nil, false
+}
+
+func (s *apiKeyStore) list() []apiKey {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys := make([]apiKey, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, *key)
+	}
+	return keys
+}
+
+func (s *apiKeyStore) create(template apiKey) (apiKey, string, error) {
+	secret, err := newAPIKeySecret()
+	if err != nil {
+		return apiKey{}, "", err
+	}
+	id, err := newAPIKeyID()
+	if err != nil {
+		return apiKey{}, "", err
+	}
+	key := template
+	key.ID = id
+	key.Hash = hashAPIKey(secret)
+	key.Hint = secret[len(secret)-4:]
+	key.CreatedAt = time.Now().UTC()
+	key.RotatedAt, key.RevokedAt = nil, nil
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.keys = append(s.keys, &key)
+	if err = s.saveLocked(); err != nil {
+		s.keys = s.keys[:len(s.keys)-1]
+		return apiKey{}, "", err
+	}
+	return key, secret, nil
+}
+
+// update applies fn to the key with id and persists the result, rolling
+// back if the file cannot be written.
+func (s *apiKeyStore) update(id string, fn func(key *apiKey) error) (apiKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	index := slices.IndexFunc(s.keys, func(key *apiKey) bool { return key.ID == id })
+	if index < 0 {
+		return apiKey{}, errAPIKeyNotFound
+	}
+	previous := *s.keys[index]
+	if err := fn(s.keys[index]); err != nil {
+		*s.keys[index] = previous
+		return apiKey{}, err
+	}
+	if err := s.saveLocked(); err != nil {
+		*s.keys[index] = previous
+		return apiKey{}, err
+	}
+	return *s.keys[index], nil
+}
+
+type apiKeyRequest struct {
+	Label     *string    `json:"label"`
+	Servers   []string   `json:"servers"`
+	Tools     []string   `json:"tools"`
+	ReadOnly  bool       `json:"readOnly"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	// ExpiresIn is a Go duration such as "720h", relative to now.
+	ExpiresIn string `json:"expiresIn"`
+}
+
+func (req *apiKeyRequest) expiry() (*time.Time, error) {
+	if req.ExpiresIn == "" {
+		return req.ExpiresAt, nil
+	}
+	d, err := time.ParseDuration(req.ExpiresIn)
+	if err != nil {
+		return nil, fmt.Errorf("invalid expiresIn: %w", err)
+	}
+	expiresAt := time.Now().Add(d).UTC()
+	return &expiresAt, nil
+}
+
+// apiKeyResponse is a key as shown by the admin API. Key carries the secret
+// and is only set right after creation or rotation.
+type apiKeyResponse struct {
+	apiKey
+	// Hash shadows the stored hash so that it is never returned.
+	Hash   string `json:"hash,omitempty"`
+	Key    string `json:"key,omitempty"`
+	Active bool   `json:"active"`
+}
+
+func newAPIKeyResponse(key apiKey, secret string) apiKeyResponse {
+	return apiKeyResponse{apiKey: key, Key: secret, Active: key.active(time.Now())}
+}
+
+func (a *adminServer) handleListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys := make([]apiKeyResponse, 0)
+	for _, key := range a.keys.list() {
+		keys = append(keys, newAPIKeyResponse(key, ""))
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"keys": keys})
+}
+
+func (a *adminServer) handleCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req apiKeyRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+	}
+	expiresAt, err := req.expiry()
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	template := apiKey{
+		Servers:   req.Servers,
+		Tools:     req.Tools,
+		ReadOnly:  req.ReadOnly,
+		ExpiresAt: expiresAt,
+	}
+	if req.Label != nil {
+		template.Label = *req.Label
+	}
+	key, secret, err := a.keys.create(template)
+	if err != nil {
+		log.Printf("<admin> Failed to create api key: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to store api key")
+		return
+	}
+	log.Printf("<admin> Created api key %s (%s)", key.ID, key.Label)
+	a.proxy.metrics.recordAPIKeyEvent("created")
+	writeJSON(w, http.StatusCreated, newAPIKeyResponse(key, secret))
+}
+
+// handleUpdateAPIKey changes the label or expiry of a key. Scopes are fixed
+// at creation; issue a new key to change them.
+func (a *adminServer) handleUpdateAPIKey(w http.ResponseWriter, r *http.Request) {
+	var req apiKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	expiresAt, err := req.expiry()
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	key, err := a.keys.update(r.PathValue("id"), func(key *apiKey) error {
+		if req.Label != nil {
+			key.Label = *req.Label
+		}
+		if expiresAt != nil {
+			key.ExpiresAt = expiresAt
+		}
+		return nil
+	})
+	if a.writeAPIKeyError(w, err) {
+		return
+	}
+	log.Printf("<admin> Updated api key %s (%s)", key.ID, key.Label)
+	writeJSON(w, http.StatusOK, newAPIKeyResponse(key, ""))
+}
+
+func (a *adminServer) handleRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	key, err := a.keys.update(r.PathValue("id"), func(key *apiKey) error {
+		if key.RevokedAt == nil {
+			now := time.Now().UTC()
+			key.RevokedAt = &now
+		}
+		return nil
+	})
+	if a.writeAPIKeyError(w, err) {
+		return
+	}
+	log.Printf("<admin> Revoked api key %s (%s)", key.ID, key.Label)
+	a.proxy.metrics.recordAPIKeyEvent("revoked")
+	writeJSON(w, http.StatusOK, newAPIKeyResponse(key, ""))
+}
+
+// handleRotateAPIKey replaces the secret of a key, keeping its id and
+// scopes. The previous secret stops working immediately.
+func (a *adminServer) handleRotateAPIKey(w http.ResponseWriter, r *http.Request) {
+	secret, err := newAPIKeySecret()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	key, err := a.keys.update(r.PathValue("id"), func(key *apiKey) error {
+		if key.RevokedAt != nil {
+			return errors.New("api key is revoked")
+		}
+		now := time.Now().UTC()
+		key.Hash = hashAPIKey(secret)
+		key.Hint = secret[len(secret)-4:]
+		key.RotatedAt = &now
+		return nil
+	})
+	if a.writeAPIKeyError(w, err) {
+		return
+	}
+	log.Printf("<admin> Rotated api key %s (%s)", key.ID, key.Label)
+	a.proxy.metrics.recordAPIKeyEvent("rotated")
+	writeJSON(w, http.StatusOK, newAPIKeyResponse(key, secret))
+}
+
+func (a *adminServer) writeAPIKeyError(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return false
+	case errors.Is(err, errAPIKeyNotFound):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+	case errors.Is(err, os.ErrPermission) || errors.As(err, new(*os.PathError)):
+		log.Printf("<admin> Failed to store api keys: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to store api keys")
+	default:
+		writeJSONError(w, http.StatusConflict, err.Error())
+	}
+	return true
+}
@@ -0,0 +1,78 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// toolSchema returns the JSON Schema under key, inputSchema or
+// outputSchema, in the encoding of tool, whichever of the typed and raw
+// schema fields the upstream's tool was decoded into.
+func toolSchema(tool mcp.Tool, key string) (json.RawMessage, bool) {
+	data, err := json.Marshal(tool)
+	if err != nil {
+		return nil, false
+	}
+	var fields map[string]json.RawMessage
+	if err = json.Unmarshal(data, &fields); err != nil {
+		return nil, false
+	}
+	schema, ok := fields[key]
+	return schema, ok && len(schema) > 0 && string(schema) != "null"
+}
+
+// compileArgumentSchema prepares the input schema of a tool for
+// options.validateArguments. Tools whose schema cannot be compiled are
+// forwarded unchecked.
+func (c *Client) compileArgumentSchema(tool mcp.Tool) {
+	if c.options == nil || !c.options.ValidateArguments.OrElse(false) {
+		return
+	}
+	raw, ok := toolSchema(tool, "inputSchema")
+	if !ok {
+		return
+	}
+	schema, err := compileJSONSchema(raw)
+	if err != nil {
+		log.Printf("<%s> Not validating arguments of %s: %v", c.name, tool.Name, err)
+		return
+	}
+	if c.argumentSchemas == nil {
+		c.argumentSchemas = make(map[string]*jsonSchema)
+	}
+	c.argumentSchemas[tool.Name] = schema
+}
+
+// validateArguments rejects tool calls whose arguments do not match the
+// tool's advertised input schema, so that malformed calls fail with a
+// precise message instead of reaching the upstream.
+func (c *Client) validateArguments(next ToolCallFunc) ToolCallFunc {
+	if c.options == nil || !c.options.ValidateArguments.OrElse(false) {
+		return next
+	}
+	return func(ctx context.Context, server string, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		schema := c.argumentSchemas[request.Params.Name]
+		if schema == nil {
+			return next(ctx, server, request)
+		}
+		arguments := request.Params.Arguments
+		if arguments == nil {
+			// Clients omit the arguments of tools that take none.
+			arguments = map[string]any{}
+		}
+		if violations := schema.validate("arguments", arguments); len(violations) > 0 {
+			return nil, &ToolError{
+				Source:  ErrorSourceProxy,
+				Code:    ErrorCodeInvalidParams,
+				Server:  server,
+				Message: fmt.Sprintf("invalid arguments for %s: %s", request.Params.Name, strings.Join(violations, "; ")),
+			}
+		}
+		return next(ctx, server, request)
+	}
+}
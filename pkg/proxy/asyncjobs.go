@@ -0,0 +1,523 @@
+package proxy
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	defaultAsyncMaxAttempts = 5
+	defaultAsyncRetryDelay  = 10 * time.Second
+	maxAsyncRetryDelay      = time.Hour
+	defaultAsyncRetention   = 7 * 24 * time.Hour
+	defaultAsyncWorkers     = 4
+	asyncPollInterval       = time.Second
+	asyncPruneInterval      = time.Hour
+)
+
+// Job statuses. Only queued jobs can be canceled.
+const (
+	jobQueued    = "queued"
+	jobRunning   = "running"
+	jobSucceeded = "succeeded"
+	jobFailed    = "failed"
+	jobCanceled  = "canceled"
+)
+
+var errJobNotFound = errors.New("job not found")
+
+// asyncQueue runs REST tool calls made with ?async=1 in the background. Jobs
+// are kept in a SQLite database so they survive restarts, and calls that
+// fail for reasons expected to clear by themselves are retried with
+// backoff. A job interrupted by a restart runs again, so calls are made at
+// least once rather than exactly once.
+type asyncQueue struct {
+	db          *sql.DB
+	api         *apiServer
+	maxAttempts int
+	retryDelay  time.Duration
+	retention   time.Duration
+	workers     chan struct{}
+
+	wake   chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	done   chan struct{}
+}
+
+// asyncJob is a job as stored and as returned by /api/jobs/<id>.
+type asyncJob struct {
+	ID        string          `json:"id"`
+	Server    string          `json:"server"`
+	Tool      string          `json:"tool"`
+	User      string          `json:"user,omitempty"`
+	Status    string          `json:"status"`
+	Attempts  int             `json:"attempts"`
+	CreatedAt time.Time       `json:"createdAt"`
+	UpdatedAt time.Time       `json:"updatedAt"`
+	NextRunAt *time.Time      `json:"nextAttemptAt,omitempty"`
+	Arguments json.RawMessage `json:"-"`
+	// Caller holds the scopes and groups of the token the job was queued
+	// with, so that it runs as the same identity.
+	Caller *jobCaller      `json:"-"`
+	Result json.RawMessage `json:"result,omitempty"`
+	// Error and Code describe the last failed attempt, classified as in
+	// the REST API's error responses.
+	Error string `json:"error,omitempty"`
+	Code  string `json:"code,omitempty"`
+}
+
+// jobCaller is the token a job was queued with, less its secret.
+type jobCaller struct {
+	Servers  []string `json:"servers,omitempty"`
+	Tools    []string `json:"tools,omitempty"`
+	ReadOnly bool     `json:"readOnly,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+}
+
+// authToken presents the caller of a job to interceptors and the
+// tool-level checks as the token it was queued with.
+func (c *jobCaller) authToken(name string) *AuthToken {
+	token := &AuthToken{Name: name}
+	if c != nil {
+		token.Servers = c.Servers
+		token.Tools = c.Tools
+		token.ReadOnly = c.ReadOnly
+		token.Groups = c.Groups
+	}
+	return token
+}
+
+const asyncQueueSchema = `
+CREATE TABLE IF NOT EXISTS jobs (
+	id TEXT PRIMARY KEY,
+	server TEXT NOT NULL,
+	tool TEXT NOT NULL,
+	user TEXT NOT NULL,
+	arguments TEXT,
+	caller TEXT,
+	status TEXT NOT NULL,
+	attempts INTEGER NOT NULL DEFAULT 0,
+	created INTEGER NOT NULL,
+	updated INTEGER NOT NULL,
+	next_attempt INTEGER NOT NULL,
+	result TEXT,
+	error TEXT NOT NULL DEFAULT '',
+	code TEXT NOT NULL DEFAULT ''
+);
+CREATE INDEX IF NOT EXISTS jobs_due ON jobs (status, next_attempt);
+CREATE INDEX IF NOT EXISTS jobs_updated ON jobs (updated);
+`
+
+func newAsyncQueue(conf *AsyncCallConfig, api *apiServer) (*asyncQueue, error) {
+	// Created up front so the database is private to the proxy's user.
+	f, err := os.OpenFile(conf.Database, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open job queue: %w", err)
+	}
+	_ = f.Close()
+	db, err := sql.Open("sqlite", "file:"+conf.Database+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("open job queue: %w", err)
+	}
+	if _, err = db.Exec(asyncQueueSchema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("open job queue %s: %w", conf.Database, err)
+	}
+	// Jobs left running were interrupted by a restart.
+	result, err := db.Exec(`UPDATE jobs SET status = ?, attempts = attempts - 1 WHERE status = ?`, jobQueued, jobRunning)
+	if err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("open job queue %s: %w", conf.Database, err)
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("Requeued %d tool calls interrupted by the last shutdown", n)
+	}
+	q := &asyncQueue{
+		db:          db,
+		api:         api,
+		maxAttempts: conf.MaxAttempts,
+		retryDelay:  conf.RetryDelay,
+		retention:   conf.Retention,
+		wake:        make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+	if q.maxAttempts <= 0 {
+		q.maxAttempts = defaultAsyncMaxAttempts
+	}
+	if q.retryDelay <= 0 {
+		q.retryDelay = defaultAsyncRetryDelay
+	}
+	if q.retention <= 0 {
+		q.retention = defaultAsyncRetention
+	}
+	workers := conf.Workers
+	if workers <= 0 {
+		workers = defaultAsyncWorkers
+	}
+	q.workers = make(chan struct{}, workers)
+	q.ctx, q.cancel = context.WithCancel(context.Background())
+	go q.run()
+	log.Printf("Async tool calls enabled, queued in %s", conf.Database)
+	return q, nil
+}
+
+// enqueue stores a call to run in the background and returns its job.
+func (q *asyncQueue) enqueue(ctx context.Context, serverName, tool string, arguments map[string]any) (*asyncJob, error) {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	now := time.Now()
+	token := authTokenFromContext(ctx)
+	job := &asyncJob{
+		ID:        hex.EncodeToString(id),
+		Server:    serverName,
+		Tool:      tool,
+		User:      callerName(token),
+		Status:    jobQueued,
+		CreatedAt: now.UTC(),
+		UpdatedAt: now.UTC(),
+		NextRunAt: &now,
+	}
+	job.Arguments, _ = json.Marshal(arguments)
+	var caller json.RawMessage
+	if token != nil {
+		job.Caller = &jobCaller{Servers: token.Servers, Tools: token.Tools, ReadOnly: token.ReadOnly, Groups: token.Groups}
+		caller, _ = json.Marshal(job.Caller)
+	}
+	_, err := q.db.ExecContext(ctx, `INSERT INTO jobs (id, server, tool, user, arguments, caller, status, created, updated, next_attempt)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		job.ID, job.Server, job.Tool, job.User, nullableJSON(job.Arguments), nullableJSON(caller), job.Status,
+		now.UnixMilli(), now.UnixMilli(), now.UnixMilli())
+	if err != nil {
+		return nil, err
+	}
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return job, nil
+}
+
+// run hands due jobs to the workers and prunes finished ones.
+func (q *asyncQueue) run() {
+	defer close(q.done)
+	q.prune()
+	poll := time.NewTicker(asyncPollInterval)
+	defer poll.Stop()
+	prune := time.NewTicker(asyncPruneInterval)
+	defer prune.Stop()
+	for {
+		q.dispatch()
+		select {
+		case <-q.ctx.Done():
+			q.wg.Wait()
+			return
+		case <-q.wake:
+		case <-poll.C:
+		case <-prune.C:
+			q.prune()
+		}
+	}
+}
+
+// dispatch starts due jobs while workers are free. Only run claims jobs, so
+// no job is started twice.
+func (q *asyncQueue) dispatch() {
+	for {
+		select {
+		case q.workers <- struct{}{}:
+		default:
+			return
+		}
+		job, err := q.claim()
+		if job == nil {
+			<-q.workers
+			if err != nil {
+				log.Printf("Failed to read the job queue: %v", err)
+			}
+			return
+		}
+		q.wg.Add(1)
+		go func() {
+			defer func() {
+				<-q.workers
+				q.wg.Done()
+			}()
+			q.execute(job)
+		}()
+	}
+}
+
+// claim marks the next due job as running. It returns nil when no job is
+// due.
+func (q *asyncQueue) claim() (*asyncJob, error) {
+	var job asyncJob
+	var arguments, caller sql.NullString
+	now := time.Now()
+	err := q.db.QueryRow(`SELECT id, server, tool, user, arguments, caller, attempts FROM jobs
+		WHERE status = ? AND next_attempt <= ? ORDER BY next_attempt LIMIT 1`, jobQueued, now.UnixMilli()).
+		Scan(&job.ID, &job.Server, &job.Tool, &job.User, &arguments, &caller, &job.Attempts)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	// The status check keeps a job canceled in the meantime from running.
+	result, err := q.db.Exec(`UPDATE jobs SET status = ?, attempts = attempts + 1, updated = ? WHERE id = ? AND status = ?`,
+		jobRunning, now.UnixMilli(), job.ID, jobQueued)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return q.claim()
+	}
+	job.Attempts++
+	if arguments.Valid {
+		job.Arguments = json.RawMessage(arguments.String)
+	}
+	switch {
+	case caller.Valid:
+		job.Caller = &jobCaller{}
+		err = json.Unmarshal([]byte(caller.String), job.Caller)
+	case job.User != "":
+		err = errors.New("no caller recorded")
+	}
+	if err != nil {
+		// Running it with no scopes would widen what the caller may do.
+		log.Printf("<%s> Failing job %s, its caller cannot be read: %v", job.Server, job.ID, err)
+		_, err = q.db.Exec(`UPDATE jobs SET status = ?, error = ?, code = ? WHERE id = ?`,
+			jobFailed, "caller cannot be read", ErrorCodeUnauthorized, job.ID)
+		if err != nil {
+			return nil, err
+		}
+		return q.claim()
+	}
+	return &job, nil
+}
+
+// execute makes one attempt at a job and records the outcome.
+func (q *asyncQueue) execute(job *asyncJob) {
+	request := mcp.CallToolRequest{}
+	request.Params.Name = job.Tool
+	var arguments map[string]any
+	_ = json.Unmarshal(job.Arguments, &arguments)
+	request.Params.Arguments = arguments
+	ctx := q.ctx
+	if job.Caller != nil {
+		// Run the call as whoever queued it, with their token's scopes and
+		// groups.
+		ctx = withAuthToken(ctx, job.Caller.authToken(job.User))
+	}
+
+	var result *mcp.CallToolResult
+	var err error
+	if entry, ok := q.api.lookup(job.Server); ok {
+		result, err = entry.client.callTool(ctx, request)
+	} else {
+		err = fmt.Errorf("%w: %s is not connected", errServerUnavailable, job.Server)
+	}
+
+	now := time.Now()
+	switch {
+	case q.ctx.Err() != nil:
+		// Interrupted by shutdown: the attempt does not count.
+		_, err = q.db.Exec(`UPDATE jobs SET status = ?, attempts = attempts - 1, updated = ? WHERE id = ?`,
+			jobQueued, now.UnixMilli(), job.ID)
+	case err == nil:
+		status := jobSucceeded
+		if result.IsError {
+			status = jobFailed
+		}
+		data, _ := json.Marshal(result)
+		_, err = q.db.Exec(`UPDATE jobs SET status = ?, updated = ?, result = ?, error = '', code = '' WHERE id = ?`,
+			status, now.UnixMilli(), string(data), job.ID)
+	default:
+		toolErr := classifyToolError(job.Server, err)
+		if asyncRetryable(toolErr) && job.Attempts < q.maxAttempts {
+			delay := q.backoff(job.Attempts, toolErr)
+			log.Printf("<%s> Async call to tool %s failed (attempt %d of %d), retrying in %s: %v",
+				job.Server, job.Tool, job.Attempts, q.maxAttempts, delay, err)
+			_, err = q.db.Exec(`UPDATE jobs SET status = ?, updated = ?, next_attempt = ?, error = ?, code = ? WHERE id = ?`,
+				jobQueued, now.UnixMilli(), now.Add(delay).UnixMilli(), toolErr.Message, toolErr.Code, job.ID)
+		} else {
+			log.Printf("<%s> Async call to tool %s failed after %d attempts: %v", job.Server, job.Tool, job.Attempts, err)
+			_, err = q.db.Exec(`UPDATE jobs SET status = ?, updated = ?, error = ?, code = ? WHERE id = ?`,
+				jobFailed, now.UnixMilli(), toolErr.Message, toolErr.Code, job.ID)
+		}
+	}
+	if err != nil {
+		log.Printf("<%s> Failed to record the outcome of job %s: %v", job.Server, job.ID, err)
+	}
+}
+
+// asyncRetryable reports whether a failed call may succeed if made again.
+// Calls the upstream rejected as invalid, unknown or unauthorized are not
+// retried.
+func asyncRetryable(err *ToolError) bool {
+	switch err.Code {
+	case ErrorCodeUnavailable, ErrorCodeTimeout, ErrorCodeConnectionFailed, ErrorCodeUpstreamError, ErrorCodeCanceled:
+		return true
+	}
+	return false
+}
+
+// backoff doubles the retry delay with every attempt, up to an hour, and
+// waits at least as long as the error asked for.
+func (q *asyncQueue) backoff(attempts int, err *ToolError) time.Duration {
+	delay := q.retryDelay
+	for i := 1; i < attempts && delay < maxAsyncRetryDelay; i++ {
+		delay *= 2
+	}
+	delay = min(delay, maxAsyncRetryDelay)
+	if hint := time.Duration(err.RetryAfter) * time.Second; hint > delay {
+		delay = hint
+	}
+	return delay
+}
+
+func (q *asyncQueue) prune() {
+	cutoff := time.Now().Add(-q.retention).UnixMilli()
+	result, err := q.db.Exec(`DELETE FROM jobs WHERE status IN (?, ?, ?) AND updated < ?`,
+		jobSucceeded, jobFailed, jobCanceled, cutoff)
+	if err != nil {
+		log.Printf("Failed to prune the job queue: %v", err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("Pruned %d finished jobs older than %s", n, q.retention)
+	}
+}
+
+// get returns a job including its result.
+func (q *asyncQueue) get(ctx context.Context, id string) (*asyncJob, error) {
+	var job asyncJob
+	var created, updated, next int64
+	var result sql.NullString
+	err := q.db.QueryRowContext(ctx, `SELECT id, server, tool, user, status, attempts, created, updated, next_attempt, result, error, code
+		FROM jobs WHERE id = ?`, id).Scan(&job.ID, &job.Server, &job.Tool, &job.User, &job.Status, &job.Attempts,
+		&created, &updated, &next, &result, &job.Error, &job.Code)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errJobNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	job.CreatedAt = time.UnixMilli(created).UTC()
+	job.UpdatedAt = time.UnixMilli(updated).UTC()
+	if job.Status == jobQueued {
+		nextRun := time.UnixMilli(next).UTC()
+		job.NextRunAt = &nextRun
+	}
+	if result.Valid {
+		job.Result = json.RawMessage(result.String)
+	}
+	return &job, nil
+}
+
+// cancelJob drops a job that has not started. It reports false when the job
+// is running or already finished.
+func (q *asyncQueue) cancelJob(ctx context.Context, id string) (bool, error) {
+	result, err := q.db.ExecContext(ctx, `UPDATE jobs SET status = ?, updated = ? WHERE id = ? AND status = ?`,
+		jobCanceled, time.Now().UnixMilli(), id, jobQueued)
+	if err != nil {
+		return false, err
+	}
+	n, _ := result.RowsAffected()
+	return n > 0, nil
+}
+
+// Close waits for the running attempts to be interrupted and closes the
+// database. Interrupted jobs run again after a restart.
+func (q *asyncQueue) Close() error {
+	if q == nil {
+		return nil
+	}
+	q.cancel()
+	<-q.done
+	return q.db.Close()
+}
+
+// serveJob authorizes a request for a job like a call to the job's server,
+// and only lets the caller that queued the job see it.
+func (a *apiServer) serveJob(w http.ResponseWriter, r *http.Request) {
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		job, err := a.jobs.get(r.Context(), r.PathValue("id"))
+		if errors.Is(err, errJobNotFound) {
+			writeJSONError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		token := authTokenFromContext(r.Context())
+		if callerName(token) != job.User {
+			writeJSONError(w, http.StatusNotFound, errJobNotFound.Error())
+			return
+		}
+		if entry, ok := a.lookup(job.Server); ok && !entry.auth.accepts(token) {
+			writeJSONError(w, http.StatusNotFound, errJobNotFound.Error())
+			return
+		}
+		if r.Method == http.MethodDelete {
+			a.handleCancelJob(w, r, job)
+			return
+		}
+		writeJSON(w, http.StatusOK, job)
+	}
+	// Authenticate before the lookup, so that an unauthenticated caller cannot
+	// tell a missing job from an existing one.
+	chainMiddleware(http.HandlerFunc(handler), a.middlewares...).ServeHTTP(w, r)
+}
+
+func (a *apiServer) handleCancelJob(w http.ResponseWriter, r *http.Request, job *asyncJob) {
+	canceled, err := a.jobs.cancelJob(r.Context(), job.ID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !canceled {
+		writeJSONError(w, http.StatusConflict, "job is "+job.Status+" and can no longer be canceled")
+		return
+	}
+	job, err = a.jobs.get(r.Context(), job.ID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, job)
+}
+
+// handleAsyncCall queues a REST tool call and answers with where to find
+// its outcome.
+func (a *apiServer) handleAsyncCall(w http.ResponseWriter, r *http.Request, name, toolName string, arguments map[string]any) {
+	job, err := a.jobs.enqueue(r.Context(), name, toolName, arguments)
+	if err != nil {
+		log.Printf("<%s> Failed to queue a call to tool %s: %v", name, toolName, err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to queue the call")
+		return
+	}
+	statusURL := a.baseURL + path.Join("/api", "jobs", job.ID)
+	w.Header().Set("Location", statusURL)
+	writeJSON(w, http.StatusAccepted, map[string]string{
+		"id":        job.ID,
+		"status":    job.Status,
+		"statusUrl": statusURL,
+	})
+}
@@ -0,0 +1,47 @@
+package proxy
+
+import (
+	"context"
+	"net/url"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// TestAsyncQueueJobWithoutCaller checks that a named job without the
+// scopes of its caller is failed rather than run unscoped.
+func TestAsyncQueueJobWithoutCaller(t *testing.T) {
+	baseURL, _ := url.Parse("http://localhost/")
+	api := newAPIServer(baseURL, mcp.Implementation{Name: "test", Version: "1.0.0"})
+	api.addClient("github", newTestClient(t, "github"), nil)
+	q, err := newAsyncQueue(&AsyncCallConfig{Database: filepath.Join(t.TempDir(), "jobs.db")}, api)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = q.Close() })
+	_, err = q.db.Exec(`INSERT INTO jobs (id, server, tool, user, status, created, updated, next_attempt) VALUES (?, ?, ?, ?, ?, 0, 0, 0)`,
+		"job", "github", "delete", "alice", jobQueued)
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.wake <- struct{}{}
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		job, err := q.get(context.Background(), "job")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if job.Status != jobQueued && job.Status != jobRunning {
+			if job.Status != jobFailed || job.Error != "caller cannot be read" || job.Code != ErrorCodeUnauthorized {
+				t.Errorf("job = %s %q %s, want it failed as unauthorized", job.Status, job.Error, job.Code)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("job still %s", job.Status)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
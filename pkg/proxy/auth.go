@@ -0,0 +1,262 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// authSources are the ways besides static authTokens in which a request can
+// authenticate. Enabling any of them makes every route require credentials.
+type authSources struct {
+	keys       *apiKeyStore
+	signatures *signatureVerifier
+	users      *userAuthenticator
+	// groups maps identity names to the groups mcpProxy.groups puts them in.
+	groups map[string][]string
+	// metrics counts authentication outcomes; it may be nil.
+	metrics *proxyMetrics
+	// blocks rejects identities on the runtime block list; it may be nil.
+	blocks *blockList
+	// geo resolves client countries for ipFilter; it may be nil.
+	geo *geoIPDB
+	// events ships request events to mcpProxy.logSinks; it may be nil.
+	events *eventLog
+	// cluster shares rate limits with the other nodes; it may be nil.
+	cluster *cluster
+	// streams buffers SSE streams for resumption; it may be nil.
+	streams *streamStore
+	// sse is set when servers are served over the SSE transport, whose
+	// message posts belong to a session counted already.
+	sse bool
+}
+
+func newGroupIndex(groups map[string][]string) map[string][]string {
+	index := make(map[string][]string)
+	for group, members := range groups {
+		for _, member := range members {
+			index[member] = append(index[member], group)
+		}
+	}
+	for member := range index {
+		slices.Sort(index[member])
+	}
+	return index
+}
+
+func (s *authSources) enabled() bool {
+	return s != nil && (s.keys != nil || s.signatures != nil || s.users != nil)
+}
+
+// Authentication methods as reported in metrics.
+const (
+	authMethodNone      = "none"
+	authMethodToken     = "token"
+	authMethodAPIKey    = "apikey"
+	authMethodSignature = "hmac"
+)
+
+// authenticate resolves the credentials of r to a token, adding the groups
+// its name is mapped to. method names the kind of credentials presented.
+func (s *authSources) authenticate(r *http.Request, tokenSet map[string]*AuthToken) (token *AuthToken, method string, ok bool) {
+	token, method, ok = s.credentials(r, tokenSet)
+	if !ok || s == nil || token.Name == "" || len(s.groups[token.Name]) == 0 {
+		return token, method, ok
+	}
+	withGroups := *token
+	withGroups.Groups = append(slices.Clone(token.Groups), s.groups[token.Name]...)
+	return &withGroups, method, true
+}
+
+// credentials checks, in order: a signature when the request is signed, a
+// user identity, and a bearer token from tokenSet or an API key.
+func (s *authSources) credentials(r *http.Request, tokenSet map[string]*AuthToken) (*AuthToken, string, bool) {
+	if s != nil && s.signatures != nil && r.Header.Get(signatureHeader) != "" {
+		token, ok := s.signatures.verify(r)
+		return token, authMethodSignature, ok
+	}
+	if s != nil && s.users != nil {
+		if token, ok := s.users.authenticate(r); ok {
+			return token, string(s.users.mode), true
+		}
+		if s.users.mode == AuthModeBasic && strings.HasPrefix(r.Header.Get("Authorization"), "Basic ") {
+			return nil, string(AuthModeBasic), false
+		}
+	}
+	token := r.Header.Get("Authorization")
+	token = strings.TrimSpace(strings.TrimPrefix(token, "Bearer "))
+	if token == "" {
+		return nil, authMethodNone, false
+	}
+	if authToken, ok := tokenSet[token]; ok {
+		return authToken, authMethodToken, true
+	}
+	if s != nil && s.keys != nil {
+		authToken, ok := s.keys.lookup(token)
+		return authToken, authMethodAPIKey, ok
+	}
+	return nil, authMethodToken, false
+}
+
+func (s *authSources) blocked(token *AuthToken) bool {
+	return s != nil && s.blocks.blockedIdentity(token)
+}
+
+func (s *authSources) geoIP() *geoIPDB {
+	if s == nil {
+		return nil
+	}
+	return s.geo
+}
+
+func (s *authSources) recordAuth(route, method string, token *AuthToken, outcome string) {
+	if s != nil {
+		s.metrics.recordAuth(route, method, token, outcome)
+	}
+}
+
+// challenge adds the headers a client needs to retry a rejected request.
+func (s *authSources) challenge(w http.ResponseWriter) {
+	if s != nil && s.users != nil {
+		s.users.challenge(w)
+	}
+}
+
+type authTokenKey struct{}
+
+func withAuthToken(ctx context.Context, token *AuthToken) context.Context {
+	return context.WithValue(ctx, authTokenKey{}, token)
+}
+
+// authTokenFromContext returns the token the request was authorized with,
+// or nil when the route does not require one.
+func authTokenFromContext(ctx context.Context) *AuthToken {
+	token, _ := ctx.Value(authTokenKey{}).(*AuthToken)
+	return token
+}
+
+// callerName identifies the caller behind token to upstreams and the call
+// history: its name, or a hash of an unnamed token so the token itself is
+// never handed out. It is empty without a token.
+func callerName(token *AuthToken) string {
+	switch {
+	case token == nil:
+		return ""
+	case token.Name != "":
+		return token.Name
+	}
+	sum := sha256.Sum256([]byte(token.Token))
+	return "token:" + hex.EncodeToString(sum[:6])
+}
+
+func (t *AuthToken) allowsServer(name string) bool {
+	return len(t.Servers) == 0 || slices.Contains(t.Servers, name)
+}
+
+func (t *AuthToken) allowsTool(tool mcp.Tool) bool {
+	if len(t.Tools) > 0 && !slices.Contains(t.Tools, tool.Name) {
+		return false
+	}
+	if t.ReadOnly {
+		return tool.Annotations.ReadOnlyHint != nil && *tool.Annotations.ReadOnlyHint
+	}
+	return true
+}
+
+// allows reports whether token matches the rule by name or group. An empty
+// rule matches everyone, including unauthenticated requests.
+func (r AccessRule) allows(token *AuthToken) bool {
+	if len(r.Users) == 0 && len(r.Groups) == 0 {
+		return true
+	}
+	if token == nil {
+		return false
+	}
+	if token.Name != "" && slices.Contains(r.Users, token.Name) {
+		return true
+	}
+	for _, group := range token.Groups {
+		if slices.Contains(r.Groups, group) {
+			return true
+		}
+	}
+	return false
+}
+
+func (a *AccessConfig) allowsServer(token *AuthToken) bool {
+	return a == nil || a.AccessRule.allows(token)
+}
+
+func (a *AccessConfig) allowsTool(token *AuthToken, name string) bool {
+	if a == nil {
+		return true
+	}
+	rule, ok := a.Tools[name]
+	return !ok || rule.allows(token)
+}
+
+// toolAllowed reports whether the request may see and call tool, given
+// the scopes of its token, if any, and the server's access rules.
+// Unauthenticated requests may use every tool no rule restricts.
+func toolAllowed(ctx context.Context, access *AccessConfig, tool mcp.Tool) bool {
+	token := authTokenFromContext(ctx)
+	if token != nil && !token.allowsTool(tool) {
+		return false
+	}
+	return access.allowsTool(token, tool.Name)
+}
+
+// scopedTools narrows tools down to those the request may use.
+func scopedTools(ctx context.Context, access *AccessConfig, tools []mcp.Tool) []mcp.Tool {
+	if authTokenFromContext(ctx) == nil && (access == nil || len(access.Tools) == 0) {
+		return tools
+	}
+	visible := make([]mcp.Tool, 0, len(tools))
+	for _, tool := range tools {
+		if toolAllowed(ctx, access, tool) {
+			visible = append(visible, tool)
+		}
+	}
+	return visible
+}
+
+// newAccessMiddleware rejects requests whose identity is not allowed to use
+// the server at all.
+func newAccessMiddleware(access *AccessConfig) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if !access.allowsServer(authTokenFromContext(r.Context())) {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// tokenScopeOptions enforces the tool scopes of authTokens and the server's
+// tool access rules on a downstream MCP server: disallowed tools are hidden
+// from listings and refused when called. The server is resolved lazily
+// since it does not exist yet when its options are built.
+func tokenScopeOptions(mcpServer func() *server.MCPServer, access *AccessConfig) []server.ServerOption {
+	return []server.ServerOption{
+		server.WithToolFilter(func(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+			return scopedTools(ctx, access, tools)
+		}),
+		server.WithToolHandlerMiddleware(func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+			return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				if tool := mcpServer().GetTool(request.Params.Name); tool != nil && !toolAllowed(ctx, access, tool.Tool) {
+					return nil, fmt.Errorf("tool %s is not allowed for this token", request.Params.Name)
+				}
+				return next(ctx, request)
+			}
+		}),
+	}
+}
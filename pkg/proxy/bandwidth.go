@@ -0,0 +1,76 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// maxThrottledWrite is the most a throttled response writes at once, so
+// that large results go out at an even pace rather than in bursts.
+const maxThrottledWrite = 32 << 10
+
+// newBandwidthMiddleware caps the bytes per second a server's routes send
+// to clients, over all requests together, so that one server returning
+// huge results or resources cannot take the host's bandwidth from the
+// others. A second's worth can be sent at once, so small responses are
+// not slowed down.
+func newBandwidthMiddleware(name string, bytesPerSecond int, metrics *proxyMetrics) MiddlewareFunc {
+	bucket := newTokenBucket(float64(bytesPerSecond), float64(bytesPerSecond))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			next.ServeHTTP(&throttledWriter{
+				ResponseWriter: w,
+				ctx:            r.Context(),
+				server:         name,
+				bucket:         bucket,
+				chunk:          min(bytesPerSecond, maxThrottledWrite),
+				metrics:        metrics,
+			}, r)
+		})
+	}
+}
+
+type throttledWriter struct {
+	http.ResponseWriter
+	ctx     context.Context
+	server  string
+	bucket  *tokenBucket
+	chunk   int
+	metrics *proxyMetrics
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), w.chunk)
+		if wait := w.bucket.reserve(time.Now(), n); wait > 0 {
+			timer := time.NewTimer(wait)
+			select {
+			case <-w.ctx.Done():
+				timer.Stop()
+				return written, w.ctx.Err()
+			case <-timer.C:
+			}
+			w.metrics.recordThrottled(w.server, wait)
+		}
+		m, err := w.ResponseWriter.Write(p[:n])
+		written += m
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+// Flush passes flushes through, which SSE streams depend on.
+func (w *throttledWriter) Flush() {
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *throttledWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,83 @@
+package proxy
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"log"
+	"slices"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const defaultOffloadTTL = time.Hour
+
+// Content types a binaryContent policy applies to.
+const (
+	binaryContentImage    = "image"
+	binaryContentAudio    = "audio"
+	binaryContentResource = "resource"
+)
+
+// wrap applies conf to the binary content in the results of next: strip
+// replaces it with a placeholder and offload with a link to a copy served
+// by the proxy, so that text-only clients are not sent large base64 blobs.
+func (s *blobStore) wrap(conf *BinaryContentConfig, next ToolCallFunc) ToolCallFunc {
+	if conf == nil || conf.Mode == "" || conf.Mode == BinaryContentModePassthrough {
+		return next
+	}
+	ttl := conf.TTL
+	if ttl <= 0 {
+		ttl = defaultOffloadTTL
+	}
+	return func(ctx context.Context, server string, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := next(ctx, server, request)
+		if err != nil || result == nil {
+			return result, err
+		}
+		replaced := 0
+		for i, content := range result.Content {
+			kind, mimeType, data, ok := binaryContent(content)
+			if !ok || (len(conf.Types) > 0 && !slices.Contains(conf.Types, kind)) {
+				continue
+			}
+			decoded, err := base64.StdEncoding.DecodeString(data)
+			if err != nil || len(decoded) < conf.MinBytes {
+				continue
+			}
+			if conf.Mode == BinaryContentModeOffload {
+				link, expires, err := s.put(ctx, decoded, mimeType, ttl)
+				if err != nil {
+					log.Printf("<%s> Failed to offload %s content of %s: %v", server, kind, request.Params.Name, err)
+					continue
+				}
+				result.Content[i] = mcp.NewTextContent(fmt.Sprintf("[%s %s, %d bytes, available until %s at %s]", mimeType, kind, len(decoded), expires.UTC().Format(time.RFC3339), link))
+			} else {
+				result.Content[i] = mcp.NewTextContent(fmt.Sprintf("[%s %s removed, %d bytes]", mimeType, kind, len(decoded)))
+			}
+			replaced++
+		}
+		if replaced > 0 {
+			log.Printf("<%s> Applied binaryContent %s to %d content blocks of %s", server, conf.Mode, replaced, request.Params.Name)
+		}
+		return result, nil
+	}
+}
+
+// binaryContent returns the kind, MIME type and base64 data of an image,
+// audio or embedded blob resource content block.
+func binaryContent(content mcp.Content) (kind, mimeType, data string, ok bool) {
+	if image, ok := mcp.AsImageContent(content); ok {
+		return binaryContentImage, image.MIMEType, image.Data, true
+	}
+	if audio, ok := mcp.AsAudioContent(content); ok {
+		return binaryContentAudio, audio.MIMEType, audio.Data, true
+	}
+	if resource, ok := mcp.AsEmbeddedResource(content); ok {
+		if blob, ok := mcp.AsBlobResourceContents(resource.Resource); ok {
+			return binaryContentResource, blob.MIMEType, blob.Blob, true
+		}
+	}
+	return "", "", "", false
+}
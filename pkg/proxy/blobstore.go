@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// maxOffloadedBytes bounds the memory held by content offloaded in memory;
+// the oldest content is dropped first when it is exceeded.
+const maxOffloadedBytes = 256 << 20
+
+var errBlobNotFound = errors.New("content no longer available")
+
+// blobBackend stores the content a blobStore links to.
+type blobBackend interface {
+	put(ctx context.Context, name string, data []byte, mimeType string, expires time.Time) error
+	get(ctx context.Context, name string) (io.ReadCloser, string, error)
+}
+
+// blobStore hands out links to content it keeps in a backend, and serves
+// that content at <baseURL>/<route>/<id> to whoever holds a link until the
+// link expires. Links are signed, so a link cannot be extended or pointed
+// at other content.
+type blobStore struct {
+	baseURL *url.URL
+	route   string
+	key     []byte
+	backend blobBackend
+	// ttl is how long the links of a result store are valid.
+	ttl time.Duration
+}
+
+// newBlobStore returns a store whose links are signed with key, or with a
+// random key that only lasts as long as the process when key is empty.
+func newBlobStore(baseURL *url.URL, route string, key []byte, backend blobBackend) *blobStore {
+	if len(key) == 0 {
+		key = make([]byte, 32)
+		_, _ = rand.Read(key)
+	}
+	return &blobStore{baseURL: baseURL, route: route, key: key, backend: backend}
+}
+
+func (s *blobStore) register(mux *http.ServeMux, basePath string) {
+	mux.HandleFunc("GET "+path.Join("/", basePath, s.route, "{id}"), s.serve)
+}
+
+// put stores data and returns a link to it that is valid for ttl.
+func (s *blobStore) put(ctx context.Context, data []byte, mimeType string, ttl time.Duration) (string, time.Time, error) {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	name := hex.EncodeToString(id)
+	expires := time.Now().Add(ttl).Truncate(time.Second)
+	if err := s.backend.put(ctx, name, data, mimeType, expires); err != nil {
+		return "", time.Time{}, err
+	}
+	u := s.baseURL.JoinPath(s.route, name)
+	u.RawQuery = url.Values{
+		"expires": {strconv.FormatInt(expires.Unix(), 10)},
+		"sig":     {s.sign(name, expires.Unix())},
+	}.Encode()
+	return u.String(), expires, nil
+}
+
+func (s *blobStore) sign(name string, expires int64) string {
+	mac := hmac.New(sha256.New, s.key)
+	_, _ = fmt.Fprintf(mac, "%s\n%d", name, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (s *blobStore) serve(w http.ResponseWriter, r *http.Request) {
+	name := r.PathValue("id")
+	expires, err := strconv.ParseInt(r.URL.Query().Get("expires"), 10, 64)
+	if err != nil || !hmac.Equal([]byte(r.URL.Query().Get("sig")), []byte(s.sign(name, expires))) {
+		writeJSONError(w, http.StatusForbidden, "invalid signature")
+		return
+	}
+	if time.Now().Unix() > expires {
+		writeJSONError(w, http.StatusGone, "link expired")
+		return
+	}
+	body, mimeType, err := s.backend.get(r.Context(), name)
+	if errors.Is(err, errBlobNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to read %s/%s: %v", s.route, name, err)
+		writeJSONError(w, http.StatusBadGateway, "failed to read content")
+		return
+	}
+	defer func() { _ = body.Close() }()
+	if mimeType != "" {
+		w.Header().Set("Content-Type", mimeType)
+	}
+	w.Header().Set("Cache-Control", "private, max-age="+strconv.FormatInt(expires-time.Now().Unix(), 10))
+	// The links need no credentials, so content typed as HTML or SVG by an
+	// upstream must not run on the proxy's origin.
+	setAttachmentHeaders(w, blobFilename(name, mimeType))
+	_, _ = io.Copy(w, body)
+}
+
+// blobFilename names the download of a blob after its id, with the
+// extension of its MIME type when there is one.
+func blobFilename(name, mimeType string) string {
+	if mediaType, _, err := mime.ParseMediaType(mimeType); err == nil {
+		if extensions, _ := mime.ExtensionsByType(mediaType); len(extensions) > 0 {
+			return name + extensions[0]
+		}
+	}
+	return name
+}
+
+// memoryBlobs keeps content in memory until it expires, up to
+// maxOffloadedBytes.
+type memoryBlobs struct {
+	mu    sync.Mutex
+	blobs map[string]*memoryBlob
+	// order lists the names from oldest to newest, for eviction.
+	order []string
+	size  int
+}
+
+type memoryBlob struct {
+	data     []byte
+	mimeType string
+	expires  time.Time
+}
+
+func newMemoryBlobs() *memoryBlobs {
+	return &memoryBlobs{blobs: make(map[string]*memoryBlob)}
+}
+
+func (m *memoryBlobs) put(_ context.Context, name string, data []byte, mimeType string, expires time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.prune(time.Now(), len(data))
+	m.blobs[name] = &memoryBlob{data: data, mimeType: mimeType, expires: expires}
+	m.order = append(m.order, name)
+	m.size += len(data)
+	return nil
+}
+
+// prune drops expired content, and the oldest content while adding
+// incoming bytes would exceed maxOffloadedBytes. m.mu must be held.
+func (m *memoryBlobs) prune(now time.Time, incoming int) {
+	kept := m.order[:0]
+	for _, name := range m.order {
+		b := m.blobs[name]
+		if now.After(b.expires) || m.size+incoming > maxOffloadedBytes {
+			delete(m.blobs, name)
+			m.size -= len(b.data)
+			continue
+		}
+		kept = append(kept, name)
+	}
+	m.order = kept
+}
+
+func (m *memoryBlobs) get(_ context.Context, name string) (io.ReadCloser, string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.blobs[name]
+	if !ok {
+		return nil, "", errBlobNotFound
+	}
+	return io.NopCloser(bytes.NewReader(b.data)), b.mimeType, nil
+}
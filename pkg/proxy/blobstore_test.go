@@ -0,0 +1,53 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestBlobStoreServeAttachment(t *testing.T) {
+	baseURL, _ := url.Parse("http://localhost/")
+	store := newBlobStore(baseURL, "blobs", nil, newMemoryBlobs())
+	mux := http.NewServeMux()
+	store.register(mux, "/")
+	// The extension of the filename depends on the host's MIME types.
+	tests := []struct {
+		name     string
+		mimeType string
+	}{
+		{name: "svg", mimeType: "image/svg+xml"},
+		{name: "html", mimeType: "text/html; charset=utf-8"},
+		{name: "untyped"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			link, _, err := store.put(context.Background(), []byte("<svg onload=alert(1)/>"), tt.mimeType, time.Minute)
+			if err != nil {
+				t.Fatal(err)
+			}
+			w := httptest.NewRecorder()
+			mux.ServeHTTP(w, httptest.NewRequest(http.MethodGet, link, nil))
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			name := blobLinkID(link)
+			if got, want := w.Header().Get("Content-Disposition"), "attachment; filename="+name; !strings.HasPrefix(got, want) {
+				t.Errorf("Content-Disposition = %q, want it to start with %q", got, want)
+			}
+			if got := w.Header().Get("Content-Security-Policy"); got != "sandbox" {
+				t.Errorf("Content-Security-Policy = %q, want sandbox", got)
+			}
+		})
+	}
+}
+
+// blobLinkID returns the id a blob link points at.
+func blobLinkID(link string) string {
+	u, _ := url.Parse(link)
+	return u.Path[strings.LastIndex(u.Path, "/")+1:]
+}
@@ -0,0 +1,286 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/netip"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Kinds of block list entries.
+const (
+	blockKindToken = "token"
+	blockKindUser  = "user"
+	blockKindIP    = "ip"
+)
+
+var errBlockNotFound = errors.New("block list entry not found")
+
+// blockEntry rejects a bearer token, an identity or a client address.
+// Tokens are stored as their SHA-256, like API keys.
+type blockEntry struct {
+	ID        string     `json:"id"`
+	Kind      string     `json:"kind"`
+	Value     string     `json:"value"`
+	Reason    string     `json:"reason,omitempty"`
+	CreatedAt time.Time  `json:"createdAt"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+
+	prefix netip.Prefix
+}
+
+func (e *blockEntry) active(now time.Time) bool {
+	return e.ExpiresAt == nil || now.Before(*e.ExpiresAt)
+}
+
+// blockList holds the runtime block list managed through /admin/blocklist
+// and persists it to a JSON file after every change, so that blocks made
+// during an incident survive restarts.
+type blockList struct {
+	mu      sync.RWMutex
+	path    string
+	entries []*blockEntry
+}
+
+func newBlockList(path string) (*blockList, error) {
+	list := &blockList{path: path}
+	err := loadStateFile(path, &list.entries)
+	if err != nil {
+		return nil, fmt.Errorf("block list file: %w", err)
+	}
+	for _, entry := range list.entries {
+		if err = entry.parse(); err != nil {
+			return nil, fmt.Errorf("invalid block list file %s: %w", path, err)
+		}
+	}
+	return list, nil
+}
+
+// parse validates the entry and normalizes its value.
+func (e *blockEntry) parse() error {
+	e.Value = strings.TrimSpace(e.Value)
+	if e.Value == "" {
+		return errors.New("value is required")
+	}
+	switch e.Kind {
+	case blockKindToken, blockKindUser:
+	case blockKindIP:
+		prefix, err := parseAddressOrPrefix(e.Value)
+		if err != nil {
+			return err
+		}
+		e.prefix = prefix
+		e.Value = prefix.String()
+	default:
+		return fmt.Errorf("unknown kind %q, want token, user or ip", e.Kind)
+	}
+	return nil
+}
+
+func parseAddressOrPrefix(value string) (netip.Prefix, error) {
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return netip.Prefix{}, fmt.Errorf("invalid ip %q: %w", value, err)
+		}
+		return prefix.Masked(), nil
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, fmt.Errorf("invalid ip %q: %w", value, err)
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+func (l *blockList) saveLocked() error {
+	return saveStateFile(l.path, l.entries)
+}
+
+// matches reports the first active entry of kind for which match is true.
+func (l *blockList) matches(kind string, match func(entry *blockEntry) bool) (*blockEntry, bool) {
+	now := time.Now()
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	for _, entry := range l.entries {
+		if entry.Kind == kind && entry.active(now) && match(entry) {
+			return entry, true
+		}
+	}
+	return nil, false
+}
+
+// blockedRequest checks the client address and bearer token of r.
+func (l *blockList) blockedRequest(r *http.Request) (string, bool) {
+	if addr, ok := remoteAddr(r); ok {
+		if _, ok := l.matches(blockKindIP, func(entry *blockEntry) bool { return entry.prefix.Contains(addr) }); ok {
+			return blockKindIP, true
+		}
+	}
+	token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+	if token != "" {
+		hash := hashAPIKey(token)
+		if _, ok := l.matches(blockKindToken, func(entry *blockEntry) bool { return entry.Value == hash }); ok {
+			return blockKindToken, true
+		}
+	}
+	return "", false
+}
+
+// blockedIdentity checks an authenticated identity: a username, token
+// name, API key label or HMAC caller id.
+func (l *blockList) blockedIdentity(token *AuthToken) bool {
+	if l == nil || token == nil || token.Name == "" {
+		return false
+	}
+	_, ok := l.matches(blockKindUser, func(entry *blockEntry) bool { return entry.Value == token.Name })
+	return ok
+}
+
+// middleware rejects blocked addresses and tokens on every route except
+// those under exempt, which keeps the admin API reachable to lift a block.
+func (l *blockList) middleware(exempt string, sources *authSources) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == exempt || strings.HasPrefix(r.URL.Path, exempt+"/") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			if kind, ok := l.blockedRequest(r); ok {
+				sources.recordAuth("", kind, nil, authOutcomeBlocked)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func (l *blockList) list() []blockEntry {
+	now := time.Now()
+	l.mu.RLock()
+	defer l.mu.RUnlock()
+	entries := make([]blockEntry, 0, len(l.entries))
+	for _, entry := range l.entries {
+		if entry.active(now) {
+			entries = append(entries, *entry)
+		}
+	}
+	return entries
+}
+
+func (l *blockList) add(entry blockEntry) (blockEntry, error) {
+	id, err := newAPIKeyID()
+	if err != nil {
+		return blockEntry{}, err
+	}
+	entry.ID = id
+	entry.CreatedAt = time.Now().UTC()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	// Expired entries are dropped whenever the list is written.
+	now := time.Now()
+	previous := l.entries
+	l.entries = slices.DeleteFunc(slices.Clone(l.entries), func(e *blockEntry) bool { return !e.active(now) })
+	l.entries = append(l.entries, &entry)
+	if err = l.saveLocked(); err != nil {
+		l.entries = previous
+		return blockEntry{}, err
+	}
+	return entry, nil
+}
+
+func (l *blockList) remove(id string) (blockEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	index := slices.IndexFunc(l.entries, func(entry *blockEntry) bool { return entry.ID == id })
+	if index < 0 {
+		return blockEntry{}, errBlockNotFound
+	}
+	removed := *l.entries[index]
+	previous := l.entries
+	l.entries = slices.Delete(slices.Clone(l.entries), index, index+1)
+	if err := l.saveLocked(); err != nil {
+		l.entries = previous
+		return blockEntry{}, err
+	}
+	return removed, nil
+}
+
+type blockRequest struct {
+	Kind      string     `json:"kind"`
+	Value     string     `json:"value"`
+	Reason    string     `json:"reason"`
+	ExpiresAt *time.Time `json:"expiresAt"`
+	// ExpiresIn is a Go duration such as "24h", relative to now.
+	ExpiresIn string `json:"expiresIn"`
+}
+
+func (a *adminServer) handleListBlocks(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{"entries": a.blocks.list()})
+}
+
+// handleAddBlock blocks a token, identity or address. It takes effect on
+// the next request; sessions that are already open are not closed, but
+// every further request they make is rejected.
+func (a *adminServer) handleAddBlock(w http.ResponseWriter, r *http.Request) {
+	var req blockRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	expiry := apiKeyRequest{ExpiresAt: req.ExpiresAt, ExpiresIn: req.ExpiresIn}
+	expiresAt, err := expiry.expiry()
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	entry := blockEntry{Kind: req.Kind, Value: req.Value, Reason: req.Reason, ExpiresAt: expiresAt}
+	if err = entry.parse(); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if entry.Kind == blockKindToken {
+		entry.Value = hashAPIKey(entry.Value)
+	}
+	entry, err = a.blocks.add(entry)
+	if err != nil {
+		log.Printf("<admin> Failed to update block list: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to store block list")
+		return
+	}
+	log.Printf("<admin> Blocked %s %s (%s) %s", entry.Kind, entry.ID, blockDescription(entry), entry.Reason)
+	writeJSON(w, http.StatusCreated, entry)
+}
+
+func (a *adminServer) handleRemoveBlock(w http.ResponseWriter, r *http.Request) {
+	entry, err := a.blocks.remove(r.PathValue("id"))
+	switch {
+	case errors.Is(err, errBlockNotFound):
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	case err != nil:
+		log.Printf("<admin> Failed to update block list: %v", err)
+		writeJSONError(w, http.StatusInternalServerError, "failed to store block list")
+		return
+	}
+	log.Printf("<admin> Unblocked %s %s (%s)", entry.Kind, entry.ID, blockDescription(entry))
+	writeJSON(w, http.StatusOK, entry)
+}
+
+// blockDescription names what an entry blocks without revealing tokens.
+func blockDescription(entry blockEntry) string {
+	if entry.Kind == blockKindToken {
+		return "sha256 " + entry.Value[:12]
+	}
+	return entry.Value
+}
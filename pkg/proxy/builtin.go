@@ -0,0 +1,26 @@
+package proxy
+
+import (
+	"fmt"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// builtinCommandPrefix marks a server entry that is implemented inside the
+// proxy itself, e.g. "command": "builtin:fetch".
+const builtinCommandPrefix = "builtin:"
+
+type builtinServerFactory func(name string, conf *BuiltinMCPClientConfig) (*server.MCPServer, error)
+
+var builtinServers = map[string]builtinServerFactory{
+	"fetch":       newFetchMCPServer,
+	"diagnostics": newDiagnosticsMCPServer,
+}
+
+func newBuiltinMCPServer(name string, conf *BuiltinMCPClientConfig) (*server.MCPServer, error) {
+	factory, ok := builtinServers[conf.Name]
+	if !ok {
+		return nil, fmt.Errorf("unknown builtin server: %s", conf.Name)
+	}
+	return factory(name, conf)
+}
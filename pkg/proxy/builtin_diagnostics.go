@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// maxDiagnosticsSleep caps the sleep tool so a test call can't hold a
+// request open indefinitely.
+const maxDiagnosticsSleep = 5 * time.Minute
+
+// whoami is what the whoami tool of builtin:diagnostics returns.
+type whoami struct {
+	Server string    `json:"server"`
+	Time   time.Time `json:"time"`
+	// Identity is the caller the request was authorized as, empty when the
+	// route does not require a token.
+	Identity      string   `json:"identity,omitempty"`
+	TokenServers  []string `json:"tokenServers,omitempty"`
+	TokenTools    []string `json:"tokenTools,omitempty"`
+	TokenReadOnly bool     `json:"tokenReadOnly,omitempty"`
+	RemoteAddr    string   `json:"remoteAddr,omitempty"`
+	UserAgent     string   `json:"userAgent,omitempty"`
+	SessionID     string   `json:"sessionId,omitempty"`
+	ClientName    string   `json:"clientName,omitempty"`
+	ClientVersion string   `json:"clientVersion,omitempty"`
+}
+
+// newDiagnosticsMCPServer serves tools that touch nothing but the proxy,
+// so the path from a client to the proxy can be tested without a real
+// upstream.
+func newDiagnosticsMCPServer(name string, _ *BuiltinMCPClientConfig) (*server.MCPServer, error) {
+	mcpServer := server.NewMCPServer(name, BuildVersion, server.WithToolCapabilities(false))
+	mcpServer.AddTool(mcp.NewTool("echo",
+		mcp.WithDescription("Returns the message it is called with."),
+		mcp.WithString("message", mcp.Required(), mcp.Description("Text to echo back")),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(false),
+	), handleDiagnosticsEcho)
+	mcpServer.AddTool(mcp.NewTool("sleep",
+		mcp.WithDescription(fmt.Sprintf("Waits for the given number of seconds, at most %d, before returning. Useful for testing timeouts.", int(maxDiagnosticsSleep.Seconds()))),
+		mcp.WithNumber("seconds", mcp.Required(), mcp.Description("How long to wait"), mcp.Min(0), mcp.Max(maxDiagnosticsSleep.Seconds())),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(false),
+	), handleDiagnosticsSleep)
+	mcpServer.AddTool(mcp.NewTool("whoami",
+		mcp.WithDescription("Returns the identity the proxy authorized the call as and the metadata of the connection it came in on."),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(false),
+	), func(ctx context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		return handleDiagnosticsWhoami(ctx, name)
+	})
+	return mcpServer, nil
+}
+
+func handleDiagnosticsEcho(_ context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	message, err := request.RequireString("message")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	return mcp.NewToolResultText(message), nil
+}
+
+func handleDiagnosticsSleep(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	seconds, err := request.RequireFloat("seconds")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	if seconds < 0 || seconds > maxDiagnosticsSleep.Seconds() {
+		return mcp.NewToolResultError(fmt.Sprintf("seconds must be between 0 and %d", int(maxDiagnosticsSleep.Seconds()))), nil
+	}
+	duration := time.Duration(seconds * float64(time.Second))
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return mcp.NewToolResultText(fmt.Sprintf("slept for %s", duration)), nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+func handleDiagnosticsWhoami(ctx context.Context, serverName string) (*mcp.CallToolResult, error) {
+	result := whoami{Server: serverName, Time: time.Now().UTC()}
+	if token := authTokenFromContext(ctx); token != nil {
+		result.Identity = callerName(token)
+		result.TokenServers = token.Servers
+		result.TokenTools = token.Tools
+		result.TokenReadOnly = token.ReadOnly
+	}
+	if origin, ok := ctx.Value(requestOriginKey{}).(requestOrigin); ok {
+		result.RemoteAddr = origin.remoteAddr
+		result.UserAgent = origin.userAgent
+	}
+	// The builtin server runs in process, so the session is the one of the
+	// client connected to the proxy.
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		result.SessionID = session.SessionID()
+		if withInfo, ok := session.(server.SessionWithClientInfo); ok {
+			info := withInfo.GetClientInfo()
+			result.ClientName = info.Name
+			result.ClientVersion = info.Version
+		}
+	}
+	data, err := json.MarshalIndent(result, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return mcp.NewToolResultText(string(data)), nil
+}
@@ -0,0 +1,155 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const (
+	defaultFetchMaxBytes = 1 << 20
+	defaultFetchTimeout  = 30 * time.Second
+	maxFetchRedirects    = 5
+)
+
+var errFetchPrivateAddress = errors.New("fetching private or loopback addresses is not allowed")
+
+// carrierGradeNAT is the shared address space of RFC 6598, which cloud
+// providers and VPNs use to reach internal networks.
+var carrierGradeNAT = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+
+// privateAddress reports whether ip is one the fetch tool may not reach
+// unless allowPrivate is set.
+func privateAddress(ip net.IP) bool {
+	return ip == nil || ip.IsLoopback() || ip.IsPrivate() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsUnspecified() || carrierGradeNAT.Contains(ip)
+}
+
+type fetcher struct {
+	allowedDomains []string
+	maxBytes       int64
+	client         *http.Client
+}
+
+func newFetchMCPServer(name string, conf *BuiltinMCPClientConfig) (*server.MCPServer, error) {
+	fetchConf := conf.Fetch
+	if fetchConf == nil {
+		fetchConf = &FetchConfig{}
+	}
+	f := &fetcher{
+		allowedDomains: fetchConf.AllowedDomains,
+		maxBytes:       fetchConf.MaxBytes,
+	}
+	if f.maxBytes <= 0 {
+		f.maxBytes = defaultFetchMaxBytes
+	}
+	timeout := fetchConf.Timeout
+	if timeout <= 0 {
+		timeout = defaultFetchTimeout
+	}
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	if !fetchConf.AllowPrivate {
+		// Check the resolved address so DNS names pointing at internal
+		// hosts can't be used to reach them.
+		dialer.Control = func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			if privateAddress(net.ParseIP(host)) {
+				return errFetchPrivateAddress
+			}
+			return nil
+		}
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+	f.client = &http.Client{
+		Timeout:   timeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxFetchRedirects {
+				return errors.New("too many redirects")
+			}
+			return f.checkURL(req.URL)
+		},
+	}
+
+	mcpServer := server.NewMCPServer(name, BuildVersion, server.WithToolCapabilities(false))
+	mcpServer.AddTool(mcp.NewTool("fetch",
+		mcp.WithDescription("Fetches a URL from the internet and returns its content as text."),
+		mcp.WithString("url", mcp.Required(), mcp.Description("URL to fetch")),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(true),
+	), f.handleFetch)
+	return mcpServer, nil
+}
+
+func (f *fetcher) checkURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported URL scheme: %s", u.Scheme)
+	}
+	if len(f.allowedDomains) == 0 {
+		return nil
+	}
+	host := strings.ToLower(u.Hostname())
+	for _, domain := range f.allowedDomains {
+		domain = strings.ToLower(strings.TrimPrefix(domain, "*."))
+		if host == domain || strings.HasSuffix(host, "."+domain) {
+			return nil
+		}
+	}
+	return fmt.Errorf("domain %s is not in the allow list", host)
+}
+
+func (f *fetcher) handleFetch(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	rawURL, err := request.RequireString("url")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return mcp.NewToolResultError("invalid url: " + err.Error()), nil
+	}
+	if err = f.checkURL(u); err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	req.Header.Set("User-Agent", "mcp-proxy/"+BuildVersion)
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return mcp.NewToolResultError("fetch failed: " + err.Error()), nil
+	}
+	defer func() { _ = resp.Body.Close() }()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, f.maxBytes+1))
+	if err != nil {
+		return mcp.NewToolResultError("failed to read response: " + err.Error()), nil
+	}
+	truncated := int64(len(body)) > f.maxBytes
+	if truncated {
+		body = body[:f.maxBytes]
+	}
+	text := string(body)
+	if truncated {
+		text += fmt.Sprintf("\n\n[truncated at %d bytes]", f.maxBytes)
+	}
+	if resp.StatusCode >= http.StatusBadRequest {
+		return mcp.NewToolResultError(fmt.Sprintf("HTTP %d\n\n%s", resp.StatusCode, text)), nil
+	}
+	return mcp.NewToolResultText(text), nil
+}
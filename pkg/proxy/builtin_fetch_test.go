@@ -0,0 +1,36 @@
+package proxy
+
+import (
+	"net"
+	"testing"
+)
+
+func TestPrivateAddress(t *testing.T) {
+	tests := []struct {
+		ip   string
+		want bool
+	}{
+		{ip: "127.0.0.1", want: true},
+		{ip: "10.1.2.3", want: true},
+		{ip: "172.16.0.1", want: true},
+		{ip: "192.168.1.1", want: true},
+		{ip: "169.254.169.254", want: true},
+		{ip: "0.0.0.0", want: true},
+		{ip: "100.64.0.1", want: true},
+		{ip: "100.127.255.254", want: true},
+		{ip: "::ffff:100.100.1.1", want: true},
+		{ip: "::1", want: true},
+		{ip: "fd00::1", want: true},
+		{ip: "fe80::1", want: true},
+		{ip: "not an ip", want: true},
+		{ip: "100.63.255.255", want: false},
+		{ip: "100.128.0.1", want: false},
+		{ip: "93.184.216.34", want: false},
+		{ip: "2606:2800:220:1::1", want: false},
+	}
+	for _, tt := range tests {
+		if got := privateAddress(net.ParseIP(tt.ip)); got != tt.want {
+			t.Errorf("privateAddress(%s) = %v, want %v", tt.ip, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,382 @@
+package proxy
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	_ "modernc.org/sqlite"
+)
+
+const (
+	defaultCallHistoryRetention = 7 * 24 * time.Hour
+	defaultCallHistoryResult    = 64 << 10
+	callHistoryQueue            = 1024
+	callHistoryPruneInterval    = time.Hour
+	defaultHistoryPageSize      = 100
+	maxHistoryPageSize          = 1000
+)
+
+var errCallNotFound = errors.New("call not found")
+
+// callHistory keeps recent tool calls in a SQLite database so operators can
+// look up what agents did after the fact. Calls are written by a single
+// goroutine; when it falls behind, new calls are dropped rather than
+// slowing down the calls themselves.
+type callHistory struct {
+	db          *sql.DB
+	retention   time.Duration
+	resultLimit int
+	clients     *clientTracker
+
+	queue  chan *recordedCall
+	done   chan struct{}
+	lostMu sync.Mutex
+	lost   int
+}
+
+// recordedCall is a tool call as stored in the history.
+type recordedCall struct {
+	ID         int64           `json:"id"`
+	Time       time.Time       `json:"time"`
+	Server     string          `json:"server"`
+	Tool       string          `json:"tool"`
+	User       string          `json:"user,omitempty"`
+	Client     string          `json:"client"`
+	Status     string          `json:"status"`
+	DurationMs float64         `json:"durationMs"`
+	Arguments  json.RawMessage `json:"arguments,omitempty"`
+	Result     json.RawMessage `json:"result,omitempty"`
+	// ResultTruncated is set when the result exceeded the configured
+	// limit and was not stored.
+	ResultTruncated bool   `json:"resultTruncated,omitempty"`
+	Error           string `json:"error,omitempty"`
+}
+
+const callHistorySchema = `
+CREATE TABLE IF NOT EXISTS tool_calls (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	time INTEGER NOT NULL,
+	server TEXT NOT NULL,
+	tool TEXT NOT NULL,
+	user TEXT NOT NULL,
+	client TEXT NOT NULL,
+	status TEXT NOT NULL,
+	duration_ms REAL NOT NULL,
+	arguments TEXT,
+	result TEXT,
+	result_truncated INTEGER NOT NULL DEFAULT 0,
+	error TEXT NOT NULL
+);
+CREATE INDEX IF NOT EXISTS tool_calls_time ON tool_calls (time);
+CREATE INDEX IF NOT EXISTS tool_calls_server_tool ON tool_calls (server, tool, time);
+`
+
+func newCallHistory(conf *CallHistoryConfig, clients *clientTracker) (*callHistory, error) {
+	// Created up front so the database is private to the proxy's user.
+	f, err := os.OpenFile(conf.Database, os.O_CREATE|os.O_RDWR, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open call history: %w", err)
+	}
+	_ = f.Close()
+	db, err := sql.Open("sqlite", "file:"+conf.Database+"?_pragma=journal_mode(WAL)&_pragma=busy_timeout(5000)")
+	if err != nil {
+		return nil, fmt.Errorf("open call history: %w", err)
+	}
+	if _, err = db.Exec(callHistorySchema); err != nil {
+		_ = db.Close()
+		return nil, fmt.Errorf("open call history %s: %w", conf.Database, err)
+	}
+	h := &callHistory{
+		db:          db,
+		retention:   conf.Retention,
+		resultLimit: conf.MaxResultBytes,
+		clients:     clients,
+		queue:       make(chan *recordedCall, callHistoryQueue),
+		done:        make(chan struct{}),
+	}
+	if h.retention <= 0 {
+		h.retention = defaultCallHistoryRetention
+	}
+	if h.resultLimit == 0 {
+		h.resultLimit = defaultCallHistoryResult
+	}
+	go h.run()
+	log.Printf("Recording tool calls to %s, kept for %s", conf.Database, h.retention)
+	return h, nil
+}
+
+// wrap records every call of next. A nil history records nothing.
+func (h *callHistory) wrap(next ToolCallFunc) ToolCallFunc {
+	if h == nil {
+		return next
+	}
+	return func(ctx context.Context, server string, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		start := time.Now()
+		result, err := next(ctx, server, request)
+		call := &recordedCall{
+			Time:       start,
+			Server:     server,
+			Tool:       request.Params.Name,
+			User:       callerName(authTokenFromContext(ctx)),
+			Client:     h.clients.fromContext(ctx).String(),
+			Status:     callOutcome(server, result, err),
+			DurationMs: milliseconds(time.Since(start)),
+		}
+		call.Arguments, _ = json.Marshal(request.Params.Arguments)
+		if result != nil {
+			call.Result, _ = json.Marshal(result)
+			if h.resultLimit > 0 && len(call.Result) > h.resultLimit {
+				call.Result, call.ResultTruncated = nil, true
+			}
+		}
+		if err != nil {
+			call.Error = err.Error()
+		}
+		select {
+		case h.queue <- call:
+		default:
+			h.lostMu.Lock()
+			h.lost++
+			h.lostMu.Unlock()
+		}
+		return result, err
+	}
+}
+
+// run writes queued calls and prunes those past the retention period.
+func (h *callHistory) run() {
+	defer close(h.done)
+	h.prune()
+	ticker := time.NewTicker(callHistoryPruneInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case call, ok := <-h.queue:
+			if !ok {
+				return
+			}
+			h.insert(call)
+		case <-ticker.C:
+			h.prune()
+		}
+	}
+}
+
+func (h *callHistory) insert(call *recordedCall) {
+	_, err := h.db.Exec(`INSERT INTO tool_calls
+		(time, server, tool, user, client, status, duration_ms, arguments, result, result_truncated, error)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		call.Time.UnixMilli(), call.Server, call.Tool, call.User, call.Client, call.Status, call.DurationMs,
+		nullableJSON(call.Arguments), nullableJSON(call.Result), call.ResultTruncated, call.Error)
+	if err != nil {
+		log.Printf("<%s> Failed to record tool call %s: %v", call.Server, call.Tool, err)
+	}
+	h.lostMu.Lock()
+	lost := h.lost
+	h.lost = 0
+	h.lostMu.Unlock()
+	if lost > 0 {
+		log.Printf("Call history fell behind, %d tool calls were not recorded", lost)
+	}
+}
+
+func (h *callHistory) prune() {
+	cutoff := time.Now().Add(-h.retention).UnixMilli()
+	result, err := h.db.Exec(`DELETE FROM tool_calls WHERE time < ?`, cutoff)
+	if err != nil {
+		log.Printf("Failed to prune call history: %v", err)
+		return
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		log.Printf("Pruned %d tool calls older than %s from the call history", n, h.retention)
+	}
+}
+
+func nullableJSON(data json.RawMessage) any {
+	if len(data) == 0 {
+		return nil
+	}
+	return string(data)
+}
+
+// callFilter selects calls from the history. Zero fields match anything.
+type callFilter struct {
+	Server, Tool, User, Status string
+	Since, Until               time.Time
+	// Before pages backwards: only calls with a smaller id are returned.
+	Before int64
+	Limit  int
+}
+
+// list returns the calls matching filter, newest first, without their
+// results.
+func (h *callHistory) list(ctx context.Context, filter callFilter) ([]recordedCall, error) {
+	var where []string
+	var args []any
+	for column, value := range map[string]string{"server": filter.Server, "tool": filter.Tool, "user": filter.User, "status": filter.Status} {
+		if value != "" {
+			where = append(where, column+" = ?")
+			args = append(args, value)
+		}
+	}
+	if !filter.Since.IsZero() {
+		where = append(where, "time >= ?")
+		args = append(args, filter.Since.UnixMilli())
+	}
+	if !filter.Until.IsZero() {
+		where = append(where, "time < ?")
+		args = append(args, filter.Until.UnixMilli())
+	}
+	if filter.Before > 0 {
+		where = append(where, "id < ?")
+		args = append(args, filter.Before)
+	}
+	query := `SELECT id, time, server, tool, user, client, status, duration_ms, arguments, result_truncated, error FROM tool_calls`
+	if len(where) > 0 {
+		query += " WHERE " + strings.Join(where, " AND ")
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, filter.Limit)
+	rows, err := h.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+	calls := make([]recordedCall, 0)
+	for rows.Next() {
+		var call recordedCall
+		var millis int64
+		var arguments sql.NullString
+		if err = rows.Scan(&call.ID, &millis, &call.Server, &call.Tool, &call.User, &call.Client, &call.Status,
+			&call.DurationMs, &arguments, &call.ResultTruncated, &call.Error); err != nil {
+			return nil, err
+		}
+		call.Time = time.UnixMilli(millis).UTC()
+		if arguments.Valid {
+			call.Arguments = json.RawMessage(arguments.String)
+		}
+		calls = append(calls, call)
+	}
+	return calls, rows.Err()
+}
+
+// get returns one call including its result.
+func (h *callHistory) get(ctx context.Context, id int64) (*recordedCall, error) {
+	var call recordedCall
+	var millis int64
+	var arguments, result sql.NullString
+	err := h.db.QueryRowContext(ctx, `SELECT id, time, server, tool, user, client, status, duration_ms, arguments, result, result_truncated, error
+		FROM tool_calls WHERE id = ?`, id).Scan(&call.ID, &millis, &call.Server, &call.Tool, &call.User, &call.Client,
+		&call.Status, &call.DurationMs, &arguments, &result, &call.ResultTruncated, &call.Error)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, errCallNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	call.Time = time.UnixMilli(millis).UTC()
+	if arguments.Valid {
+		call.Arguments = json.RawMessage(arguments.String)
+	}
+	if result.Valid {
+		call.Result = json.RawMessage(result.String)
+	}
+	return &call, nil
+}
+
+// Close writes the calls still queued and closes the database.
+func (h *callHistory) Close() error {
+	if h == nil {
+		return nil
+	}
+	close(h.queue)
+	<-h.done
+	return h.db.Close()
+}
+
+// parseHistoryTime accepts an RFC 3339 time or a duration before now, such
+// as 24h.
+func parseHistoryTime(value string, now time.Time) (time.Time, error) {
+	if d, err := time.ParseDuration(value); err == nil {
+		return now.Add(-d), nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func (a *adminServer) handleListCalls(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := callFilter{
+		Server: query.Get("server"),
+		Tool:   query.Get("tool"),
+		User:   query.Get("user"),
+		Status: query.Get("status"),
+		Limit:  defaultHistoryPageSize,
+	}
+	now := time.Now()
+	var err error
+	if value := query.Get("since"); value != "" {
+		if filter.Since, err = parseHistoryTime(value, now); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "since must be an RFC 3339 time or a duration like 24h")
+			return
+		}
+	}
+	if value := query.Get("until"); value != "" {
+		if filter.Until, err = parseHistoryTime(value, now); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "until must be an RFC 3339 time or a duration like 24h")
+			return
+		}
+	}
+	if value := query.Get("before"); value != "" {
+		if filter.Before, err = strconv.ParseInt(value, 10, 64); err != nil || filter.Before <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "before must be a call id")
+			return
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, aErr := strconv.Atoi(value)
+		if aErr != nil || limit <= 0 {
+			writeJSONError(w, http.StatusBadRequest, "limit must be a positive integer")
+			return
+		}
+		filter.Limit = min(limit, maxHistoryPageSize)
+	}
+	calls, err := a.calls.list(r.Context(), filter)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	response := map[string]any{"calls": calls}
+	if len(calls) == filter.Limit {
+		response["next"] = calls[len(calls)-1].ID
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (a *adminServer) handleGetCall(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, errCallNotFound.Error())
+		return
+	}
+	call, err := a.calls.get(r.Context(), id)
+	if errors.Is(err, errCallNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, call)
+}
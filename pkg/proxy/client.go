@@ -0,0 +1,788 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+var (
+	errServerUnavailable  = errors.New("server unavailable")
+	errRestartUnsupported = errors.New("restart is only supported for stdio servers")
+)
+
+type Client struct {
+	name            string
+	needPing        bool
+	needManualStart bool
+	options         *OptionsV2
+	tools           []mcp.Tool
+	// argumentSchemas holds the compiled input schemas of the tools when
+	// options.validateArguments is set.
+	argumentSchemas map[string]*jsonSchema
+	// outputSchemas holds the compiled output schemas of the tools when
+	// options.validateOutput is set.
+	outputSchemas map[string]*jsonSchema
+	// prompts are the prompts the upstream listed, for the prompt library.
+	prompts     []mcp.Prompt
+	schedule    *schedule
+	maintenance atomic.Bool
+
+	mu         sync.RWMutex
+	client     *client.Client
+	clientInfo mcp.Implementation
+
+	// spawn creates a fresh, unstarted upstream connection. It is only set
+	// for transports that own a process and can therefore be restarted.
+	spawn     func() (*client.Client, error)
+	standby   *standbyPool
+	restartMu sync.Mutex
+	// replicas serve the resources of http upstreams that have them.
+	replicas *replicaSet
+	// egress is the gateway stdio servers with an egress allowlist are
+	// pointed at.
+	egress *egressGateway
+
+	// pkg is set for npx/uvx servers by pre-flight; serverInfo is what the
+	// upstream reported during initialization.
+	pkg          *packageInfo
+	serverInfo   mcp.Implementation
+	capabilities mcp.ServerCapabilities
+
+	health  healthState
+	metrics *proxyMetrics
+	hooks   *lifecycleHooks
+	cluster *cluster
+	// wire traces the JSON-RPC messages exchanged with the upstream.
+	wire *wireTap
+	// diagnostics keeps the latest handshake and upstream errors for
+	// GET /<name>/diagnose.
+	diagnostics upstreamLog
+
+	// stop ends the background tasks started by addToMCPServer.
+	stop context.CancelFunc
+	// toolCall is forwardToolCall wrapped in the proxy's tool interceptors
+	// and call metrics.
+	toolCall ToolCallFunc
+}
+
+func newMCPClient(name string, conf *MCPClientConfigV2, signer *upstreamSigner, identity *workloadIdentity) (*Client, error) {
+	c, err := newMCPClientForConfig(name, conf, signer, identity)
+	if err != nil {
+		return nil, err
+	}
+	if conf.Options != nil && conf.Options.Schedule != nil {
+		c.schedule, err = newSchedule(conf.Options.Schedule)
+		if err != nil {
+			return nil, fmt.Errorf("<%s> invalid schedule: %w", name, err)
+		}
+	}
+	if len(conf.Replicas) > 0 {
+		c.replicas = newReplicaSet(name, conf, signer, identity)
+	}
+	if conf.Options != nil && conf.Options.Standby > 0 {
+		if c.spawn == nil {
+			log.Printf("<%s> Ignoring standby option: only supported for stdio servers", name)
+		} else {
+			c.standby = newStandbyPool(name, conf.Options.Standby, c.spawnInitialized)
+		}
+	}
+	return c, nil
+}
+
+// newMCPClientForConfig creates the client for conf. signer signs the
+// requests of http upstreams with signRequests set, and those with mtls
+// connect with identity.
+func newMCPClientForConfig(name string, conf *MCPClientConfigV2, signer *upstreamSigner, identity *workloadIdentity) (*Client, error) {
+	clientInfo, pErr := parseMCPClientConfigV2(conf)
+	if pErr != nil {
+		return nil, pErr
+	}
+	if !conf.SignRequests {
+		signer = nil
+	}
+	var traceConf *TraceWireConfig
+	if conf.Options != nil {
+		traceConf = conf.Options.TraceWire
+	}
+	tap, err := newWireTap(name, traceConf)
+	if err != nil {
+		return nil, err
+	}
+	var conformance *conformanceChecker
+	if conf.Options != nil {
+		conformance = newConformanceChecker(name, conf.Options.Conformance)
+	}
+	switch v := clientInfo.(type) {
+	case *StdioMCPClientConfig:
+		var gateway *egressGateway
+		if v.Egress != nil {
+			var err error
+			if gateway, err = newEgressGateway(name, v.Egress); err != nil {
+				return nil, err
+			}
+		}
+		commandFunc := newStdioCommandFunc(name, v, gateway)
+		spawn := func() (*client.Client, error) {
+			stdio := transport.NewStdioWithOptions(v.Command, nil, v.Args, transport.WithCommandFunc(commandFunc))
+			if err := stdio.Start(context.Background()); err != nil {
+				return nil, fmt.Errorf("failed to start stdio transport: %w", err)
+			}
+			return newUpstreamClient(stdio, tap, conformance), nil
+		}
+		mcpClient, err := spawn()
+		if err != nil {
+			if gateway != nil {
+				_ = gateway.Close()
+			}
+			return nil, err
+		}
+
+		return &Client{
+			name:    name,
+			client:  mcpClient,
+			options: conf.Options,
+			wire:    tap,
+			spawn:   spawn,
+			egress:  gateway,
+		}, nil
+	case *SSEMCPClientConfig:
+		var options []transport.ClientOption
+		if conf.MTLS != nil && identity != nil {
+			options = append(options, transport.WithHTTPClient(identity.httpClient(conf.MTLS.SPIFFEIDs)))
+		}
+		if len(v.Headers) > 0 {
+			options = append(options, client.WithHeaders(v.Headers))
+		}
+		if headerFunc := signer.headerFunc(name); headerFunc != nil {
+			options = append(options, client.WithHeaderFunc(headerFunc))
+		}
+		sse, err := transport.NewSSE(v.URL, options...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create SSE transport: %w", err)
+		}
+		mcpClient := newUpstreamClient(sse, tap, conformance)
+		return &Client{
+			name:            name,
+			needPing:        true,
+			needManualStart: true,
+			client:          mcpClient,
+			options:         conf.Options,
+			wire:            tap,
+		}, nil
+	case *StaticMCPClientConfig:
+		staticServer, err := newStaticMCPServer(name, v)
+		if err != nil {
+			return nil, err
+		}
+		mcpClient := newUpstreamClient(transport.NewInProcessTransport(staticServer), tap, conformance)
+		return &Client{
+			name:            name,
+			needManualStart: true,
+			client:          mcpClient,
+			options:         conf.Options,
+			wire:            tap,
+		}, nil
+	case *BuiltinMCPClientConfig:
+		builtinServer, err := newBuiltinMCPServer(name, v)
+		if err != nil {
+			return nil, err
+		}
+		mcpClient := newUpstreamClient(transport.NewInProcessTransport(builtinServer), tap, conformance)
+		return &Client{
+			name:            name,
+			needManualStart: true,
+			client:          mcpClient,
+			options:         conf.Options,
+			wire:            tap,
+		}, nil
+	case *StreamableMCPClientConfig:
+		var options []transport.StreamableHTTPCOption
+		if conf.MTLS != nil && identity != nil {
+			// Before WithHTTPTimeout, which configures the client set here.
+			options = append(options, transport.WithHTTPBasicClient(identity.httpClient(conf.MTLS.SPIFFEIDs)))
+		}
+		if len(v.Headers) > 0 {
+			options = append(options, transport.WithHTTPHeaders(v.Headers))
+		}
+		if v.Timeout > 0 {
+			options = append(options, transport.WithHTTPTimeout(v.Timeout))
+		}
+		if headerFunc := signer.headerFunc(name); headerFunc != nil {
+			options = append(options, transport.WithHTTPHeaderFunc(headerFunc))
+		}
+		streamable, err := transport.NewStreamableHTTP(v.URL, options...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create streamable-http transport: %w", err)
+		}
+		mcpClient := newUpstreamClient(streamable, tap, conformance)
+		return &Client{
+			name:            name,
+			needPing:        true,
+			needManualStart: true,
+			client:          mcpClient,
+			options:         conf.Options,
+			wire:            tap,
+		}, nil
+	}
+	return nil, errors.New("invalid client type")
+}
+
+// current returns the live upstream connection. It may be swapped out by
+// restart, so callers must not hold on to it across calls.
+func (c *Client) current() *client.Client {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.client
+}
+
+func (c *Client) initialize(ctx context.Context, mcpClient *client.Client) (*mcp.InitializeResult, error) {
+	if c.needManualStart {
+		err := mcpClient.Start(ctx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	initRequest.Params.ClientInfo = c.clientInfo
+	initRequest.Params.Capabilities = mcp.ClientCapabilities{
+		Experimental: make(map[string]any),
+		Roots:        nil,
+		Sampling:     nil,
+	}
+	start := time.Now()
+	result, err := mcpClient.Initialize(ctx, initRequest)
+	if err != nil {
+		c.diagnostics.noteError("initialize", err)
+		return nil, err
+	}
+	c.metrics.observeUpstream(c.name, "initialize", time.Since(start))
+	c.diagnostics.initialized(result, start)
+	return result, nil
+}
+
+// ping pings the upstream, recording the round trip time of a successful
+// ping.
+func (c *Client) ping(ctx context.Context, mcpClient *client.Client) error {
+	start := time.Now()
+	if err := mcpClient.Ping(ctx); err != nil {
+		return err
+	}
+	rtt := time.Since(start)
+	c.health.recordPing(rtt)
+	c.metrics.observeUpstream(c.name, "ping", rtt)
+	return nil
+}
+
+// spawnInitialized starts a new upstream process and completes the MCP
+// handshake so it is ready to serve calls immediately.
+func (c *Client) spawnInitialized(ctx context.Context) (*client.Client, error) {
+	mcpClient, err := c.spawn()
+	if err != nil {
+		return nil, err
+	}
+	if _, err = c.initialize(ctx, mcpClient); err != nil {
+		_ = mcpClient.Close()
+		return nil, err
+	}
+	return mcpClient, nil
+}
+
+// restart replaces the upstream process, taking a warm standby when one is
+// ready. failed is the connection that was observed to be broken; if it has
+// already been replaced by a concurrent restart nothing happens.
+func (c *Client) restart(ctx context.Context, failed *client.Client) error {
+	if c.spawn == nil {
+		return errRestartUnsupported
+	}
+	c.restartMu.Lock()
+	defer c.restartMu.Unlock()
+	if failed != nil && c.current() != failed {
+		return nil
+	}
+	var next *client.Client
+	var err error
+	if c.standby != nil {
+		next, err = c.standby.take(ctx)
+	} else {
+		next, err = c.spawnInitialized(ctx)
+	}
+	if err != nil {
+		c.diagnostics.noteError("restart", err)
+		return err
+	}
+	c.mu.Lock()
+	old := c.client
+	c.client = next
+	c.mu.Unlock()
+	_ = old.Close()
+	log.Printf("<%s> Restarted MCP client", c.name)
+	c.hooks.fire(lifecycleEvent{Event: hookServerRestarted, Server: c.name})
+	return nil
+}
+
+func (c *Client) addToMCPServer(ctx context.Context, clientInfo mcp.Implementation, mcpServer *server.MCPServer) error {
+	c.clientInfo = clientInfo
+	initResult, err := c.initialize(ctx, c.current())
+	if err != nil {
+		return err
+	}
+	c.serverInfo = initResult.ServerInfo
+	c.capabilities = initResult.Capabilities
+	log.Printf("<%s> Successfully initialized MCP client", c.name)
+
+	err = c.addToolsToServer(ctx, mcpServer)
+	if err != nil {
+		c.diagnostics.noteError("tools/list", err)
+		return err
+	}
+	c.addCapabilitiesToServer(ctx, mcpServer)
+
+	if c.options != nil && c.options.HealthCheck != nil {
+		go c.startHealthCheckTask(ctx, c.options.HealthCheck)
+	} else if c.needPing {
+		go c.startPingTask(ctx)
+	}
+	if c.standby != nil {
+		go c.standby.fill(ctx)
+	}
+	return nil
+}
+
+// addCapabilitiesToServer declares on mcpServer the prompt, resource and
+// logging capabilities the upstream reported, and copies its prompts and
+// resources. Clients are not told about features the upstream lacks, and
+// subscriptions are not offered since the proxy does not relay them. It
+// must run before mcpServer is served.
+func (c *Client) addCapabilitiesToServer(ctx context.Context, mcpServer *server.MCPServer) {
+	if prompts := c.capabilities.Prompts; prompts != nil {
+		server.WithPromptCapabilities(prompts.ListChanged)(mcpServer)
+		_ = c.addPromptsToServer(ctx, mcpServer)
+	}
+	if resources := c.capabilities.Resources; resources != nil {
+		server.WithResourceCapabilities(false, resources.ListChanged)(mcpServer)
+		c.replicas.connect(ctx, c.clientInfo)
+		_ = c.addResourcesToServer(ctx, mcpServer)
+		_ = c.addResourceTemplatesToServer(ctx, mcpServer)
+	} else if c.replicas != nil {
+		log.Printf("<%s> Ignoring replicas: the server does not serve resources", c.name)
+	}
+	if c.capabilities.Logging != nil {
+		server.WithLogging()(mcpServer)
+	}
+}
+
+func (c *Client) startPingTask(ctx context.Context) {
+	interval := 30 * time.Second
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	failCount := 0
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("<%s> Context done, stopping ping", c.name)
+			return
+		case <-ticker.C:
+			err := c.ping(ctx, c.current())
+			if err != nil && (errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded)) {
+				return
+			}
+			c.health.record(err)
+			if err != nil {
+				c.diagnostics.noteError("ping", err)
+				failCount++
+				log.Printf("<%s> MCP Ping failed: %v (count=%d)", c.name, err, failCount)
+				if failCount%defaultHealthCheckThreshold == 0 {
+					c.hooks.fire(lifecycleEvent{Event: hookServerUnhealthy, Server: c.name, Failures: failCount, Error: err.Error()})
+				}
+			} else if failCount > 0 {
+				log.Printf("<%s> MCP Ping recovered after %d failures", c.name, failCount)
+				if failCount >= defaultHealthCheckThreshold {
+					c.hooks.fire(lifecycleEvent{Event: hookServerRecovered, Server: c.name})
+				}
+				failCount = 0
+			}
+		}
+	}
+}
+
+func newToolFilterFunc(name string, toolFilter *ToolFilterConfig) func(toolName string) bool {
+	filterFunc := func(toolName string) bool {
+		return true
+	}
+
+	if toolFilter != nil && len(toolFilter.List) > 0 {
+		filterSet := make(map[string]struct{})
+		mode := ToolFilterMode(strings.ToLower(string(toolFilter.Mode)))
+		for _, toolName := range toolFilter.List {
+			filterSet[toolName] = struct{}{}
+		}
+		switch mode {
+		case ToolFilterModeAllow:
+			filterFunc = func(toolName string) bool {
+				_, inList := filterSet[toolName]
+				if !inList {
+					log.Printf("<%s> Ignoring tool %s as it is not in allow list", name, toolName)
+				}
+				return inList
+			}
+		case ToolFilterModeBlock:
+			filterFunc = func(toolName string) bool {
+				_, inList := filterSet[toolName]
+				if inList {
+					log.Printf("<%s> Ignoring tool %s as it is in block list", name, toolName)
+				}
+				return !inList
+			}
+		default:
+			log.Printf("<%s> Unknown tool filter mode: %s, skipping tool filter", name, mode)
+		}
+	}
+	return filterFunc
+}
+
+func (c *Client) addToolsToServer(ctx context.Context, mcpServer *server.MCPServer) error {
+	toolsRequest := mcp.ListToolsRequest{}
+	var toolFilter *ToolFilterConfig
+	if c.options != nil {
+		toolFilter = c.options.ToolFilter
+	}
+	filterFunc := newToolFilterFunc(c.name, toolFilter)
+
+	mcpClient := c.current()
+	for {
+		start := time.Now()
+		tools, err := mcpClient.ListTools(ctx, toolsRequest)
+		if err != nil {
+			return err
+		}
+		c.metrics.observeUpstream(c.name, "list_tools", time.Since(start))
+		if tools == nil {
+			return fmt.Errorf("<%s> ListTools returned nil response without error", c.name)
+		}
+		if len(tools.Tools) == 0 {
+			break
+		}
+		log.Printf("<%s> Successfully listed %d tools", c.name, len(tools.Tools))
+		for _, tool := range tools.Tools {
+			if filterFunc(tool.Name) {
+				tool = withUpstreamSchemas(mcpClient, tool)
+				log.Printf("<%s> Adding tool %s", c.name, tool.Name)
+				mcpServer.AddTool(tool, translateToolErrors(c.name, c.callTool))
+				c.mu.Lock()
+				c.tools = append(c.tools, tool)
+				c.mu.Unlock()
+				c.compileArgumentSchema(tool)
+				c.compileOutputSchema(tool)
+			}
+		}
+		if tools.NextCursor == "" {
+			break
+		}
+		toolsRequest.Params.Cursor = tools.NextCursor
+	}
+
+	return nil
+}
+
+func (c *Client) addPromptsToServer(ctx context.Context, mcpServer *server.MCPServer) error {
+	promptsRequest := mcp.ListPromptsRequest{}
+	var listed []mcp.Prompt
+	for {
+		prompts, err := c.current().ListPrompts(ctx, promptsRequest)
+		if err != nil {
+			return err
+		}
+		if prompts == nil {
+			return fmt.Errorf("<%s> ListPrompts returned nil response without error", c.name)
+		}
+		if len(prompts.Prompts) == 0 {
+			break
+		}
+		log.Printf("<%s> Successfully listed %d prompts", c.name, len(prompts.Prompts))
+		for _, prompt := range prompts.Prompts {
+			log.Printf("<%s> Adding prompt %s", c.name, prompt.Name)
+			mcpServer.AddPrompt(prompt, c.getPrompt)
+			listed = append(listed, prompt)
+		}
+		if prompts.NextCursor == "" {
+			break
+		}
+		promptsRequest.Params.Cursor = prompts.NextCursor
+	}
+	c.prompts = listed
+	return nil
+}
+
+// addResourcesToServer lists the resources from a replica, if the server
+// has one connected, or else from the primary.
+func (c *Client) addResourcesToServer(ctx context.Context, mcpServer *server.MCPServer) error {
+	resourcesRequest := mcp.ListResourcesRequest{}
+	reader, replicaLabel := c.resourceReader()
+	for {
+		resources, err := reader.ListResources(ctx, resourcesRequest)
+		if err != nil && replicaLabel != "" {
+			log.Printf("<%s> Replica %s failed to list resources, listing them from the primary: %v", c.name, replicaLabel, err)
+			reader, replicaLabel = c.current(), ""
+			resourcesRequest.Params.Cursor = ""
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if resources == nil {
+			return fmt.Errorf("<%s> ListResources returned nil response without error", c.name)
+		}
+		if len(resources.Resources) == 0 {
+			break
+		}
+		log.Printf("<%s> Successfully listed %d resources", c.name, len(resources.Resources))
+		for _, resource := range resources.Resources {
+			log.Printf("<%s> Adding resource %s", c.name, resource.Name)
+			mcpServer.AddResource(resource, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+				readResource, e := c.readResource(ctx, request)
+				if e != nil {
+					return nil, e
+				}
+				return readResource.Contents, nil
+			})
+		}
+		if resources.NextCursor == "" {
+			break
+		}
+		resourcesRequest.Params.Cursor = resources.NextCursor
+
+	}
+	return nil
+}
+
+func (c *Client) addResourceTemplatesToServer(ctx context.Context, mcpServer *server.MCPServer) error {
+	resourceTemplatesRequest := mcp.ListResourceTemplatesRequest{}
+	reader, replicaLabel := c.resourceReader()
+	for {
+		resourceTemplates, err := reader.ListResourceTemplates(ctx, resourceTemplatesRequest)
+		if err != nil && replicaLabel != "" {
+			log.Printf("<%s> Replica %s failed to list resource templates, listing them from the primary: %v", c.name, replicaLabel, err)
+			reader, replicaLabel = c.current(), ""
+			resourceTemplatesRequest.Params.Cursor = ""
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if resourceTemplates == nil || len(resourceTemplates.ResourceTemplates) == 0 {
+			break
+		}
+		log.Printf("<%s> Successfully listed %d resource templates", c.name, len(resourceTemplates.ResourceTemplates))
+		for _, resourceTemplate := range resourceTemplates.ResourceTemplates {
+			log.Printf("<%s> Adding resource template %s", c.name, resourceTemplate.Name)
+			mcpServer.AddResourceTemplate(resourceTemplate, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+				readResource, e := c.readResource(ctx, request)
+				if e != nil {
+					return nil, e
+				}
+				return readResource.Contents, nil
+			})
+		}
+		if resourceTemplates.NextCursor == "" {
+			break
+		}
+		resourceTemplatesRequest.Params.Cursor = resourceTemplates.NextCursor
+	}
+	return nil
+}
+
+// callTool runs a tool call through the interceptors registered with
+// WithToolInterceptor, if any, and forwards it to the upstream. Every route
+// and bridge calls tools through here.
+func (c *Client) callTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if c.toolCall != nil {
+		return c.toolCall(ctx, c.name, request)
+	}
+	return c.forwardToolCall(ctx, c.name, request)
+}
+
+// forwardToolCall forwards a tool call to the upstream after applying the
+// proxy's availability checks.
+func (c *Client) forwardToolCall(ctx context.Context, _ string, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	if c.maintenance.Load() {
+		return nil, fmt.Errorf("%w: %s is under maintenance", errServerUnavailable, c.name)
+	}
+	if now := time.Now(); c.schedule != nil && !c.schedule.active(now) {
+		err := fmt.Errorf("%w: %s is outside its scheduled window", errServerUnavailable, c.name)
+		if next, ok := c.schedule.nextActive(now); ok {
+			err = retryAfter(err, next.Sub(now))
+		}
+		return nil, err
+	}
+	mcpClient := c.current()
+	result, err := mcpClient.CallTool(ctx, request)
+	if err != nil {
+		c.diagnostics.noteError("tools/call "+request.Params.Name, err)
+	}
+	if err != nil && c.spawn != nil && errors.Is(err, transport.ErrTransportClosed) {
+		log.Printf("<%s> Upstream process exited, restarting", c.name)
+		if rErr := c.restart(ctx, mcpClient); rErr != nil {
+			log.Printf("<%s> Failed to restart MCP client: %v", c.name, rErr)
+		}
+	}
+	return result, err
+}
+
+func (c *Client) getPrompt(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+	return c.current().GetPrompt(ctx, request)
+}
+
+// setMaintenance switches maintenance mode and reports whether it changed.
+// In a cluster, the change applies to every node.
+func (c *Client) setMaintenance(enabled bool) bool {
+	if c.cluster != nil {
+		return c.cluster.setMaintenance(c.name, c, enabled)
+	}
+	return c.maintenance.Swap(enabled) != enabled
+}
+
+// filterTools hides the server's tools from tool listings while it is under
+// maintenance.
+func (c *Client) filterTools(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+	if c.maintenance.Load() {
+		return []mcp.Tool{}
+	}
+	return tools
+}
+
+// serverOptions returns the options a downstream MCP server needs to honour
+// this client's runtime state.
+func (c *Client) serverOptions() []server.ServerOption {
+	return []server.ServerOption{server.WithToolFilter(c.filterTools)}
+}
+
+func (c *Client) access() *AccessConfig {
+	if c.options == nil {
+		return nil
+	}
+	return c.options.Access
+}
+
+// toolList returns the tools listed so far. They are appended while the
+// client connects, which may overlap with requests.
+func (c *Client) toolList() []mcp.Tool {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.tools
+}
+
+func (c *Client) findTool(name string) (mcp.Tool, bool) {
+	for _, tool := range c.toolList() {
+		if tool.Name == name {
+			return tool, true
+		}
+	}
+	return mcp.Tool{}, false
+}
+
+func (c *Client) findPrompt(name string) (mcp.Prompt, bool) {
+	for _, prompt := range c.prompts {
+		if prompt.Name == name {
+			return prompt, true
+		}
+	}
+	return mcp.Prompt{}, false
+}
+
+func (c *Client) hasTool(name string) bool {
+	_, ok := c.findTool(name)
+	return ok
+}
+
+func (c *Client) Close() error {
+	if c.stop != nil {
+		c.stop()
+	}
+	if c.standby != nil {
+		c.standby.close()
+	}
+	c.replicas.close()
+	if c.egress != nil {
+		_ = c.egress.Close()
+	}
+	if mcpClient := c.current(); mcpClient != nil {
+		return mcpClient.Close()
+	}
+	return nil
+}
+
+type Server struct {
+	tokens    []AuthToken
+	mcpServer *server.MCPServer
+	handler   http.Handler
+	// handlerAt serves the same MCP server under another route, since SSE
+	// handlers only answer on the paths they were created for.
+	handlerAt func(route string) http.Handler
+}
+
+func newMCPServer(name string, serverConfig *MCPProxyConfigV2, clientConfig *MCPClientConfigV2, extraOpts ...server.ServerOption) (*Server, error) {
+	serverOpts := []server.ServerOption{
+		server.WithRecovery(),
+	}
+	serverOpts = append(serverOpts, extraOpts...)
+
+	var mcpServer *server.MCPServer
+	var access *AccessConfig
+	var toolCap *ToolCapConfig
+	if clientConfig.Options != nil {
+		access = clientConfig.Options.Access
+		toolCap = clientConfig.Options.ToolCap
+	}
+	serverOpts = append(serverOpts, tokenScopeOptions(func() *server.MCPServer { return mcpServer }, access)...)
+	serverOpts = append(serverOpts, toolCapOptions(toolCap)...)
+	mcpServer = server.NewMCPServer(
+		name,
+		serverConfig.Version,
+		serverOpts...,
+	)
+
+	var handlerAt func(route string) http.Handler
+	switch serverConfig.Type {
+	case MCPServerTypeSSE:
+		handlerAt = func(route string) http.Handler {
+			return server.NewSSEServer(
+				mcpServer,
+				server.WithStaticBasePath(route),
+				server.WithBaseURL(serverConfig.BaseURL),
+			)
+		}
+	case MCPServerTypeStreamable:
+		handler := server.NewStreamableHTTPServer(
+			mcpServer,
+			server.WithStateLess(true),
+		)
+		handlerAt = func(string) http.Handler { return handler }
+	default:
+		return nil, fmt.Errorf("unknown server type: %s", serverConfig.Type)
+	}
+	srv := &Server{
+		mcpServer: mcpServer,
+		handler:   handlerAt(name),
+		handlerAt: handlerAt,
+	}
+
+	if clientConfig.Options != nil && len(clientConfig.Options.AuthTokens) > 0 {
+		srv.tokens = clientConfig.Options.AuthTokens
+	}
+
+	return srv, nil
+}
@@ -0,0 +1,201 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"maps"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// maxTrackedClients caps the distinct client name and version pairs kept,
+// since both are whatever the connecting client claims to be. Later ones
+// are tracked as clientOther.
+const maxTrackedClients = 100
+
+const (
+	clientOther   = "other"
+	clientUnknown = "unknown"
+)
+
+// clientTracker records the clientInfo MCP clients such as Claude, Cursor
+// or the Inspector send in initialize, and attributes tool calls to them
+// through their session.
+type clientTracker struct {
+	mu       sync.Mutex
+	sessions map[string]clientKey
+	clients  map[clientKey]*clientStats
+	metrics  *proxyMetrics
+}
+
+type clientKey struct {
+	name, version string
+}
+
+type clientStats struct {
+	servers   map[string]struct{}
+	sessions  int64
+	calls     int64
+	firstSeen time.Time
+	lastSeen  time.Time
+}
+
+// ClientStatus is the usage of one downstream client as listed by
+// /admin/clients.
+type ClientStatus struct {
+	Name    string   `json:"name"`
+	Version string   `json:"version"`
+	Servers []string `json:"servers"`
+	// Sessions counts initializations, ActiveSessions the sessions still
+	// open. Stateless streamable-http requests hold no session.
+	Sessions       int64     `json:"sessions"`
+	ActiveSessions int       `json:"activeSessions"`
+	Calls          int64     `json:"calls"`
+	FirstSeen      time.Time `json:"firstSeen"`
+	LastSeen       time.Time `json:"lastSeen"`
+}
+
+func newClientTracker(metrics *proxyMetrics) *clientTracker {
+	return &clientTracker{
+		sessions: make(map[string]clientKey),
+		clients:  make(map[clientKey]*clientStats),
+		metrics:  metrics,
+	}
+}
+
+// serverOption hooks the tracker into the MCP server of route.
+func (t *clientTracker) serverOption(route string) server.ServerOption {
+	hooks := &server.Hooks{}
+	hooks.AddAfterInitialize(func(ctx context.Context, _ any, request *mcp.InitializeRequest, _ *mcp.InitializeResult) {
+		t.initialized(ctx, route, request.Params.ClientInfo)
+	})
+	hooks.AddOnUnregisterSession(func(_ context.Context, session server.ClientSession) {
+		t.mu.Lock()
+		defer t.mu.Unlock()
+		delete(t.sessions, session.SessionID())
+	})
+	return server.WithHooks(hooks)
+}
+
+func (t *clientTracker) initialized(ctx context.Context, route string, info mcp.Implementation) {
+	now := time.Now()
+	t.mu.Lock()
+	key := t.keyFor(info)
+	stats, ok := t.clients[key]
+	if !ok {
+		stats = &clientStats{servers: make(map[string]struct{}), firstSeen: now}
+		t.clients[key] = stats
+	}
+	stats.servers[route] = struct{}{}
+	stats.sessions++
+	stats.lastSeen = now
+	sessionID := ""
+	if session := server.ClientSessionFromContext(ctx); session != nil {
+		sessionID = session.SessionID()
+	}
+	if sessionID != "" {
+		t.sessions[sessionID] = key
+	}
+	t.mu.Unlock()
+	t.metrics.recordClientSession(route, key.name, key.version)
+	log.Printf("<%s> Client %s %s initialized", route, key.name, key.version)
+}
+
+// keyFor normalizes info into a bounded key. t.mu must be held.
+func (t *clientTracker) keyFor(info mcp.Implementation) clientKey {
+	key := clientKey{name: clientLabel(info.Name), version: clientLabel(info.Version)}
+	if key.name == "" {
+		key.name = clientUnknown
+	}
+	if _, ok := t.clients[key]; !ok && len(t.clients) >= maxTrackedClients {
+		return clientKey{name: clientOther}
+	}
+	return key
+}
+
+// clientLabel trims a client-chosen string to something safe to log and
+// use as a label.
+func clientLabel(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r < 0x20 || r == 0x7f {
+			return -1
+		}
+		return r
+	}, strings.TrimSpace(s))
+	if len(s) > 64 {
+		s = strings.ToValidUTF8(s[:64], "")
+	}
+	return s
+}
+
+// fromContext returns the client behind the session of ctx. Calls without
+// a known session, such as REST API and stateless streamable-http calls,
+// are clientUnknown.
+func (t *clientTracker) fromContext(ctx context.Context) clientKey {
+	if t != nil {
+		if session := server.ClientSessionFromContext(ctx); session != nil {
+			t.mu.Lock()
+			key, ok := t.sessions[session.SessionID()]
+			t.mu.Unlock()
+			if ok {
+				return key
+			}
+		}
+	}
+	return clientKey{name: clientUnknown}
+}
+
+// String names the client as name/version for logs.
+func (k clientKey) String() string {
+	if k.version == "" {
+		return k.name
+	}
+	return k.name + "/" + k.version
+}
+
+// countCalls attributes the tool calls of next to the calling client.
+func (t *clientTracker) countCalls(next ToolCallFunc) ToolCallFunc {
+	return func(ctx context.Context, serverName string, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		key := t.fromContext(ctx)
+		t.mu.Lock()
+		if stats, ok := t.clients[key]; ok {
+			stats.calls++
+			stats.lastSeen = time.Now()
+		}
+		t.mu.Unlock()
+		t.metrics.recordClientCall(serverName, key.name, key.version)
+		return next(ctx, serverName, request)
+	}
+}
+
+// list reports every client seen since startup, most recently seen first.
+func (t *clientTracker) list() []ClientStatus {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	active := make(map[clientKey]int)
+	for _, key := range t.sessions {
+		active[key]++
+	}
+	clients := make([]ClientStatus, 0, len(t.clients))
+	for key, stats := range t.clients {
+		clients = append(clients, ClientStatus{
+			Name:           key.name,
+			Version:        key.version,
+			Servers:        slices.Sorted(maps.Keys(stats.servers)),
+			Sessions:       stats.sessions,
+			ActiveSessions: active[key],
+			Calls:          stats.calls,
+			FirstSeen:      stats.firstSeen,
+			LastSeen:       stats.lastSeen,
+		})
+	}
+	slices.SortFunc(clients, func(a, b ClientStatus) int {
+		return b.LastSeen.Compare(a.LastSeen)
+	})
+	return clients
+}
@@ -0,0 +1,399 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	defaultClusterPrefix   = "mcp-proxy"
+	defaultClusterInterval = 5 * time.Second
+	// clusterNodeTTL is how many intervals a node that stopped publishing
+	// is still counted.
+	clusterNodeTTL = 3
+	// clusterWriteTimeout bounds the Redis writes made while handling a
+	// request.
+	clusterWriteTimeout = 2 * time.Second
+	// clusterRateLimitTimeout bounds taking a token from a shared bucket,
+	// which every request to a server with maxRequestsPerMinute waits for.
+	clusterRateLimitTimeout = 250 * time.Millisecond
+)
+
+// clusterNode is the state a node publishes under <prefix>:node:<node>.
+type clusterNode struct {
+	Node    string                   `json:"node"`
+	Version string                   `json:"version"`
+	Started time.Time                `json:"started"`
+	Updated time.Time                `json:"updated"`
+	Servers map[string]clusterServer `json:"servers"`
+}
+
+// clusterServer is a node's view of one of its servers.
+type clusterServer struct {
+	Healthy             bool   `json:"healthy"`
+	ConsecutiveFailures int    `json:"consecutiveFailures"`
+	LastError           string `json:"lastError,omitempty"`
+	Maintenance         bool   `json:"maintenance"`
+}
+
+// maintenanceChange is published when a node switches maintenance mode.
+type maintenanceChange struct {
+	Node    string `json:"node"`
+	Server  string `json:"server"`
+	Enabled bool   `json:"enabled"`
+}
+
+// cluster shares state between proxies behind a load balancer through
+// Redis. Every node publishes the health of its servers and reads that of
+// the others, so that /status and /admin/cluster answer the same on every
+// node, and maintenance mode switched on one node applies to all of them.
+type cluster struct {
+	rdb      *redis.Client
+	node     string
+	prefix   string
+	interval time.Duration
+	registry *clientRegistry
+	started  time.Time
+	// rateLimits enforces maxRequestsPerMinute across the cluster.
+	rateLimits bool
+
+	mu    sync.RWMutex
+	nodes map[string]clusterNode
+	// maintenanceMu keeps a sync from reverting a change this node is
+	// still writing to Redis.
+	maintenanceMu sync.Mutex
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+}
+
+func newCluster(conf *ClusterConfig, registry *clientRegistry) (*cluster, error) {
+	options, err := redis.ParseURL(conf.Redis)
+	if err != nil {
+		return nil, err
+	}
+	c := &cluster{
+		rdb:        redis.NewClient(options),
+		node:       conf.Node,
+		prefix:     conf.Prefix,
+		interval:   conf.Interval,
+		registry:   registry,
+		started:    time.Now(),
+		rateLimits: conf.RateLimits,
+		nodes:      make(map[string]clusterNode),
+	}
+	if c.node == "" {
+		if c.node, err = os.Hostname(); err != nil {
+			return nil, err
+		}
+	}
+	if c.prefix == "" {
+		c.prefix = defaultClusterPrefix
+	}
+	if c.interval <= 0 {
+		c.interval = defaultClusterInterval
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	return c, nil
+}
+
+func (c *cluster) key(parts ...string) string {
+	return c.prefix + ":" + strings.Join(parts, ":")
+}
+
+// start publishes the node's state every interval and follows maintenance
+// changes of the other nodes. Redis being down is logged, not fatal: the
+// node keeps serving with its own state and catches up once it is back.
+func (c *cluster) start() {
+	if c == nil {
+		return
+	}
+	sub := c.rdb.Subscribe(c.ctx, c.key("maintenance"))
+	c.wg.Add(2)
+	go func() {
+		defer c.wg.Done()
+		defer sub.Close()
+		messages := sub.Channel()
+		for {
+			select {
+			case <-c.ctx.Done():
+				return
+			case msg := <-messages:
+				var change maintenanceChange
+				if err := json.Unmarshal([]byte(msg.Payload), &change); err != nil || change.Node == c.node {
+					continue
+				}
+				if client, ok := c.registry.get(change.Server); ok {
+					c.maintenanceMu.Lock()
+					c.applyMaintenance(change.Server, client, change.Enabled, change.Node)
+					c.maintenanceMu.Unlock()
+				}
+			}
+		}
+	}()
+	go func() {
+		defer c.wg.Done()
+		ticker := time.NewTicker(c.interval)
+		defer ticker.Stop()
+		healthy := true
+		for {
+			err := c.sync()
+			switch {
+			case err != nil && healthy && c.ctx.Err() == nil:
+				log.Printf("Failed to sync cluster state with Redis: %v", err)
+			case err == nil && !healthy:
+				log.Printf("Cluster state synced with Redis again")
+			}
+			healthy = err == nil
+			select {
+			case <-c.ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	log.Printf("Joined cluster as node %s", c.node)
+}
+
+// sync publishes this node's state, reads that of every node, and brings
+// maintenance mode in line with the cluster's, in case a change was
+// published while this node was not listening.
+func (c *cluster) sync() error {
+	ctx, cancel := context.WithTimeout(c.ctx, c.interval)
+	defer cancel()
+	self := c.localState()
+	data, err := json.Marshal(self)
+	if err != nil {
+		return err
+	}
+	if err = c.rdb.Set(ctx, c.key("node", c.node), data, clusterNodeTTL*c.interval).Err(); err != nil {
+		return err
+	}
+	var keys []string
+	iter := c.rdb.Scan(ctx, 0, c.key("node", "*"), 100).Iterator()
+	for iter.Next(ctx) {
+		keys = append(keys, iter.Val())
+	}
+	if err = iter.Err(); err != nil {
+		return err
+	}
+	nodes := map[string]clusterNode{c.node: self}
+	if len(keys) > 0 {
+		values, mErr := c.rdb.MGet(ctx, keys...).Result()
+		if mErr != nil {
+			return mErr
+		}
+		for _, value := range values {
+			raw, ok := value.(string)
+			if !ok {
+				continue
+			}
+			var node clusterNode
+			if json.Unmarshal([]byte(raw), &node) != nil || node.Node == c.node {
+				continue
+			}
+			// The TTL removes nodes that are gone; this also covers clock
+			// jumps and Redis servers that expire keys lazily.
+			if time.Since(node.Updated) > clusterNodeTTL*c.interval {
+				continue
+			}
+			nodes[node.Node] = node
+		}
+	}
+	c.mu.Lock()
+	c.nodes = nodes
+	c.mu.Unlock()
+
+	c.maintenanceMu.Lock()
+	defer c.maintenanceMu.Unlock()
+	maintenance, err := c.rdb.HGetAll(ctx, c.key("maintenance")).Result()
+	if err != nil {
+		return err
+	}
+	for _, name := range c.registry.names() {
+		if client, ok := c.registry.get(name); ok {
+			c.applyMaintenance(name, client, maintenance[name] != "", "")
+		}
+	}
+	return nil
+}
+
+func (c *cluster) localState() clusterNode {
+	node := clusterNode{
+		Node:    c.node,
+		Version: BuildVersion,
+		Started: c.started,
+		Updated: time.Now(),
+		Servers: make(map[string]clusterServer),
+	}
+	for _, name := range c.registry.names() {
+		client, ok := c.registry.get(name)
+		if !ok {
+			continue
+		}
+		health := client.health.status()
+		node.Servers[name] = clusterServer{
+			Healthy:             health.Healthy,
+			ConsecutiveFailures: health.ConsecutiveFailures,
+			LastError:           health.LastError,
+			Maintenance:         client.maintenance.Load(),
+		}
+	}
+	return node
+}
+
+// applyMaintenance switches maintenance mode as another node did, without
+// publishing it again. from is empty when the change was missed and is
+// caught up on by sync.
+func (c *cluster) applyMaintenance(name string, client *Client, enabled bool, from string) {
+	if client.maintenance.Swap(enabled) == enabled {
+		return
+	}
+	if from == "" {
+		from = "the cluster"
+	} else {
+		from = "node " + from
+	}
+	if enabled {
+		log.Printf("<%s> Entering maintenance mode, set by %s", name, from)
+	} else {
+		log.Printf("<%s> Leaving maintenance mode, set by %s", name, from)
+	}
+}
+
+// setMaintenance switches maintenance mode of a server of this node,
+// reports whether it changed, and shares the change with the other nodes.
+// When Redis cannot be reached the change only applies here, and the next
+// sync with Redis reverts it.
+func (c *cluster) setMaintenance(name string, client *Client, enabled bool) bool {
+	c.maintenanceMu.Lock()
+	defer c.maintenanceMu.Unlock()
+	if client.maintenance.Swap(enabled) == enabled {
+		return false
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, clusterWriteTimeout)
+	defer cancel()
+	var err error
+	if enabled {
+		err = c.rdb.HSet(ctx, c.key("maintenance"), name, c.node).Err()
+	} else {
+		err = c.rdb.HDel(ctx, c.key("maintenance"), name).Err()
+	}
+	if err == nil {
+		data, _ := json.Marshal(maintenanceChange{Node: c.node, Server: name, Enabled: enabled})
+		err = c.rdb.Publish(ctx, c.key("maintenance"), data).Err()
+	}
+	if err != nil {
+		log.Printf("<%s> Failed to share maintenance mode with the cluster: %v", name, err)
+	}
+	return true
+}
+
+// restoreMaintenance puts a server that just connected into maintenance
+// mode if the cluster has it there.
+func (c *cluster) restoreMaintenance(name string, client *Client) {
+	if c == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(c.ctx, clusterWriteTimeout)
+	defer cancel()
+	c.maintenanceMu.Lock()
+	defer c.maintenanceMu.Unlock()
+	from, err := c.rdb.HGet(ctx, c.key("maintenance"), name).Result()
+	if err != nil {
+		return
+	}
+	c.applyMaintenance(name, client, true, from)
+}
+
+// rateLimitScript takes a token from a bucket kept in a Redis hash, so that
+// every node takes from the same one. It returns whether a token was taken
+// and, if not, the milliseconds until one is available. The bucket expires
+// once it would be full again.
+var rateLimitScript = redis.NewScript(`
+local capacity = tonumber(ARGV[1])
+local rate = tonumber(ARGV[2])
+local now = tonumber(ARGV[3])
+local bucket = redis.call('HMGET', KEYS[1], 'tokens', 'last')
+local tokens = tonumber(bucket[1]) or capacity
+local last = tonumber(bucket[2]) or now
+tokens = math.min(capacity, tokens + math.max(0, now - last) * rate)
+local taken, wait = 0, 0
+if tokens >= 1 then
+	tokens = tokens - 1
+	taken = 1
+else
+	wait = math.ceil((1 - tokens) / rate)
+end
+redis.call('HSET', KEYS[1], 'tokens', tostring(tokens), 'last', now)
+redis.call('PEXPIRE', KEYS[1], math.ceil(capacity / rate) + 1000)
+return {taken, wait}
+`)
+
+// takeToken takes a token from the bucket the cluster shares for server,
+// which holds perMinute tokens and refills over a minute.
+func (c *cluster) takeToken(server string, perMinute int, now time.Time) (bool, time.Duration, error) {
+	ctx, cancel := context.WithTimeout(c.ctx, clusterRateLimitTimeout)
+	defer cancel()
+	perMillisecond := float64(perMinute) / float64(time.Minute/time.Millisecond)
+	result, err := rateLimitScript.Run(ctx, c.rdb, []string{c.key("ratelimit", server)},
+		perMinute, strconv.FormatFloat(perMillisecond, 'g', -1, 64), now.UnixMilli()).Int64Slice()
+	if err != nil {
+		return false, 0, err
+	}
+	if len(result) != 2 {
+		return false, 0, fmt.Errorf("unexpected rate limit reply %v", result)
+	}
+	return result[0] == 1, time.Duration(result[1]) * time.Millisecond, nil
+}
+
+// snapshot returns the nodes as last read from Redis, sorted by name.
+func (c *cluster) snapshot() []clusterNode {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	nodes := make([]clusterNode, 0, len(c.nodes))
+	for _, name := range slices.Sorted(maps.Keys(c.nodes)) {
+		nodes = append(nodes, c.nodes[name])
+	}
+	return nodes
+}
+
+// unhealthyNodes returns the nodes that report server as unhealthy.
+func (c *cluster) unhealthyNodes(server string) []string {
+	if c == nil {
+		return nil
+	}
+	var unhealthy []string
+	for _, node := range c.snapshot() {
+		if status, ok := node.Servers[server]; ok && !status.Healthy {
+			unhealthy = append(unhealthy, node.Node)
+		}
+	}
+	return unhealthy
+}
+
+// Close leaves the cluster, removing the node's state so the others stop
+// counting it right away.
+func (c *cluster) Close() error {
+	if c == nil {
+		return nil
+	}
+	c.cancel()
+	c.wg.Wait()
+	ctx, cancel := context.WithTimeout(context.Background(), clusterWriteTimeout)
+	defer cancel()
+	_ = c.rdb.Del(ctx, c.key("node", c.node)).Err()
+	return c.rdb.Close()
+}
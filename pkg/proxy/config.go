@@ -0,0 +1,1670 @@
+package proxy
+
+import (
+	"cmp"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	nethttp "net/http"
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/go-sphere/confstore"
+	"github.com/go-sphere/confstore/codec"
+	"github.com/go-sphere/confstore/provider"
+	"github.com/go-sphere/confstore/provider/file"
+	"github.com/go-sphere/confstore/provider/http"
+	"github.com/tbxark/optional-go"
+)
+
+type StdioMCPClientConfig struct {
+	Command    string            `json:"command"`
+	Env        map[string]string `json:"env"`
+	Args       []string          `json:"args"`
+	InheritEnv *EnvInheritance   `json:"inheritEnv,omitempty"`
+	EnvDeny    []string          `json:"envDeny,omitempty"`
+	Cwd        string            `json:"cwd,omitempty"`
+	ExtraPath  []string          `json:"extraPath,omitempty"`
+	Egress     *EgressConfig     `json:"egress,omitempty"`
+}
+
+// EgressConfig limits the hosts a stdio server reaches through the proxy
+// variables it is started with. Allow holds host names, "*.domain"
+// wildcards, IP addresses and CIDR ranges.
+type EgressConfig struct {
+	Allow []string `json:"allow"`
+}
+
+// EnvInheritance controls which variables of the proxy's own environment a
+// stdio server inherits: true (the default) passes everything, false
+// nothing, and a list passes only the named variables. Names ending in *
+// match by prefix.
+type EnvInheritance struct {
+	All   bool
+	Names []string
+}
+
+func (e *EnvInheritance) UnmarshalJSON(data []byte) error {
+	var all bool
+	if err := json.Unmarshal(data, &all); err == nil {
+		e.All, e.Names = all, nil
+		return nil
+	}
+	var names []string
+	if err := json.Unmarshal(data, &names); err != nil {
+		return errors.New("inheritEnv must be a boolean or a list of variable names")
+	}
+	e.All, e.Names = false, names
+	return nil
+}
+
+func (e EnvInheritance) MarshalJSON() ([]byte, error) {
+	if e.Names != nil {
+		return json.Marshal(e.Names)
+	}
+	return json.Marshal(e.All)
+}
+
+type SSEMCPClientConfig struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+}
+
+type StreamableMCPClientConfig struct {
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers"`
+	Timeout time.Duration     `json:"timeout"`
+}
+
+type StaticMCPClientConfig struct {
+	Root    string `json:"root"`
+	Prompts string `json:"prompts"`
+}
+
+type FetchConfig struct {
+	AllowedDomains []string      `json:"allowedDomains,omitempty"`
+	AllowPrivate   bool          `json:"allowPrivate,omitempty"`
+	MaxBytes       int64         `json:"maxBytes,omitempty"`
+	Timeout        time.Duration `json:"timeout,omitempty"`
+}
+
+type BuiltinMCPClientConfig struct {
+	Name  string       `json:"name"`
+	Fetch *FetchConfig `json:"fetch"`
+}
+
+type MCPClientType string
+
+const (
+	MCPClientTypeStdio      MCPClientType = "stdio"
+	MCPClientTypeSSE        MCPClientType = "sse"
+	MCPClientTypeStreamable MCPClientType = "streamable-http"
+	MCPClientTypeStatic     MCPClientType = "static"
+)
+
+type MCPServerType string
+
+const (
+	MCPServerTypeSSE        MCPServerType = "sse"
+	MCPServerTypeStreamable MCPServerType = "streamable-http"
+)
+
+// ---- V2 ----
+
+type ToolFilterMode string
+
+const (
+	ToolFilterModeAllow ToolFilterMode = "allow"
+	ToolFilterModeBlock ToolFilterMode = "block"
+)
+
+type ToolFilterConfig struct {
+	Mode ToolFilterMode `json:"mode,omitempty"`
+	List []string       `json:"list,omitempty"`
+}
+
+type ScheduleConfig struct {
+	Enable   []string `json:"enable,omitempty"`
+	Disable  []string `json:"disable,omitempty"`
+	Timezone string   `json:"timezone,omitempty"`
+}
+
+// AuthToken is an entry of authTokens. A plain string grants full access;
+// the object form scopes the token to some servers and tools, or to tools
+// annotated as read-only.
+type AuthToken struct {
+	Token    string   `json:"token"`
+	Name     string   `json:"name,omitempty"`
+	Servers  []string `json:"servers,omitempty"`
+	Tools    []string `json:"tools,omitempty"`
+	ReadOnly bool     `json:"readOnly,omitempty"`
+	Groups   []string `json:"groups,omitempty"`
+}
+
+func (t *AuthToken) UnmarshalJSON(data []byte) error {
+	var token string
+	if err := json.Unmarshal(data, &token); err == nil {
+		*t = AuthToken{Token: token}
+		return nil
+	}
+	type plain AuthToken
+	var entry plain
+	if err := json.Unmarshal(data, &entry); err != nil {
+		return err
+	}
+	if entry.Token == "" {
+		return errors.New("authTokens entry requires a token")
+	}
+	*t = AuthToken(entry)
+	return nil
+}
+
+func (t AuthToken) MarshalJSON() ([]byte, error) {
+	if t.Name == "" && t.Servers == nil && t.Tools == nil && !t.ReadOnly && t.Groups == nil {
+		return json.Marshal(t.Token)
+	}
+	type plain AuthToken
+	return json.Marshal(plain(t))
+}
+
+func newAuthTokens(tokens ...string) []AuthToken {
+	if tokens == nil {
+		return nil
+	}
+	authTokens := make([]AuthToken, 0, len(tokens))
+	for _, token := range tokens {
+		authTokens = append(authTokens, AuthToken{Token: token})
+	}
+	return authTokens
+}
+
+// AccessRule lists the users and groups allowed to do something. An empty
+// rule allows everyone.
+type AccessRule struct {
+	Users  []string `json:"users,omitempty"`
+	Groups []string `json:"groups,omitempty"`
+}
+
+type AccessConfig struct {
+	AccessRule
+	Tools map[string]AccessRule `json:"tools,omitempty"`
+}
+
+// IPFilterConfig lists client addresses or CIDR ranges and, with
+// mcpProxy.geoip, ISO country codes. Blocks win over allows; without any
+// allow every address not blocked is admitted.
+type IPFilterConfig struct {
+	Allow          []string `json:"allow,omitempty"`
+	Block          []string `json:"block,omitempty"`
+	AllowCountries []string `json:"allowCountries,omitempty"`
+	BlockCountries []string `json:"blockCountries,omitempty"`
+}
+
+// HoneypotConfig declares decoy tokens and tools. Nobody legitimate uses
+// them, so every use raises an alert.
+type HoneypotConfig struct {
+	Tokens []string             `json:"tokens,omitempty"`
+	Tools  []HoneypotToolConfig `json:"tools,omitempty"`
+	// Webhook receives every alert as a JSON POST.
+	Webhook string `json:"webhook,omitempty"`
+	// AutoBlock puts the caller's address, bearer token and identity on the
+	// block list, for BlockFor or, when it is zero, until removed.
+	AutoBlock bool          `json:"autoBlock,omitempty"`
+	BlockFor  time.Duration `json:"blockFor,omitempty"`
+}
+
+type HoneypotToolConfig struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// Servers lists the servers that offer the tool; empty means all.
+	Servers []string `json:"servers,omitempty"`
+}
+
+type GeoIPConfig struct {
+	// Database is a MaxMind GeoIP2 or GeoLite2 Country or City database.
+	Database string `json:"database"`
+}
+
+type HealthCheckConfig struct {
+	Interval         time.Duration  `json:"interval,omitempty"`
+	Timeout          time.Duration  `json:"timeout,omitempty"`
+	Tool             string         `json:"tool,omitempty"`
+	Arguments        map[string]any `json:"arguments,omitempty"`
+	FailureThreshold int            `json:"failureThreshold,omitempty"`
+}
+
+type OptionsV2 struct {
+	PanicIfInvalid optional.Field[bool] `json:"panicIfInvalid,omitzero"`
+	LogEnabled     optional.Field[bool] `json:"logEnabled,omitzero"`
+	AuthTokens     []AuthToken          `json:"authTokens,omitempty"`
+	ToolFilter     *ToolFilterConfig    `json:"toolFilter,omitempty"`
+	Disabled       bool                 `json:"disabled,omitempty"`
+	Schedule       *ScheduleConfig      `json:"schedule,omitempty"`
+	Standby        int                  `json:"standby,omitempty"`
+	HealthCheck    *HealthCheckConfig   `json:"healthCheck,omitempty"`
+	Access         *AccessConfig        `json:"access,omitempty"`
+	IPFilter       *IPFilterConfig      `json:"ipFilter,omitempty"`
+	// SlowCallThreshold logs tool calls that take at least this long.
+	SlowCallThreshold time.Duration    `json:"slowCallThreshold,omitempty"`
+	SizeAlert         *SizeAlertConfig `json:"sizeAlert,omitempty"`
+	TraceWire         *TraceWireConfig `json:"traceWire,omitempty"`
+	// Conformance checks upstream results against the MCP spec.
+	Conformance ConformanceMode `json:"conformance,omitempty"`
+	// ValidateArguments checks tool call arguments against the tool's input
+	// schema before forwarding the call.
+	ValidateArguments optional.Field[bool] `json:"validateArguments,omitzero"`
+	// ValidateOutput checks structured tool results against the tool's
+	// output schema.
+	ValidateOutput ConformanceMode `json:"validateOutput,omitempty"`
+	// BinaryContent decides what happens to images, audio and blobs in
+	// tool results.
+	BinaryContent *BinaryContentConfig `json:"binaryContent,omitempty"`
+	// OffloadResults moves large results to mcpProxy.resultStore.
+	OffloadResults *OffloadResultsConfig `json:"offloadResults,omitempty"`
+	// ToolCap limits how many tools the route lists at once.
+	ToolCap *ToolCapConfig `json:"toolCap,omitempty"`
+	// WaitForClients delays listening until the servers are connected. It
+	// is only read from mcpProxy.options.
+	WaitForClients WaitForClientsMode `json:"waitForClients,omitempty"`
+	// MaxSessions caps the sessions open on the server at once. Streamable
+	// HTTP routes are stateless, so there it caps the requests in progress.
+	MaxSessions int `json:"maxSessions,omitempty"`
+	// MaxRequestsPerMinute caps the requests the server receives.
+	MaxRequestsPerMinute int `json:"maxRequestsPerMinute,omitempty"`
+	// MaxBytesPerSecond caps the bandwidth of the responses the server's
+	// routes send.
+	MaxBytesPerSecond int `json:"maxBytesPerSecond,omitempty"`
+}
+
+type WaitForClientsMode string
+
+const (
+	// WaitForClientsAll listens once every server has connected or failed
+	// to, and virtual servers and profiles are mounted.
+	WaitForClientsAll WaitForClientsMode = "all"
+	// WaitForClientsAny listens once the first server has connected.
+	WaitForClientsAny WaitForClientsMode = "any"
+	// WaitForClientsNone listens right away, as servers connect.
+	WaitForClientsNone WaitForClientsMode = "none"
+)
+
+type ConformanceMode string
+
+const (
+	// ConformanceModeLog logs nonconforming upstream results and passes
+	// them on.
+	ConformanceModeLog ConformanceMode = "log"
+	// ConformanceModeReject replaces nonconforming upstream results with a
+	// JSON-RPC error.
+	ConformanceModeReject ConformanceMode = "reject"
+)
+
+// TraceWireConfig logs every JSON-RPC message exchanged with an upstream.
+// Tracing can also be switched on and off at runtime through the admin API.
+type TraceWireConfig struct {
+	Enabled bool `json:"enabled"`
+	// RedactKeys are the object keys whose values are hidden, matched
+	// without regard to case. They replace the default list.
+	RedactKeys []string `json:"redactKeys,omitempty"`
+	// RedactPatterns are regular expressions whose matches are hidden in
+	// every string.
+	RedactPatterns []string `json:"redactPatterns,omitempty"`
+	// MaxBytes truncates logged messages, 4096 by default.
+	MaxBytes int `json:"maxBytes,omitempty"`
+}
+
+type BinaryContentMode string
+
+const (
+	BinaryContentModePassthrough BinaryContentMode = "passthrough"
+	// BinaryContentModeStrip replaces binary content with a text
+	// placeholder giving its type and size.
+	BinaryContentModeStrip BinaryContentMode = "strip"
+	// BinaryContentModeOffload replaces binary content with a signed,
+	// expiring URL under which the proxy serves it.
+	BinaryContentModeOffload BinaryContentMode = "offload"
+)
+
+// BinaryContentConfig is the policy for image, audio and embedded blob
+// content in tool results.
+type BinaryContentConfig struct {
+	Mode BinaryContentMode `json:"mode,omitempty"`
+	// Types limits the policy to image, audio or resource content; all
+	// three by default.
+	Types []string `json:"types,omitempty"`
+	// MinBytes leaves content smaller than this, decoded, untouched.
+	MinBytes int `json:"minBytes,omitempty"`
+	// TTL is how long offloaded content can be downloaded, one hour by
+	// default.
+	TTL time.Duration `json:"ttl,omitempty"`
+}
+
+type ToolCapMode string
+
+const (
+	// ToolCapModePaginate splits tools/list into pages of Limit tools.
+	ToolCapModePaginate ToolCapMode = "paginate"
+	// ToolCapModeRank lists only the Limit most recently called tools.
+	ToolCapModeRank ToolCapMode = "rank"
+)
+
+// ToolCapConfig keeps tool listings short for clients that break or choose
+// badly with hundreds of tools.
+type ToolCapConfig struct {
+	Limit int         `json:"limit"`
+	Mode  ToolCapMode `json:"mode,omitempty"`
+}
+
+// OffloadResultsConfig uploads the content of tool results of at least
+// MinBytes, JSON encoded, and sends resource links in its place.
+type OffloadResultsConfig struct {
+	MinBytes int `json:"minBytes"`
+}
+
+const (
+	ResultStoreLocal = "local"
+	ResultStoreS3    = "s3"
+)
+
+// ResultStoreConfig is where options.offloadResults puts large results.
+type ResultStoreConfig struct {
+	// Type is local or s3.
+	Type string         `json:"type"`
+	Dir  string         `json:"dir,omitempty"`
+	S3   *S3StoreConfig `json:"s3,omitempty"`
+	// TTL is how long links to offloaded results are valid, 24 hours by
+	// default.
+	TTL time.Duration `json:"ttl,omitempty"`
+	// SigningKey signs the links so they stay valid across restarts; a
+	// random key is used when it is empty.
+	SigningKey string `json:"signingKey,omitempty"`
+}
+
+// S3StoreConfig is an S3 compatible bucket, e.g. on AWS or MinIO. Without
+// AccessKeyID the AWS_* environment variables are used.
+type S3StoreConfig struct {
+	// Endpoint defaults to AWS S3 in Region.
+	Endpoint string `json:"endpoint,omitempty"`
+	Region   string `json:"region,omitempty"`
+	Bucket   string `json:"bucket"`
+	Prefix   string `json:"prefix,omitempty"`
+	// PathStyle addresses the bucket in the path instead of the host
+	// name, as MinIO usually needs.
+	PathStyle       bool   `json:"pathStyle,omitempty"`
+	AccessKeyID     string `json:"accessKeyId,omitempty"`
+	SecretAccessKey string `json:"secretAccessKey,omitempty"`
+	SessionToken    string `json:"sessionToken,omitempty"`
+}
+
+// SizeAlertConfig raises an alert when a tool result is larger than
+// MaxResultBytes, or Factor times the tool's recent average.
+type SizeAlertConfig struct {
+	MaxResultBytes int     `json:"maxResultBytes,omitempty"`
+	Factor         float64 `json:"factor,omitempty"`
+}
+
+type APIConfig struct {
+	Enabled   bool `json:"enabled"`
+	OpenAI    bool `json:"openai,omitempty"`
+	LangChain bool `json:"langchain,omitempty"`
+	A2A       bool `json:"a2a,omitempty"`
+	// Async lets callers queue tool calls with ?async=1.
+	Async *AsyncCallConfig `json:"async,omitempty"`
+}
+
+// AsyncCallConfig keeps REST tool calls made with ?async=1 in a SQLite
+// database and retries those that fail for transient reasons.
+type AsyncCallConfig struct {
+	Database    string        `json:"database"`
+	MaxAttempts int           `json:"maxAttempts,omitempty"`
+	RetryDelay  time.Duration `json:"retryDelay,omitempty"`
+	Workers     int           `json:"workers,omitempty"`
+	Retention   time.Duration `json:"retention,omitempty"`
+}
+
+type AdminConfig struct {
+	Enabled    bool     `json:"enabled"`
+	AuthTokens []string `json:"authTokens,omitempty"`
+	// GRPC also serves the admin API over gRPC, on a listener of its own.
+	GRPC *AdminGRPCConfig `json:"grpc,omitempty"`
+}
+
+type AdminGRPCConfig struct {
+	Addr     string `json:"addr"`
+	CertFile string `json:"certFile,omitempty"`
+	KeyFile  string `json:"keyFile,omitempty"`
+}
+
+// AnalyticsConfig sets how /admin/analytics decides a tool is unused.
+type AnalyticsConfig struct {
+	// Window is how long a tool must go without calls to count as unused.
+	Window time.Duration `json:"window,omitempty"`
+	// File keeps the usage across restarts; it is only recorded in memory
+	// otherwise.
+	File string `json:"file,omitempty"`
+}
+
+type MetricsConfig struct {
+	Enabled    bool     `json:"enabled"`
+	AuthTokens []string `json:"authTokens,omitempty"`
+	// IdentityLabels adds a series per hashed caller identity, up to
+	// MaxPrincipals of them.
+	IdentityLabels bool `json:"identityLabels,omitempty"`
+	MaxPrincipals  int  `json:"maxPrincipals,omitempty"`
+	// StatsD pushes the same metrics to a statsd or DogStatsD agent, with
+	// or without Enabled.
+	StatsD *StatsDConfig `json:"statsd,omitempty"`
+}
+
+// collecting reports whether metrics are exported in any way.
+func (c *MetricsConfig) collecting() bool {
+	return c != nil && (c.Enabled || c.StatsD != nil)
+}
+
+type StatsDConfig struct {
+	// Address is the agent's UDP host:port.
+	Address string `json:"address"`
+	// Flavor is dogstatsd (the default), which sends labels as tags, or
+	// statsd, which appends them to the metric name.
+	Flavor string `json:"flavor,omitempty"`
+	Prefix string `json:"prefix,omitempty"`
+	// Tags are added to every metric; DogStatsD only.
+	Tags map[string]string `json:"tags,omitempty"`
+	// TagNames renames labels, for example server to mcp_server.
+	TagNames      map[string]string `json:"tagNames,omitempty"`
+	FlushInterval time.Duration     `json:"flushInterval,omitempty"`
+}
+
+type HMACCallerConfig struct {
+	ID       string   `json:"id"`
+	Secret   string   `json:"secret"`
+	Servers  []string `json:"servers,omitempty"`
+	Tools    []string `json:"tools,omitempty"`
+	ReadOnly bool     `json:"readOnly,omitempty"`
+}
+
+type HMACConfig struct {
+	Enabled bool               `json:"enabled"`
+	Callers []HMACCallerConfig `json:"callers,omitempty"`
+	MaxSkew time.Duration      `json:"maxSkew,omitempty"`
+}
+
+type AuthMode string
+
+const (
+	AuthModeBasic       AuthMode = "basic"
+	AuthModeProxyHeader AuthMode = "proxy-header"
+)
+
+type AuthConfig struct {
+	Mode           AuthMode          `json:"mode"`
+	Users          map[string]string `json:"users,omitempty"`
+	Header         string            `json:"header,omitempty"`
+	GroupsHeader   string            `json:"groupsHeader,omitempty"`
+	TrustedProxies []string          `json:"trustedProxies,omitempty"`
+	// InsecureTrustAnyClient accepts the proxy-header identity from any
+	// client when TrustedProxies is empty, for deployments that are only
+	// reachable through the SSO proxy.
+	InsecureTrustAnyClient bool `json:"insecureTrustAnyClient,omitempty"`
+}
+
+type APIKeysConfig struct {
+	Enabled bool   `json:"enabled"`
+	File    string `json:"file"`
+}
+
+type PinConfig struct {
+	Version   string `json:"version"`
+	Integrity string `json:"integrity,omitempty"`
+}
+
+// BlocklistConfig enables the block list of tokens, identities and client
+// addresses managed through the admin API, kept in File.
+type BlocklistConfig struct {
+	Enabled bool   `json:"enabled"`
+	File    string `json:"file"`
+}
+
+// UpstreamSigningConfig describes the JWT the proxy attaches to requests to
+// servers with signRequests set. Secret selects HS256; otherwise KeyFile is
+// a PEM RSA, P-256 or Ed25519 private key.
+type UpstreamSigningConfig struct {
+	Issuer  string        `json:"issuer"`
+	Secret  string        `json:"secret,omitempty"`
+	KeyFile string        `json:"keyFile,omitempty"`
+	KeyID   string        `json:"keyId,omitempty"`
+	Header  string        `json:"header,omitempty"`
+	TTL     time.Duration `json:"ttl,omitempty"`
+}
+
+// WorkloadIdentityConfig points at the X.509 SVID and trust bundle the
+// proxy presents to and verifies upstreams with when they set mtls.
+type WorkloadIdentityConfig struct {
+	CertFile       string        `json:"certFile"`
+	KeyFile        string        `json:"keyFile"`
+	BundleFile     string        `json:"bundleFile"`
+	ReloadInterval time.Duration `json:"reloadInterval,omitempty"`
+}
+
+// UpstreamMTLSConfig connects to a server with the proxy's workload
+// identity. SPIFFEIDs restricts the identities the server may present.
+type UpstreamMTLSConfig struct {
+	SPIFFEIDs []string `json:"spiffeIds,omitempty"`
+}
+
+// CallHistoryConfig records tool calls in a SQLite database for the admin
+// API. Results larger than MaxResultBytes are not stored; -1 stores all.
+type CallHistoryConfig struct {
+	Database       string        `json:"database"`
+	Retention      time.Duration `json:"retention,omitempty"`
+	MaxResultBytes int           `json:"maxResultBytes,omitempty"`
+}
+
+// HookConfig runs a command or posts to a webhook on lifecycle events.
+type HookConfig struct {
+	// Events are the events the hook runs on, e.g. server_unhealthy.
+	Events []string `json:"events"`
+	// Servers limits server events to these servers; all when empty.
+	Servers []string `json:"servers,omitempty"`
+	// Command is run without a shell. Each argument is a template.
+	Command []string          `json:"command,omitempty"`
+	Webhook string            `json:"webhook,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Payload is a template for the webhook body or the command's stdin;
+	// the event is sent as JSON without it.
+	Payload string        `json:"payload,omitempty"`
+	Timeout time.Duration `json:"timeout,omitempty"`
+}
+
+// LogSinkConfig ships the structured access and audit log to a Loki or
+// Elasticsearch endpoint.
+type LogSinkConfig struct {
+	Type string `json:"type"`
+	// URL is the base URL; the push and bulk API paths are appended.
+	URL     string            `json:"url"`
+	Headers map[string]string `json:"headers,omitempty"`
+	// Labels are added to every Loki stream.
+	Labels map[string]string `json:"labels,omitempty"`
+	// Index is the Elasticsearch index; {date} expands to the event's date.
+	Index         string        `json:"index,omitempty"`
+	BatchSize     int           `json:"batchSize,omitempty"`
+	FlushInterval time.Duration `json:"flushInterval,omitempty"`
+}
+
+// ConfigHistoryConfig enables snapshots of the effective config whenever
+// it changes.
+type ConfigHistoryConfig struct {
+	Dir  string `json:"dir"`
+	Keep int    `json:"keep,omitempty"`
+}
+
+type PreflightConfig struct {
+	Enabled  bool          `json:"enabled"`
+	CacheDir string        `json:"cacheDir,omitempty"`
+	Timeout  time.Duration `json:"timeout,omitempty"`
+}
+
+type MCPProxyConfigV2 struct {
+	BaseURL   string           `json:"baseURL"`
+	Addr      string           `json:"addr"`
+	Name      string           `json:"name"`
+	Version   string           `json:"version"`
+	Type      MCPServerType    `json:"type,omitempty"`
+	Options   *OptionsV2       `json:"options,omitempty"`
+	API       *APIConfig       `json:"api,omitempty"`
+	Admin     *AdminConfig     `json:"admin,omitempty"`
+	Preflight *PreflightConfig `json:"preflight,omitempty"`
+	APIKeys   *APIKeysConfig   `json:"apiKeys,omitempty"`
+	Blocklist *BlocklistConfig `json:"blocklist,omitempty"`
+	GeoIP     *GeoIPConfig     `json:"geoip,omitempty"`
+	Honeypot  *HoneypotConfig  `json:"honeypot,omitempty"`
+	HMAC      *HMACConfig      `json:"hmac,omitempty"`
+	// UpstreamSigning identifies the proxy to upstreams that verify
+	// where requests come from.
+	UpstreamSigning *UpstreamSigningConfig `json:"upstreamSigning,omitempty"`
+	// WorkloadIdentity is the SPIFFE identity used for upstream mTLS.
+	WorkloadIdentity *WorkloadIdentityConfig `json:"workloadIdentity,omitempty"`
+	Auth             *AuthConfig             `json:"auth,omitempty"`
+	History          *ConfigHistoryConfig    `json:"history,omitempty"`
+	// CallHistory is served at /admin/history, unlike History, which
+	// holds config snapshots.
+	CallHistory *CallHistoryConfig `json:"callHistory,omitempty"`
+	LogSinks    []LogSinkConfig    `json:"logSinks,omitempty"`
+	Hooks       []HookConfig       `json:"hooks,omitempty"`
+	Metrics     *MetricsConfig     `json:"metrics,omitempty"`
+	// SlowCallLog is the file slow tool calls are appended to; they go to
+	// the proxy's log when it is empty.
+	SlowCallLog string `json:"slowCallLog,omitempty"`
+	// Groups maps group names to the users, token names and API key labels
+	// in them.
+	Groups map[string][]string `json:"groups,omitempty"`
+	// ResultStore is where options.offloadResults uploads large results.
+	ResultStore *ResultStoreConfig `json:"resultStore,omitempty"`
+	// Analytics tunes the tool usage report at /admin/analytics.
+	Analytics *AnalyticsConfig `json:"analytics,omitempty"`
+	// ToolSearch serves a search over the tools of every upstream at
+	// /search.
+	ToolSearch *ToolSearchConfig `json:"toolSearch,omitempty"`
+	// PromptLibrary serves the prompts of every upstream at /prompts.
+	PromptLibrary *PromptLibraryConfig `json:"promptLibrary,omitempty"`
+	// MessageBus takes tool calls from NATS or Kafka.
+	MessageBus *MessageBusConfig `json:"messageBus,omitempty"`
+	// Cluster shares server health and maintenance mode with the other
+	// proxies using the same Redis.
+	Cluster *ClusterConfig `json:"cluster,omitempty"`
+	// Resumability lets clients reconnect to SSE streams with
+	// Last-Event-ID.
+	Resumability *ResumabilityConfig `json:"resumability,omitempty"`
+	// Listener tunes the connections clients make to addr.
+	Listener *ListenerConfig `json:"listener,omitempty"`
+}
+
+// ListenerConfig tunes the connections of the listener on addr, mostly for
+// long-lived streams through load balancers.
+type ListenerConfig struct {
+	// HTTP2 serves HTTP/2 without TLS next to HTTP/1.1.
+	HTTP2 bool `json:"http2,omitempty"`
+	// MaxConcurrentStreams caps the HTTP/2 streams of one connection.
+	MaxConcurrentStreams int `json:"maxConcurrentStreams,omitempty"`
+	// PingInterval sends HTTP/2 pings on connections that were quiet for
+	// that long, and closes them when the ping is not answered.
+	PingInterval time.Duration `json:"pingInterval,omitempty"`
+	// KeepAlive is the TCP keep-alive period; negative turns keep-alives
+	// off.
+	KeepAlive time.Duration `json:"keepAlive,omitempty"`
+	// IdleTimeout closes connections that have no request in progress
+	// for that long.
+	IdleTimeout time.Duration `json:"idleTimeout,omitempty"`
+}
+
+// ResumabilityConfig buffers the SSE streams of MCP routes so that clients
+// that lose the connection can reconnect without losing responses.
+type ResumabilityConfig struct {
+	Enabled bool `json:"enabled"`
+	// TTL is how long a stream is kept, and its handler kept running,
+	// while no client is connected to it.
+	TTL time.Duration `json:"ttl,omitempty"`
+	// MaxEvents is how many of a stream's latest events are kept.
+	MaxEvents int `json:"maxEvents,omitempty"`
+}
+
+// ClusterConfig joins the proxy to a cluster of proxies behind a load
+// balancer, which share state through Redis.
+type ClusterConfig struct {
+	// Redis is a redis:// or rediss:// URL.
+	Redis string `json:"redis"`
+	// Node names this proxy in the cluster; the hostname by default.
+	Node string `json:"node,omitempty"`
+	// Prefix starts every key and channel, so that clusters can share a
+	// Redis; "mcp-proxy" by default.
+	Prefix string `json:"prefix,omitempty"`
+	// Interval is how often the node publishes its state and reads that of
+	// the others.
+	Interval time.Duration `json:"interval,omitempty"`
+	// RateLimits enforces options.maxRequestsPerMinute across the cluster
+	// rather than on each node.
+	RateLimits bool `json:"rateLimits,omitempty"`
+}
+
+// MessageBusConfig consumes tool calls from a NATS subject or a Kafka topic
+// and publishes their results.
+type MessageBusConfig struct {
+	NATS  *NATSBusConfig  `json:"nats,omitempty"`
+	Kafka *KafkaBusConfig `json:"kafka,omitempty"`
+	// Name is who the calls are made as, in the call history and to
+	// upstreams; "bus" by default. Servers and Tools scope the calls like
+	// the same fields of a token, and mcpProxy.groups applies to Name.
+	Name        string   `json:"name,omitempty"`
+	Servers     []string `json:"servers,omitempty"`
+	Tools       []string `json:"tools,omitempty"`
+	Concurrency int      `json:"concurrency,omitempty"`
+}
+
+// NATSBusConfig subscribes the message bus to a NATS subject.
+type NATSBusConfig struct {
+	// URL is a nats:// URL, which may carry the credentials.
+	URL     string `json:"url"`
+	Subject string `json:"subject"`
+	// Queue is the queue group, so that several proxies share the calls.
+	Queue string `json:"queue,omitempty"`
+	// ResultSubject receives the results of calls sent without a reply
+	// subject.
+	ResultSubject string `json:"resultSubject,omitempty"`
+}
+
+// KafkaBusConfig consumes the message bus from a Kafka topic.
+type KafkaBusConfig struct {
+	Brokers     []string `json:"brokers"`
+	Topic       string   `json:"topic"`
+	GroupID     string   `json:"groupId,omitempty"`
+	ResultTopic string   `json:"resultTopic,omitempty"`
+}
+
+type MCPClientConfigV2 struct {
+	// Template names an entry of serverTemplates to start from, and Vars
+	// fill its placeholders. Both are gone once the config is loaded.
+	Template string            `json:"template,omitempty"`
+	Vars     map[string]string `json:"vars,omitempty"`
+
+	TransportType MCPClientType `json:"transportType,omitempty"`
+
+	// Path mounts the server somewhere other than /<name>/; Aliases are
+	// additional routes serving the same server.
+	Path    string   `json:"path,omitempty"`
+	Aliases []string `json:"aliases,omitempty"`
+	// Passthrough reverse-proxies an sse or streamable-http upstream as is
+	// instead of re-serving its tools.
+	Passthrough bool `json:"passthrough,omitempty"`
+
+	// Stdio
+	Command string            `json:"command,omitempty"`
+	Args    []string          `json:"args,omitempty"`
+	Env     map[string]string `json:"env,omitempty"`
+	Pin     *PinConfig        `json:"pin,omitempty"`
+
+	InheritEnv *EnvInheritance `json:"inheritEnv,omitempty"`
+	EnvDeny    []string        `json:"envDeny,omitempty"`
+	Cwd        string          `json:"cwd,omitempty"`
+	ExtraPath  []string        `json:"extraPath,omitempty"`
+	Egress     *EgressConfig   `json:"egress,omitempty"`
+
+	// SSE or Streamable HTTP
+	URL     string            `json:"url,omitempty"`
+	Headers map[string]string `json:"headers,omitempty"`
+	Timeout time.Duration     `json:"timeout,omitempty"`
+	// SignRequests attaches a JWT from mcpProxy.upstreamSigning to every
+	// request to the server.
+	SignRequests bool `json:"signRequests,omitempty"`
+	// MTLS presents mcpProxy.workloadIdentity to the server.
+	MTLS *UpstreamMTLSConfig `json:"mtls,omitempty"`
+	// Replicas are URLs of read-only copies of the server, reached like
+	// it, which serve resource listings and reads while tool calls go to
+	// URL.
+	Replicas []string `json:"replicas,omitempty"`
+
+	// Static
+	Root    string `json:"root,omitempty"`
+	Prompts string `json:"prompts,omitempty"`
+
+	// Builtin
+	Fetch *FetchConfig `json:"fetch,omitempty"`
+
+	// DependsOn names servers that must have connected before this one is
+	// started; WaitFor is a command that must succeed first.
+	DependsOn []string       `json:"dependsOn,omitempty"`
+	WaitFor   *WaitForConfig `json:"waitFor,omitempty"`
+
+	Options *OptionsV2 `json:"options,omitempty"`
+}
+
+type WaitForConfig struct {
+	Command  []string      `json:"command"`
+	Interval time.Duration `json:"interval,omitempty"`
+	Timeout  time.Duration `json:"timeout,omitempty"`
+}
+
+// routes returns the routes a server is mounted at relative to the base
+// URL: its path, or its name, followed by its aliases.
+func (c *MCPClientConfigV2) routes(name string) []string {
+	routes := []string{name}
+	if c.Path != "" {
+		routes[0] = strings.Trim(c.Path, "/")
+	}
+	for _, alias := range c.Aliases {
+		routes = append(routes, strings.Trim(alias, "/"))
+	}
+	return routes
+}
+
+func parseMCPClientConfigV2(conf *MCPClientConfigV2) (any, error) {
+	if conf.TransportType == MCPClientTypeStatic {
+		if conf.Root == "" && conf.Prompts == "" {
+			return nil, errors.New("root or prompts is required for static transport")
+		}
+		return &StaticMCPClientConfig{
+			Root:    conf.Root,
+			Prompts: conf.Prompts,
+		}, nil
+	}
+	if builtinName, ok := strings.CutPrefix(conf.Command, builtinCommandPrefix); ok {
+		return &BuiltinMCPClientConfig{
+			Name:  builtinName,
+			Fetch: conf.Fetch,
+		}, nil
+	}
+	if conf.Command != "" || conf.TransportType == MCPClientTypeStdio {
+		if conf.Command == "" {
+			return nil, errors.New("command is required for stdio transport")
+		}
+		return &StdioMCPClientConfig{
+			Command:    conf.Command,
+			Env:        conf.Env,
+			Args:       conf.Args,
+			InheritEnv: conf.InheritEnv,
+			EnvDeny:    conf.EnvDeny,
+			Cwd:        conf.Cwd,
+			ExtraPath:  conf.ExtraPath,
+			Egress:     conf.Egress,
+		}, nil
+	}
+	if conf.URL != "" {
+		if conf.TransportType == MCPClientTypeStreamable {
+			return &StreamableMCPClientConfig{
+				URL:     conf.URL,
+				Headers: conf.Headers,
+				Timeout: conf.Timeout,
+			}, nil
+		} else {
+			return &SSEMCPClientConfig{
+				URL:     conf.URL,
+				Headers: conf.Headers,
+			}, nil
+		}
+	}
+	return nil, errors.New("invalid server type")
+}
+
+type VirtualToolConfig struct {
+	Server string `json:"server"`
+	Tool   string `json:"tool"`
+	As     string `json:"as,omitempty"`
+}
+
+type VirtualServerConfig struct {
+	Tools []VirtualToolConfig `json:"tools"`
+	// MetaTools adds the proxy's management tools, such as list_servers,
+	// next to the upstream tools.
+	MetaTools []string `json:"metaTools,omitempty"`
+	// Macros are tools that call several upstream tools in sequence.
+	Macros  []*MacroToolConfig `json:"macros,omitempty"`
+	Options *OptionsV2         `json:"options,omitempty"`
+}
+
+// MacroToolConfig is a tool of a virtual server that runs upstream tool
+// calls one after another, with {{...}} templates in the arguments of each
+// step filled from the macro's arguments and the results of earlier steps.
+type MacroToolConfig struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	// InputSchema is the JSON Schema of the macro's arguments; any object
+	// is accepted without it.
+	InputSchema json.RawMessage    `json:"inputSchema,omitempty"`
+	Steps       []*MacroStepConfig `json:"steps"`
+}
+
+type MacroStepConfig struct {
+	// ID names the step's result in later templates; step<N> by default.
+	ID        string         `json:"id,omitempty"`
+	Server    string         `json:"server"`
+	Tool      string         `json:"tool"`
+	Arguments map[string]any `json:"arguments,omitempty"`
+}
+
+// HTTPRouteConfig reverse-proxies a plain HTTP path, e.g. an upstream's
+// OAuth callback or health endpoint, next to the MCP routes.
+type HTTPRouteConfig struct {
+	Target      string            `json:"target"`
+	Headers     map[string]string `json:"headers,omitempty"`
+	StripPrefix bool              `json:"stripPrefix,omitempty"`
+	// AuthTokens protects the route; without them it is public, since
+	// callbacks are usually called by browsers or third parties.
+	AuthTokens []AuthToken `json:"authTokens,omitempty"`
+	LogEnabled bool        `json:"logEnabled,omitempty"`
+}
+
+// ToolSearchConfig lets agents find tools by what they do instead of
+// receiving every tool of every server.
+type ToolSearchConfig struct {
+	Enabled bool `json:"enabled"`
+	// Embeddings ranks tools by embedding similarity; without it, tools are
+	// ranked with BM25 over their names and descriptions.
+	Embeddings *EmbeddingsConfig `json:"embeddings,omitempty"`
+	// MetaTool also serves the search_tools and call_tool tools at
+	// /search/mcp or /search/sse.
+	MetaTool bool       `json:"metaTool,omitempty"`
+	Options  *OptionsV2 `json:"options,omitempty"`
+}
+
+// EmbeddingsConfig is an OpenAI compatible embeddings endpoint.
+type EmbeddingsConfig struct {
+	URL    string `json:"url"`
+	Model  string `json:"model"`
+	APIKey string `json:"apiKey,omitempty"`
+}
+
+// PromptLibraryConfig aggregates the prompts of the upstreams into one
+// route. Identical prompts are listed once; different prompts of the same
+// name are namespaced as <server>_<prompt>.
+type PromptLibraryConfig struct {
+	Enabled bool `json:"enabled"`
+	// Servers limits the library to these servers; all by default.
+	Servers []string `json:"servers,omitempty"`
+	// Pinned prompts, as <server>/<prompt>, are listed first, keep their
+	// plain name and are included even from servers not in Servers.
+	Pinned []string `json:"pinned,omitempty"`
+	// Namespace names every prompt but the pinned ones <server>_<prompt>.
+	Namespace bool       `json:"namespace,omitempty"`
+	Options   *OptionsV2 `json:"options,omitempty"`
+}
+
+type ProfileConfig struct {
+	Servers    []string          `json:"servers,omitempty"`
+	ToolFilter *ToolFilterConfig `json:"toolFilter,omitempty"`
+	Options    *OptionsV2        `json:"options,omitempty"`
+}
+
+// ---- Config ----
+
+type Config struct {
+	McpProxy       *MCPProxyConfigV2               `json:"mcpProxy"`
+	McpServers     map[string]*MCPClientConfigV2   `json:"mcpServers"`
+	VirtualServers map[string]*VirtualServerConfig `json:"virtualServers,omitempty"`
+	Profiles       map[string]*ProfileConfig       `json:"profiles,omitempty"`
+	HTTPRoutes     map[string]*HTTPRouteConfig     `json:"httpRoutes,omitempty"`
+}
+
+type FullConfig struct {
+	DeprecatedServerV1  *MCPProxyConfigV1             `json:"server"`
+	DeprecatedClientsV1 map[string]*MCPClientConfigV1 `json:"clients"`
+
+	McpProxy       *MCPProxyConfigV2               `json:"mcpProxy"`
+	McpServers     map[string]*MCPClientConfigV2   `json:"mcpServers"`
+	VirtualServers map[string]*VirtualServerConfig `json:"virtualServers"`
+	Profiles       map[string]*ProfileConfig       `json:"profiles"`
+	HTTPRoutes     map[string]*HTTPRouteConfig     `json:"httpRoutes"`
+	// ServerTemplates are expanded into the mcpServers entries that use
+	// them while the config is loaded.
+	ServerTemplates map[string]*MCPClientConfigV2 `json:"serverTemplates"`
+}
+
+func newConfProvider(path string, insecure, expandEnv bool, httpHeaders string, httpTimeout int) (provider.Provider, error) {
+	if http.IsRemoteURL(path) {
+		var opts []http.Option
+		httpClient := nethttp.DefaultClient
+		if insecure {
+			transport := nethttp.DefaultTransport.(*nethttp.Transport).Clone()
+			transport.TLSClientConfig = &tls.Config{InsecureSkipVerify: true}
+			httpClient = &nethttp.Client{Transport: transport}
+		}
+		if httpTimeout > 0 {
+			httpClient.Timeout = time.Duration(httpTimeout) * time.Second
+		}
+		opts = append(opts, http.WithClient(httpClient))
+		if httpHeaders != "" {
+			// format: 'Key1:Value1;Key2:Value2'
+			headers := make(nethttp.Header)
+			for kv := range strings.SplitSeq(httpHeaders, ";") {
+				parts := strings.SplitN(kv, ":", 2)
+				if len(parts) == 2 {
+					key := strings.TrimSpace(parts[0])
+					value := strings.TrimSpace(parts[1])
+					if key != "" && value != "" {
+						headers.Add(key, value)
+					}
+				}
+			}
+			if len(headers) > 0 {
+				opts = append(opts, http.WithHeaders(headers))
+			}
+		}
+		pro := http.New(path, opts...)
+		if expandEnv {
+			return provider.NewExpandEnv(pro), nil
+		} else {
+			return pro, nil
+		}
+	}
+	if file.IsLocalPath(path) {
+		if expandEnv {
+			return provider.NewExpandEnv(file.New(path, file.WithExpandEnv())), nil
+		} else {
+			return file.New(path), nil
+		}
+	}
+	return nil, errors.New("unsupported config path")
+}
+
+// inheritOptions fills the options a server leaves unset from the proxy-wide
+// defaults.
+func inheritOptions(clientConfig *MCPClientConfigV2, defaults *OptionsV2) {
+	if clientConfig.Options == nil {
+		clientConfig.Options = &OptionsV2{}
+	}
+	if clientConfig.Options.AuthTokens == nil {
+		clientConfig.Options.AuthTokens = defaults.AuthTokens
+	}
+	if !clientConfig.Options.PanicIfInvalid.Present() {
+		clientConfig.Options.PanicIfInvalid = defaults.PanicIfInvalid
+	}
+	if !clientConfig.Options.LogEnabled.Present() {
+		clientConfig.Options.LogEnabled = defaults.LogEnabled
+	}
+	if clientConfig.Options.IPFilter == nil {
+		clientConfig.Options.IPFilter = defaults.IPFilter
+	}
+	if clientConfig.Options.SlowCallThreshold == 0 {
+		clientConfig.Options.SlowCallThreshold = defaults.SlowCallThreshold
+	}
+	if clientConfig.Options.SizeAlert == nil {
+		clientConfig.Options.SizeAlert = defaults.SizeAlert
+	}
+	if clientConfig.Options.TraceWire == nil {
+		clientConfig.Options.TraceWire = defaults.TraceWire
+	}
+	if clientConfig.Options.Conformance == "" {
+		clientConfig.Options.Conformance = defaults.Conformance
+	}
+	if !clientConfig.Options.ValidateArguments.Present() {
+		clientConfig.Options.ValidateArguments = defaults.ValidateArguments
+	}
+	if clientConfig.Options.ValidateOutput == "" {
+		clientConfig.Options.ValidateOutput = defaults.ValidateOutput
+	}
+	if clientConfig.Options.BinaryContent == nil {
+		clientConfig.Options.BinaryContent = defaults.BinaryContent
+	}
+	if clientConfig.Options.OffloadResults == nil {
+		clientConfig.Options.OffloadResults = defaults.OffloadResults
+	}
+	if clientConfig.Options.ToolCap == nil {
+		clientConfig.Options.ToolCap = defaults.ToolCap
+	}
+	if clientConfig.Options.MaxSessions == 0 {
+		clientConfig.Options.MaxSessions = defaults.MaxSessions
+	}
+	if clientConfig.Options.MaxRequestsPerMinute == 0 {
+		clientConfig.Options.MaxRequestsPerMinute = defaults.MaxRequestsPerMinute
+	}
+	if clientConfig.Options.MaxBytesPerSecond == 0 {
+		clientConfig.Options.MaxBytesPerSecond = defaults.MaxBytesPerSecond
+	}
+}
+
+// validateMacros checks the macros of a virtual server up to what can only
+// be known once the upstreams are connected.
+func validateMacros(name string, virtualConfig *VirtualServerConfig) error {
+	names := make(map[string]bool)
+	for _, tool := range virtualConfig.Tools {
+		names[cmp.Or(tool.As, tool.Tool)] = true
+	}
+	for _, metaTool := range virtualConfig.MetaTools {
+		names[metaTool] = true
+	}
+	for i, macro := range virtualConfig.Macros {
+		where := fmt.Sprintf("virtualServers.%s.macros[%d]", name, i)
+		if macro == nil || macro.Name == "" {
+			return fmt.Errorf("%s: name is required", where)
+		}
+		if names[macro.Name] {
+			return fmt.Errorf("%s: tool %s is already defined", where, macro.Name)
+		}
+		names[macro.Name] = true
+		if len(macro.Steps) == 0 {
+			return fmt.Errorf("%s: steps are required", where)
+		}
+		if len(macro.InputSchema) > 0 {
+			if _, err := compileJSONSchema(macro.InputSchema); err != nil {
+				return fmt.Errorf("%s.inputSchema: %w", where, err)
+			}
+		}
+		ids := make(map[string]bool)
+		for j, step := range macro.Steps {
+			if step == nil || step.Server == "" || step.Tool == "" {
+				return fmt.Errorf("%s.steps[%d]: server and tool are required", where, j)
+			}
+			id := macroStepID(step.ID, j)
+			if ids[id] {
+				return fmt.Errorf("%s.steps[%d]: duplicate id %s", where, j, id)
+			}
+			ids[id] = true
+			if _, err := parseMacroTemplates(step.Arguments); err != nil {
+				return fmt.Errorf("%s.steps[%d]: %w", where, j, err)
+			}
+		}
+	}
+	return nil
+}
+
+// featureRoutes maps the routes of the enabled proxy features that serve
+// MCP next to the servers to the config key of the feature.
+func (c *MCPProxyConfigV2) featureRoutes() map[string]string {
+	routes := make(map[string]string)
+	if c.PromptLibrary != nil && c.PromptLibrary.Enabled {
+		routes[promptLibraryRoute] = "promptLibrary"
+	}
+	if c.ToolSearch != nil && c.ToolSearch.Enabled {
+		routes[toolSearchRoute] = "toolSearch"
+	}
+	return routes
+}
+
+// inheritRouteOptions fills the auth, logging and address filter options
+// of a route that aggregates other servers, such as a virtual server, from
+// the proxy-wide defaults.
+func inheritRouteOptions(options, defaults *OptionsV2) *OptionsV2 {
+	if options == nil {
+		options = &OptionsV2{}
+	}
+	if options.AuthTokens == nil {
+		options.AuthTokens = defaults.AuthTokens
+	}
+	if !options.LogEnabled.Present() {
+		options.LogEnabled = defaults.LogEnabled
+	}
+	if options.IPFilter == nil {
+		options.IPFilter = defaults.IPFilter
+	}
+	return options
+}
+
+// LoadConfig reads a config from a local path or an http(s) URL, converts
+// the deprecated v1 layout and applies defaults. Unknown keys fail the load
+// in strict mode and are logged as warnings otherwise.
+func LoadConfig(path string, insecure, expandEnv bool, httpHeaders string, httpTimeout int, strict bool) (*Config, error) {
+	pro, err := newConfProvider(path, insecure, expandEnv, httpHeaders, httpTimeout)
+	if err != nil {
+		return nil, err
+	}
+	jsonCodec := codec.JsonCodec()
+	checkedCodec := codec.NewCodec(jsonCodec.Marshal, func(data []byte, val any) error {
+		findings, fErr := unknownConfigKeys(data)
+		if fErr != nil {
+			return fErr
+		}
+		if len(findings) > 0 && strict {
+			return fmt.Errorf("invalid config (run with -strict=false to only warn):\n  %s", strings.Join(findings, "\n  "))
+		}
+		for _, finding := range findings {
+			log.Printf("Config warning: %s", finding)
+		}
+		if data, fErr = expandServerTemplates(data); fErr != nil {
+			return fErr
+		}
+		return jsonCodec.Unmarshal(data, val)
+	})
+	conf, err := confstore.Load[FullConfig](pro, checkedCodec)
+	if err != nil {
+		return nil, err
+	}
+	if notes := adaptMCPClientConfigV1ToV2(conf); len(notes) > 0 {
+		log.Printf("Config uses the deprecated v1 layout, convert it with `mcp-proxy migrate-config --in %s --out <new.json>`", path)
+	}
+
+	config := &Config{
+		McpProxy:       conf.McpProxy,
+		McpServers:     conf.McpServers,
+		VirtualServers: conf.VirtualServers,
+		Profiles:       conf.Profiles,
+		HTTPRoutes:     conf.HTTPRoutes,
+	}
+	if err = config.Validate(); err != nil {
+		return nil, err
+	}
+	config.setDefaults()
+	return config, nil
+}
+
+// parseConfig reads a config pushed at runtime the way LoadConfig reads the
+// config file, except that environment variables are not expanded and
+// unknown keys are always an error.
+func parseConfig(data []byte) (*Config, error) {
+	findings, err := unknownConfigKeys(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(findings) > 0 {
+		return nil, fmt.Errorf("invalid config:\n  %s", strings.Join(findings, "\n  "))
+	}
+	if data, err = expandServerTemplates(data); err != nil {
+		return nil, err
+	}
+	var conf FullConfig
+	if err = json.Unmarshal(data, &conf); err != nil {
+		return nil, err
+	}
+	adaptMCPClientConfigV1ToV2(&conf)
+	config := &Config{
+		McpProxy:       conf.McpProxy,
+		McpServers:     conf.McpServers,
+		VirtualServers: conf.VirtualServers,
+		Profiles:       conf.Profiles,
+		HTTPRoutes:     conf.HTTPRoutes,
+	}
+	if err = config.Validate(); err != nil {
+		return nil, err
+	}
+	config.setDefaults()
+	return config, nil
+}
+
+// Validate reports the first problem that would keep the proxy from
+// starting with c.
+func (c *Config) Validate() error {
+	if c.McpProxy == nil {
+		return errors.New("mcpProxy is required")
+	}
+	if c.McpProxy.Admin != nil && c.McpProxy.Admin.Enabled && len(c.McpProxy.Admin.AuthTokens) == 0 {
+		return errors.New("mcpProxy.admin.authTokens is required when the admin API is enabled")
+	}
+	if admin := c.McpProxy.Admin; admin != nil && admin.GRPC != nil {
+		if !admin.Enabled {
+			return errors.New("mcpProxy.admin.grpc needs the admin API enabled")
+		}
+		if admin.GRPC.Addr == "" {
+			return errors.New("mcpProxy.admin.grpc.addr is required")
+		}
+		if (admin.GRPC.CertFile == "") != (admin.GRPC.KeyFile == "") {
+			return errors.New("mcpProxy.admin.grpc.certFile and keyFile must be set together")
+		}
+	}
+	if auth := c.McpProxy.Auth; auth != nil && auth.Mode == AuthModeProxyHeader && len(auth.TrustedProxies) == 0 && !auth.InsecureTrustAnyClient {
+		return errors.New("mcpProxy.auth.trustedProxies is required in proxy-header mode, unless insecureTrustAnyClient is set")
+	}
+	if c.McpProxy.APIKeys != nil && c.McpProxy.APIKeys.Enabled && c.McpProxy.APIKeys.File == "" {
+		return errors.New("mcpProxy.apiKeys.file is required when api keys are enabled")
+	}
+	if c.McpProxy.Blocklist != nil && c.McpProxy.Blocklist.Enabled && c.McpProxy.Blocklist.File == "" {
+		return errors.New("mcpProxy.blocklist.file is required when the block list is enabled")
+	}
+	if bus := c.McpProxy.MessageBus; bus != nil {
+		if bus.NATS == nil && bus.Kafka == nil {
+			return errors.New("mcpProxy.messageBus needs nats or kafka")
+		}
+		if bus.NATS != nil && (bus.NATS.URL == "" || bus.NATS.Subject == "") {
+			return errors.New("mcpProxy.messageBus.nats.url and subject are required")
+		}
+		if bus.Kafka != nil && (len(bus.Kafka.Brokers) == 0 || bus.Kafka.Topic == "") {
+			return errors.New("mcpProxy.messageBus.kafka.brokers and topic are required")
+		}
+	}
+	if c.McpProxy.Cluster != nil && c.McpProxy.Cluster.Redis == "" {
+		return errors.New("mcpProxy.cluster.redis is required")
+	}
+	if l := c.McpProxy.Listener; l != nil {
+		if l.MaxConcurrentStreams < 0 || l.PingInterval < 0 || l.IdleTimeout < 0 {
+			return errors.New("mcpProxy.listener: maxConcurrentStreams, pingInterval and idleTimeout must not be negative")
+		}
+		if !l.HTTP2 && (l.MaxConcurrentStreams > 0 || l.PingInterval > 0) {
+			return errors.New("mcpProxy.listener: maxConcurrentStreams and pingInterval require http2")
+		}
+	}
+	if r := c.McpProxy.Resumability; r != nil && (r.TTL < 0 || r.MaxEvents < 0) {
+		return errors.New("mcpProxy.resumability: ttl and maxEvents must not be negative")
+	}
+	if api := c.McpProxy.API; api != nil && api.Async != nil && api.Async.Database == "" {
+		return errors.New("mcpProxy.api.async.database is required")
+	}
+	if c.McpProxy.CallHistory != nil && c.McpProxy.CallHistory.Database == "" {
+		return errors.New("mcpProxy.callHistory.database is required")
+	}
+	if metrics := c.McpProxy.Metrics; metrics != nil && metrics.StatsD != nil {
+		if metrics.StatsD.Address == "" {
+			return errors.New("mcpProxy.metrics.statsd.address is required")
+		}
+		if flavor := metrics.StatsD.Flavor; flavor != "" && flavor != statsdFlavorDogStatsD && flavor != statsdFlavorStatsD {
+			return errors.New("mcpProxy.metrics.statsd.flavor must be dogstatsd or statsd")
+		}
+	}
+	for i, hook := range c.McpProxy.Hooks {
+		if len(hook.Events) == 0 {
+			return fmt.Errorf("mcpProxy.hooks[%d].events is required", i)
+		}
+		for _, event := range hook.Events {
+			if !slices.Contains(hookEvents, event) {
+				return fmt.Errorf("mcpProxy.hooks[%d]: unknown event %q", i, event)
+			}
+		}
+		if (len(hook.Command) == 0) == (hook.Webhook == "") {
+			return fmt.Errorf("mcpProxy.hooks[%d] requires either a command or a webhook", i)
+		}
+		if hook.Webhook != "" {
+			if u, err := url.Parse(hook.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return fmt.Errorf("mcpProxy.hooks[%d].webhook must be an http(s) url", i)
+			}
+		}
+		for _, text := range append([]string{hook.Payload}, hook.Command...) {
+			if _, err := parseHookTemplate("hook", text); err != nil {
+				return fmt.Errorf("mcpProxy.hooks[%d]: %w", i, err)
+			}
+		}
+	}
+	for i, sink := range c.McpProxy.LogSinks {
+		if sink.Type != logSinkTypeLoki && sink.Type != logSinkTypeElasticsearch {
+			return fmt.Errorf("mcpProxy.logSinks[%d].type must be loki or elasticsearch", i)
+		}
+		if u, err := url.Parse(sink.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("mcpProxy.logSinks[%d].url must be an http(s) URL", i)
+		}
+	}
+	if honeypot := c.McpProxy.Honeypot; honeypot != nil {
+		if honeypot.AutoBlock && (c.McpProxy.Blocklist == nil || !c.McpProxy.Blocklist.Enabled) {
+			return errors.New("mcpProxy.honeypot.autoBlock requires mcpProxy.blocklist")
+		}
+		for _, tool := range honeypot.Tools {
+			if tool.Name == "" {
+				return errors.New("mcpProxy.honeypot.tools entries require a name")
+			}
+		}
+		if honeypot.Webhook != "" {
+			if u, err := url.Parse(honeypot.Webhook); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				return errors.New("mcpProxy.honeypot.webhook must be an http(s) url")
+			}
+		}
+	}
+	if c.McpProxy.HMAC != nil && c.McpProxy.HMAC.Enabled {
+		for _, caller := range c.McpProxy.HMAC.Callers {
+			if caller.ID == "" || caller.Secret == "" {
+				return errors.New("mcpProxy.hmac.callers entries require an id and a secret")
+			}
+		}
+	}
+	if signing := c.McpProxy.UpstreamSigning; signing != nil {
+		if signing.Issuer == "" {
+			return errors.New("mcpProxy.upstreamSigning.issuer is required")
+		}
+		if (signing.Secret == "") == (signing.KeyFile == "") {
+			return errors.New("mcpProxy.upstreamSigning requires exactly one of secret and keyFile")
+		}
+	}
+	if identity := c.McpProxy.WorkloadIdentity; identity != nil {
+		if identity.CertFile == "" || identity.KeyFile == "" || identity.BundleFile == "" {
+			return errors.New("mcpProxy.workloadIdentity requires certFile, keyFile and bundleFile")
+		}
+	}
+	if _, err := url.Parse(c.McpProxy.BaseURL); err != nil {
+		return fmt.Errorf("mcpProxy.baseURL: %w", err)
+	}
+	switch c.McpProxy.Type {
+	case "", MCPServerTypeSSE, MCPServerTypeStreamable:
+	default:
+		return fmt.Errorf("unknown server type: %s", c.McpProxy.Type)
+	}
+	if err := c.validateOptions("mcpProxy.options", c.McpProxy.Options); err != nil {
+		return err
+	}
+	for name, virtualConfig := range c.VirtualServers {
+		if err := c.validateOptions("virtualServers."+name+".options", virtualConfig.Options); err != nil {
+			return err
+		}
+		for _, metaTool := range virtualConfig.MetaTools {
+			if _, ok := metaTools[metaTool]; !ok {
+				return fmt.Errorf("virtualServers.%s.metaTools: unknown tool %q", name, metaTool)
+			}
+			if slices.ContainsFunc(virtualConfig.Tools, func(tool VirtualToolConfig) bool { return cmp.Or(tool.As, tool.Tool) == metaTool }) {
+				return fmt.Errorf("virtualServers.%s.metaTools: %s is also one of its tools", name, metaTool)
+			}
+		}
+		if err := validateMacros(name, virtualConfig); err != nil {
+			return err
+		}
+	}
+	for name, profileConfig := range c.Profiles {
+		if err := c.validateOptions("profiles."+name+".options", profileConfig.Options); err != nil {
+			return err
+		}
+	}
+	if c.McpProxy.Analytics != nil && c.McpProxy.Analytics.Window < 0 {
+		return errors.New("mcpProxy.analytics.window must not be negative")
+	}
+	if search := c.McpProxy.ToolSearch; search != nil && search.Enabled {
+		if err := c.validateOptions("mcpProxy.toolSearch.options", search.Options); err != nil {
+			return err
+		}
+		if embeddings := search.Embeddings; embeddings != nil {
+			if target, err := url.Parse(embeddings.URL); err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+				return errors.New("mcpProxy.toolSearch.embeddings.url must be an http(s) url")
+			}
+			if embeddings.Model == "" {
+				return errors.New("mcpProxy.toolSearch.embeddings.model is required")
+			}
+		}
+	}
+	if library := c.McpProxy.PromptLibrary; library != nil && library.Enabled {
+		if err := c.validateOptions("mcpProxy.promptLibrary.options", library.Options); err != nil {
+			return err
+		}
+		for _, pin := range library.Pinned {
+			if server, prompt, ok := strings.Cut(pin, "/"); !ok || server == "" || prompt == "" {
+				return fmt.Errorf("mcpProxy.promptLibrary.pinned: %q must be <server>/<prompt>", pin)
+			}
+		}
+	}
+	for name, clientConfig := range c.McpServers {
+		if clientConfig.Options != nil && clientConfig.Options.Disabled {
+			continue
+		}
+		if err := c.validateOptions("mcpServers."+name+".options", clientConfig.Options); err != nil {
+			return err
+		}
+		parsed, err := parseMCPClientConfigV2(clientConfig)
+		if err != nil {
+			return fmt.Errorf("mcpServers.%s: %w", name, err)
+		}
+		if clientConfig.SignRequests {
+			switch parsed.(type) {
+			case *SSEMCPClientConfig, *StreamableMCPClientConfig:
+			default:
+				return fmt.Errorf("mcpServers.%s: signRequests requires an sse or streamable-http url", name)
+			}
+			if c.McpProxy.UpstreamSigning == nil {
+				return fmt.Errorf("mcpServers.%s: signRequests requires mcpProxy.upstreamSigning", name)
+			}
+		}
+		if clientConfig.MTLS != nil {
+			if u, uErr := url.Parse(clientConfig.URL); uErr != nil || u.Scheme != "https" {
+				return fmt.Errorf("mcpServers.%s: mtls requires an https url", name)
+			}
+			if c.McpProxy.WorkloadIdentity == nil {
+				return fmt.Errorf("mcpServers.%s: mtls requires mcpProxy.workloadIdentity", name)
+			}
+		}
+		if len(clientConfig.Replicas) > 0 {
+			switch parsed.(type) {
+			case *SSEMCPClientConfig, *StreamableMCPClientConfig:
+			default:
+				return fmt.Errorf("mcpServers.%s: replicas require an sse or streamable-http url", name)
+			}
+			if clientConfig.Passthrough {
+				return fmt.Errorf("mcpServers.%s: replicas are not supported for passthrough servers", name)
+			}
+			for _, replica := range clientConfig.Replicas {
+				u, uErr := url.Parse(replica)
+				if uErr != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+					return fmt.Errorf("mcpServers.%s: invalid replica url %q", name, replica)
+				}
+				if clientConfig.MTLS != nil && u.Scheme != "https" {
+					return fmt.Errorf("mcpServers.%s: mtls requires https replica urls", name)
+				}
+			}
+		}
+		if clientConfig.Egress != nil {
+			if _, ok := parsed.(*StdioMCPClientConfig); !ok {
+				return fmt.Errorf("mcpServers.%s: egress requires a stdio server", name)
+			}
+		}
+		if clientConfig.Passthrough {
+			switch parsed.(type) {
+			case *SSEMCPClientConfig, *StreamableMCPClientConfig:
+			default:
+				return fmt.Errorf("mcpServers.%s: passthrough requires an sse or streamable-http url", name)
+			}
+			if len(clientConfig.DependsOn) > 0 || clientConfig.WaitFor != nil {
+				return fmt.Errorf("mcpServers.%s: dependsOn and waitFor are not supported for passthrough servers", name)
+			}
+		}
+		if clientConfig.WaitFor != nil && len(clientConfig.WaitFor.Command) == 0 {
+			return fmt.Errorf("mcpServers.%s: waitFor.command is required", name)
+		}
+	}
+	if err := validateDependencies(c.McpServers); err != nil {
+		return err
+	}
+	owners := make(map[string]string)
+	for _, name := range slices.Sorted(maps.Keys(c.McpServers)) {
+		for _, route := range c.McpServers[name].routes(name) {
+			if route == "" || slices.Contains(strings.Split(route, "/"), "..") {
+				return fmt.Errorf("mcpServers.%s: invalid path or alias %q", name, route)
+			}
+			if owner, taken := owners[route]; taken {
+				return fmt.Errorf("mcpServers.%s: route /%s is already used by %s", name, route, owner)
+			}
+			owners[route] = name
+		}
+	}
+	for route, feature := range c.McpProxy.featureRoutes() {
+		if owner, taken := owners[route]; taken {
+			return fmt.Errorf("mcpProxy.%s: route /%s is already used by %s", feature, route, owner)
+		}
+		if _, taken := c.VirtualServers[route]; taken {
+			return fmt.Errorf("mcpProxy.%s: route /%s is already used by virtual server %s", feature, route, route)
+		}
+	}
+	for name := range c.VirtualServers {
+		if owner, taken := owners[name]; taken && owner != name {
+			return fmt.Errorf("virtual server %s conflicts with a path or alias of %s", name, owner)
+		}
+		if _, exists := c.McpServers[name]; exists {
+			return fmt.Errorf("virtual server %s conflicts with an entry in mcpServers", name)
+		}
+	}
+	for _, routePath := range slices.Sorted(maps.Keys(c.HTTPRoutes)) {
+		route := strings.Trim(routePath, "/")
+		if route == "" || slices.Contains(strings.Split(route, "/"), "..") {
+			return fmt.Errorf("httpRoutes: invalid path %q", routePath)
+		}
+		if first, _, _ := strings.Cut(route, "/"); first == "api" || first == "admin" || first == "status" || first == "status.json" || first == "metrics" || first == "profiles" || first == "blobs" || first == "results" || first == promptLibraryRoute || first == toolSearchRoute || first == ".well-known" {
+			return fmt.Errorf("httpRoutes.%s: path is reserved by the proxy", routePath)
+		}
+		if owner, taken := owners[route]; taken {
+			return fmt.Errorf("httpRoutes.%s: route /%s is already used by %s", routePath, route, owner)
+		}
+		if _, taken := c.VirtualServers[route]; taken {
+			return fmt.Errorf("httpRoutes.%s: route /%s is already used by virtual server %s", routePath, route, route)
+		}
+		owners[route] = "httpRoutes." + routePath
+		target, err := url.Parse(c.HTTPRoutes[routePath].Target)
+		if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+			return fmt.Errorf("httpRoutes.%s: target must be an http(s) url", routePath)
+		}
+	}
+	return nil
+}
+
+func (c *Config) validateOptions(where string, options *OptionsV2) error {
+	if options == nil {
+		return nil
+	}
+	if alert := options.SizeAlert; alert != nil {
+		if alert.MaxResultBytes < 0 || (alert.Factor != 0 && alert.Factor <= 1) {
+			return fmt.Errorf("%s.sizeAlert: maxResultBytes must not be negative and factor must be greater than 1", where)
+		}
+	}
+	if options.MaxSessions < 0 || options.MaxRequestsPerMinute < 0 || options.MaxBytesPerSecond < 0 {
+		return fmt.Errorf("%s: maxSessions, maxRequestsPerMinute and maxBytesPerSecond must not be negative", where)
+	}
+	switch options.WaitForClients {
+	case "":
+	case WaitForClientsAll, WaitForClientsAny, WaitForClientsNone:
+		if where != "mcpProxy.options" {
+			return fmt.Errorf("%s.waitForClients: only supported in mcpProxy.options", where)
+		}
+	default:
+		return fmt.Errorf("%s.waitForClients: must be all, any or none", where)
+	}
+	switch options.Conformance {
+	case "", ConformanceModeLog, ConformanceModeReject:
+	default:
+		return fmt.Errorf("%s.conformance: must be log or reject", where)
+	}
+	switch options.ValidateOutput {
+	case "", ConformanceModeLog, ConformanceModeReject:
+	default:
+		return fmt.Errorf("%s.validateOutput: must be log or reject", where)
+	}
+	if binary := options.BinaryContent; binary != nil {
+		switch binary.Mode {
+		case "", BinaryContentModePassthrough, BinaryContentModeStrip, BinaryContentModeOffload:
+		default:
+			return fmt.Errorf("%s.binaryContent.mode: must be passthrough, strip or offload", where)
+		}
+		for _, kind := range binary.Types {
+			if kind != binaryContentImage && kind != binaryContentAudio && kind != binaryContentResource {
+				return fmt.Errorf("%s.binaryContent.types: %q must be image, audio or resource", where, kind)
+			}
+		}
+		if binary.MinBytes < 0 || binary.TTL < 0 {
+			return fmt.Errorf("%s.binaryContent: minBytes and ttl must not be negative", where)
+		}
+	}
+	if offload := options.OffloadResults; offload != nil {
+		if offload.MinBytes <= 0 {
+			return fmt.Errorf("%s.offloadResults.minBytes: must be positive", where)
+		}
+		if c.McpProxy == nil || c.McpProxy.ResultStore == nil {
+			return fmt.Errorf("%s.offloadResults: requires mcpProxy.resultStore", where)
+		}
+	}
+	if toolCap := options.ToolCap; toolCap != nil {
+		if toolCap.Limit <= 0 {
+			return fmt.Errorf("%s.toolCap.limit: must be positive", where)
+		}
+		switch toolCap.Mode {
+		case "", ToolCapModePaginate, ToolCapModeRank:
+		default:
+			return fmt.Errorf("%s.toolCap.mode: must be paginate or rank", where)
+		}
+	}
+	if trace := options.TraceWire; trace != nil {
+		for _, pattern := range trace.RedactPatterns {
+			if _, err := regexp.Compile(pattern); err != nil {
+				return fmt.Errorf("%s.traceWire.redactPatterns: %w", where, err)
+			}
+		}
+	}
+	if options.IPFilter == nil {
+		return nil
+	}
+	if _, err := newIPFilter(options.IPFilter, nil); err != nil {
+		return fmt.Errorf("%s.%w", where, err)
+	}
+	countries := len(options.IPFilter.AllowCountries) + len(options.IPFilter.BlockCountries)
+	if countries > 0 && (c.McpProxy.GeoIP == nil || c.McpProxy.GeoIP.Database == "") {
+		return fmt.Errorf("%s.ipFilter: country lists require mcpProxy.geoip.database", where)
+	}
+	return nil
+}
+
+// setDefaults fills in the options servers, virtual servers and profiles
+// inherit from mcpProxy.options. It is safe to call more than once.
+func (c *Config) setDefaults() {
+	if c.McpProxy.Options == nil {
+		c.McpProxy.Options = &OptionsV2{}
+	}
+	if c.McpServers == nil {
+		c.McpServers = make(map[string]*MCPClientConfigV2)
+	}
+	for _, clientConfig := range c.McpServers {
+		inheritOptions(clientConfig, c.McpProxy.Options)
+	}
+	for _, virtualConfig := range c.VirtualServers {
+		virtualConfig.Options = inheritRouteOptions(virtualConfig.Options, c.McpProxy.Options)
+	}
+	for _, profileConfig := range c.Profiles {
+		profileConfig.Options = inheritRouteOptions(profileConfig.Options, c.McpProxy.Options)
+	}
+	if library := c.McpProxy.PromptLibrary; library != nil {
+		library.Options = inheritRouteOptions(library.Options, c.McpProxy.Options)
+	}
+	if search := c.McpProxy.ToolSearch; search != nil {
+		search.Options = inheritRouteOptions(search.Options, c.McpProxy.Options)
+	}
+	if c.McpProxy.Type == "" {
+		c.McpProxy.Type = MCPServerTypeSSE // default to SSE
+	}
+}
@@ -0,0 +1,113 @@
+package proxy
+
+// ConfigOption sets part of a Config built with NewConfig.
+type ConfigOption func(*Config)
+
+// NewConfig builds a config in code instead of JSON. The result listens on
+// nothing and uses streamable HTTP unless options say otherwise; call
+// Validate before handing it to New to catch mistakes early.
+func NewConfig(opts ...ConfigOption) *Config {
+	config := &Config{
+		McpProxy: &MCPProxyConfigV2{
+			Name:    "mcp-proxy",
+			Version: BuildVersion,
+			Type:    MCPServerTypeStreamable,
+			Options: &OptionsV2{},
+		},
+		McpServers:     make(map[string]*MCPClientConfigV2),
+		VirtualServers: make(map[string]*VirtualServerConfig),
+		Profiles:       make(map[string]*ProfileConfig),
+		HTTPRoutes:     make(map[string]*HTTPRouteConfig),
+	}
+	for _, opt := range opts {
+		opt(config)
+	}
+	config.setDefaults()
+	return config
+}
+
+// WithListener sets the address the proxy listens on and the public base URL
+// clients reach it at.
+func WithListener(addr, baseURL string) ConfigOption {
+	return func(c *Config) {
+		c.McpProxy.Addr = addr
+		c.McpProxy.BaseURL = baseURL
+	}
+}
+
+// WithServerType selects the transport served to clients.
+func WithServerType(serverType MCPServerType) ConfigOption {
+	return func(c *Config) {
+		c.McpProxy.Type = serverType
+	}
+}
+
+// WithAuthTokens sets the default tokens of every route.
+func WithAuthTokens(tokens ...AuthToken) ConfigOption {
+	return func(c *Config) {
+		c.McpProxy.Options.AuthTokens = tokens
+	}
+}
+
+// WithProxyConfig lets opts edit the mcpProxy section directly, for
+// settings without a dedicated option.
+func WithProxyConfig(edit func(*MCPProxyConfigV2)) ConfigOption {
+	return func(c *Config) {
+		edit(c.McpProxy)
+	}
+}
+
+// WithServer adds an upstream server, see StdioServer, SSEServer and
+// StreamableServer.
+func WithServer(name string, server *MCPClientConfigV2) ConfigOption {
+	return func(c *Config) {
+		c.McpServers[name] = server
+	}
+}
+
+// WithVirtualServer adds a virtual server.
+func WithVirtualServer(name string, server *VirtualServerConfig) ConfigOption {
+	return func(c *Config) {
+		c.VirtualServers[name] = server
+	}
+}
+
+// WithProfile adds a profile.
+func WithProfile(name string, profile *ProfileConfig) ConfigOption {
+	return func(c *Config) {
+		c.Profiles[name] = profile
+	}
+}
+
+// WithHTTPRoute reverse-proxies path and everything below it to route's
+// target.
+func WithHTTPRoute(path string, route *HTTPRouteConfig) ConfigOption {
+	return func(c *Config) {
+		c.HTTPRoutes[path] = route
+	}
+}
+
+// StdioServer describes an upstream started as a child process.
+func StdioServer(command string, args ...string) *MCPClientConfigV2 {
+	return &MCPClientConfigV2{
+		TransportType: MCPClientTypeStdio,
+		Command:       command,
+		Args:          args,
+	}
+}
+
+// SSEServer describes an upstream reached over SSE.
+func SSEServer(url string) *MCPClientConfigV2 {
+	return &MCPClientConfigV2{
+		TransportType: MCPClientTypeSSE,
+		URL:           url,
+	}
+}
+
+// StreamableServer describes an upstream reached over streamable HTTP.
+func StreamableServer(url string) *MCPClientConfigV2 {
+	return &MCPClientConfigV2{
+		TransportType: MCPClientTypeStreamable,
+		URL:           url,
+	}
+}
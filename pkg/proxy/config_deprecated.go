@@ -0,0 +1,166 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"slices"
+
+	"github.com/tbxark/optional-go"
+)
+
+// ---- V1 ----
+
+type MCPClientConfigV1 struct {
+	Type           MCPClientType   `json:"type"`
+	Config         json.RawMessage `json:"config"`
+	PanicIfInvalid bool            `json:"panicIfInvalid"`
+	LogEnabled     bool            `json:"logEnabled"`
+	AuthTokens     []string        `json:"authTokens"`
+}
+
+type MCPProxyConfigV1 struct {
+	BaseURL          string   `json:"baseURL"`
+	Addr             string   `json:"addr"`
+	Name             string   `json:"name"`
+	Version          string   `json:"version"`
+	GlobalAuthTokens []string `json:"globalAuthTokens"`
+}
+
+func parseMCPClientConfigV1(conf *MCPClientConfigV1) (any, error) {
+	switch conf.Type {
+	case MCPClientTypeStdio:
+		var config StdioMCPClientConfig
+		err := json.Unmarshal(conf.Config, &config)
+		if err != nil {
+			return nil, err
+		}
+		return &config, nil
+	case MCPClientTypeSSE:
+		var config SSEMCPClientConfig
+		err := json.Unmarshal(conf.Config, &config)
+		if err != nil {
+			return nil, err
+		}
+		return &config, nil
+	case MCPClientTypeStreamable:
+		var config StreamableMCPClientConfig
+		err := json.Unmarshal(conf.Config, &config)
+		if err != nil {
+			return nil, err
+		}
+		return &config, nil
+	default:
+		return nil, errors.New("invalid client type")
+	}
+}
+
+// adaptMCPClientConfigV1ToV2 converts the v1 sections of conf in place and
+// returns a note for every field it moved, renamed or dropped.
+func adaptMCPClientConfigV1ToV2(conf *FullConfig) []string {
+	var notes []string
+	if conf.DeprecatedServerV1 != nil {
+		if conf.McpProxy != nil {
+			notes = append(notes, "server: ignored because mcpProxy is set")
+		} else {
+			v1 := conf.DeprecatedServerV1
+			conf.McpProxy = &MCPProxyConfigV2{
+				BaseURL: v1.BaseURL,
+				Addr:    v1.Addr,
+				Name:    v1.Name,
+				Version: v1.Version,
+				Options: &OptionsV2{
+					AuthTokens: newAuthTokens(v1.GlobalAuthTokens...),
+				},
+			}
+			notes = append(notes, "server: moved to mcpProxy")
+			if len(v1.GlobalAuthTokens) > 0 {
+				notes = append(notes, "server.globalAuthTokens: moved to mcpProxy.options.authTokens and added to every migrated client's authTokens")
+			}
+		}
+	}
+
+	if len(conf.DeprecatedClientsV1) > 0 {
+		if len(conf.McpServers) > 0 {
+			notes = append(notes, "clients: ignored because mcpServers is set")
+		} else {
+			conf.McpServers = make(map[string]*MCPClientConfigV2)
+			for _, name := range slices.Sorted(maps.Keys(conf.DeprecatedClientsV1)) {
+				clientConfig := conf.DeprecatedClientsV1[name]
+				clientInfo, cErr := parseMCPClientConfigV1(clientConfig)
+				if cErr != nil {
+					notes = append(notes, fmt.Sprintf("clients.%s: dropped, %v", name, cErr))
+					continue
+				}
+				options := &OptionsV2{
+					AuthTokens: newAuthTokens(clientConfig.AuthTokens...),
+				}
+				if clientConfig.PanicIfInvalid {
+					options.PanicIfInvalid = optional.NewField(true)
+				}
+				if clientConfig.LogEnabled {
+					options.LogEnabled = optional.NewField(true)
+				}
+				if conf.DeprecatedServerV1 != nil && len(conf.DeprecatedServerV1.GlobalAuthTokens) > 0 {
+					options.AuthTokens = append(options.AuthTokens, newAuthTokens(conf.DeprecatedServerV1.GlobalAuthTokens...)...)
+				}
+				switch v := clientInfo.(type) {
+				case *StdioMCPClientConfig:
+					conf.McpServers[name] = &MCPClientConfigV2{
+						Command: v.Command,
+						Args:    v.Args,
+						Env:     v.Env,
+						Options: options,
+					}
+				case *SSEMCPClientConfig:
+					conf.McpServers[name] = &MCPClientConfigV2{
+						URL:     v.URL,
+						Headers: v.Headers,
+						Options: options,
+					}
+				case *StreamableMCPClientConfig:
+					conf.McpServers[name] = &MCPClientConfigV2{
+						TransportType: MCPClientTypeStreamable,
+						URL:           v.URL,
+						Headers:       v.Headers,
+						Timeout:       v.Timeout,
+						Options:       options,
+					}
+				default:
+					continue
+				}
+				notes = append(notes, fmt.Sprintf("clients.%s: moved to mcpServers.%s; type and config fields are now inlined, panicIfInvalid, logEnabled and authTokens moved to options", name, name))
+			}
+		}
+	}
+	// remove deprecated fields
+	conf.DeprecatedServerV1 = nil
+	conf.DeprecatedClientsV1 = nil
+	return notes
+}
+
+// MigrateConfig converts a v1 config to the v2 layout. It returns the v2
+// config, without defaults applied so it can be written back as is, and a
+// note for every field that was moved, renamed or dropped.
+func MigrateConfig(data []byte) (*Config, []string, error) {
+	var conf FullConfig
+	if err := json.Unmarshal(data, &conf); err != nil {
+		return nil, nil, err
+	}
+	if conf.DeprecatedServerV1 == nil && conf.DeprecatedClientsV1 == nil {
+		return nil, nil, errors.New("not a v1 config: neither server nor clients is set")
+	}
+	notes := adaptMCPClientConfigV1ToV2(&conf)
+	config := &Config{
+		McpProxy:       conf.McpProxy,
+		McpServers:     conf.McpServers,
+		VirtualServers: conf.VirtualServers,
+		Profiles:       conf.Profiles,
+		HTTPRoutes:     conf.HTTPRoutes,
+	}
+	if err := config.Validate(); err != nil {
+		return config, notes, fmt.Errorf("migrated config is invalid: %w", err)
+	}
+	return config, notes, nil
+}
@@ -0,0 +1,132 @@
+package proxy
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMigrateConfig(t *testing.T) {
+	config, notes, err := MigrateConfig([]byte(`{
+		"server": {"baseURL": "http://localhost:9090", "addr": ":9090", "name": "proxy", "version": "1.0", "globalAuthTokens": ["global"]},
+		"clients": {
+			"fetch": {"type": "stdio", "config": {"command": "uvx", "args": ["mcp-server-fetch"], "env": {"A": "1"}}, "panicIfInvalid": true, "authTokens": ["client"]},
+			"remote": {"type": "sse", "config": {"url": "http://remote/sse", "headers": {"X-Key": "k"}}, "logEnabled": true},
+			"stream": {"type": "streamable-http", "config": {"url": "http://stream/mcp", "timeout": 1000000000}},
+			"ftp": {"type": "ftp", "config": {}}
+		}
+	}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantNotes := []string{
+		"server: moved to mcpProxy",
+		"server.globalAuthTokens: moved to mcpProxy.options.authTokens",
+		"clients.fetch: moved to mcpServers.fetch;",
+		"clients.ftp: dropped, invalid client type",
+		"clients.remote: moved to mcpServers.remote;",
+		"clients.stream: moved to mcpServers.stream;",
+	}
+	if len(notes) != len(wantNotes) {
+		t.Fatalf("got notes %q, want %d", notes, len(wantNotes))
+	}
+	for i, want := range wantNotes {
+		if !strings.HasPrefix(notes[i], want) {
+			t.Errorf("note %d = %q, want it to start with %q", i, notes[i], want)
+		}
+	}
+
+	if p := config.McpProxy; p.BaseURL != "http://localhost:9090" || p.Addr != ":9090" || p.Name != "proxy" || p.Version != "1.0" ||
+		!reflect.DeepEqual(p.Options.AuthTokens, newAuthTokens("global")) {
+		t.Errorf("mcpProxy = %+v, options = %+v", p, p.Options)
+	}
+	if _, ok := config.McpServers["ftp"]; ok {
+		t.Error("client of an unknown type was migrated")
+	}
+
+	fetch := config.McpServers["fetch"]
+	if fetch.TransportType != "" || fetch.Command != "uvx" || !reflect.DeepEqual(fetch.Args, []string{"mcp-server-fetch"}) || fetch.Env["A"] != "1" {
+		t.Errorf("fetch = %+v", fetch)
+	}
+	if v, ok := fetch.Options.PanicIfInvalid.Get(); !ok || !v || fetch.Options.LogEnabled.Present() {
+		t.Errorf("fetch options = %+v", fetch.Options)
+	}
+	if !reflect.DeepEqual(fetch.Options.AuthTokens, newAuthTokens("client", "global")) {
+		t.Errorf("fetch authTokens = %v", fetch.Options.AuthTokens)
+	}
+
+	remote := config.McpServers["remote"]
+	if remote.TransportType != "" || remote.URL != "http://remote/sse" || remote.Headers["X-Key"] != "k" {
+		t.Errorf("remote = %+v", remote)
+	}
+	if v, ok := remote.Options.LogEnabled.Get(); !ok || !v || remote.Options.PanicIfInvalid.Present() {
+		t.Errorf("remote options = %+v", remote.Options)
+	}
+	if !reflect.DeepEqual(remote.Options.AuthTokens, newAuthTokens("global")) {
+		t.Errorf("remote authTokens = %v", remote.Options.AuthTokens)
+	}
+
+	stream := config.McpServers["stream"]
+	if stream.TransportType != MCPClientTypeStreamable || stream.URL != "http://stream/mcp" || stream.Timeout != time.Second {
+		t.Errorf("stream = %+v", stream)
+	}
+
+	data, err := json.Marshal(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, unset := range []string{`"panicIfInvalid":null`, `"logEnabled":null`} {
+		if strings.Contains(string(data), unset) {
+			t.Errorf("migrated config contains %s: %s", unset, data)
+		}
+	}
+}
+
+func TestMigrateConfigConflicts(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    string
+		wantNotes []string
+		wantErr   string
+	}{
+		{
+			name:    "v2 config",
+			config:  `{"mcpProxy": {"addr": ":9090"}, "mcpServers": {}}`,
+			wantErr: "not a v1 config",
+		},
+		{
+			name:      "server next to mcpProxy",
+			config:    `{"server": {"addr": ":1"}, "mcpProxy": {"addr": ":9090"}}`,
+			wantNotes: []string{"server: ignored because mcpProxy is set"},
+		},
+		{
+			name:      "clients next to mcpServers",
+			config:    `{"mcpProxy": {"addr": ":9090"}, "clients": {"a": {"type": "stdio", "config": {"command": "a"}}}, "mcpServers": {"b": {"command": "b"}}}`,
+			wantNotes: []string{"clients: ignored because mcpServers is set"},
+		},
+		{
+			name:      "invalid result",
+			config:    `{"clients": {}}`,
+			wantNotes: nil,
+			wantErr:   "migrated config is invalid: mcpProxy is required",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, notes, err := MigrateConfig([]byte(tt.config))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+			} else if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(notes, tt.wantNotes) {
+				t.Errorf("got notes %q, want %q", notes, tt.wantNotes)
+			}
+		})
+	}
+}
@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"maps"
+	"net"
+	"slices"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// claudeDesktopServer is an entry of the mcpServers block in Claude
+// Desktop's claude_desktop_config.json. Remote entries use type and url as
+// written by newer clients.
+type claudeDesktopServer struct {
+	Command  string            `json:"command"`
+	Args     []string          `json:"args"`
+	Env      map[string]string `json:"env"`
+	Type     string            `json:"type"`
+	URL      string            `json:"url"`
+	Headers  map[string]string `json:"headers"`
+	Disabled bool              `json:"disabled"`
+}
+
+// ImportClaudeDesktopConfig converts the mcpServers block of a Claude
+// Desktop config into a proxy config around proxyConfig. It returns notes
+// on entries that were skipped or need attention on the target host.
+func ImportClaudeDesktopConfig(data []byte, proxyConfig *MCPProxyConfigV2) (*Config, []string, error) {
+	var desktop struct {
+		McpServers map[string]claudeDesktopServer `json:"mcpServers"`
+	}
+	if err := json.Unmarshal(data, &desktop); err != nil {
+		return nil, nil, err
+	}
+	if len(desktop.McpServers) == 0 {
+		return nil, nil, errors.New("no mcpServers found")
+	}
+
+	config := &Config{
+		McpProxy:   proxyConfig,
+		McpServers: make(map[string]*MCPClientConfigV2),
+	}
+	var notes []string
+	for _, name := range slices.Sorted(maps.Keys(desktop.McpServers)) {
+		entry := desktop.McpServers[name]
+		server := &MCPClientConfigV2{
+			Command: entry.Command,
+			Args:    entry.Args,
+			Env:     entry.Env,
+			URL:     entry.URL,
+			Headers: entry.Headers,
+		}
+		switch entry.Type {
+		case "", "stdio":
+		case "sse":
+			server.TransportType = MCPClientTypeSSE
+		case "http", "streamable-http":
+			server.TransportType = MCPClientTypeStreamable
+		default:
+			notes = append(notes, fmt.Sprintf("%s: skipped, unsupported type %q", name, entry.Type))
+			continue
+		}
+		if _, err := parseMCPClientConfigV2(server); err != nil {
+			notes = append(notes, fmt.Sprintf("%s: skipped, %v", name, err))
+			continue
+		}
+		if entry.Disabled {
+			server.Options = &OptionsV2{Disabled: true}
+			notes = append(notes, fmt.Sprintf("%s: imported as disabled", name))
+		}
+		for _, arg := range append([]string{entry.Command}, entry.Args...) {
+			if isLocalUserPath(arg) {
+				notes = append(notes, fmt.Sprintf("%s: refers to %s, make sure it exists on the target host", name, arg))
+				break
+			}
+		}
+		config.McpServers[name] = server
+	}
+	return config, notes, nil
+}
+
+// isLocalUserPath reports whether arg looks like a path inside a desktop
+// user's home directory, which rarely exists on a server.
+func isLocalUserPath(arg string) bool {
+	for _, prefix := range []string{"~/", "/Users/", "/home/", `C:\Users\`, "C:/Users/"} {
+		if strings.HasPrefix(arg, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// Labels that mark a docker compose service as an MCP server and describe
+// how to reach it.
+const (
+	composeLabelEnable    = "mcp-proxy.enable"
+	composeLabelName      = "mcp-proxy.name"
+	composeLabelPort      = "mcp-proxy.port"
+	composeLabelPath      = "mcp-proxy.path"
+	composeLabelTransport = "mcp-proxy.transport"
+)
+
+// composeFile is the part of a docker compose file the generator reads.
+// Labels, ports and expose come in a list and a map form, so they are
+// decoded loosely.
+type composeFile struct {
+	Services map[string]struct {
+		Labels any   `yaml:"labels"`
+		Ports  []any `yaml:"ports"`
+		Expose []any `yaml:"expose"`
+	} `yaml:"services"`
+}
+
+// ImportComposeConfig builds a proxy config around proxyConfig from the
+// services of a docker compose file labeled mcp-proxy.enable=true. The
+// servers are reached by service name on the compose network, at the
+// container port. It returns notes on services that were skipped.
+func ImportComposeConfig(data []byte, proxyConfig *MCPProxyConfigV2) (*Config, []string, error) {
+	var compose composeFile
+	if err := yaml.Unmarshal(data, &compose); err != nil {
+		return nil, nil, err
+	}
+	config := &Config{
+		McpProxy:   proxyConfig,
+		McpServers: make(map[string]*MCPClientConfigV2),
+	}
+	var notes []string
+	for _, service := range slices.Sorted(maps.Keys(compose.Services)) {
+		entry := compose.Services[service]
+		labels := composeLabels(entry.Labels)
+		if enabled, _ := strconv.ParseBool(labels[composeLabelEnable]); !enabled {
+			continue
+		}
+		name := cmp.Or(labels[composeLabelName], service)
+		port := labels[composeLabelPort]
+		if port == "" {
+			port = composeContainerPort(entry.Expose, entry.Ports)
+		}
+		if port == "" {
+			notes = append(notes, fmt.Sprintf("%s: skipped, no port; set the %s label", service, composeLabelPort))
+			continue
+		}
+		server := &MCPClientConfigV2{TransportType: MCPClientTypeStreamable}
+		path := "/mcp"
+		switch transport := labels[composeLabelTransport]; transport {
+		case "", string(MCPClientTypeStreamable):
+		case string(MCPClientTypeSSE):
+			server.TransportType, path = MCPClientTypeSSE, "/sse"
+		default:
+			notes = append(notes, fmt.Sprintf("%s: skipped, unsupported transport %q", service, transport))
+			continue
+		}
+		if p := labels[composeLabelPath]; p != "" {
+			path = "/" + strings.TrimPrefix(p, "/")
+		}
+		server.URL = "http://" + net.JoinHostPort(service, port) + path
+		if _, exists := config.McpServers[name]; exists {
+			notes = append(notes, fmt.Sprintf("%s: skipped, server name %s is already used", service, name))
+			continue
+		}
+		config.McpServers[name] = server
+	}
+	if len(config.McpServers) == 0 {
+		return nil, notes, fmt.Errorf("no services labeled %s=true found", composeLabelEnable)
+	}
+	return config, notes, nil
+}
+
+// composeLabels reads labels in either the map or the "key=value" list
+// form.
+func composeLabels(raw any) map[string]string {
+	labels := make(map[string]string)
+	switch v := raw.(type) {
+	case map[string]any:
+		for key, value := range v {
+			labels[key] = fmt.Sprint(value)
+		}
+	case []any:
+		for _, item := range v {
+			key, value, _ := strings.Cut(fmt.Sprint(item), "=")
+			labels[key] = value
+		}
+	}
+	return labels
+}
+
+// composeContainerPort returns the first container port a service exposes
+// or publishes, in any of the short ("8080:80/tcp", 80) and long
+// ({target: 80}) forms.
+func composeContainerPort(expose, ports []any) string {
+	for _, item := range append(slices.Clone(expose), ports...) {
+		var port string
+		switch v := item.(type) {
+		case map[string]any:
+			port = fmt.Sprint(v["target"])
+		default:
+			spec := fmt.Sprint(v)
+			spec, _, _ = strings.Cut(spec, "/")
+			port = spec[strings.LastIndex(spec, ":")+1:]
+		}
+		// Ranges such as 8000-8010 are not a single server's port.
+		if _, err := strconv.Atoi(port); err == nil {
+			return port
+		}
+	}
+	return ""
+}
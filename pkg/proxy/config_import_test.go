@@ -0,0 +1,89 @@
+package proxy
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestImportClaudeDesktopConfig(t *testing.T) {
+	proxyConfig := &MCPProxyConfigV2{Addr: ":9090", Options: &OptionsV2{AuthTokens: newAuthTokens("secret")}}
+	config, notes, err := ImportClaudeDesktopConfig([]byte(`{
+		"globalShortcut": "Ctrl+Space",
+		"mcpServers": {
+			"files": {"command": "npx", "args": ["-y", "@modelcontextprotocol/server-filesystem", "/Users/me/Documents"], "env": {"DEBUG": "1"}},
+			"remote": {"type": "sse", "url": "http://remote/sse", "headers": {"Authorization": "Bearer x"}},
+			"http": {"type": "http", "url": "http://http/mcp"},
+			"streamable": {"type": "streamable-http", "url": "http://streamable/mcp"},
+			"off": {"type": "stdio", "command": "~/bin/server", "disabled": true},
+			"socket": {"type": "websocket", "url": "ws://socket"},
+			"empty": {"type": "stdio"}
+		}
+	}`), proxyConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantNotes := []string{
+		"empty: skipped, invalid server type",
+		"files: refers to /Users/me/Documents, make sure it exists on the target host",
+		"off: imported as disabled",
+		"off: refers to ~/bin/server, make sure it exists on the target host",
+		`socket: skipped, unsupported type "websocket"`,
+	}
+	if !reflect.DeepEqual(notes, wantNotes) {
+		t.Errorf("got notes %q, want %q", notes, wantNotes)
+	}
+	if config.McpProxy != proxyConfig {
+		t.Errorf("mcpProxy = %+v, want the given proxy config", config.McpProxy)
+	}
+
+	want := map[string]*MCPClientConfigV2{
+		"files": {
+			Command: "npx",
+			Args:    []string{"-y", "@modelcontextprotocol/server-filesystem", "/Users/me/Documents"},
+			Env:     map[string]string{"DEBUG": "1"},
+		},
+		"remote":     {TransportType: MCPClientTypeSSE, URL: "http://remote/sse", Headers: map[string]string{"Authorization": "Bearer x"}},
+		"http":       {TransportType: MCPClientTypeStreamable, URL: "http://http/mcp"},
+		"streamable": {TransportType: MCPClientTypeStreamable, URL: "http://streamable/mcp"},
+		"off":        {Command: "~/bin/server", Options: &OptionsV2{Disabled: true}},
+	}
+	if len(config.McpServers) != len(want) {
+		t.Errorf("imported %d servers, want %d", len(config.McpServers), len(want))
+	}
+	for name, wantServer := range want {
+		if got := config.McpServers[name]; !reflect.DeepEqual(got, wantServer) {
+			t.Errorf("%s = %+v, want %+v", name, got, wantServer)
+		}
+	}
+}
+
+func TestImportClaudeDesktopConfigErrors(t *testing.T) {
+	for _, data := range []string{
+		`{"mcpServers": `,
+		`{}`,
+		`{"mcpServers": {}}`,
+	} {
+		if _, _, err := ImportClaudeDesktopConfig([]byte(data), &MCPProxyConfigV2{}); err == nil {
+			t.Errorf("ImportClaudeDesktopConfig(%s) succeeded", data)
+		}
+	}
+}
+
+func TestIsLocalUserPath(t *testing.T) {
+	for arg, want := range map[string]bool{
+		"~/projects":             true,
+		"/Users/me":              true,
+		"/home/me/data":          true,
+		`C:\Users\me\Documents`:  true,
+		"C:/Users/me/Documents":  true,
+		"/srv/data":              false,
+		"-y":                     false,
+		"@scope/server":          false,
+		"relative/~/not-a-home/": false,
+	} {
+		if got := isLocalUserPath(arg); got != want {
+			t.Errorf("isLocalUserPath(%q) = %v, want %v", arg, got, want)
+		}
+	}
+}
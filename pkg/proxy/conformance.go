@@ -0,0 +1,328 @@
+package proxy
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// conformanceReportLimit caps the violations listed per response.
+const conformanceReportLimit = 10
+
+// toolNamePattern is the tool name format the MCP spec asks servers for.
+var toolNamePattern = regexp.MustCompile(`^[A-Za-z0-9_.-]{1,128}$`)
+
+// conformanceChecker checks the results an upstream returns against the
+// MCP spec before the mcp-go client decodes them, so that malformed tools,
+// content blocks and prompts are caught where they enter the proxy. A nil
+// checker checks nothing.
+type conformanceChecker struct {
+	server string
+	mode   ConformanceMode
+
+	mu sync.Mutex
+	// outputSchemas records the tools that declared an outputSchema, whose
+	// successful results must carry structuredContent.
+	outputSchemas map[string]bool
+}
+
+func newConformanceChecker(server string, mode ConformanceMode) *conformanceChecker {
+	if mode == "" {
+		return nil
+	}
+	return &conformanceChecker{server: server, mode: mode, outputSchemas: make(map[string]bool)}
+}
+
+// check validates the result of a request. In reject mode it returns the
+// response to use instead when the result does not conform: lists with the
+// nonconforming entries dropped, so that one bad tool does not take the
+// whole server down, and a JSON-RPC error for everything else.
+func (c *conformanceChecker) check(method string, params any, response *transport.JSONRPCResponse) *transport.JSONRPCResponse {
+	if c == nil || response.Error != nil {
+		return nil
+	}
+	v := &conformanceViolations{}
+	var raw any
+	var result map[string]any
+	dropped := false
+	if err := json.Unmarshal(response.Result, &raw); err != nil {
+		v.add("result", "is not valid JSON")
+	} else if object, ok := v.object("result", raw); ok {
+		result = object
+		dropped = c.checkResult(v, method, params, result)
+	}
+	if len(v.found) == 0 {
+		return nil
+	}
+	report := v.found
+	if len(report) > conformanceReportLimit {
+		report = append(report[:conformanceReportLimit:conformanceReportLimit], fmt.Sprintf("and %d more", len(v.found)-conformanceReportLimit))
+	}
+	switch {
+	case c.mode != ConformanceModeReject:
+		log.Printf("<%s> Nonconforming %s result: %s", c.server, method, strings.Join(report, "; "))
+		return nil
+	case dropped:
+		log.Printf("<%s> Dropped nonconforming entries from %s result: %s", c.server, method, strings.Join(report, "; "))
+		if data, err := json.Marshal(result); err == nil {
+			filtered := *response
+			filtered.Result = data
+			return &filtered
+		}
+	}
+	log.Printf("<%s> Rejected nonconforming %s result: %s", c.server, method, strings.Join(report, "; "))
+	return &transport.JSONRPCResponse{
+		JSONRPC: mcp.JSONRPC_VERSION,
+		ID:      response.ID,
+		Error: &mcp.JSONRPCErrorDetails{
+			Code:    mcp.INTERNAL_ERROR,
+			Message: fmt.Sprintf("upstream %s returned a %s result that does not conform to the MCP spec", c.server, method),
+			Data:    map[string]any{"violations": report},
+		},
+	}
+}
+
+// checkResult records the violations in result and reports whether
+// nonconforming list entries were dropped from it.
+func (c *conformanceChecker) checkResult(v *conformanceViolations, method string, params any, result map[string]any) bool {
+	switch method {
+	case string(mcp.MethodInitialize):
+		v.nonEmptyString("protocolVersion", result["protocolVersion"])
+		v.object("capabilities", result["capabilities"])
+		if info, ok := v.object("serverInfo", result["serverInfo"]); ok {
+			v.nonEmptyString("serverInfo.name", info["name"])
+		}
+	case string(mcp.MethodToolsList):
+		return c.checkTools(v, result)
+	case string(mcp.MethodToolsCall):
+		c.checkToolResult(v, toolCallName(params), result)
+	case string(mcp.MethodPromptsList):
+		return c.checkEntries(v, result, "prompts", func(path string, prompt map[string]any) {
+			v.nonEmptyString(path+".name", prompt["name"])
+			if arguments, present := prompt["arguments"]; present {
+				args, _ := v.array(path+".arguments", arguments)
+				for i, arg := range args {
+					argPath := fmt.Sprintf("%s.arguments[%d]", path, i)
+					if argument, ok := v.object(argPath, arg); ok {
+						v.nonEmptyString(argPath+".name", argument["name"])
+					}
+				}
+			}
+		})
+	case string(mcp.MethodPromptsGet):
+		messages, _ := v.array("messages", result["messages"])
+		for i, item := range messages {
+			path := fmt.Sprintf("messages[%d]", i)
+			message, ok := v.object(path, item)
+			if !ok {
+				continue
+			}
+			if role := message["role"]; role != string(mcp.RoleUser) && role != string(mcp.RoleAssistant) {
+				v.add(path+".role", `must be "user" or "assistant"`)
+			}
+			v.content(path+".content", message["content"])
+		}
+	case string(mcp.MethodResourcesList):
+		return c.checkEntries(v, result, "resources", func(path string, resource map[string]any) {
+			v.nonEmptyString(path+".uri", resource["uri"])
+			v.nonEmptyString(path+".name", resource["name"])
+		})
+	case string(mcp.MethodResourcesTemplatesList):
+		return c.checkEntries(v, result, "resourceTemplates", func(path string, template map[string]any) {
+			v.nonEmptyString(path+".uriTemplate", template["uriTemplate"])
+			v.nonEmptyString(path+".name", template["name"])
+		})
+	case string(mcp.MethodResourcesRead):
+		contents, _ := v.array("contents", result["contents"])
+		for i, item := range contents {
+			v.resourceContents(fmt.Sprintf("contents[%d]", i), item)
+		}
+	}
+	return false
+}
+
+// checkEntries checks every object in the list result[key]. In reject mode
+// the entries with violations are removed from the list; it reports
+// whether any were.
+func (c *conformanceChecker) checkEntries(v *conformanceViolations, result map[string]any, key string, check func(path string, entry map[string]any)) bool {
+	items, ok := v.array(key, result[key])
+	if !ok {
+		return false
+	}
+	kept := make([]any, 0, len(items))
+	for i, item := range items {
+		before := len(v.found)
+		path := fmt.Sprintf("%s[%d]", key, i)
+		if entry, ok := v.object(path, item); ok {
+			check(path, entry)
+		}
+		if len(v.found) == before {
+			kept = append(kept, item)
+		}
+	}
+	if c.mode != ConformanceModeReject || len(kept) == len(items) {
+		return false
+	}
+	result[key] = kept
+	return true
+}
+
+func (c *conformanceChecker) checkTools(v *conformanceViolations, result map[string]any) bool {
+	seen := make(map[string]bool)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.checkEntries(v, result, "tools", func(path string, tool map[string]any) {
+		name, _ := tool["name"].(string)
+		switch {
+		case !toolNamePattern.MatchString(name):
+			v.add(path+".name", fmt.Sprintf("%q must be 1 to 128 letters, digits, '_', '-' or '.'", name))
+		case seen[name]:
+			v.add(path+".name", fmt.Sprintf("%q is listed more than once", name))
+		}
+		seen[name] = true
+		v.objectSchema(path+".inputSchema", tool["inputSchema"])
+		_, hasOutputSchema := tool["outputSchema"]
+		if hasOutputSchema {
+			v.objectSchema(path+".outputSchema", tool["outputSchema"])
+		}
+		c.outputSchemas[name] = hasOutputSchema
+	})
+}
+
+func (c *conformanceChecker) checkToolResult(v *conformanceViolations, tool string, result map[string]any) {
+	content, _ := v.array("content", result["content"])
+	for i, item := range content {
+		v.content(fmt.Sprintf("content[%d]", i), item)
+	}
+	isError, present := result["isError"]
+	if _, ok := isError.(bool); present && !ok {
+		v.add("isError", "must be a boolean")
+	}
+	structured, hasStructured := result["structuredContent"]
+	if hasStructured {
+		v.object("structuredContent", structured)
+	}
+	c.mu.Lock()
+	declared := c.outputSchemas[tool]
+	c.mu.Unlock()
+	if declared && !hasStructured && isError != true {
+		v.add("structuredContent", fmt.Sprintf("is required since %s declares an outputSchema", tool))
+	}
+}
+
+// toolCallName returns the tool a tools/call request is for.
+func toolCallName(params any) string {
+	data, err := json.Marshal(params)
+	if err != nil {
+		return ""
+	}
+	var call struct {
+		Name string `json:"name"`
+	}
+	_ = json.Unmarshal(data, &call)
+	return call.Name
+}
+
+// conformanceViolations collects the problems found in one result, each
+// prefixed with the path of the offending value.
+type conformanceViolations struct {
+	found []string
+}
+
+func (v *conformanceViolations) add(path, problem string) {
+	v.found = append(v.found, path+" "+problem)
+}
+
+func (v *conformanceViolations) object(path string, value any) (map[string]any, bool) {
+	object, ok := value.(map[string]any)
+	if !ok {
+		v.add(path, "must be an object")
+	}
+	return object, ok
+}
+
+func (v *conformanceViolations) array(path string, value any) ([]any, bool) {
+	array, ok := value.([]any)
+	if !ok {
+		v.add(path, "must be an array")
+	}
+	return array, ok
+}
+
+func (v *conformanceViolations) nonEmptyString(path string, value any) {
+	if s, ok := value.(string); !ok || s == "" {
+		v.add(path, "must be a non-empty string")
+	}
+}
+
+func (v *conformanceViolations) base64(path string, value any) {
+	s, ok := value.(string)
+	if !ok {
+		v.add(path, "must be a base64 string")
+		return
+	}
+	if _, err := base64.StdEncoding.DecodeString(s); err != nil {
+		v.add(path, "is not valid base64")
+	}
+}
+
+// objectSchema checks a tool's input or output schema, which the spec
+// requires to describe an object.
+func (v *conformanceViolations) objectSchema(path string, value any) {
+	schema, ok := v.object(path, value)
+	if ok && schema["type"] != "object" {
+		v.add(path+".type", `must be "object"`)
+	}
+}
+
+// content checks a content block of a tool result or prompt message.
+func (v *conformanceViolations) content(path string, value any) {
+	block, ok := v.object(path, value)
+	if !ok {
+		return
+	}
+	switch kind := block["type"]; kind {
+	case "text":
+		if _, ok := block["text"].(string); !ok {
+			v.add(path+".text", "must be a string")
+		}
+	case "image", "audio":
+		v.base64(path+".data", block["data"])
+		v.nonEmptyString(path+".mimeType", block["mimeType"])
+	case "resource":
+		v.resourceContents(path+".resource", block["resource"])
+	case "resource_link":
+		v.nonEmptyString(path+".uri", block["uri"])
+		v.nonEmptyString(path+".name", block["name"])
+	default:
+		v.add(path+".type", fmt.Sprintf("%v is not a content type", kind))
+	}
+}
+
+// resourceContents checks the text or blob contents of a resource.
+func (v *conformanceViolations) resourceContents(path string, value any) {
+	contents, ok := v.object(path, value)
+	if !ok {
+		return
+	}
+	v.nonEmptyString(path+".uri", contents["uri"])
+	text, hasText := contents["text"]
+	blob, hasBlob := contents["blob"]
+	switch {
+	case hasText == hasBlob:
+		v.add(path, "must have either text or blob")
+	case hasText:
+		if _, ok := text.(string); !ok {
+			v.add(path+".text", "must be a string")
+		}
+	default:
+		v.base64(path+".blob", blob)
+	}
+}
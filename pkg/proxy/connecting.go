@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	serverStateWaiting    = "waiting"
+	serverStateConnecting = "connecting"
+
+	// connectingRetryAfter is the Retry-After sent while a server is not
+	// connected yet.
+	connectingRetryAfter = 5 * time.Second
+)
+
+// mountConnecting serves the routes of a server that is not connected yet,
+// so clients that arrive early are told to retry rather than finding no
+// server, or one without tools. state is waiting while its dependencies
+// are not up, and connecting after. connectServer replaces the handler.
+func (p *Proxy) mountConnecting(name string, clientConfig *MCPClientConfigV2, state string) {
+	since := time.Now().UTC()
+	message := fmt.Sprintf("server %s is connecting", name)
+	if state == serverStateWaiting {
+		message = fmt.Sprintf("server %s is waiting for its dependencies", name)
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Retry-After", strconv.Itoa(int(connectingRetryAfter.Seconds())))
+		writeJSON(w, http.StatusServiceUnavailable, map[string]any{
+			"error":      message,
+			"server":     name,
+			"state":      state,
+			"since":      since,
+			"retryAfter": int(connectingRetryAfter.Seconds()),
+		})
+	})
+	middlewares := newServerMiddlewares(name, clientConfig.Options, p.sources)
+	for _, route := range clientConfig.routes(name) {
+		p.routes.Handle(mcpRoutePath(p.baseURL.Path, route), chainMiddleware(handler, middlewares...))
+	}
+}
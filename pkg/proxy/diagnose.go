@@ -0,0 +1,245 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	// diagnoseErrorWindow is the number of recent upstream errors kept per
+	// server.
+	diagnoseErrorWindow = 20
+	diagnosePingTimeout = 5 * time.Second
+)
+
+// upstreamLog keeps the parts of an upstream's history GET /<name>/diagnose
+// reports: the latest handshake and the latest errors.
+type upstreamLog struct {
+	mu         sync.Mutex
+	initialize *initializeRecord
+	errors     []upstreamError
+}
+
+type initializeRecord struct {
+	Time            time.Time              `json:"time"`
+	DurationMs      float64                `json:"durationMs"`
+	ProtocolVersion string                 `json:"protocolVersion"`
+	ServerInfo      mcp.Implementation     `json:"serverInfo"`
+	Capabilities    mcp.ServerCapabilities `json:"capabilities"`
+	Instructions    string                 `json:"instructions,omitempty"`
+}
+
+type upstreamError struct {
+	Time time.Time `json:"time"`
+	// Source is what failed, e.g. "initialize", "ping" or "tools/call echo".
+	Source string `json:"source"`
+	Error  string `json:"error"`
+}
+
+func (l *upstreamLog) initialized(result *mcp.InitializeResult, start time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.initialize = &initializeRecord{
+		Time:            start,
+		DurationMs:      milliseconds(time.Since(start)),
+		ProtocolVersion: result.ProtocolVersion,
+		ServerInfo:      result.ServerInfo,
+		Capabilities:    result.Capabilities,
+		Instructions:    result.Instructions,
+	}
+}
+
+func (l *upstreamLog) noteError(source string, err error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.errors) == diagnoseErrorWindow {
+		l.errors = l.errors[1:]
+	}
+	l.errors = append(l.errors, upstreamError{Time: time.Now(), Source: source, Error: err.Error()})
+}
+
+func (l *upstreamLog) snapshot() (*initializeRecord, []upstreamError) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	errs := make([]upstreamError, len(l.errors))
+	// Newest first.
+	for i, e := range l.errors {
+		errs[len(errs)-1-i] = e
+	}
+	return l.initialize, errs
+}
+
+// diagnoseReport is the body of GET /<name>/diagnose.
+type diagnoseReport struct {
+	Server  string          `json:"server"`
+	Time    time.Time       `json:"time"`
+	Request diagnoseRequest `json:"request"`
+	// Upstream is only filled in for requests that are authorized to use
+	// the server.
+	Upstream *diagnoseUpstream `json:"upstream,omitempty"`
+}
+
+// diagnoseRequest describes the request as the proxy saw it, which is what
+// tells apart a client sending the wrong token from a load balancer in
+// front of the proxy dropping the header.
+type diagnoseRequest struct {
+	RemoteAddr     string `json:"remoteAddr"`
+	Host           string `json:"host"`
+	UserAgent      string `json:"userAgent,omitempty"`
+	ForwardedFor   string `json:"forwardedFor,omitempty"`
+	ForwardedProto string `json:"forwardedProto,omitempty"`
+	// Endpoint is the URL MCP clients should connect to.
+	Endpoint     string `json:"endpoint"`
+	AuthRequired bool   `json:"authRequired"`
+	// AuthPresented describes the credentials the request carried without
+	// revealing them, e.g. "bearer (32 characters)".
+	AuthPresented string `json:"authPresented"`
+	AuthMethod    string `json:"authMethod,omitempty"`
+	AuthOutcome   string `json:"authOutcome,omitempty"`
+	Identity      string `json:"identity,omitempty"`
+	Hint          string `json:"hint,omitempty"`
+}
+
+type diagnoseUpstream struct {
+	Transport string `json:"transport"`
+	Connected bool   `json:"connected"`
+	// Reachable is the outcome of a ping sent while building the report.
+	Reachable    bool              `json:"reachable"`
+	PingMs       float64           `json:"pingMs,omitempty"`
+	PingError    string            `json:"pingError,omitempty"`
+	Initialize   *initializeRecord `json:"initialize,omitempty"`
+	Health       healthStatus      `json:"health"`
+	Maintenance  bool              `json:"maintenance"`
+	Tools        int               `json:"tools"`
+	RecentErrors []upstreamError   `json:"recentErrors"`
+}
+
+var authOutcomeHints = map[string]string{
+	authOutcomeMissing:   "the request carried no credentials; send Authorization: Bearer <token> and check that no reverse proxy in front of mcp-proxy strips the header",
+	authOutcomeInvalid:   "the credentials are not accepted on this route; check the token against the server's and mcpProxy's authTokens",
+	authOutcomeForbidden: "the token is valid but its servers list does not include this server",
+	authOutcomeBlocked:   "the identity is on the block list",
+}
+
+// withDiagnose serves GET <route>/diagnose in front of next. The report is
+// served ahead of the route's auth so that a rejected client can still see
+// why; only the request section is shown unless the request is authorized.
+// c is the client mounted on the route, which may have failed to connect.
+func (p *Proxy) withDiagnose(name, route string, clientConfig *MCPClientConfigV2, c *Client, next http.Handler) http.Handler {
+	mcpRoute := mcpRoutePath(p.baseURL.Path, route)
+	auth := newRouteAuth(name, clientConfig.Options.AuthTokens, p.sources)
+	endpoint := strings.TrimSuffix(p.baseURL.String(), "/") + "/" + route + "/mcp"
+	if p.config.McpProxy.Type == MCPServerTypeSSE {
+		endpoint = strings.TrimSuffix(endpoint, "/mcp") + "/sse"
+	}
+	var diagnose http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := diagnoseReport{
+			Server: name,
+			Time:   time.Now().UTC(),
+			Request: diagnoseRequest{
+				RemoteAddr:     r.RemoteAddr,
+				Host:           r.Host,
+				UserAgent:      r.UserAgent(),
+				ForwardedFor:   r.Header.Get("X-Forwarded-For"),
+				ForwardedProto: r.Header.Get("X-Forwarded-Proto"),
+				Endpoint:       endpoint,
+				AuthRequired:   auth.required,
+				AuthPresented:  describeCredentials(r),
+			},
+		}
+		authorized := !auth.required
+		if auth.required {
+			token, method, outcome := auth.check(r)
+			report.Request.AuthMethod = method
+			report.Request.AuthOutcome = outcome
+			report.Request.Identity = callerName(token)
+			report.Request.Hint = authOutcomeHints[outcome]
+			authorized = outcome == authOutcomeSuccess
+		}
+		if authorized {
+			report.Upstream = p.diagnoseUpstream(r.Context(), name, clientConfig, c)
+		}
+		writeJSON(w, http.StatusOK, report)
+	})
+	diagnose = recoverMiddleware(name)(diagnose)
+	// Addresses the route refuses get no report either.
+	if clientConfig.Options.IPFilter != nil {
+		diagnose = newIPFilterMiddleware(name, clientConfig.Options.IPFilter, p.sources.geoIP())(diagnose)
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodGet && r.URL.Path == mcpRoute+"diagnose" {
+			diagnose.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (p *Proxy) diagnoseUpstream(ctx context.Context, name string, clientConfig *MCPClientConfigV2, c *Client) *diagnoseUpstream {
+	initialize, errs := c.diagnostics.snapshot()
+	upstream := &diagnoseUpstream{
+		Transport:    clientTransport(clientConfig),
+		Initialize:   initialize,
+		Health:       c.health.status(),
+		Maintenance:  c.maintenance.Load(),
+		Tools:        len(c.toolList()),
+		RecentErrors: errs,
+	}
+	if current, ok := p.registry.get(name); ok && current == c {
+		upstream.Connected = true
+		pingCtx, cancel := context.WithTimeout(ctx, diagnosePingTimeout)
+		defer cancel()
+		start := time.Now()
+		if err := c.current().Ping(pingCtx); err != nil {
+			upstream.PingError = err.Error()
+		} else {
+			upstream.Reachable = true
+			upstream.PingMs = milliseconds(time.Since(start))
+		}
+	}
+	return upstream
+}
+
+// describeCredentials names the kind of credentials r carries without
+// revealing them.
+func describeCredentials(r *http.Request) string {
+	if r.Header.Get(signatureHeader) != "" {
+		return "signature"
+	}
+	header := r.Header.Get("Authorization")
+	if header == "" {
+		return authMethodNone
+	}
+	scheme, credentials, ok := strings.Cut(header, " ")
+	if !ok {
+		return "malformed Authorization header"
+	}
+	credentials = strings.TrimSpace(credentials)
+	if credentials == "" {
+		return strings.ToLower(scheme) + " without credentials"
+	}
+	return strings.ToLower(scheme) + " (" + strconv.Itoa(len(credentials)) + " characters)"
+}
+
+// clientTransport names how the proxy talks to the upstream.
+func clientTransport(conf *MCPClientConfigV2) string {
+	switch parsed, _ := parseMCPClientConfigV2(conf); parsed.(type) {
+	case *StdioMCPClientConfig:
+		return string(MCPClientTypeStdio)
+	case *SSEMCPClientConfig:
+		return string(MCPClientTypeSSE)
+	case *StreamableMCPClientConfig:
+		return string(MCPClientTypeStreamable)
+	case *StaticMCPClientConfig:
+		return string(MCPClientTypeStatic)
+	case *BuiltinMCPClientConfig:
+		return conf.Command
+	}
+	return ""
+}
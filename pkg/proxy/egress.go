@@ -0,0 +1,152 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+// egressGateway is a forward HTTP proxy on the loopback interface that a
+// stdio server is pointed at through the usual proxy variables. It only
+// lets through requests to allowed hosts and logs everything else. Programs
+// that ignore the proxy variables are not restricted; run those in a
+// network namespace that only reaches the gateway.
+type egressGateway struct {
+	name     string
+	hosts    []string
+	prefixes []netip.Prefix
+	listener net.Listener
+	server   *http.Server
+	forward  *httputil.ReverseProxy
+}
+
+func newEgressGateway(name string, conf *EgressConfig) (*egressGateway, error) {
+	g := &egressGateway{name: name}
+	for _, entry := range conf.Allow {
+		if prefix, err := parseAddressOrPrefix(entry); err == nil {
+			g.prefixes = append(g.prefixes, prefix)
+		} else {
+			g.hosts = append(g.hosts, strings.ToLower(entry))
+		}
+	}
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, fmt.Errorf("egress gateway: %w", err)
+	}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	g.listener = listener
+	g.forward = &httputil.ReverseProxy{
+		Rewrite:   func(r *httputil.ProxyRequest) { r.Out.URL = r.In.URL },
+		Transport: transport,
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("<%s> Egress request to %s failed: %v", name, r.URL.Host, err)
+			http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		},
+	}
+	g.server = &http.Server{Handler: g, ReadHeaderTimeout: 30 * time.Second}
+	go func() {
+		if sErr := g.server.Serve(listener); sErr != nil && sErr != http.ErrServerClosed {
+			log.Printf("<%s> Egress gateway stopped: %v", name, sErr)
+		}
+	}()
+	log.Printf("<%s> Egress limited to %s via %s", name, strings.Join(conf.Allow, ", "), listener.Addr())
+	return g, nil
+}
+
+// allows reports whether host, a name or an IP address, is on the
+// allowlist. "*.example.com" matches subdomains of example.com.
+func (g *egressGateway) allows(host string) bool {
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if addr, err := netip.ParseAddr(strings.Trim(host, "[]")); err == nil {
+		addr = addr.Unmap()
+		for _, prefix := range g.prefixes {
+			if prefix.Contains(addr) {
+				return true
+			}
+		}
+		return false
+	}
+	for _, pattern := range g.hosts {
+		if suffix, ok := strings.CutPrefix(pattern, "*."); ok {
+			if strings.HasSuffix(host, "."+suffix) {
+				return true
+			}
+		} else if host == pattern {
+			return true
+		}
+	}
+	return false
+}
+
+func (g *egressGateway) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	target := r.Host
+	if r.Method != http.MethodConnect {
+		if !r.URL.IsAbs() {
+			http.Error(w, "Bad Request", http.StatusBadRequest)
+			return
+		}
+		target = r.URL.Host
+	}
+	host := target
+	if h, _, err := net.SplitHostPort(target); err == nil {
+		host = h
+	}
+	if !g.allows(host) {
+		log.Printf("<%s> Egress to %s denied", g.name, target)
+		http.Error(w, "egress to "+host+" is not allowed", http.StatusForbidden)
+		return
+	}
+	if r.Method != http.MethodConnect {
+		g.forward.ServeHTTP(w, r)
+		return
+	}
+	g.tunnel(w, r)
+}
+
+// tunnel serves a CONNECT request by splicing the client connection to
+// the target.
+func (g *egressGateway) tunnel(w http.ResponseWriter, r *http.Request) {
+	upstream, err := (&net.Dialer{Timeout: 30 * time.Second}).DialContext(r.Context(), "tcp", r.Host)
+	if err != nil {
+		log.Printf("<%s> Egress connection to %s failed: %v", g.name, r.Host, err)
+		http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		return
+	}
+	downstream, buffered, err := http.NewResponseController(w).Hijack()
+	if err != nil {
+		_ = upstream.Close()
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	_, _ = io.WriteString(downstream, "HTTP/1.1 200 Connection Established\r\n\r\n")
+	go func() {
+		_, _ = buffered.Reader.WriteTo(upstream)
+		_ = upstream.Close()
+	}()
+	_, _ = io.Copy(downstream, upstream)
+	_ = downstream.Close()
+}
+
+// env returns the variables pointing a child process at the gateway.
+func (g *egressGateway) env() []string {
+	proxyURL := "http://" + g.listener.Addr().String()
+	var env []string
+	for _, key := range []string{"HTTP_PROXY", "HTTPS_PROXY", "ALL_PROXY"} {
+		env = append(env, key+"="+proxyURL, strings.ToLower(key)+"="+proxyURL)
+	}
+	return append(env, "NO_PROXY=", "no_proxy=")
+}
+
+func (g *egressGateway) Close() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	return g.server.Shutdown(ctx)
+}
@@ -0,0 +1,186 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// Sources of a ToolError.
+const (
+	ErrorSourceProxy    = "proxy"
+	ErrorSourceUpstream = "upstream"
+)
+
+// Codes of a ToolError.
+const (
+	ErrorCodeUnavailable      = "unavailable"
+	ErrorCodeCanceled         = "canceled"
+	ErrorCodeTimeout          = "timeout"
+	ErrorCodeConnectionFailed = "connection_failed"
+	ErrorCodeUnauthorized     = "unauthorized"
+	ErrorCodeToolNotFound     = "tool_not_found"
+	ErrorCodeInvalidParams    = "invalid_params"
+	ErrorCodeUpstreamError    = "upstream_error"
+)
+
+// toolErrorMetaKey is the _meta key carrying a ToolError in tool results.
+const toolErrorMetaKey = "mcp-proxy/error"
+
+// ToolError is a failed tool call classified for agents: Source tells
+// whether the proxy or the upstream failed and Code what went wrong.
+// Interceptors may return one to control how their failures are reported.
+type ToolError struct {
+	Source  string `json:"source"`
+	Code    string `json:"code"`
+	Server  string `json:"server"`
+	Message string `json:"message"`
+	// RetryAfter is the number of seconds after which a retry may succeed,
+	// or 0 when there is no such hint.
+	RetryAfter int   `json:"retryAfter,omitempty"`
+	Err        error `json:"-"`
+}
+
+func (e *ToolError) Error() string {
+	return e.Message
+}
+
+func (e *ToolError) Unwrap() error {
+	return e.Err
+}
+
+// retryAfterError marks a rejection that is expected to clear by itself, so
+// callers can back off instead of retrying at once.
+type retryAfterError struct {
+	err   error
+	after time.Duration
+}
+
+func retryAfter(err error, after time.Duration) error {
+	return &retryAfterError{err: err, after: after}
+}
+
+func (e *retryAfterError) Error() string {
+	return e.err.Error()
+}
+
+func (e *retryAfterError) Unwrap() error {
+	return e.err
+}
+
+// retryAfterSeconds rounds d up to whole seconds, at least one.
+func retryAfterSeconds(d time.Duration) int {
+	return max(1, int((d+time.Second-1)/time.Second))
+}
+
+// classifyToolError turns an error from a tool call to server into a
+// ToolError, keeping one an interceptor already returned.
+func classifyToolError(serverName string, err error) *ToolError {
+	var toolErr *ToolError
+	if errors.As(err, &toolErr) {
+		if toolErr.Server == "" {
+			toolErr.Server = serverName
+		}
+		return toolErr
+	}
+	source, code := ErrorSourceUpstream, ErrorCodeUpstreamError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errServerUnavailable):
+		source, code = ErrorSourceProxy, ErrorCodeUnavailable
+	case errors.Is(err, context.Canceled):
+		source, code = ErrorSourceProxy, ErrorCodeCanceled
+	case errors.Is(err, context.DeadlineExceeded), errors.As(err, &netErr) && netErr.Timeout():
+		code = ErrorCodeTimeout
+	case errors.Is(err, transport.ErrUnauthorized):
+		code = ErrorCodeUnauthorized
+	case errors.Is(err, syscall.ECONNREFUSED), errors.Is(err, syscall.ECONNRESET),
+		errors.Is(err, transport.ErrTransportClosed), errors.As(err, &netErr):
+		code = ErrorCodeConnectionFailed
+	case errors.Is(err, mcp.ErrInvalidParams) && strings.Contains(err.Error(), "not found"),
+		errors.Is(err, mcp.ErrMethodNotFound):
+		code = ErrorCodeToolNotFound
+	case errors.Is(err, mcp.ErrInvalidParams):
+		code = ErrorCodeInvalidParams
+	}
+	toolErr = &ToolError{
+		Source:  source,
+		Code:    code,
+		Server:  serverName,
+		Message: err.Error(),
+		Err:     err,
+	}
+	var retryErr *retryAfterError
+	if errors.As(err, &retryErr) {
+		toolErr.RetryAfter = retryAfterSeconds(retryErr.after)
+	}
+	return toolErr
+}
+
+// httpStatus is the status the REST API answers a failed call with.
+func (e *ToolError) httpStatus() int {
+	switch e.Code {
+	case ErrorCodeUnavailable:
+		return http.StatusServiceUnavailable
+	case ErrorCodeTimeout:
+		return http.StatusGatewayTimeout
+	case ErrorCodeToolNotFound:
+		return http.StatusNotFound
+	case ErrorCodeInvalidParams:
+		return http.StatusBadRequest
+	default:
+		return http.StatusBadGateway
+	}
+}
+
+// writeHTTP answers a failed REST call, with a Retry-After header when the
+// error carries a hint.
+func (e *ToolError) writeHTTP(w http.ResponseWriter) {
+	body := map[string]any{
+		"error":  e.Message,
+		"source": e.Source,
+		"code":   e.Code,
+	}
+	if e.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(e.RetryAfter))
+		body["retryAfter"] = e.RetryAfter
+	}
+	writeJSON(w, e.httpStatus(), body)
+}
+
+// result reports the error as a tool result with isError set, since MCP
+// errors cannot carry data through the server. The classification is in
+// _meta under "mcp-proxy/error".
+func (e *ToolError) result() *mcp.CallToolResult {
+	text := fmt.Sprintf("%s error (%s): %s", e.Source, e.Code, e.Message)
+	if e.RetryAfter > 0 {
+		text += fmt.Sprintf(" (retry after %ds)", e.RetryAfter)
+	}
+	result := mcp.NewToolResultError(text)
+	result.Meta = mcp.NewMetaFromMap(map[string]any{
+		toolErrorMetaKey: e,
+	})
+	return result
+}
+
+// translateToolErrors wraps a tool handler so failed calls reach MCP
+// clients as classified tool results instead of bare internal errors.
+func translateToolErrors(serverName string, handler server.ToolHandlerFunc) server.ToolHandlerFunc {
+	return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := handler(ctx, request)
+		if err != nil {
+			return classifyToolError(serverName, err).result(), nil
+		}
+		return result, nil
+	}
+}
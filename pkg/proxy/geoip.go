@@ -0,0 +1,51 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/netip"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// geoIPDB resolves client addresses to ISO country codes using a MaxMind
+// GeoIP2/GeoLite2 Country or City database.
+type geoIPDB struct {
+	reader *maxminddb.Reader
+}
+
+func openGeoIPDB(path string) (*geoIPDB, error) {
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open geoip database: %w", err)
+	}
+	built := time.Unix(int64(reader.Metadata.BuildEpoch), 0).UTC()
+	log.Printf("GeoIP database %s loaded (%s, built %s)", path, reader.Metadata.DatabaseType, built.Format(time.DateOnly))
+	return &geoIPDB{reader: reader}, nil
+}
+
+// country returns the ISO 3166-1 alpha-2 code of addr, or "" when the
+// database does not know the address, e.g. for private ranges.
+func (g *geoIPDB) country(addr netip.Addr) string {
+	if g == nil {
+		return ""
+	}
+	var record struct {
+		Country struct {
+			ISOCode string `maxminddb:"iso_code"`
+		} `maxminddb:"country"`
+	}
+	if err := g.reader.Lookup(net.IP(addr.AsSlice()), &record); err != nil {
+		return ""
+	}
+	return record.Country.ISOCode
+}
+
+func (g *geoIPDB) Close() error {
+	if g == nil {
+		return nil
+	}
+	return g.reader.Close()
+}
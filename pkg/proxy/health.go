@@ -0,0 +1,294 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"path"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	defaultHealthCheckInterval  = 30 * time.Second
+	defaultHealthCheckTimeout   = 10 * time.Second
+	defaultHealthCheckThreshold = 3
+
+	// pingWindow is the number of recent ping round trips kept for the p95
+	// reported by /status.
+	pingWindow = 128
+)
+
+// healthState tracks the outcome of the periodic checks of one upstream,
+// either the configured health check or the ping of HTTP upstreams.
+type healthState struct {
+	mu        sync.Mutex
+	threshold int
+	failures  int
+	lastCheck time.Time
+	lastError string
+	lastPing  time.Time
+
+	// pings holds the latest round trips, oldest overwritten first.
+	pings    []time.Duration
+	nextPing int
+}
+
+type healthStatus struct {
+	Healthy             bool       `json:"healthy"`
+	ConsecutiveFailures int        `json:"consecutiveFailures"`
+	LastCheck           *time.Time `json:"lastCheck,omitempty"`
+	LastError           string     `json:"lastError,omitempty"`
+	LastPing            *time.Time `json:"lastPing,omitempty"`
+	LastPingMs          float64    `json:"lastPingMs,omitempty"`
+	PingP95Ms           float64    `json:"pingP95Ms,omitempty"`
+}
+
+// record stores the result of a check and returns the number of
+// consecutive failures.
+func (h *healthState) record(err error) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastCheck = time.Now()
+	if err != nil {
+		h.failures++
+		h.lastError = err.Error()
+	} else {
+		h.failures = 0
+		h.lastError = ""
+	}
+	return h.failures
+}
+
+// recordPing stores the round trip time of a successful ping.
+func (h *healthState) recordPing(rtt time.Duration) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.lastPing = time.Now()
+	if len(h.pings) < pingWindow {
+		h.pings = append(h.pings, rtt)
+	} else {
+		h.pings[h.nextPing] = rtt
+	}
+	h.nextPing = (h.nextPing + 1) % pingWindow
+}
+
+func (h *healthState) status() healthStatus {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	threshold := h.threshold
+	if threshold <= 0 {
+		threshold = defaultHealthCheckThreshold
+	}
+	status := healthStatus{
+		Healthy:             h.failures < threshold,
+		ConsecutiveFailures: h.failures,
+		LastError:           h.lastError,
+	}
+	if !h.lastCheck.IsZero() {
+		lastCheck := h.lastCheck
+		status.LastCheck = &lastCheck
+	}
+	if !h.lastPing.IsZero() {
+		lastPing := h.lastPing
+		status.LastPing = &lastPing
+	}
+	if len(h.pings) > 0 {
+		last := (h.nextPing + len(h.pings) - 1) % len(h.pings)
+		status.LastPingMs = milliseconds(h.pings[last])
+		sorted := slices.Clone(h.pings)
+		slices.Sort(sorted)
+		status.PingP95Ms = milliseconds(sorted[(len(sorted)*95+99)/100-1])
+	}
+	return status
+}
+
+// startHealthCheckTask runs the configured health check until ctx is done.
+// Once failureThreshold checks in a row have failed the server is reported
+// unhealthy and, if it owns a process, restarted; a server that keeps
+// failing is restarted again after every further failureThreshold checks.
+func (c *Client) startHealthCheckTask(ctx context.Context, conf *HealthCheckConfig) {
+	interval := conf.Interval
+	if interval <= 0 {
+		interval = defaultHealthCheckInterval
+	}
+	timeout := conf.Timeout
+	if timeout <= 0 {
+		timeout = defaultHealthCheckTimeout
+	}
+	threshold := conf.FailureThreshold
+	if threshold <= 0 {
+		threshold = defaultHealthCheckThreshold
+	}
+	c.health.mu.Lock()
+	c.health.threshold = threshold
+	c.health.mu.Unlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	unhealthy := false
+	for {
+		select {
+		case <-ctx.Done():
+			log.Printf("<%s> Context done, stopping health check", c.name)
+			return
+		case <-ticker.C:
+			mcpClient := c.current()
+			checkCtx, cancel := context.WithTimeout(ctx, timeout)
+			err := c.checkHealth(checkCtx, mcpClient, conf)
+			cancel()
+			if ctx.Err() != nil {
+				return
+			}
+			failures := c.health.record(err)
+			if err == nil {
+				if unhealthy {
+					unhealthy = false
+					c.hooks.fire(lifecycleEvent{Event: hookServerRecovered, Server: c.name})
+				}
+				continue
+			}
+			log.Printf("<%s> Health check failed: %v (count=%d)", c.name, err, failures)
+			c.diagnostics.noteError("health check", err)
+			if failures%threshold == 0 {
+				unhealthy = true
+				c.hooks.fire(lifecycleEvent{Event: hookServerUnhealthy, Server: c.name, Failures: failures, Error: err.Error()})
+			}
+			if failures%threshold == 0 && c.spawn != nil {
+				log.Printf("<%s> Unhealthy after %d failed checks, restarting", c.name, failures)
+				if rErr := c.restart(ctx, mcpClient); rErr != nil {
+					log.Printf("<%s> Failed to restart MCP client: %v", c.name, rErr)
+				}
+			}
+		}
+	}
+}
+
+// checkHealth pings the upstream, or calls the configured tool and treats a
+// tool error result as a failure.
+func (c *Client) checkHealth(ctx context.Context, mcpClient *client.Client, conf *HealthCheckConfig) error {
+	if conf.Tool == "" {
+		return c.ping(ctx, mcpClient)
+	}
+	request := mcp.CallToolRequest{}
+	request.Params.Name = conf.Tool
+	request.Params.Arguments = conf.Arguments
+	result, err := mcpClient.CallTool(ctx, request)
+	if err != nil {
+		return err
+	}
+	if result.IsError {
+		return fmt.Errorf("tool %s returned an error: %s", conf.Tool, toolResultText(result))
+	}
+	return nil
+}
+
+// registerStatus mounts GET /status, a summary of every connected server's
+// health meant for load balancers and dashboards. In a cluster, a server
+// unhealthy on any node makes the status degraded on every node.
+func registerStatus(mux *http.ServeMux, basePath string, registry *clientRegistry, cluster *cluster, middlewares ...MiddlewareFunc) {
+	mux.Handle("GET "+path.Join("/", basePath, "status"), chainMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type serverHealth struct {
+			Name string `json:"name"`
+			healthStatus
+			// UnhealthyNodes are the nodes of the cluster that report the
+			// server unhealthy.
+			UnhealthyNodes []string `json:"unhealthyNodes,omitempty"`
+		}
+		servers := make([]serverHealth, 0)
+		overall := "ok"
+		for _, name := range registry.names() {
+			c, ok := registry.get(name)
+			if !ok {
+				continue
+			}
+			status := c.health.status()
+			unhealthyNodes := cluster.unhealthyNodes(name)
+			if !status.Healthy || len(unhealthyNodes) > 0 {
+				overall = "degraded"
+			}
+			servers = append(servers, serverHealth{Name: name, healthStatus: status, UnhealthyNodes: unhealthyNodes})
+		}
+		response := map[string]any{"status": overall, "servers": servers}
+		if cluster != nil {
+			response["node"] = cluster.node
+			response["nodes"] = len(cluster.snapshot())
+		}
+		writeJSON(w, http.StatusOK, response)
+	}), middlewares...))
+}
+
+// registerStatusJSON mounts GET /status.json, the /status summary extended
+// with tool and call counts. Every row is flat so dashboards such as
+// Grafana's JSON and Infinity data sources can chart it without transforms.
+func registerStatusJSON(mux *http.ServeMux, basePath string, registry *clientRegistry, metrics *proxyMetrics, started time.Time, middlewares ...MiddlewareFunc) {
+	mux.Handle("GET "+path.Join("/", basePath, "status.json"), chainMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		type serverRow struct {
+			Name                string  `json:"name"`
+			Healthy             bool    `json:"healthy"`
+			ConsecutiveFailures int     `json:"consecutiveFailures"`
+			Maintenance         bool    `json:"maintenance"`
+			Active              bool    `json:"active"`
+			Tools               int     `json:"tools"`
+			Calls               int64   `json:"calls"`
+			CallErrors          int64   `json:"callErrors"`
+			Requests            int64   `json:"requests"`
+			PingP95Ms           float64 `json:"pingP95Ms"`
+		}
+		type totals struct {
+			Servers    int   `json:"servers"`
+			Healthy    int   `json:"healthy"`
+			Tools      int   `json:"tools"`
+			Calls      int64 `json:"calls"`
+			CallErrors int64 `json:"callErrors"`
+		}
+		now := time.Now()
+		rows := make([]serverRow, 0)
+		var sum totals
+		for _, name := range registry.names() {
+			c, ok := registry.get(name)
+			if !ok {
+				continue
+			}
+			health := c.health.status()
+			row := serverRow{
+				Name:                name,
+				Healthy:             health.Healthy,
+				ConsecutiveFailures: health.ConsecutiveFailures,
+				Maintenance:         c.maintenance.Load(),
+				Tools:               len(c.toolList()),
+				PingP95Ms:           health.PingP95Ms,
+			}
+			row.Active = !row.Maintenance && (c.schedule == nil || c.schedule.active(now))
+			if metrics != nil {
+				row.Calls = int64(metrics.toolCalls.total(name))
+				row.CallErrors = row.Calls - int64(metrics.toolCalls.total(name, "success"))
+				row.Requests = int64(metrics.requests.total(name))
+			}
+			rows = append(rows, row)
+			sum.Servers++
+			if row.Healthy {
+				sum.Healthy++
+			}
+			sum.Tools += row.Tools
+			sum.Calls += row.Calls
+			sum.CallErrors += row.CallErrors
+		}
+		overall := "ok"
+		if sum.Healthy < sum.Servers {
+			overall = "degraded"
+		}
+		writeJSON(w, http.StatusOK, map[string]any{
+			"status":        overall,
+			"version":       BuildVersion,
+			"uptimeSeconds": int64(now.Sub(started).Seconds()),
+			"totals":        sum,
+			"servers":       rows,
+		})
+	}), middlewares...))
+}
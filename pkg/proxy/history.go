@@ -0,0 +1,322 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultHistoryKeep = 20
+
+var errSnapshotNotFound = errors.New("snapshot not found")
+
+// configHistory keeps timestamped copies of the effective config in a
+// directory so a bad change can be rolled back. Snapshots contain tokens
+// and secrets as configured and are only readable by the owner.
+type configHistory struct {
+	mu   sync.Mutex
+	dir  string
+	keep int
+}
+
+type configSnapshot struct {
+	ID        string    `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Reason    string    `json:"reason"`
+	Config    *Config   `json:"config,omitempty"`
+}
+
+func newConfigHistory(conf *ConfigHistoryConfig) (*configHistory, error) {
+	if err := os.MkdirAll(conf.Dir, 0o700); err != nil {
+		return nil, err
+	}
+	keep := conf.Keep
+	if keep <= 0 {
+		keep = defaultHistoryKeep
+	}
+	return &configHistory{dir: conf.Dir, keep: keep}, nil
+}
+
+// save writes config as a new snapshot unless it equals the latest one,
+// and prunes snapshots beyond keep.
+func (h *configHistory) save(config *Config, reason string) (*configSnapshot, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ids, err := h.ids()
+	if err != nil {
+		return nil, err
+	}
+	if len(ids) > 0 {
+		latest, lErr := h.read(ids[len(ids)-1])
+		if lErr == nil && sameJSON(latest.Config, config) {
+			return nil, nil
+		}
+	}
+	now := time.Now().UTC()
+	snapshot := &configSnapshot{
+		ID:        now.Format("20060102T150405.000000000Z"),
+		CreatedAt: now,
+		Reason:    reason,
+		Config:    config,
+	}
+	data, err := json.MarshalIndent(snapshot, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err = writeFileAtomic(filepath.Join(h.dir, snapshot.ID+".json"), data, 0o600); err != nil {
+		return nil, err
+	}
+	ids = append(ids, snapshot.ID)
+	for len(ids) > h.keep {
+		_ = os.Remove(filepath.Join(h.dir, ids[0]+".json"))
+		ids = ids[1:]
+	}
+	return snapshot, nil
+}
+
+// list returns the snapshots without their configs, newest first.
+func (h *configHistory) list() ([]configSnapshot, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	ids, err := h.ids()
+	if err != nil {
+		return nil, err
+	}
+	snapshots := make([]configSnapshot, 0, len(ids))
+	for _, id := range slices.Backward(ids) {
+		snapshot, rErr := h.read(id)
+		if rErr != nil {
+			continue
+		}
+		snapshot.Config = nil
+		snapshots = append(snapshots, *snapshot)
+	}
+	return snapshots, nil
+}
+
+func (h *configHistory) get(id string) (*configSnapshot, error) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if id == "" || filepath.Base(id) != id || strings.HasPrefix(id, ".") {
+		return nil, errSnapshotNotFound
+	}
+	return h.read(id)
+}
+
+func (h *configHistory) ids() ([]string, error) {
+	entries, err := os.ReadDir(h.dir)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if id, ok := strings.CutSuffix(entry.Name(), ".json"); ok && !entry.IsDir() {
+			ids = append(ids, id)
+		}
+	}
+	slices.Sort(ids)
+	return ids, nil
+}
+
+func (h *configHistory) read(id string) (*configSnapshot, error) {
+	data, err := os.ReadFile(filepath.Join(h.dir, id+".json"))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errSnapshotNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	var snapshot configSnapshot
+	if err = json.Unmarshal(data, &snapshot); err != nil {
+		return nil, fmt.Errorf("snapshot %s: %w", id, err)
+	}
+	return &snapshot, nil
+}
+
+func sameJSON(a, b any) bool {
+	aData, aErr := json.Marshal(a)
+	bData, bErr := json.Marshal(b)
+	return aErr == nil && bErr == nil && bytes.Equal(aData, bData)
+}
+
+// recordConfig snapshots the effective config when history is enabled and
+// runs the config_changed hooks.
+func (p *Proxy) recordConfig(reason string) {
+	p.hooks.fire(lifecycleEvent{Event: hookConfigChanged, Reason: reason})
+	if p.history == nil {
+		return
+	}
+	p.mu.Lock()
+	data, err := json.Marshal(p.config)
+	p.mu.Unlock()
+	if err != nil {
+		log.Printf("Failed to snapshot config: %v", err)
+		return
+	}
+	// Round-trip so the snapshot does not share state with the live config.
+	var config Config
+	if err = json.Unmarshal(data, &config); err != nil {
+		log.Printf("Failed to snapshot config: %v", err)
+		return
+	}
+	snapshot, err := p.history.save(&config, reason)
+	if err != nil {
+		log.Printf("Failed to snapshot config: %v", err)
+		return
+	}
+	if snapshot != nil {
+		log.Printf("Config snapshot %s saved (%s)", snapshot.ID, reason)
+	}
+}
+
+// configChanges tells the caller what a rollback or an applied config
+// changed, or would change, and whether the target also differs in parts
+// that only apply after a restart.
+type configChanges struct {
+	Added     []string `json:"added"`
+	Removed   []string `json:"removed"`
+	Replaced  []string `json:"replaced"`
+	Unchanged []string `json:"unchanged"`
+	// Fields lists the top-level keys that differ in the config of each
+	// replaced server.
+	Fields          map[string][]string `json:"fields,omitempty"`
+	RestartRequired bool                `json:"restartRequired"`
+}
+
+// rollback brings the servers back to the state of a snapshot, adding,
+// removing and reconnecting servers as needed.
+func (p *Proxy) rollback(ctx context.Context, id string) (*configChanges, error) {
+	snapshot, err := p.history.get(id)
+	if err != nil {
+		return nil, err
+	}
+	target := snapshot.Config
+	if target == nil || target.McpProxy == nil {
+		return nil, fmt.Errorf("snapshot %s has no config", id)
+	}
+	return p.applyConfig(ctx, target, "rollback to "+id)
+}
+
+// planConfig compares the running servers with those of target. target
+// must have its defaults set, like a loaded config.
+func (p *Proxy) planConfig(target *Config) *configChanges {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	changes := &configChanges{
+		Added:     []string{},
+		Removed:   []string{},
+		Replaced:  []string{},
+		Unchanged: []string{},
+		RestartRequired: !sameJSON(
+			&Config{McpProxy: p.config.McpProxy, VirtualServers: p.config.VirtualServers, Profiles: p.config.Profiles, HTTPRoutes: p.config.HTTPRoutes},
+			&Config{McpProxy: target.McpProxy, VirtualServers: target.VirtualServers, Profiles: target.Profiles, HTTPRoutes: target.HTTPRoutes},
+		),
+	}
+	for _, name := range slices.Sorted(maps.Keys(p.config.McpServers)) {
+		current := p.config.McpServers[name]
+		wanted, ok := target.McpServers[name]
+		switch {
+		case !ok:
+			changes.Removed = append(changes.Removed, name)
+		case sameJSON(current, wanted):
+			changes.Unchanged = append(changes.Unchanged, name)
+		default:
+			changes.Replaced = append(changes.Replaced, name)
+			if changes.Fields == nil {
+				changes.Fields = make(map[string][]string)
+			}
+			changes.Fields[name] = changedKeys(current, wanted)
+		}
+	}
+	for _, name := range slices.Sorted(maps.Keys(target.McpServers)) {
+		if _, ok := p.config.McpServers[name]; !ok {
+			changes.Added = append(changes.Added, name)
+		}
+	}
+	return changes
+}
+
+// changedKeys returns the top-level JSON keys whose values differ between
+// a and b, without the values, which may be secrets.
+func changedKeys(a, b any) []string {
+	var aFields, bFields map[string]json.RawMessage
+	aData, _ := json.Marshal(a)
+	bData, _ := json.Marshal(b)
+	_ = json.Unmarshal(aData, &aFields)
+	_ = json.Unmarshal(bData, &bFields)
+	keys := make([]string, 0)
+	for key, value := range aFields {
+		if !bytes.Equal(value, bFields[key]) {
+			keys = append(keys, key)
+		}
+	}
+	for key := range bFields {
+		if _, ok := aFields[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	slices.Sort(keys)
+	return keys
+}
+
+// applyConfig brings the servers in line with target, adding, removing and
+// reconnecting servers as needed. Servers that could not be changed are
+// left out of the result and reported in the error. Nothing is recorded
+// when no server changes.
+func (p *Proxy) applyConfig(ctx context.Context, target *Config, reason string) (*configChanges, error) {
+	p.applying.Lock()
+	defer p.applying.Unlock()
+	plan := p.planConfig(target)
+	if len(plan.Added)+len(plan.Removed)+len(plan.Replaced) == 0 {
+		return plan, nil
+	}
+	result := &configChanges{
+		Added:           []string{},
+		Removed:         []string{},
+		Replaced:        []string{},
+		Unchanged:       plan.Unchanged,
+		Fields:          plan.Fields,
+		RestartRequired: plan.RestartRequired,
+	}
+	// Everything is removed first, so that routes can move between servers.
+	var errs []error
+	var readd []string
+	for _, name := range plan.Removed {
+		if rErr := p.removeServer(name); rErr != nil {
+			errs = append(errs, rErr)
+			continue
+		}
+		result.Removed = append(result.Removed, name)
+	}
+	for _, name := range plan.Replaced {
+		if rErr := p.removeServer(name); rErr != nil {
+			errs = append(errs, rErr)
+			continue
+		}
+		result.Replaced = append(result.Replaced, name)
+		readd = append(readd, name)
+	}
+	toAdd := append(readd, plan.Added...)
+	slices.Sort(toAdd)
+	for _, name := range toAdd {
+		if aErr := p.addServer(ctx, name, target.McpServers[name]); aErr != nil {
+			errs = append(errs, fmt.Errorf("server %s: %w", name, aErr))
+			continue
+		}
+		if slices.Contains(plan.Added, name) {
+			result.Added = append(result.Added, name)
+		}
+	}
+	p.recordConfig(reason)
+	return result, errors.Join(errs...)
+}
@@ -0,0 +1,212 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+const honeypotWebhookTimeout = 10 * time.Second
+
+// Kinds of honeypot alerts.
+const (
+	honeypotKindToken = "token"
+	honeypotKindTool  = "tool"
+)
+
+// honeypot watches for decoy credentials and decoy tools that no
+// legitimate caller uses, so any use is an early sign of a leaked
+// credential or a compromised agent.
+type honeypot struct {
+	tokens  map[string]bool
+	tools   []HoneypotToolConfig
+	conf    *HoneypotConfig
+	blocks  *blockList
+	metrics *proxyMetrics
+	client  *http.Client
+}
+
+// honeypotAlert is logged and posted to the webhook as JSON.
+type honeypotAlert struct {
+	Event      string    `json:"event"`
+	Kind       string    `json:"kind"`
+	Time       time.Time `json:"time"`
+	RemoteAddr string    `json:"remoteAddr"`
+	UserAgent  string    `json:"userAgent,omitempty"`
+	Identity   string    `json:"identity,omitempty"`
+	Server     string    `json:"server,omitempty"`
+	Tool       string    `json:"tool,omitempty"`
+	Blocked    bool      `json:"blocked"`
+}
+
+type requestOriginKey struct{}
+
+// requestOrigin is the address, user agent and bearer token hash of the
+// HTTP request behind a tool call.
+type requestOrigin struct {
+	remoteAddr string
+	userAgent  string
+	// tokenHash is the SHA-256 of the bearer token, as block list entries
+	// store tokens; it is empty without one.
+	tokenHash string
+}
+
+func newRequestOrigin(r *http.Request) requestOrigin {
+	origin := requestOrigin{remoteAddr: r.RemoteAddr, userAgent: r.UserAgent()}
+	if token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")); token != "" {
+		origin.tokenHash = hashAPIKey(token)
+	}
+	return origin
+}
+
+func newHoneypot(conf *HoneypotConfig, blocks *blockList, metrics *proxyMetrics) *honeypot {
+	h := &honeypot{
+		tokens:  make(map[string]bool, len(conf.Tokens)),
+		tools:   conf.Tools,
+		conf:    conf,
+		blocks:  blocks,
+		metrics: metrics,
+		client:  &http.Client{Timeout: honeypotWebhookTimeout},
+	}
+	for _, token := range conf.Tokens {
+		h.tokens[token] = true
+	}
+	log.Printf("Honeypot enabled with %d decoy tokens and %d decoy tools", len(conf.Tokens), len(conf.Tools))
+	return h
+}
+
+// middleware rejects decoy tokens as if they were unknown.
+func (h *honeypot) middleware() MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if h == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			origin := newRequestOrigin(r)
+			token := strings.TrimSpace(strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer "))
+			if token != "" && h.tokens[token] {
+				h.trip(honeypotAlert{Kind: honeypotKindToken}, origin, nil)
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// recordRequestOrigin makes the origin of each request available to the
+// tool calls it carries, for decoy tools and builtin:diagnostics.
+func recordRequestOrigin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := newRequestOrigin(r)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestOriginKey{}, origin)))
+	})
+}
+
+// addDecoyTools lists the decoy tools meant for server on mcpServer. They
+// are never forwarded upstream.
+func (h *honeypot) addDecoyTools(serverName string, mcpServer *server.MCPServer) {
+	if h == nil {
+		return
+	}
+	for _, decoy := range h.tools {
+		if len(decoy.Servers) > 0 && !slices.Contains(decoy.Servers, serverName) {
+			continue
+		}
+		tool := mcp.NewTool(decoy.Name, mcp.WithDescription(decoy.Description))
+		mcpServer.AddTool(tool, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			origin, _ := ctx.Value(requestOriginKey{}).(requestOrigin)
+			h.trip(honeypotAlert{Kind: honeypotKindTool, Server: serverName, Tool: decoy.Name}, origin, authTokenFromContext(ctx))
+			return mcp.NewToolResultError("permission denied"), nil
+		})
+	}
+}
+
+// trip raises an alert and, with autoBlock, puts the caller's address,
+// bearer token and identity on the block list.
+func (h *honeypot) trip(alert honeypotAlert, origin requestOrigin, token *AuthToken) {
+	alert.Event = "honeypot"
+	alert.Time = time.Now().UTC()
+	alert.RemoteAddr = origin.remoteAddr
+	alert.UserAgent = origin.userAgent
+	if token != nil {
+		alert.Identity = token.Name
+	}
+	if h.conf.AutoBlock && h.blocks != nil {
+		alert.Blocked = h.block(alert, origin)
+	}
+	what := "decoy token"
+	if alert.Kind == honeypotKindTool {
+		what = "decoy tool " + alert.Server + "/" + alert.Tool
+	}
+	log.Printf("Honeypot triggered: %s used from %s (identity %q, blocked %t)", what, alert.RemoteAddr, alert.Identity, alert.Blocked)
+	h.metrics.recordHoneypot(alert.Kind)
+	if h.conf.Webhook != "" {
+		go h.notify(alert)
+	}
+}
+
+// block adds the entries for an alert. The token is blocked as well as
+// its name, since static tokens need not have one.
+func (h *honeypot) block(alert honeypotAlert, origin requestOrigin) bool {
+	var expiresAt *time.Time
+	if h.conf.BlockFor > 0 {
+		until := alert.Time.Add(h.conf.BlockFor)
+		expiresAt = &until
+	}
+	reason := "honeypot " + alert.Kind
+	if alert.Tool != "" {
+		reason += " " + alert.Tool
+	}
+	var entries []blockEntry
+	if addr, ok := remoteAddr(&http.Request{RemoteAddr: alert.RemoteAddr}); ok {
+		entries = append(entries, blockEntry{Kind: blockKindIP, Value: addr.String()})
+	}
+	if origin.tokenHash != "" {
+		entries = append(entries, blockEntry{Kind: blockKindToken, Value: origin.tokenHash})
+	}
+	if alert.Identity != "" {
+		entries = append(entries, blockEntry{Kind: blockKindUser, Value: alert.Identity})
+	}
+	blocked := false
+	for _, entry := range entries {
+		entry.Reason, entry.ExpiresAt = reason, expiresAt
+		if err := entry.parse(); err != nil {
+			continue
+		}
+		if _, exists := h.blocks.matches(entry.Kind, func(e *blockEntry) bool { return e.Value == entry.Value }); exists {
+			blocked = true
+			continue
+		}
+		if _, err := h.blocks.add(entry); err != nil {
+			log.Printf("Honeypot failed to block %s %s: %v", entry.Kind, entry.Value, err)
+			continue
+		}
+		blocked = true
+	}
+	return blocked
+}
+
+func (h *honeypot) notify(alert honeypotAlert) {
+	body, err := json.Marshal(alert)
+	if err != nil {
+		return
+	}
+	resp, err := h.client.Post(h.conf.Webhook, "application/json", bytes.NewReader(body))
+	if err != nil {
+		log.Printf("Honeypot webhook failed: %v", err)
+		return
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		log.Printf("Honeypot webhook failed: %s", resp.Status)
+	}
+}
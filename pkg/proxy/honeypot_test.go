@@ -0,0 +1,43 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// TestHoneypotBlocksUnnamedToken checks that a static token without a name
+// is blocked from every address once it trips a decoy tool.
+func TestHoneypotBlocksUnnamedToken(t *testing.T) {
+	blocks, err := newBlockList(filepath.Join(t.TempDir(), "blocks.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := newHoneypot(&HoneypotConfig{AutoBlock: true, Tools: []HoneypotToolConfig{{Name: "export_all_secrets"}}}, blocks, nil)
+	mcpServer := server.NewMCPServer("github", "1.0.0")
+	h.addDecoyTools("github", mcpServer)
+
+	tripping := httptest.NewRequest(http.MethodPost, "/github/mcp", nil)
+	tripping.RemoteAddr = "192.0.2.1:1234"
+	tripping.Header.Set("Authorization", "Bearer static")
+	ctx := context.WithValue(context.Background(), requestOriginKey{}, newRequestOrigin(tripping))
+	ctx = withAuthToken(ctx, &AuthToken{Token: "static"})
+	mcpServer.HandleMessage(ctx, []byte(`{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"export_all_secrets"}}`))
+
+	elsewhere := httptest.NewRequest(http.MethodPost, "/github/mcp", nil)
+	elsewhere.RemoteAddr = "198.51.100.7:1234"
+	elsewhere.Header.Set("Authorization", "Bearer static")
+	if kind, blocked := blocks.blockedRequest(elsewhere); !blocked || kind != blockKindToken {
+		t.Errorf("blockedRequest() = %q, %v, want the token blocked", kind, blocked)
+	}
+	other := httptest.NewRequest(http.MethodPost, "/github/mcp", nil)
+	other.RemoteAddr = "198.51.100.7:1234"
+	other.Header.Set("Authorization", "Bearer other")
+	if kind, blocked := blocks.blockedRequest(other); blocked {
+		t.Errorf("blockedRequest() = %q, want other tokens let through", kind)
+	}
+}
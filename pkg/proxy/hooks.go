@@ -0,0 +1,207 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/exec"
+	"slices"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Lifecycle events hooks can subscribe to.
+const (
+	hookServerConnected     = "server_connected"
+	hookServerConnectFailed = "server_connect_failed"
+	hookServerUnhealthy     = "server_unhealthy"
+	hookServerRecovered     = "server_recovered"
+	hookServerRestarted     = "server_restarted"
+	hookConfigChanged       = "config_changed"
+
+	defaultHookTimeout = 30 * time.Second
+	// hookOutputLimit caps the command output logged when a hook fails.
+	hookOutputLimit = 1024
+)
+
+var hookEvents = []string{
+	hookServerConnected, hookServerConnectFailed, hookServerUnhealthy,
+	hookServerRecovered, hookServerRestarted, hookConfigChanged,
+}
+
+// lifecycleEvent is what hook templates are executed with and, without a
+// payload template, what webhooks receive as JSON.
+type lifecycleEvent struct {
+	Event  string    `json:"event"`
+	Time   time.Time `json:"time"`
+	Server string    `json:"server,omitempty"`
+	// Failures is the number of consecutive failed checks of an unhealthy
+	// server.
+	Failures int    `json:"failures,omitempty"`
+	Error    string `json:"error,omitempty"`
+	// Reason says what changed the config, e.g. "rollback to <id>".
+	Reason string `json:"reason,omitempty"`
+}
+
+// lifecycleHooks runs the configured commands and webhooks when servers
+// connect, fail or recover and when the config changes, so operators can
+// wire up remediation such as restarting a container. Hooks run in the
+// background; a hook that fails or times out is only logged. A nil
+// *lifecycleHooks runs nothing.
+type lifecycleHooks struct {
+	hooks  []*lifecycleHook
+	client *http.Client
+}
+
+type lifecycleHook struct {
+	conf    HookConfig
+	payload *template.Template
+	args    []*template.Template
+}
+
+var hookTemplateFuncs = template.FuncMap{
+	// json renders a value as a JSON literal, for payloads that embed
+	// error messages.
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+func parseHookTemplate(name, text string) (*template.Template, error) {
+	return template.New(name).Funcs(hookTemplateFuncs).Option("missingkey=error").Parse(text)
+}
+
+func newLifecycleHooks(confs []HookConfig) (*lifecycleHooks, error) {
+	if len(confs) == 0 {
+		return nil, nil
+	}
+	h := &lifecycleHooks{client: &http.Client{}}
+	for i, conf := range confs {
+		hook := &lifecycleHook{conf: conf}
+		if hook.conf.Timeout <= 0 {
+			hook.conf.Timeout = defaultHookTimeout
+		}
+		var err error
+		if conf.Payload != "" {
+			if hook.payload, err = parseHookTemplate("payload", conf.Payload); err != nil {
+				return nil, fmt.Errorf("hooks[%d].payload: %w", i, err)
+			}
+		}
+		for j, arg := range conf.Command {
+			tmpl, pErr := parseHookTemplate("command", arg)
+			if pErr != nil {
+				return nil, fmt.Errorf("hooks[%d].command[%d]: %w", i, j, pErr)
+			}
+			hook.args = append(hook.args, tmpl)
+		}
+		h.hooks = append(h.hooks, hook)
+	}
+	log.Printf("Lifecycle hooks enabled: %d", len(h.hooks))
+	return h, nil
+}
+
+// fire runs the hooks subscribed to event.
+func (h *lifecycleHooks) fire(event lifecycleEvent) {
+	if h == nil {
+		return
+	}
+	event.Time = time.Now()
+	for _, hook := range h.hooks {
+		if !slices.Contains(hook.conf.Events, event.Event) {
+			continue
+		}
+		if event.Server != "" && len(hook.conf.Servers) > 0 && !slices.Contains(hook.conf.Servers, event.Server) {
+			continue
+		}
+		go func() {
+			if err := h.run(hook, event); err != nil {
+				log.Printf("Hook for %s failed: %v", describeEvent(event), err)
+			}
+		}()
+	}
+}
+
+func describeEvent(event lifecycleEvent) string {
+	if event.Server == "" {
+		return event.Event
+	}
+	return event.Event + " of " + event.Server
+}
+
+func (h *lifecycleHooks) run(hook *lifecycleHook, event lifecycleEvent) error {
+	payload, err := hook.render(event)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), hook.conf.Timeout)
+	defer cancel()
+	if hook.conf.Webhook != "" {
+		return h.post(ctx, hook, payload)
+	}
+	args := make([]string, len(hook.args))
+	for i, tmpl := range hook.args {
+		var b strings.Builder
+		if err = tmpl.Execute(&b, event); err != nil {
+			return err
+		}
+		args[i] = b.String()
+	}
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Env = append(os.Environ(),
+		"MCP_PROXY_EVENT="+event.Event,
+		"MCP_PROXY_SERVER="+event.Server,
+		"MCP_PROXY_FAILURES="+strconv.Itoa(event.Failures),
+		"MCP_PROXY_ERROR="+event.Error,
+		"MCP_PROXY_REASON="+event.Reason,
+	)
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		if len(output) > hookOutputLimit {
+			output = output[:hookOutputLimit]
+		}
+		return fmt.Errorf("%s: %w: %s", args[0], err, strings.TrimSpace(string(output)))
+	}
+	log.Printf("Hook %s ran for %s", args[0], describeEvent(event))
+	return nil
+}
+
+// render executes the payload template, or encodes the event as JSON when
+// there is none.
+func (hook *lifecycleHook) render(event lifecycleEvent) ([]byte, error) {
+	if hook.payload == nil {
+		return json.Marshal(event)
+	}
+	var b bytes.Buffer
+	if err := hook.payload.Execute(&b, event); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (h *lifecycleHooks) post(ctx context.Context, hook *lifecycleHook, payload []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.conf.Webhook, bytes.NewReader(payload))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range hook.conf.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return err
+	}
+	_ = resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		return fmt.Errorf("webhook: %s", resp.Status)
+	}
+	return nil
+}
@@ -0,0 +1,245 @@
+package proxy
+
+import (
+	"log"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+)
+
+type MiddlewareFunc func(http.Handler) http.Handler
+
+func chainMiddleware(h http.Handler, middlewares ...MiddlewareFunc) http.Handler {
+	for _, mw := range middlewares {
+		h = mw(h)
+	}
+	return h
+}
+
+// routeAuth checks requests against the credentials accepted on a route.
+type routeAuth struct {
+	route    string
+	required bool
+	tokenSet map[string]*AuthToken
+	sources  *authSources
+}
+
+func newRouteAuth(route string, tokens []AuthToken, sources *authSources) *routeAuth {
+	a := &routeAuth{
+		route:    route,
+		required: len(tokens) != 0 || sources.enabled(),
+		tokenSet: make(map[string]*AuthToken, len(tokens)),
+		sources:  sources,
+	}
+	for i := range tokens {
+		a.tokenSet[tokens[i].Token] = &tokens[i]
+	}
+	return a
+}
+
+// accepts reports whether the route lets in token, which another route
+// already authenticated. Identities from API keys, signatures and users
+// carry no token string and are accepted on every route, like there.
+func (a *routeAuth) accepts(token *AuthToken) bool {
+	if a == nil || !a.required {
+		return true
+	}
+	if token == nil || a.sources.blocked(token) || (a.route != "" && !token.allowsServer(a.route)) {
+		return false
+	}
+	return token.Token == "" || a.tokenSet[token.Token] != nil
+}
+
+// check authenticates r and returns the outcome as counted in metrics. The
+// token is nil unless credentials were recognized.
+func (a *routeAuth) check(r *http.Request) (token *AuthToken, method, outcome string) {
+	token, method, ok := a.sources.authenticate(r, a.tokenSet)
+	switch {
+	case !ok && method == authMethodNone:
+		return nil, method, authOutcomeMissing
+	case !ok:
+		return nil, method, authOutcomeInvalid
+	case a.sources.blocked(token):
+		return token, method, authOutcomeBlocked
+	case a.route != "" && !token.allowsServer(a.route):
+		return token, method, authOutcomeForbidden
+	}
+	return token, method, authOutcomeSuccess
+}
+
+// newAuthMiddleware accepts requests bearing one of tokens or credentials
+// from one of the additional sources. route names the server behind the
+// handler and is checked against scoped tokens; it is empty for routes that
+// are not tied to a single server. The matching token is stored in the
+// request context for the tool-level checks.
+func newAuthMiddleware(route string, tokens []AuthToken, sources *authSources) MiddlewareFunc {
+	auth := newRouteAuth(route, tokens, sources)
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if auth.required {
+				// Requests another route authenticated already, such as the
+				// calls of the OpenAI bridge, are not authenticated twice,
+				// since signatures cannot be replayed.
+				if authToken := authTokenFromContext(r.Context()); authToken != nil {
+					if !auth.accepts(authToken) {
+						http.Error(w, "Forbidden", http.StatusForbidden)
+						return
+					}
+					next.ServeHTTP(w, r)
+					return
+				}
+				authToken, method, outcome := auth.check(r)
+				sources.recordAuth(route, method, authToken, outcome)
+				switch outcome {
+				case authOutcomeMissing, authOutcomeInvalid:
+					sources.challenge(w)
+					http.Error(w, "Unauthorized", http.StatusUnauthorized)
+					return
+				case authOutcomeBlocked, authOutcomeForbidden:
+					noteCaller(r.Context(), authToken)
+					http.Error(w, "Forbidden", http.StatusForbidden)
+					return
+				}
+				noteCaller(r.Context(), authToken)
+				r = r.WithContext(withAuthToken(r.Context(), authToken))
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func loggerMiddleware(prefix string) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			log.Printf("<%s> Request [%s] %s", prefix, r.Method, r.URL.Path)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func recoverMiddleware(prefix string) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			defer func() {
+				if err := recover(); err != nil {
+					log.Printf("<%s> Recovered from panic: %v", prefix, err)
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				}
+			}()
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func newServerMiddlewares(name string, options *OptionsV2, sources *authSources) []MiddlewareFunc {
+	var metrics *proxyMetrics
+	var cluster *cluster
+	var sse bool
+	if sources != nil {
+		metrics, cluster, sse = sources.metrics, sources.cluster, sources.sse
+	}
+	middlewares := make([]MiddlewareFunc, 0)
+	middlewares = append(middlewares, recoverMiddleware(name))
+	// Outside the recovery, since resumable streams run their handlers on
+	// goroutines of their own.
+	if sources != nil && sources.streams != nil {
+		middlewares = append(middlewares, sources.streams.middleware(name))
+	}
+	// Outside the streams, so that what is throttled is what goes out to
+	// clients rather than into stream buffers.
+	if options.MaxBytesPerSecond > 0 {
+		middlewares = append(middlewares, newBandwidthMiddleware(name, options.MaxBytesPerSecond, metrics))
+	}
+	if options.LogEnabled.OrElse(false) {
+		middlewares = append(middlewares, loggerMiddleware(name))
+	}
+	// Limits apply to authenticated requests only, so that requests
+	// without credentials cannot use up a server's share.
+	if options.MaxSessions > 0 || options.MaxRequestsPerMinute > 0 {
+		middlewares = append(middlewares, newLimitsMiddleware(name, options, metrics, cluster, sse))
+	}
+	// Middlewares wrap in order, so the access check is listed before the
+	// auth middleware that has to run ahead of it.
+	if options.Access != nil {
+		middlewares = append(middlewares, newAccessMiddleware(options.Access))
+	}
+	if len(options.AuthTokens) > 0 || sources.enabled() {
+		middlewares = append(middlewares, newAuthMiddleware(name, options.AuthTokens, sources))
+	}
+	// Addresses are checked before credentials.
+	if options.IPFilter != nil {
+		middlewares = append(middlewares, newIPFilterMiddleware(name, options.IPFilter, sources.geoIP()))
+	}
+	// Outermost, so rejected requests are counted too.
+	if sources != nil {
+		middlewares = append(middlewares, sources.metrics.countRequests(name), sources.events.middleware(name))
+	}
+	return middlewares
+}
+
+func mcpRoutePath(basePath, name string) string {
+	mcpRoute := path.Join(basePath, name)
+	if !strings.HasPrefix(mcpRoute, "/") {
+		mcpRoute = "/" + mcpRoute
+	}
+	if !strings.HasSuffix(mcpRoute, "/") {
+		mcpRoute += "/"
+	}
+	return mcpRoute
+}
+
+type clientRegistry struct {
+	mu      sync.RWMutex
+	clients map[string]*Client
+	// auths are the credentials each server's own route accepts, for the
+	// tools that reach servers without going through their routes.
+	auths map[string]*routeAuth
+}
+
+func newClientRegistry() *clientRegistry {
+	return &clientRegistry{clients: make(map[string]*Client), auths: make(map[string]*routeAuth)}
+}
+
+func (r *clientRegistry) add(name string, c *Client, auth *routeAuth) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clients[name] = c
+	r.auths[name] = auth
+}
+
+func (r *clientRegistry) remove(name string) (*Client, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	c, ok := r.clients[name]
+	delete(r.clients, name)
+	delete(r.auths, name)
+	return c, ok
+}
+
+func (r *clientRegistry) names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	names := make([]string, 0, len(r.clients))
+	for name := range r.clients {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func (r *clientRegistry) get(name string) (*Client, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	c, ok := r.clients[name]
+	return c, ok
+}
+
+// accepts reports whether the route of the named server would let in
+// token, which another route already authenticated.
+func (r *clientRegistry) accepts(name string, token *AuthToken) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.auths[name].accepts(token)
+}
@@ -0,0 +1,77 @@
+package proxy
+
+import (
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// mountHTTPRoute serves routePath and everything below it from the route's
+// target. Unlike MCP routes it does not inherit the proxy's auth tokens.
+func (p *Proxy) mountHTTPRoute(routePath string, conf *HTTPRouteConfig) error {
+	target, err := url.Parse(conf.Target)
+	if err != nil {
+		return err
+	}
+	prefix := path.Join("/", p.baseURL.Path, strings.Trim(routePath, "/"))
+	reverseProxy := &httputil.ReverseProxy{
+		FlushInterval: -1,
+		Rewrite: func(r *httputil.ProxyRequest) {
+			r.SetURL(target)
+			if conf.StripPrefix {
+				// SetURL joined the full incoming path; replace it with the
+				// part below the prefix.
+				rest := strings.TrimPrefix(r.In.URL.Path, prefix)
+				r.Out.URL.Path = singleJoiningSlash(target.Path, rest)
+				r.Out.URL.RawPath = ""
+			}
+			if len(conf.AuthTokens) > 0 {
+				r.Out.Header.Del("Authorization")
+			}
+			for key, value := range conf.Headers {
+				r.Out.Header.Set(key, value)
+			}
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("<%s> HTTP route request failed: %v", prefix, err)
+			http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		},
+	}
+	var handler http.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// The route table matches by prefix; keep /cb from also serving /cbx.
+		if r.URL.Path != prefix && !strings.HasPrefix(r.URL.Path, prefix+"/") {
+			http.NotFound(w, r)
+			return
+		}
+		reverseProxy.ServeHTTP(w, r)
+	})
+	middlewares := []MiddlewareFunc{recoverMiddleware(prefix)}
+	if conf.LogEnabled {
+		middlewares = append(middlewares, loggerMiddleware(prefix))
+	}
+	if len(conf.AuthTokens) > 0 {
+		middlewares = append(middlewares, newAuthMiddleware("", conf.AuthTokens, &authSources{metrics: p.metrics}))
+	}
+	log.Printf("Proxying HTTP requests at %s to %s", prefix, conf.Target)
+	handler = chainMiddleware(handler, middlewares...)
+	// Registered with and without the trailing slash so servers added at
+	// runtime see the path as taken.
+	p.routes.Handle(prefix, handler)
+	p.routes.Handle(prefix+"/", handler)
+	return nil
+}
+
+func singleJoiningSlash(a, b string) string {
+	switch {
+	case a == "" && b == "":
+		return "/"
+	case strings.HasSuffix(a, "/") && strings.HasPrefix(b, "/"):
+		return a + b[1:]
+	case !strings.HasSuffix(a, "/") && !strings.HasPrefix(b, "/") && a != "" && b != "":
+		return a + "/" + b
+	}
+	return a + b
+}
@@ -0,0 +1,120 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+)
+
+// ipFilter admits clients by address: blocked ranges and countries are
+// always rejected and, when allowed ranges or countries are set, only
+// addresses matching one of them pass.
+type ipFilter struct {
+	allow          []netip.Prefix
+	block          []netip.Prefix
+	allowCountries map[string]bool
+	blockCountries map[string]bool
+	geo            *geoIPDB
+}
+
+func newIPFilter(conf *IPFilterConfig, geo *geoIPDB) (*ipFilter, error) {
+	filter := &ipFilter{
+		allowCountries: countrySet(conf.AllowCountries),
+		blockCountries: countrySet(conf.BlockCountries),
+		geo:            geo,
+	}
+	for _, value := range conf.Allow {
+		prefix, err := parseAddressOrPrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("ipFilter.allow: %w", err)
+		}
+		filter.allow = append(filter.allow, prefix)
+	}
+	for _, value := range conf.Block {
+		prefix, err := parseAddressOrPrefix(value)
+		if err != nil {
+			return nil, fmt.Errorf("ipFilter.block: %w", err)
+		}
+		filter.block = append(filter.block, prefix)
+	}
+	return filter, nil
+}
+
+func countrySet(codes []string) map[string]bool {
+	set := make(map[string]bool, len(codes))
+	for _, code := range codes {
+		set[strings.ToUpper(code)] = true
+	}
+	return set
+}
+
+// allows reports whether addr may pass and, for logging, the country it
+// was resolved to when countries are filtered.
+func (f *ipFilter) allows(addr netip.Addr) (bool, string) {
+	for _, prefix := range f.block {
+		if prefix.Contains(addr) {
+			return false, ""
+		}
+	}
+	country := ""
+	if len(f.allowCountries) > 0 || len(f.blockCountries) > 0 {
+		country = f.geo.country(addr)
+		if f.blockCountries[country] {
+			return false, country
+		}
+	}
+	if len(f.allow) == 0 && len(f.allowCountries) == 0 {
+		return true, country
+	}
+	for _, prefix := range f.allow {
+		if prefix.Contains(addr) {
+			return true, country
+		}
+	}
+	return f.allowCountries[country], country
+}
+
+// newIPFilterMiddleware rejects requests from addresses conf does not
+// admit with 403. An invalid conf, which Validate normally catches,
+// rejects everything rather than leaving the route open.
+func newIPFilterMiddleware(name string, conf *IPFilterConfig, geo *geoIPDB) MiddlewareFunc {
+	filter, err := newIPFilter(conf, geo)
+	if err != nil {
+		log.Printf("<%s> Invalid ipFilter, rejecting all requests: %v", name, err)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			addr, ok := remoteAddr(r)
+			if filter == nil || !ok {
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			if allowed, country := filter.allows(addr); !allowed {
+				if country == "" {
+					country = "unknown country"
+				}
+				log.Printf("<%s> Rejected request from %s (%s)", name, addr, country)
+				http.Error(w, "Forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// remoteAddr is the address of the connecting peer. Forwarding headers are
+// not consulted, since any client can set them.
+func remoteAddr(r *http.Request) (netip.Addr, bool) {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return addr.Unmap(), true
+}
@@ -0,0 +1,366 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"math"
+	"regexp"
+	"slices"
+	"strings"
+	"sync"
+	"unicode/utf8"
+)
+
+const (
+	// jsonSchemaMaxDepth bounds $ref chains, so a recursive schema cannot
+	// recurse forever on a value it keeps matching. Deeper schemas are
+	// taken to match.
+	jsonSchemaMaxDepth = 64
+	// jsonSchemaReportLimit caps the violations reported for one value.
+	jsonSchemaReportLimit = 10
+)
+
+// jsonSchema validates values against the subset of JSON Schema that tool
+// schemas use in practice: type, enum, const, the string, number, object
+// and array constraints, allOf/anyOf/oneOf/not and local $refs. Keywords it
+// does not know, such as format, and $refs it cannot resolve are ignored, so
+// an unusual schema can only let more values through, never reject a valid
+// one.
+type jsonSchema struct {
+	root any
+
+	mu       sync.Mutex
+	patterns map[string]*regexp.Regexp
+}
+
+// compileJSONSchema prepares schema, which may be any value that encodes
+// to a JSON Schema, for validation.
+func compileJSONSchema(schema any) (*jsonSchema, error) {
+	data, err := json.Marshal(schema)
+	if err != nil {
+		return nil, err
+	}
+	var root any
+	if err = json.Unmarshal(data, &root); err != nil {
+		return nil, err
+	}
+	if _, ok := root.(map[string]any); !ok {
+		if _, ok = root.(bool); !ok {
+			return nil, fmt.Errorf("schema must be an object or a boolean")
+		}
+	}
+	return &jsonSchema{root: root, patterns: make(map[string]*regexp.Regexp)}, nil
+}
+
+// validate returns the ways value, named name in the messages, violates
+// the schema. value is normalized through JSON first, so Go values of any
+// type can be checked.
+func (s *jsonSchema) validate(name string, value any) []string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return []string{name + " cannot be encoded as JSON: " + err.Error()}
+	}
+	var normalized any
+	if err = json.Unmarshal(data, &normalized); err != nil {
+		return []string{name + " cannot be encoded as JSON: " + err.Error()}
+	}
+	var errs []string
+	s.check(s.root, normalized, name, 0, &errs)
+	if len(errs) > jsonSchemaReportLimit {
+		errs = append(errs[:jsonSchemaReportLimit:jsonSchemaReportLimit], fmt.Sprintf("and %d more", len(errs)-jsonSchemaReportLimit))
+	}
+	return errs
+}
+
+func (s *jsonSchema) check(schema, value any, path string, depth int, errs *[]string) {
+	if depth > jsonSchemaMaxDepth {
+		return
+	}
+	switch node := schema.(type) {
+	case bool:
+		if !node {
+			*errs = append(*errs, path+" is not allowed")
+		}
+		return
+	case map[string]any:
+		s.checkObject(node, value, path, depth, errs)
+	}
+}
+
+func (s *jsonSchema) checkObject(schema map[string]any, value any, path string, depth int, errs *[]string) {
+	fail := func(format string, args ...any) {
+		*errs = append(*errs, path+" "+fmt.Sprintf(format, args...))
+	}
+	// Remote and anchor $refs cannot be resolved and match anything.
+	if ref, ok := schema["$ref"].(string); ok {
+		if target, found := s.resolve(ref); found {
+			s.check(target, value, path, depth+1, errs)
+		}
+	}
+	if types := schemaTypes(schema["type"]); len(types) > 0 && !slices.ContainsFunc(types, func(t string) bool { return jsonTypeMatches(t, value) }) {
+		fail("must be %s, not %s", strings.Join(types, " or "), jsonTypeName(value))
+		return
+	}
+	if enum, ok := schema["enum"].([]any); ok && !slices.ContainsFunc(enum, func(option any) bool { return jsonEqual(option, value) }) {
+		fail("must be one of %s", compactJSON(enum))
+	}
+	if constant, ok := schema["const"]; ok && !jsonEqual(constant, value) {
+		fail("must be %s", compactJSON(constant))
+	}
+
+	switch v := value.(type) {
+	case string:
+		length := float64(utf8.RuneCountInString(v))
+		if limit, ok := schemaNumber(schema["minLength"]); ok && length < limit {
+			fail("must be at least %v characters long", limit)
+		}
+		if limit, ok := schemaNumber(schema["maxLength"]); ok && length > limit {
+			fail("must be at most %v characters long", limit)
+		}
+		if pattern, ok := schema["pattern"].(string); ok {
+			if re := s.pattern(pattern); re != nil && !re.MatchString(v) {
+				fail("must match %s", pattern)
+			}
+		}
+	case float64:
+		if limit, ok := schemaNumber(schema["minimum"]); ok && v < limit {
+			fail("must be at least %v", limit)
+		}
+		if limit, ok := schemaNumber(schema["maximum"]); ok && v > limit {
+			fail("must be at most %v", limit)
+		}
+		if limit, ok := schemaNumber(schema["exclusiveMinimum"]); ok && v <= limit {
+			fail("must be greater than %v", limit)
+		}
+		if limit, ok := schemaNumber(schema["exclusiveMaximum"]); ok && v >= limit {
+			fail("must be less than %v", limit)
+		}
+		if factor, ok := schemaNumber(schema["multipleOf"]); ok && factor > 0 {
+			if quotient := v / factor; math.Abs(quotient-math.Round(quotient)) > 1e-9 {
+				fail("must be a multiple of %v", factor)
+			}
+		}
+	case map[string]any:
+		s.checkProperties(schema, v, path, depth, errs)
+	case []any:
+		s.checkItems(schema, v, path, depth, errs)
+	}
+
+	if all, ok := schema["allOf"].([]any); ok {
+		for _, sub := range all {
+			s.check(sub, value, path, depth+1, errs)
+		}
+	}
+	if anyOf, ok := schema["anyOf"].([]any); ok {
+		matched := slices.ContainsFunc(anyOf, func(sub any) bool { return s.matches(sub, value, path, depth) })
+		if !matched {
+			fail("must match at least one of the schemas in anyOf")
+		}
+	}
+	if oneOf, ok := schema["oneOf"].([]any); ok {
+		matches := 0
+		for _, sub := range oneOf {
+			if s.matches(sub, value, path, depth) {
+				matches++
+			}
+		}
+		if matches != 1 {
+			fail("must match exactly one of the schemas in oneOf, matched %d", matches)
+		}
+	}
+	if not, ok := schema["not"]; ok && s.matches(not, value, path, depth) {
+		fail("must not match the schema in not")
+	}
+}
+
+func (s *jsonSchema) checkProperties(schema, object map[string]any, path string, depth int, errs *[]string) {
+	if required, ok := schema["required"].([]any); ok {
+		for _, name := range required {
+			if key, ok := name.(string); ok {
+				if _, present := object[key]; !present {
+					*errs = append(*errs, fmt.Sprintf("%s.%s is required", path, key))
+				}
+			}
+		}
+	}
+	count := float64(len(object))
+	if limit, ok := schemaNumber(schema["minProperties"]); ok && count < limit {
+		*errs = append(*errs, fmt.Sprintf("%s must have at least %v properties", path, limit))
+	}
+	if limit, ok := schemaNumber(schema["maxProperties"]); ok && count > limit {
+		*errs = append(*errs, fmt.Sprintf("%s must have at most %v properties", path, limit))
+	}
+	properties, _ := schema["properties"].(map[string]any)
+	patternProperties, _ := schema["patternProperties"].(map[string]any)
+	additional, hasAdditional := schema["additionalProperties"]
+	for _, key := range slices.Sorted(maps.Keys(object)) {
+		value := object[key]
+		keyPath := path + "." + key
+		matched := false
+		if sub, ok := properties[key]; ok {
+			matched = true
+			s.check(sub, value, keyPath, depth+1, errs)
+		}
+		for pattern, sub := range patternProperties {
+			if re := s.pattern(pattern); re != nil && re.MatchString(key) {
+				matched = true
+				s.check(sub, value, keyPath, depth+1, errs)
+			}
+		}
+		if matched || !hasAdditional {
+			continue
+		}
+		if allowed, ok := additional.(bool); ok && !allowed {
+			*errs = append(*errs, keyPath+" is not a known property")
+			continue
+		}
+		s.check(additional, value, keyPath, depth+1, errs)
+	}
+}
+
+func (s *jsonSchema) checkItems(schema map[string]any, array []any, path string, depth int, errs *[]string) {
+	count := float64(len(array))
+	if limit, ok := schemaNumber(schema["minItems"]); ok && count < limit {
+		*errs = append(*errs, fmt.Sprintf("%s must have at least %v items", path, limit))
+	}
+	if limit, ok := schemaNumber(schema["maxItems"]); ok && count > limit {
+		*errs = append(*errs, fmt.Sprintf("%s must have at most %v items", path, limit))
+	}
+	if unique, _ := schema["uniqueItems"].(bool); unique {
+		for i := range array {
+			for j := i + 1; j < len(array); j++ {
+				if jsonEqual(array[i], array[j]) {
+					*errs = append(*errs, fmt.Sprintf("%s[%d] duplicates %s[%d]", path, j, path, i))
+				}
+			}
+		}
+	}
+	// prefixItems, or the older array form of items, constrain the leading
+	// items; items as a schema constrains the rest.
+	prefix, _ := schema["prefixItems"].([]any)
+	if tuple, ok := schema["items"].([]any); ok {
+		prefix = tuple
+	}
+	for i, item := range array {
+		itemPath := fmt.Sprintf("%s[%d]", path, i)
+		if i < len(prefix) {
+			s.check(prefix[i], item, itemPath, depth+1, errs)
+			continue
+		}
+		if items, ok := schema["items"]; ok {
+			if _, tuple := items.([]any); !tuple {
+				s.check(items, item, itemPath, depth+1, errs)
+			}
+		}
+	}
+}
+
+// matches reports whether value satisfies schema, for the combinators.
+func (s *jsonSchema) matches(schema, value any, path string, depth int) bool {
+	var errs []string
+	s.check(schema, value, path, depth+1, &errs)
+	return len(errs) == 0
+}
+
+// resolve looks up a $ref within the schema, e.g. #/$defs/address.
+func (s *jsonSchema) resolve(ref string) (any, bool) {
+	pointer, ok := strings.CutPrefix(ref, "#")
+	if !ok {
+		return nil, false
+	}
+	node := s.root
+	for token := range strings.SplitSeq(strings.TrimPrefix(pointer, "/"), "/") {
+		if token == "" {
+			continue
+		}
+		token = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+		object, ok := node.(map[string]any)
+		if !ok {
+			return nil, false
+		}
+		if node, ok = object[token]; !ok {
+			return nil, false
+		}
+	}
+	return node, true
+}
+
+// pattern compiles and caches a pattern. Patterns Go cannot compile, such
+// as those with lookarounds, are skipped.
+func (s *jsonSchema) pattern(pattern string) *regexp.Regexp {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	re, ok := s.patterns[pattern]
+	if !ok {
+		re, _ = regexp.Compile(pattern)
+		s.patterns[pattern] = re
+	}
+	return re
+}
+
+func schemaTypes(v any) []string {
+	switch t := v.(type) {
+	case string:
+		return []string{t}
+	case []any:
+		var types []string
+		for _, item := range t {
+			if name, ok := item.(string); ok {
+				types = append(types, name)
+			}
+		}
+		return types
+	}
+	return nil
+}
+
+func schemaNumber(v any) (float64, bool) {
+	n, ok := v.(float64)
+	return n, ok
+}
+
+func jsonTypeMatches(t string, value any) bool {
+	switch t {
+	case "integer":
+		n, ok := value.(float64)
+		return ok && n == math.Trunc(n)
+	case "number":
+		_, ok := value.(float64)
+		return ok
+	}
+	return jsonTypeName(value) == t
+}
+
+func jsonTypeName(value any) string {
+	switch value.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "boolean"
+	case float64:
+		return "number"
+	case string:
+		return "string"
+	case []any:
+		return "array"
+	case map[string]any:
+		return "object"
+	}
+	return fmt.Sprintf("%T", value)
+}
+
+func jsonEqual(a, b any) bool {
+	dataA, errA := json.Marshal(a)
+	dataB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && bytes.Equal(dataA, dataB)
+}
+
+func compactJSON(v any) string {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(data)
+}
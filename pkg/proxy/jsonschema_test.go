@@ -0,0 +1,85 @@
+package proxy
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+)
+
+func TestJSONSchemaValidate(t *testing.T) {
+	const defs = `{
+		"$defs": {
+			"name": {"type": "string", "minLength": 1},
+			"node": {"type": "object", "properties": {"next": {"$ref": "#/$defs/node"}}, "additionalProperties": false}
+		},
+		"type": "object",
+		"properties": {"owner": {"$ref": "#/$defs/name"}, "list": {"$ref": "#/$defs/node"}}
+	}`
+	tests := []struct {
+		name   string
+		schema string
+		value  string
+		// want is a substring of the only violation; empty when the value
+		// is valid.
+		want string
+	}{
+		{name: "type", schema: `{"type": "string"}`, value: `1`, want: "must be string, not number"},
+		{name: "integer", schema: `{"type": "integer"}`, value: `1.5`, want: "must be integer"},
+		{name: "type list", schema: `{"type": ["string", "null"]}`, value: `null`},
+		{name: "enum", schema: `{"enum": ["a", "b"]}`, value: `"c"`, want: `must be one of ["a","b"]`},
+		{name: "required", schema: `{"type": "object", "required": ["id"]}`, value: `{}`, want: "arguments.id is required"},
+		{name: "additional properties", schema: `{"type": "object", "additionalProperties": false}`, value: `{"x": 1}`, want: "arguments.x is not a known property"},
+		{name: "items", schema: `{"type": "array", "items": {"type": "number"}}`, value: `[1, "2"]`, want: "arguments[1] must be number"},
+
+		{name: "$ref", schema: defs, value: `{"owner": "me"}`},
+		{name: "$ref violation", schema: defs, value: `{"owner": ""}`, want: "arguments.owner must be at least 1 characters long"},
+		{name: "recursive $ref", schema: defs, value: `{"list": {"next": {"next": {}}}}`},
+		{name: "recursive $ref violation", schema: defs, value: `{"list": {"next": {"other": 1}}}`, want: "arguments.list.next.other is not a known property"},
+		{name: "definitions $ref", schema: `{"definitions": {"n": {"type": "number"}}, "$ref": "#/definitions/n"}`, value: `"x"`, want: "must be number"},
+		{name: "remote $ref", schema: `{"$ref": "https://example.com/schema.json"}`, value: `"anything"`},
+		{name: "anchor $ref", schema: `{"$ref": "#item", "type": "string"}`, value: `"anything"`},
+		{name: "missing $ref", schema: `{"$ref": "#/$defs/missing"}`, value: `1`},
+		{name: "unresolvable $ref keeps siblings", schema: `{"$ref": "#item", "type": "string"}`, value: `1`, want: "must be string"},
+		{name: "self $ref past depth", schema: `{"$ref": "#"}`, value: `1`},
+
+		{name: "allOf", schema: `{"allOf": [{"minimum": 1}, {"maximum": 3}]}`, value: `2`},
+		{name: "allOf violation", schema: `{"allOf": [{"minimum": 1}, {"maximum": 3}]}`, value: `4`, want: "must be at most 3"},
+		{name: "anyOf", schema: `{"anyOf": [{"type": "string"}, {"type": "number"}]}`, value: `1`},
+		{name: "anyOf violation", schema: `{"anyOf": [{"type": "string"}, {"type": "number"}]}`, value: `true`, want: "must match at least one of the schemas in anyOf"},
+		{name: "oneOf", schema: `{"oneOf": [{"type": "string"}, {"type": "number"}]}`, value: `"a"`},
+		{name: "oneOf matching two", schema: `{"oneOf": [{"type": "number"}, {"type": "integer"}]}`, value: `1`, want: "matched 2"},
+		{name: "oneOf matching none", schema: `{"oneOf": [{"type": "string"}, {"type": "number"}]}`, value: `null`, want: "matched 0"},
+		{name: "not", schema: `{"not": {"type": "null"}}`, value: `null`, want: "must not match the schema in not"},
+
+		{name: "date-time format", schema: `{"type": "string", "format": "date-time"}`, value: `"not a date"`},
+		{name: "email format", schema: `{"type": "string", "format": "email"}`, value: `"not an email"`},
+		{name: "uri format", schema: `{"type": "string", "format": "uri"}`, value: `"::"`},
+		{name: "unknown format", schema: `{"type": "string", "format": "x-custom"}`, value: `"x"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var schema any
+			if err := json.Unmarshal([]byte(tt.schema), &schema); err != nil {
+				t.Fatal(err)
+			}
+			var value any
+			if err := json.Unmarshal([]byte(tt.value), &value); err != nil {
+				t.Fatal(err)
+			}
+			compiled, err := compileJSONSchema(schema)
+			if err != nil {
+				t.Fatal(err)
+			}
+			violations := compiled.validate("arguments", value)
+			if tt.want == "" {
+				if len(violations) != 0 {
+					t.Errorf("violations = %q, want none", violations)
+				}
+				return
+			}
+			if len(violations) != 1 || !strings.Contains(violations[0], tt.want) {
+				t.Errorf("violations = %q, want one containing %q", violations, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,247 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	limitSessions = "sessions"
+	limitRequests = "requests"
+
+	// sessionRetryAfter is the Retry-After sent while a server has
+	// options.maxSessions sessions open.
+	sessionRetryAfter = 5 * time.Second
+)
+
+// rateLimiter hands out the requests a server may receive.
+type rateLimiter interface {
+	// take spends a token, or reports how long until one is available.
+	take(now time.Time) (bool, time.Duration)
+}
+
+// tokenBucket holds up to capacity tokens, and refills at rate tokens per
+// second.
+type tokenBucket struct {
+	mu       sync.Mutex
+	capacity float64
+	rate     float64
+	tokens   float64
+	last     time.Time
+}
+
+func newTokenBucket(capacity, rate float64) *tokenBucket {
+	return &tokenBucket{capacity: capacity, rate: rate, tokens: capacity, last: time.Now()}
+}
+
+func (b *tokenBucket) refill(now time.Time) {
+	b.tokens = math.Min(b.capacity, b.tokens+now.Sub(b.last).Seconds()*b.rate)
+	b.last = now
+}
+
+func (b *tokenBucket) take(now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	if b.tokens >= 1 {
+		b.tokens--
+		return true, 0
+	}
+	return false, time.Duration((1 - b.tokens) / b.rate * float64(time.Second))
+}
+
+// reserve takes n tokens even if the bucket does not hold them yet, and
+// returns how long to wait until it would have.
+func (b *tokenBucket) reserve(now time.Time, n int) time.Duration {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.refill(now)
+	b.tokens -= float64(n)
+	if b.tokens >= 0 {
+		return 0
+	}
+	return time.Duration(-b.tokens / b.rate * float64(time.Second))
+}
+
+// newRequestBucket allows perMinute requests at once, refilled over a
+// minute.
+func newRequestBucket(perMinute int) *tokenBucket {
+	return newTokenBucket(float64(perMinute), float64(perMinute)/60)
+}
+
+// sharedBucket takes tokens from the bucket a cluster shares for a server,
+// so that maxRequestsPerMinute holds across all nodes. While Redis cannot
+// be reached it falls back to a local bucket, which enforces the limit on
+// this node alone, and tries Redis again every cluster interval.
+type sharedBucket struct {
+	server    string
+	perMinute int
+	cluster   *cluster
+	local     *tokenBucket
+
+	mu      sync.Mutex
+	retryAt time.Time
+}
+
+func (b *sharedBucket) take(now time.Time) (bool, time.Duration) {
+	b.mu.Lock()
+	fallback := now.Before(b.retryAt)
+	b.mu.Unlock()
+	if fallback {
+		return b.local.take(now)
+	}
+	ok, wait, err := b.cluster.takeToken(b.server, b.perMinute, now)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if err != nil {
+		if b.retryAt.IsZero() {
+			log.Printf("<%s> Failed to take from the cluster's rate limit, limiting this node alone: %v", b.server, err)
+		}
+		b.retryAt = now.Add(b.cluster.interval)
+		return b.local.take(now)
+	}
+	if !b.retryAt.IsZero() {
+		log.Printf("<%s> Rate limit shared with the cluster again", b.server)
+		b.retryAt = time.Time{}
+	}
+	return ok, wait
+}
+
+// serverLimits protects an upstream, typically a small stdio process, from
+// more clients than it can serve: it caps the sessions open on the server
+// and the requests it receives per minute. Requests over either cap are
+// answered right away with a Retry-After instead of queueing.
+type serverLimits struct {
+	server      string
+	maxSessions int64
+	open        atomic.Int64
+	bucket      rateLimiter
+	metrics     *proxyMetrics
+	// Rejections are logged when they start and stop, not one by one.
+	rejectingSessions atomic.Bool
+	rejectingRequests atomic.Bool
+}
+
+// sessionSlot is the share of options.maxSessions a request holds. A
+// handler that outlives its request, such as that of a resumable stream,
+// keeps the slot until it returns.
+type sessionSlot struct {
+	release func()
+	kept    atomic.Bool
+}
+
+type sessionSlotKey struct{}
+
+// keepSessionSlot hands the slot of the request behind ctx to a handler
+// that runs apart from it. The returned func releases the slot; it does
+// nothing when the request holds none.
+func keepSessionSlot(ctx context.Context) func() {
+	slot, _ := ctx.Value(sessionSlotKey{}).(*sessionSlot)
+	if slot == nil {
+		return func() {}
+	}
+	slot.kept.Store(true)
+	return slot.release
+}
+
+// newLimitsMiddleware enforces options.maxSessions and
+// options.maxRequestsPerMinute on a server's routes. Streamable HTTP
+// routes are stateless, so sessions are counted as the requests in flight
+// that do not belong to an SSE session already open: SSE streams for as
+// long as they are open, and streamable HTTP requests while they are
+// handled, including after the client went away from a resumable stream.
+// sse tells whether the routes use the SSE transport, the only one whose
+// message posts are left out. Sessions are always counted per node;
+// requests across the cluster when it has rateLimits enabled.
+func newLimitsMiddleware(name string, options *OptionsV2, metrics *proxyMetrics, cluster *cluster, sse bool) MiddlewareFunc {
+	limits := &serverLimits{server: name, maxSessions: int64(options.MaxSessions), metrics: metrics}
+	switch {
+	case options.MaxRequestsPerMinute <= 0:
+	case cluster != nil && cluster.rateLimits:
+		limits.bucket = &sharedBucket{
+			server:    name,
+			perMinute: options.MaxRequestsPerMinute,
+			cluster:   cluster,
+			local:     newRequestBucket(options.MaxRequestsPerMinute),
+		}
+	default:
+		limits.bucket = newRequestBucket(options.MaxRequestsPerMinute)
+	}
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if limits.bucket != nil {
+				ok, wait := limits.bucket.take(time.Now())
+				if !limits.allow(limitRequests, &limits.rejectingRequests, ok) {
+					limits.reject(w, http.StatusTooManyRequests, limitRequests, wait,
+						fmt.Sprintf("server %s received more than %d requests per minute", name, options.MaxRequestsPerMinute))
+					return
+				}
+			}
+			if limits.maxSessions <= 0 || (sse && isSSEMessagePost(r)) {
+				next.ServeHTTP(w, r)
+				return
+			}
+			open := limits.open.Add(1)
+			slot := &sessionSlot{release: sync.OnceFunc(func() {
+				limits.metrics.setOpenSessions(name, limits.open.Add(-1))
+			})}
+			defer func() {
+				if !slot.kept.Load() {
+					slot.release()
+				}
+			}()
+			if !limits.allow(limitSessions, &limits.rejectingSessions, open <= limits.maxSessions) {
+				limits.reject(w, http.StatusServiceUnavailable, limitSessions, sessionRetryAfter,
+					fmt.Sprintf("server %s already has the %d sessions and requests in progress it accepts", name, limits.maxSessions))
+				return
+			}
+			limits.metrics.setOpenSessions(name, open)
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), sessionSlotKey{}, slot)))
+		})
+	}
+}
+
+// isSSEMessagePost reports whether r posts a message to an SSE session,
+// which its stream already counts.
+func isSSEMessagePost(r *http.Request) bool {
+	return r.Method == http.MethodPost && strings.HasSuffix(r.URL.Path, "/message") && r.URL.Query().Get("sessionId") != ""
+}
+
+// allow counts a rejection and logs when rejections over a limit start and
+// stop. It returns ok.
+func (l *serverLimits) allow(limit string, rejecting *atomic.Bool, ok bool) bool {
+	option := "maxSessions"
+	if limit == limitRequests {
+		option = "maxRequestsPerMinute"
+	}
+	if ok {
+		if rejecting.Swap(false) {
+			log.Printf("<%s> Accepting requests again, back under %s", l.server, option)
+		}
+		return true
+	}
+	l.metrics.recordLimitRejection(l.server, limit)
+	if !rejecting.Swap(true) {
+		log.Printf("<%s> Rejecting requests over %s", l.server, option)
+	}
+	return false
+}
+
+func (l *serverLimits) reject(w http.ResponseWriter, status int, limit string, retryAfter time.Duration, message string) {
+	seconds := max(1, int(math.Ceil(retryAfter.Seconds())))
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	writeJSON(w, status, map[string]any{
+		"error":      message,
+		"server":     l.server,
+		"limit":      limit,
+		"retryAfter": seconds,
+	})
+}
@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestTokenBucketTake(t *testing.T) {
+	start := time.Unix(1000, 0)
+	tests := []struct {
+		name     string
+		capacity float64
+		rate     float64
+		takes    int
+		after    time.Duration
+		wantOK   bool
+		wantWait time.Duration
+	}{
+		{name: "within capacity", capacity: 3, rate: 1, takes: 2, wantOK: true},
+		{name: "empty", capacity: 3, rate: 1, takes: 3, wantOK: false, wantWait: time.Second},
+		{name: "slow refill", capacity: 2, rate: 0.5, takes: 2, wantOK: false, wantWait: 2 * time.Second},
+		{name: "partly refilled", capacity: 2, rate: 1, takes: 2, after: 500 * time.Millisecond, wantOK: false, wantWait: 500 * time.Millisecond},
+		{name: "refilled", capacity: 2, rate: 1, takes: 2, after: time.Second, wantOK: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &tokenBucket{capacity: tt.capacity, rate: tt.rate, tokens: tt.capacity, last: start}
+			for i := range tt.takes {
+				if ok, _ := b.take(start); !ok {
+					t.Fatalf("take %d failed within capacity", i+1)
+				}
+			}
+			ok, wait := b.take(start.Add(tt.after))
+			if ok != tt.wantOK || wait != tt.wantWait {
+				t.Errorf("take() = %v, %s, want %v, %s", ok, wait, tt.wantOK, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestTokenBucketRefillCapped(t *testing.T) {
+	start := time.Unix(1000, 0)
+	b := &tokenBucket{capacity: 2, rate: 1, tokens: 2, last: start}
+	now := start.Add(time.Hour)
+	for range 2 {
+		if ok, _ := b.take(now); !ok {
+			t.Fatal("take failed within capacity")
+		}
+	}
+	if ok, _ := b.take(now); ok {
+		t.Error("take succeeded beyond capacity after a long idle period")
+	}
+}
+
+func TestTokenBucketReserve(t *testing.T) {
+	start := time.Unix(1000, 0)
+	tests := []struct {
+		name     string
+		reserves []int
+		after    time.Duration
+		wantWait time.Duration
+	}{
+		{name: "within capacity", reserves: []int{50}, wantWait: 0},
+		{name: "exactly capacity", reserves: []int{100}, wantWait: 0},
+		{name: "over capacity", reserves: []int{150}, wantWait: 500 * time.Millisecond},
+		{name: "debt accumulates", reserves: []int{100, 100}, wantWait: time.Second},
+		{name: "debt repaid", reserves: []int{200, 50}, after: time.Second, wantWait: 500 * time.Millisecond},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := &tokenBucket{capacity: 100, rate: 100, tokens: 100, last: start}
+			var wait time.Duration
+			for i, n := range tt.reserves {
+				now := start
+				if i == len(tt.reserves)-1 {
+					now = start.Add(tt.after)
+				}
+				wait = b.reserve(now, n)
+			}
+			if wait != tt.wantWait {
+				t.Errorf("reserve() = %s, want %s", wait, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestNewRequestBucket(t *testing.T) {
+	b := newRequestBucket(60)
+	now := b.last
+	for i := range 60 {
+		if ok, _ := b.take(now); !ok {
+			t.Fatalf("request %d of 60 rejected", i+1)
+		}
+	}
+	ok, wait := b.take(now)
+	if ok || wait != time.Second {
+		t.Errorf("take() = %v, %s, want false, 1s", ok, wait)
+	}
+}
+
+func TestLimitsSessionIDExemption(t *testing.T) {
+	tests := []struct {
+		name       string
+		sse        bool
+		method     string
+		target     string
+		wantStatus int
+	}{
+		{name: "sse message post", sse: true, method: http.MethodPost, target: "/github/message?sessionId=abc", wantStatus: http.StatusOK},
+		{name: "sse stream", sse: true, method: http.MethodGet, target: "/github/sse?sessionId=abc", wantStatus: http.StatusServiceUnavailable},
+		{name: "sse post elsewhere", sse: true, method: http.MethodPost, target: "/github/mcp?sessionId=abc", wantStatus: http.StatusServiceUnavailable},
+		{name: "streamable with session id", method: http.MethodPost, target: "/github/message?sessionId=abc", wantStatus: http.StatusServiceUnavailable},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := make(chan struct{})
+			started := make(chan struct{})
+			handler := newLimitsMiddleware("github", &OptionsV2{MaxSessions: 1}, nil, nil, tt.sse)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path == "/github/held" {
+					close(started)
+					<-release
+				}
+			}))
+			done := make(chan struct{})
+			go func() {
+				defer close(done)
+				handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/github/held", nil))
+			}()
+			<-started
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, nil))
+			close(release)
+			<-done
+			if w.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+		})
+	}
+}
@@ -0,0 +1,56 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"net"
+	"net/http"
+)
+
+// newHTTPServer builds the server for mcpProxy.addr, tuned by
+// mcpProxy.listener.
+func newHTTPServer(conf *MCPProxyConfigV2, handler http.Handler) *http.Server {
+	server := &http.Server{
+		Addr:    conf.Addr,
+		Handler: handler,
+	}
+	listener := conf.Listener
+	if listener == nil {
+		return server
+	}
+	server.IdleTimeout = listener.IdleTimeout
+	if listener.HTTP2 {
+		// The proxy does not terminate TLS, so HTTP/2 is offered in
+		// cleartext, to clients and load balancers that use it with prior
+		// knowledge. Everyone else keeps using HTTP/1.1.
+		server.Protocols = new(http.Protocols)
+		server.Protocols.SetHTTP1(true)
+		server.Protocols.SetUnencryptedHTTP2(true)
+		server.HTTP2 = &http.HTTP2Config{
+			MaxConcurrentStreams: listener.MaxConcurrentStreams,
+			SendPingTimeout:      listener.PingInterval,
+		}
+	}
+	return server
+}
+
+// listenAddr opens mcpProxy.addr with the TCP keep-alive of mcpProxy.listener.
+func listenAddr(ctx context.Context, conf *MCPProxyConfigV2) (net.Listener, error) {
+	var config net.ListenConfig
+	if listener := conf.Listener; listener != nil {
+		switch {
+		case listener.KeepAlive < 0:
+			config.KeepAlive = -1
+		case listener.KeepAlive > 0:
+			config.KeepAliveConfig = net.KeepAliveConfig{
+				Enable:   true,
+				Idle:     listener.KeepAlive,
+				Interval: listener.KeepAlive,
+			}
+		}
+		if listener.HTTP2 {
+			log.Printf("Serving HTTP/2 without TLS next to HTTP/1.1")
+		}
+	}
+	return config.Listen(ctx, "tcp", conf.Addr)
+}
@@ -0,0 +1,362 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	logSinkTypeLoki          = "loki"
+	logSinkTypeElasticsearch = "elasticsearch"
+
+	defaultLogSinkBatchSize     = 500
+	defaultLogSinkFlushInterval = time.Second
+	logSinkQueueSize            = 10000
+	logSinkAttempts             = 3
+	defaultElasticsearchIndex   = "mcp-proxy-{date}"
+)
+
+// logEvent is one entry of the structured access and audit log: an HTTP
+// request to a server's routes or the admin API, or a tool call.
+type logEvent struct {
+	Time          time.Time `json:"time"`
+	Kind          string    `json:"kind"`
+	Server        string    `json:"server"`
+	User          string    `json:"user,omitempty"`
+	Method        string    `json:"method,omitempty"`
+	Path          string    `json:"path,omitempty"`
+	Status        int       `json:"status,omitempty"`
+	RemoteAddr    string    `json:"remoteAddr,omitempty"`
+	UserAgent     string    `json:"userAgent,omitempty"`
+	Tool          string    `json:"tool,omitempty"`
+	Client        string    `json:"client,omitempty"`
+	Outcome       string    `json:"outcome,omitempty"`
+	ArgumentBytes int       `json:"argumentBytes,omitempty"`
+	ResultBytes   int       `json:"resultBytes,omitempty"`
+	DurationMs    float64   `json:"durationMs"`
+}
+
+const (
+	logEventRequest  = "request"
+	logEventToolCall = "tool_call"
+)
+
+// eventLog ships logEvents to the configured sinks. Each sink has its own
+// queue and batches, so a slow or unreachable sink neither blocks requests
+// nor holds back the others; when its queue is full, events are dropped.
+type eventLog struct {
+	sinks   []*logSinkQueue
+	clients *clientTracker
+}
+
+type logSinkQueue struct {
+	conf   LogSinkConfig
+	send   func(ctx context.Context, events []logEvent) error
+	events chan logEvent
+	done   chan struct{}
+
+	mu   sync.Mutex
+	lost int
+}
+
+var httpSinkClient = &http.Client{Timeout: 30 * time.Second}
+
+func newEventLog(sinks []LogSinkConfig, clients *clientTracker) *eventLog {
+	if len(sinks) == 0 {
+		return nil
+	}
+	l := &eventLog{clients: clients}
+	for _, conf := range sinks {
+		q := &logSinkQueue{
+			conf:   conf,
+			events: make(chan logEvent, logSinkQueueSize),
+			done:   make(chan struct{}),
+		}
+		if q.conf.BatchSize <= 0 {
+			q.conf.BatchSize = defaultLogSinkBatchSize
+		}
+		if q.conf.FlushInterval <= 0 {
+			q.conf.FlushInterval = defaultLogSinkFlushInterval
+		}
+		switch conf.Type {
+		case logSinkTypeLoki:
+			q.send = q.sendLoki
+		case logSinkTypeElasticsearch:
+			q.send = q.sendElasticsearch
+		}
+		go q.run()
+		log.Printf("Shipping access and audit logs to %s at %s", conf.Type, conf.URL)
+		l.sinks = append(l.sinks, q)
+	}
+	return l
+}
+
+func (l *eventLog) emit(event logEvent) {
+	for _, q := range l.sinks {
+		select {
+		case q.events <- event:
+		default:
+			q.mu.Lock()
+			q.lost++
+			q.mu.Unlock()
+		}
+	}
+}
+
+// callerKey holds the *AuthToken slot a request's access event reads its
+// user from. The auth middleware runs inside the event middleware and
+// fills it in through noteCaller.
+type callerKey struct{}
+
+func noteCaller(ctx context.Context, token *AuthToken) {
+	if slot, ok := ctx.Value(callerKey{}).(**AuthToken); ok {
+		*slot = token
+	}
+}
+
+// middleware emits a request event for every request to server's routes,
+// including rejected ones. A nil log emits nothing.
+func (l *eventLog) middleware(server string) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if l == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			var caller *AuthToken
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r.WithContext(context.WithValue(r.Context(), callerKey{}, &caller)))
+			l.emit(logEvent{
+				Time:       start,
+				Kind:       logEventRequest,
+				Server:     server,
+				User:       callerName(caller),
+				Method:     r.Method,
+				Path:       r.URL.Path,
+				Status:     recorder.status,
+				RemoteAddr: r.RemoteAddr,
+				UserAgent:  r.UserAgent(),
+				DurationMs: milliseconds(time.Since(start)),
+			})
+		})
+	}
+}
+
+// wrap emits a tool_call event for every call of next.
+func (l *eventLog) wrap(next ToolCallFunc) ToolCallFunc {
+	if l == nil {
+		return next
+	}
+	return func(ctx context.Context, server string, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		start := time.Now()
+		result, err := next(ctx, server, request)
+		event := logEvent{
+			Time:          start,
+			Kind:          logEventToolCall,
+			Server:        server,
+			User:          callerName(authTokenFromContext(ctx)),
+			Tool:          request.Params.Name,
+			Client:        l.clients.fromContext(ctx).String(),
+			Outcome:       callOutcome(server, result, err),
+			ArgumentBytes: jsonSize(request.Params.Arguments),
+			DurationMs:    milliseconds(time.Since(start)),
+		}
+		if result != nil {
+			event.ResultBytes = jsonSize(result)
+		}
+		l.emit(event)
+		return result, err
+	}
+}
+
+// Close ships the events still queued.
+func (l *eventLog) Close() error {
+	if l == nil {
+		return nil
+	}
+	for _, q := range l.sinks {
+		close(q.events)
+	}
+	for _, q := range l.sinks {
+		<-q.done
+	}
+	return nil
+}
+
+func (q *logSinkQueue) run() {
+	defer close(q.done)
+	ticker := time.NewTicker(q.conf.FlushInterval)
+	defer ticker.Stop()
+	batch := make([]logEvent, 0, q.conf.BatchSize)
+	flush := func() {
+		q.mu.Lock()
+		lost := q.lost
+		q.lost = 0
+		q.mu.Unlock()
+		if lost > 0 {
+			log.Printf("Log sink %s fell behind, %d events were dropped", q.conf.URL, lost)
+		}
+		if len(batch) == 0 {
+			return
+		}
+		q.deliver(batch)
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case event, ok := <-q.events:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, event)
+			if len(batch) >= q.conf.BatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+// deliver sends a batch, retrying with backoff before giving up on it.
+func (q *logSinkQueue) deliver(batch []logEvent) {
+	var err error
+	for attempt := range logSinkAttempts {
+		if attempt > 0 {
+			time.Sleep(time.Duration(attempt) * time.Second)
+		}
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err = q.send(ctx, batch)
+		cancel()
+		if err == nil {
+			return
+		}
+	}
+	log.Printf("Failed to ship %d events to %s, dropping them: %v", len(batch), q.conf.URL, err)
+}
+
+func (q *logSinkQueue) post(ctx context.Context, url, contentType string, body []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	for key, value := range q.conf.Headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := httpSinkClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if resp.StatusCode/100 != 2 {
+		return nil, fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(data)))
+	}
+	return data, nil
+}
+
+// sendLoki pushes a batch through the Loki push API, one stream per kind
+// and server so that the labels stay few.
+func (q *logSinkQueue) sendLoki(ctx context.Context, batch []logEvent) error {
+	type stream struct {
+		Stream map[string]string `json:"stream"`
+		Values [][2]string       `json:"values"`
+	}
+	streams := make(map[[2]string]*stream)
+	var order [][2]string
+	for _, event := range batch {
+		key := [2]string{event.Kind, event.Server}
+		s, ok := streams[key]
+		if !ok {
+			labels := map[string]string{"job": "mcp-proxy", "kind": event.Kind, "server": event.Server}
+			for name, value := range q.conf.Labels {
+				labels[name] = value
+			}
+			s = &stream{Stream: labels}
+			streams[key] = s
+			order = append(order, key)
+		}
+		line, err := json.Marshal(event)
+		if err != nil {
+			continue
+		}
+		s.Values = append(s.Values, [2]string{strconv.FormatInt(event.Time.UnixNano(), 10), string(line)})
+	}
+	payload := struct {
+		Streams []*stream `json:"streams"`
+	}{}
+	for _, key := range order {
+		payload.Streams = append(payload.Streams, streams[key])
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	_, err = q.post(ctx, strings.TrimSuffix(q.conf.URL, "/")+"/loki/api/v1/push", "application/json", body)
+	return err
+}
+
+// sendElasticsearch indexes a batch with the bulk API. {date} in the index
+// name is replaced by each event's UTC date, for daily indices.
+func (q *logSinkQueue) sendElasticsearch(ctx context.Context, batch []logEvent) error {
+	index := q.conf.Index
+	if index == "" {
+		index = defaultElasticsearchIndex
+	}
+	var body bytes.Buffer
+	for _, event := range batch {
+		doc, err := json.Marshal(event)
+		if err != nil {
+			continue
+		}
+		action, _ := json.Marshal(map[string]any{"create": map[string]string{
+			"_index": strings.ReplaceAll(index, "{date}", event.Time.UTC().Format("2006.01.02")),
+		}})
+		body.Write(action)
+		body.WriteByte('\n')
+		body.Write(doc)
+		body.WriteByte('\n')
+	}
+	data, err := q.post(ctx, strings.TrimSuffix(q.conf.URL, "/")+"/_bulk", "application/x-ndjson", body.Bytes())
+	if err != nil {
+		return err
+	}
+	var response struct {
+		Errors bool `json:"errors"`
+		Items  []map[string]struct {
+			Error json.RawMessage `json:"error"`
+		} `json:"items"`
+	}
+	if err = json.Unmarshal(data, &response); err != nil || !response.Errors {
+		return nil
+	}
+	// Documents that failed are dropped rather than retried with the rest
+	// of the batch, which was indexed.
+	failed := 0
+	var first json.RawMessage
+	for _, item := range response.Items {
+		for _, result := range item {
+			if len(result.Error) > 0 {
+				failed++
+				if first == nil {
+					first = result.Error
+				}
+			}
+		}
+	}
+	log.Printf("Elasticsearch rejected %d of %d events: %s", failed, len(batch), first)
+	return nil
+}
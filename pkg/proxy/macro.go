@@ -0,0 +1,262 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// macroJSONValue matches an argument template that consists of a single
+// json action, whose output is passed on as a JSON value instead of a
+// string, e.g. "{{json .input.limit}}".
+var macroJSONValue = regexp.MustCompile(`^\{\{-?\s*json\s[^{}]*\}\}$`)
+
+var macroFuncs = template.FuncMap{
+	"json": func(v any) (string, error) {
+		data, err := json.Marshal(v)
+		return string(data), err
+	},
+}
+
+// macroTool is a tool of a virtual server that calls several upstream
+// tools in sequence, feeding the results of earlier steps into the
+// arguments of later ones.
+type macroTool struct {
+	name   string
+	schema *jsonSchema
+	steps  []*macroStep
+}
+
+type macroStep struct {
+	id        string
+	server    string
+	tool      string
+	upstream  *Client
+	arguments any
+}
+
+// macroTemplate is a templated string of the arguments of a step.
+type macroTemplate struct {
+	*template.Template
+	// jsonValue passes the output on as a JSON value.
+	jsonValue bool
+}
+
+// newMacroTool resolves the steps of conf against the connected upstreams
+// and parses their argument templates.
+func newMacroTool(conf *MacroToolConfig, registry *clientRegistry) (*macroTool, mcp.Tool, error) {
+	macro := &macroTool{name: conf.Name}
+	for i, stepConfig := range conf.Steps {
+		upstream, ok := registry.get(stepConfig.Server)
+		if !ok {
+			return nil, mcp.Tool{}, fmt.Errorf("step %d: server %s is not connected", i+1, stepConfig.Server)
+		}
+		if _, ok := upstream.findTool(stepConfig.Tool); !ok {
+			return nil, mcp.Tool{}, fmt.Errorf("step %d: tool %s not provided by server %s", i+1, stepConfig.Tool, stepConfig.Server)
+		}
+		arguments, err := parseMacroTemplates(stepConfig.Arguments)
+		if err != nil {
+			return nil, mcp.Tool{}, fmt.Errorf("step %d: %w", i+1, err)
+		}
+		macro.steps = append(macro.steps, &macroStep{
+			id:        macroStepID(stepConfig.ID, i),
+			server:    stepConfig.Server,
+			tool:      stepConfig.Tool,
+			upstream:  upstream,
+			arguments: arguments,
+		})
+	}
+	schema := conf.InputSchema
+	if len(schema) == 0 {
+		schema = json.RawMessage(`{"type":"object"}`)
+	}
+	var err error
+	if macro.schema, err = compileJSONSchema(schema); err != nil {
+		return nil, mcp.Tool{}, fmt.Errorf("inputSchema: %w", err)
+	}
+	tool := mcp.NewToolWithRawSchema(conf.Name, conf.Description, schema)
+	return macro, tool, nil
+}
+
+// macroStepID names a step for later templates: its id, or step<N>
+// counting from 1.
+func macroStepID(id string, index int) string {
+	if id != "" {
+		return id
+	}
+	return fmt.Sprintf("step%d", index+1)
+}
+
+// parseMacroTemplates replaces every string of the arguments of a step
+// with its parsed template.
+func parseMacroTemplates(v any) (any, error) {
+	switch value := v.(type) {
+	case string:
+		if !strings.Contains(value, "{{") {
+			return value, nil
+		}
+		tmpl, err := template.New("").Funcs(macroFuncs).Option("missingkey=error").Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		return &macroTemplate{Template: tmpl, jsonValue: macroJSONValue.MatchString(value)}, nil
+	case map[string]any:
+		parsed := make(map[string]any, len(value))
+		for key, item := range value {
+			tmpl, err := parseMacroTemplates(item)
+			if err != nil {
+				return nil, fmt.Errorf("arguments.%s: %w", key, err)
+			}
+			parsed[key] = tmpl
+		}
+		return parsed, nil
+	case []any:
+		parsed := make([]any, len(value))
+		for i, item := range value {
+			tmpl, err := parseMacroTemplates(item)
+			if err != nil {
+				return nil, err
+			}
+			parsed[i] = tmpl
+		}
+		return parsed, nil
+	}
+	return v, nil
+}
+
+// renderMacroArguments executes the templates parsed by
+// parseMacroTemplates against data.
+func renderMacroArguments(v any, data map[string]any) (any, error) {
+	switch value := v.(type) {
+	case *macroTemplate:
+		var b strings.Builder
+		if err := value.Execute(&b, data); err != nil {
+			return nil, err
+		}
+		if value.jsonValue {
+			var decoded any
+			if err := json.Unmarshal([]byte(b.String()), &decoded); err == nil {
+				return decoded, nil
+			}
+		}
+		return b.String(), nil
+	case map[string]any:
+		rendered := make(map[string]any, len(value))
+		for key, item := range value {
+			result, err := renderMacroArguments(item, data)
+			if err != nil {
+				return nil, err
+			}
+			rendered[key] = result
+		}
+		return rendered, nil
+	case []any:
+		rendered := make([]any, len(value))
+		for i, item := range value {
+			result, err := renderMacroArguments(item, data)
+			if err != nil {
+				return nil, err
+			}
+			rendered[i] = result
+		}
+		return rendered, nil
+	}
+	return v, nil
+}
+
+// call runs the steps in order and returns the result of the last one. The
+// first step that fails ends the macro with its error.
+func (m *macroTool) call(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	input := request.GetArguments()
+	if input == nil {
+		input = map[string]any{}
+	}
+	if violations := m.schema.validate("arguments", input); len(violations) > 0 {
+		return (&ToolError{
+			Source:  ErrorSourceProxy,
+			Code:    ErrorCodeInvalidParams,
+			Message: fmt.Sprintf("invalid arguments for %s: %s", m.name, strings.Join(violations, "; ")),
+		}).result(), nil
+	}
+	outputs := make(map[string]any)
+	data := map[string]any{"input": input, "steps": outputs}
+	var result *mcp.CallToolResult
+	for i, step := range m.steps {
+		arguments, err := renderMacroArguments(step.arguments, data)
+		if err != nil {
+			return (&ToolError{
+				Source:  ErrorSourceProxy,
+				Code:    ErrorCodeInvalidParams,
+				Server:  step.server,
+				Message: fmt.Sprintf("step %d (%s/%s) of %s: %v", i+1, step.server, step.tool, m.name, err),
+			}).result(), nil
+		}
+		forwarded := mcp.CallToolRequest{}
+		forwarded.Params.Name = step.tool
+		forwarded.Params.Arguments = arguments
+		result, err = step.upstream.callTool(ctx, forwarded)
+		if err != nil {
+			toolErr := classifyToolError(step.server, err)
+			toolErr.Message = fmt.Sprintf("step %d (%s/%s) of %s: %s", i+1, step.server, step.tool, m.name, toolErr.Message)
+			return toolErr.result(), nil
+		}
+		if result.IsError {
+			log.Printf("<%s> Macro stopped at step %d (%s/%s): the tool returned an error", m.name, i+1, step.server, step.tool)
+			result.Content = append([]mcp.Content{mcp.NewTextContent(fmt.Sprintf("step %d (%s/%s) of %s failed:", i+1, step.server, step.tool, m.name))}, result.Content...)
+			return result, nil
+		}
+		outputs[step.id] = macroOutput(result)
+	}
+	return result, nil
+}
+
+// macroOutput is what the templates of later steps see of a step as
+// .steps.<id>: text joins its text content, json is that text decoded when
+// it is JSON, and structured is its structuredContent.
+func macroOutput(result *mcp.CallToolResult) map[string]any {
+	var texts []string
+	for _, content := range result.Content {
+		if text, ok := mcp.AsTextContent(content); ok {
+			texts = append(texts, text.Text)
+		}
+	}
+	output := map[string]any{"text": strings.Join(texts, "\n")}
+	var decoded any
+	if err := json.Unmarshal([]byte(output["text"].(string)), &decoded); err == nil {
+		output["json"] = decoded
+	}
+	if result.StructuredContent != nil {
+		// Round-trip so templates see plain maps and slices.
+		if data, err := json.Marshal(result.StructuredContent); err == nil {
+			var structured any
+			if json.Unmarshal(data, &structured) == nil {
+				output["structured"] = structured
+			}
+		}
+	}
+	return output
+}
+
+// addMacroTools adds the macros of a virtual server, skipping those whose
+// steps refer to servers or tools that are not available.
+func addMacroTools(name string, macros []*MacroToolConfig, registry *clientRegistry, srv *server.MCPServer) int {
+	added := 0
+	for _, conf := range macros {
+		macro, tool, err := newMacroTool(conf, registry)
+		if err != nil {
+			log.Printf("<%s> Skipping macro %s: %v", name, conf.Name, err)
+			continue
+		}
+		log.Printf("<%s> Adding macro %s with %d steps", name, conf.Name, len(macro.steps))
+		srv.AddTool(tool, macro.call)
+		added++
+	}
+	return added
+}
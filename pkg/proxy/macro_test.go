@@ -0,0 +1,100 @@
+package proxy
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestMacroTemplates(t *testing.T) {
+	data := map[string]any{
+		"input": map[string]any{"query": "mcp", "limit": float64(5), "tags": []any{"a", "b"}},
+		"steps": map[string]any{
+			"search": map[string]any{"text": `{"ids":[1,2]}`, "json": map[string]any{"ids": []any{float64(1), float64(2)}}},
+		},
+	}
+	tests := []struct {
+		name      string
+		arguments any
+		want      any
+		// wantErr is a substring of the parse or render error.
+		wantErr string
+	}{
+		{name: "plain string", arguments: "no template", want: "no template"},
+		{name: "scalars", arguments: []any{float64(1), true, nil}, want: []any{float64(1), true, nil}},
+		{name: "string", arguments: "q={{.input.query}}", want: "q=mcp"},
+		{name: "json number", arguments: "{{json .input.limit}}", want: float64(5)},
+		{name: "json string", arguments: "{{ json .input.query }}", want: "mcp"},
+		{name: "json array", arguments: "{{json .input.tags}}", want: []any{"a", "b"}},
+		{name: "json of a step", arguments: "{{json .steps.search.json.ids}}", want: []any{float64(1), float64(2)}},
+		{name: "json within text", arguments: "limit={{json .input.limit}}", want: "limit=5"},
+		{name: "text of a step", arguments: "{{.steps.search.text}}", want: `{"ids":[1,2]}`},
+		{
+			name:      "nested",
+			arguments: map[string]any{"q": "{{.input.query}}", "filters": []any{map[string]any{"limit": "{{json .input.limit}}"}, "x"}},
+			want:      map[string]any{"q": "mcp", "filters": []any{map[string]any{"limit": float64(5)}, "x"}},
+		},
+		{name: "missing key", arguments: "{{.input.missing}}", wantErr: "missing"},
+		{name: "missing step", arguments: "{{.steps.later.text}}", wantErr: "later"},
+		{name: "parse error", arguments: map[string]any{"q": "{{.input"}, wantErr: "arguments.q"},
+		{name: "unknown function", arguments: "{{upper .input.query}}", wantErr: "upper"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parsed, err := parseMacroTemplates(tt.arguments)
+			var got any
+			if err == nil {
+				got, err = renderMacroArguments(parsed, data)
+			}
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got %v, %v, want an error containing %q", got, err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestMacroOutput(t *testing.T) {
+	result := &mcp.CallToolResult{
+		Content: []mcp.Content{
+			mcp.NewTextContent(`{"ids":`),
+			mcp.NewImageContent("aGk=", "image/png"),
+			mcp.NewTextContent(`[1]}`),
+		},
+		StructuredContent: struct {
+			IDs []int `json:"ids"`
+		}{IDs: []int{1}},
+	}
+	want := map[string]any{
+		"text":       "{\"ids\":\n[1]}",
+		"json":       map[string]any{"ids": []any{float64(1)}},
+		"structured": map[string]any{"ids": []any{float64(1)}},
+	}
+	if got := macroOutput(result); !reflect.DeepEqual(got, want) {
+		t.Errorf("got %#v, want %#v", got, want)
+	}
+
+	plain := macroOutput(&mcp.CallToolResult{Content: []mcp.Content{mcp.NewTextContent("done")}})
+	if want := map[string]any{"text": "done"}; !reflect.DeepEqual(plain, want) {
+		t.Errorf("got %#v, want %#v", plain, want)
+	}
+}
+
+func TestMacroStepID(t *testing.T) {
+	if got := macroStepID("search", 0); got != "search" {
+		t.Errorf("got %q, want search", got)
+	}
+	if got := macroStepID("", 2); got != "step3" {
+		t.Errorf("got %q, want step3", got)
+	}
+}
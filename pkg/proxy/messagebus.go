@@ -0,0 +1,287 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/nats-io/nats.go"
+	"github.com/segmentio/kafka-go"
+)
+
+const (
+	defaultBusName        = "bus"
+	defaultBusConcurrency = 8
+	defaultKafkaGroupID   = "mcp-proxy"
+)
+
+// busRequest is a tool call read from the message bus.
+type busRequest struct {
+	// ID is copied to the response so callers can match them up.
+	ID        string         `json:"id,omitempty"`
+	Server    string         `json:"server"`
+	Tool      string         `json:"tool"`
+	Arguments map[string]any `json:"arguments,omitempty"`
+}
+
+// busResponse is published for every request, with either the tool's
+// result or a classified error as in the REST API.
+type busResponse struct {
+	ID     string              `json:"id,omitempty"`
+	Server string              `json:"server,omitempty"`
+	Tool   string              `json:"tool,omitempty"`
+	Result *mcp.CallToolResult `json:"result,omitempty"`
+	Error  string              `json:"error,omitempty"`
+	Source string              `json:"source,omitempty"`
+	Code   string              `json:"code,omitempty"`
+}
+
+// messageBus consumes tool calls from NATS and Kafka, so event-driven
+// systems can use the upstreams without speaking MCP or HTTP. Calls arrive
+// as the configured principal and are checked against its servers and
+// tools and the servers' access rules, like calls with a token.
+type messageBus struct {
+	registry  *clientRegistry
+	principal *AuthToken
+	slots     chan struct{}
+
+	ctx    context.Context
+	cancel context.CancelFunc
+	wg     sync.WaitGroup
+	// closed is set by Close under mu, so no NATS call is added to wg
+	// while Close waits on it.
+	mu     sync.Mutex
+	closed bool
+
+	nc     *nats.Conn
+	sub    *nats.Subscription
+	reader *kafka.Reader
+	writer *kafka.Writer
+}
+
+// newMessageBus starts consuming calls. groups maps names to the groups they
+// belong to, as built from mcpProxy.groups.
+func newMessageBus(conf *MessageBusConfig, registry *clientRegistry, groups map[string][]string) (*messageBus, error) {
+	b := &messageBus{
+		registry: registry,
+		principal: &AuthToken{
+			Name:    conf.Name,
+			Servers: conf.Servers,
+			Tools:   conf.Tools,
+		},
+	}
+	if b.principal.Name == "" {
+		b.principal.Name = defaultBusName
+	}
+	b.principal.Groups = groups[b.principal.Name]
+	concurrency := conf.Concurrency
+	if concurrency <= 0 {
+		concurrency = defaultBusConcurrency
+	}
+	b.slots = make(chan struct{}, concurrency)
+	b.ctx, b.cancel = context.WithCancel(context.Background())
+	if conf.NATS != nil {
+		if err := b.startNATS(conf.NATS); err != nil {
+			b.cancel()
+			return nil, fmt.Errorf("nats: %w", err)
+		}
+	}
+	if conf.Kafka != nil {
+		b.startKafka(conf.Kafka)
+	}
+	return b, nil
+}
+
+// startNATS subscribes to the request subject. Requests sent with a reply
+// subject, as by nats request, are answered there; the others on
+// conf.ResultSubject, if set.
+func (b *messageBus) startNATS(conf *NATSBusConfig) error {
+	nc, err := nats.Connect(conf.URL,
+		nats.Name("mcp-proxy"),
+		// Keep retrying in the background rather than failing startup
+		// while the bus is down.
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+		nats.DisconnectErrHandler(func(_ *nats.Conn, err error) {
+			if err != nil {
+				log.Printf("Disconnected from NATS: %v", err)
+			}
+		}),
+		nats.ReconnectHandler(func(nc *nats.Conn) {
+			log.Printf("Reconnected to NATS at %s", nc.ConnectedUrlRedacted())
+		}),
+	)
+	if err != nil {
+		return err
+	}
+	handler := func(msg *nats.Msg) {
+		b.slots <- struct{}{}
+		b.mu.Lock()
+		if b.closed {
+			b.mu.Unlock()
+			<-b.slots
+			return
+		}
+		b.wg.Add(1)
+		b.mu.Unlock()
+		go func() {
+			defer func() {
+				<-b.slots
+				b.wg.Done()
+			}()
+			data := b.invoke(msg.Data)
+			var err error
+			switch {
+			case msg.Reply != "":
+				err = msg.Respond(data)
+			case conf.ResultSubject != "":
+				err = nc.Publish(conf.ResultSubject, data)
+			default:
+				return
+			}
+			if err != nil {
+				log.Printf("Failed to publish a tool result to NATS: %v", err)
+			}
+		}()
+	}
+	if conf.Queue != "" {
+		b.sub, err = nc.QueueSubscribe(conf.Subject, conf.Queue, handler)
+	} else {
+		b.sub, err = nc.Subscribe(conf.Subject, handler)
+	}
+	if err != nil {
+		nc.Close()
+		return err
+	}
+	b.nc = nc
+	log.Printf("Taking tool calls from NATS subject %s", conf.Subject)
+	return nil
+}
+
+// startKafka consumes the request topic as a consumer group. Messages are
+// handled one at a time, in order, and committed once the call is done, so
+// a call interrupted by a restart is made again.
+func (b *messageBus) startKafka(conf *KafkaBusConfig) {
+	groupID := conf.GroupID
+	if groupID == "" {
+		groupID = defaultKafkaGroupID
+	}
+	b.reader = kafka.NewReader(kafka.ReaderConfig{
+		Brokers: conf.Brokers,
+		Topic:   conf.Topic,
+		GroupID: groupID,
+	})
+	if conf.ResultTopic != "" {
+		b.writer = &kafka.Writer{
+			Addr:     kafka.TCP(conf.Brokers...),
+			Topic:    conf.ResultTopic,
+			Balancer: &kafka.Hash{},
+		}
+	}
+	b.wg.Add(1)
+	go func() {
+		defer b.wg.Done()
+		for {
+			msg, err := b.reader.FetchMessage(b.ctx)
+			if err != nil {
+				if b.ctx.Err() == nil {
+					log.Printf("Failed to read tool calls from Kafka: %v", err)
+				}
+				return
+			}
+			data := b.invoke(msg.Value)
+			if b.ctx.Err() != nil {
+				// Interrupted: leave the message to be read again.
+				return
+			}
+			if b.writer != nil {
+				// Keyed like the request so results of one key stay in order.
+				// The writer retries on its own; a result it gives up on is
+				// dropped rather than making the call again.
+				if err = b.writer.WriteMessages(b.ctx, kafka.Message{Key: msg.Key, Value: data}); err != nil {
+					log.Printf("Failed to publish a tool result to Kafka: %v", err)
+				}
+			}
+			if err = b.reader.CommitMessages(b.ctx, msg); err != nil {
+				log.Printf("Failed to commit Kafka offset: %v", err)
+			}
+		}
+	}()
+	log.Printf("Taking tool calls from Kafka topic %s", conf.Topic)
+}
+
+// invoke runs the call in data and returns the response to publish.
+func (b *messageBus) invoke(data []byte) []byte {
+	var request busRequest
+	response := busResponse{}
+	if err := json.Unmarshal(data, &request); err != nil {
+		response.Error, response.Source, response.Code = "invalid request: "+err.Error(), ErrorSourceProxy, ErrorCodeInvalidParams
+		return b.marshal(response)
+	}
+	response.ID, response.Server, response.Tool = request.ID, request.Server, request.Tool
+	result, err := b.call(request)
+	if err != nil {
+		toolErr := classifyToolError(request.Server, err)
+		log.Printf("<%s> Bus call to tool %s failed: %v", request.Server, request.Tool, err)
+		response.Error, response.Source, response.Code = toolErr.Message, toolErr.Source, toolErr.Code
+	}
+	response.Result = result
+	return b.marshal(response)
+}
+
+func (b *messageBus) call(request busRequest) (*mcp.CallToolResult, error) {
+	ctx := withAuthToken(b.ctx, b.principal)
+	c, ok := b.registry.get(request.Server)
+	if !ok || !b.principal.allowsServer(request.Server) || !c.access().allowsServer(b.principal) {
+		return nil, &ToolError{Source: ErrorSourceProxy, Code: ErrorCodeToolNotFound, Message: "server not found"}
+	}
+	tool, ok := c.findTool(request.Tool)
+	if !ok {
+		return nil, &ToolError{Source: ErrorSourceProxy, Code: ErrorCodeToolNotFound, Message: "tool not found"}
+	}
+	if !toolAllowed(ctx, c.access(), tool) {
+		return nil, &ToolError{Source: ErrorSourceProxy, Code: ErrorCodeUnauthorized, Message: "tool not allowed for " + b.principal.Name}
+	}
+	forwarded := mcp.CallToolRequest{}
+	forwarded.Params.Name = request.Tool
+	forwarded.Params.Arguments = request.Arguments
+	return c.callTool(ctx, forwarded)
+}
+
+func (b *messageBus) marshal(response busResponse) []byte {
+	data, err := json.Marshal(response)
+	if err != nil {
+		data, _ = json.Marshal(busResponse{ID: response.ID, Error: err.Error(), Source: ErrorSourceProxy, Code: ErrorCodeUpstreamError})
+	}
+	return data
+}
+
+// Close stops taking calls and interrupts those in progress.
+func (b *messageBus) Close() error {
+	if b == nil {
+		return nil
+	}
+	var errs []error
+	if b.sub != nil {
+		errs = append(errs, b.sub.Unsubscribe())
+	}
+	b.cancel()
+	b.mu.Lock()
+	b.closed = true
+	b.mu.Unlock()
+	b.wg.Wait()
+	if b.nc != nil {
+		b.nc.Close()
+	}
+	if b.reader != nil {
+		errs = append(errs, b.reader.Close())
+	}
+	if b.writer != nil {
+		errs = append(errs, b.writer.Close())
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,31 @@
+package proxy
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestNewMessageBusGroups(t *testing.T) {
+	groups := newGroupIndex(map[string][]string{"ops": {"bus", "alice"}, "etl": {"ingest"}})
+	tests := []struct {
+		name       string
+		conf       MessageBusConfig
+		wantGroups []string
+	}{
+		{name: "default name", wantGroups: []string{"ops"}},
+		{name: "configured name", conf: MessageBusConfig{Name: "ingest"}, wantGroups: []string{"etl"}},
+		{name: "no groups", conf: MessageBusConfig{Name: "other"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := newMessageBus(&tt.conf, newClientRegistry(), groups)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer b.Close()
+			if !slices.Equal(b.principal.Groups, tt.wantGroups) {
+				t.Errorf("groups = %v, want %v", b.principal.Groups, tt.wantGroups)
+			}
+		})
+	}
+}
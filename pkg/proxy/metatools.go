@@ -0,0 +1,115 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// metaTools are the management tools a virtual server can offer next to
+// upstream tools, so orchestrator agents can see and switch the upstreams
+// as part of their workflow. They only act on the servers whose own
+// tokens accept the caller and whose access rules allow it. enable_server
+// is not marked read-only, so read-only tokens neither see nor call it.
+var metaTools = map[string]func(registry *clientRegistry) server.ServerTool{
+	"list_servers":      newListServersTool,
+	"get_server_status": newGetServerStatusTool,
+	"enable_server":     newEnableServerTool,
+}
+
+// managedServer returns the named server if the request may manage it:
+// the server's own route has to accept the caller's credentials too.
+func managedServer(ctx context.Context, registry *clientRegistry, name string) (*Client, bool) {
+	c, ok := registry.get(name)
+	if !ok {
+		return nil, false
+	}
+	token := authTokenFromContext(ctx)
+	if !registry.accepts(name, token) || (token != nil && !token.allowsServer(name)) {
+		return nil, false
+	}
+	return c, c.access().allowsServer(token)
+}
+
+func newListServersTool(registry *clientRegistry) server.ServerTool {
+	tool := mcp.NewTool("list_servers",
+		mcp.WithDescription("Lists the servers behind this proxy with their tool count and whether they are active."),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(false),
+	)
+	return server.ServerTool{Tool: tool, Handler: func(ctx context.Context, _ mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		servers := make([]adminServerStatus, 0)
+		for _, name := range registry.names() {
+			if c, ok := managedServer(ctx, registry, name); ok {
+				servers = append(servers, serverStatus(name, c))
+			}
+		}
+		return metaToolResult(servers)
+	}}
+}
+
+func newGetServerStatusTool(registry *clientRegistry) server.ServerTool {
+	tool := mcp.NewTool("get_server_status",
+		mcp.WithDescription("Returns the state of a server: whether it is active or under maintenance, its health, the upstream's name and version, and its capabilities."),
+		mcp.WithString("name", mcp.Required(), mcp.Description("Server name, as returned by list_servers")),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(false),
+	)
+	return server.ServerTool{Tool: tool, Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name, err := request.RequireString("name")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		c, ok := managedServer(ctx, registry, name)
+		if !ok {
+			return mcp.NewToolResultError("unknown server " + name), nil
+		}
+		return metaToolResult(serverStatus(name, c))
+	}}
+}
+
+func newEnableServerTool(registry *clientRegistry) server.ServerTool {
+	tool := mcp.NewTool("enable_server",
+		mcp.WithDescription("Enables or disables a server. A disabled server is put into maintenance mode: its tools are hidden and calls to them fail until it is enabled again. The upstream stays connected."),
+		mcp.WithString("name", mcp.Required(), mcp.Description("Server name, as returned by list_servers")),
+		mcp.WithBoolean("enabled", mcp.Description("false to disable the server; true by default")),
+		mcp.WithReadOnlyHintAnnotation(false),
+		mcp.WithDestructiveHintAnnotation(false),
+		mcp.WithIdempotentHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(false),
+	)
+	return server.ServerTool{Tool: tool, Handler: func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		name, err := request.RequireString("name")
+		if err != nil {
+			return mcp.NewToolResultError(err.Error()), nil
+		}
+		c, ok := managedServer(ctx, registry, name)
+		if !ok {
+			return mcp.NewToolResultError("unknown server " + name), nil
+		}
+		enabled := request.GetBool("enabled", true)
+		if c.setMaintenance(!enabled) {
+			caller := callerName(authTokenFromContext(ctx))
+			if caller == "" {
+				caller = principalNone
+			}
+			if enabled {
+				log.Printf("<%s> Leaving maintenance mode, requested by %s", name, caller)
+			} else {
+				log.Printf("<%s> Entering maintenance mode, requested by %s", name, caller)
+			}
+		}
+		return metaToolResult(serverStatus(name, c))
+	}}
+}
+
+func metaToolResult(v any) (*mcp.CallToolResult, error) {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return mcp.NewToolResultText(string(data)), nil
+}
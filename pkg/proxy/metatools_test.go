@@ -0,0 +1,46 @@
+package proxy
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestMetaToolsServerTokens(t *testing.T) {
+	registry := newClientRegistry()
+	for name, tokens := range map[string][]AuthToken{"public": nil, "private": {{Token: "private-only"}}} {
+		c := newTestClient(t, name)
+		c.wire = &wireTap{}
+		registry.add(name, c, newRouteAuth(name, tokens, nil))
+	}
+	ctx := withAuthToken(context.Background(), &AuthToken{Token: "virtual"})
+
+	list := newListServersTool(registry).Handler
+	result, err := list(ctx, mcp.CallToolRequest{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	text := toolResultText(result)
+	if !strings.Contains(text, `"public"`) || strings.Contains(text, `"private"`) {
+		t.Errorf("list_servers = %s, want only the public server", text)
+	}
+
+	for _, tool := range []string{"get_server_status", "enable_server"} {
+		t.Run(tool, func(t *testing.T) {
+			request := mcp.CallToolRequest{}
+			request.Params.Arguments = map[string]any{"name": "private", "enabled": false}
+			result, err := metaTools[tool](registry).Handler(ctx, request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !result.IsError || !strings.Contains(toolResultText(result), "unknown server private") {
+				t.Errorf("%s = %s, want the private server reported unknown", tool, toolResultText(result))
+			}
+		})
+	}
+	if c, _ := registry.get("private"); c.maintenance.Load() {
+		t.Error("private server was put into maintenance")
+	}
+}
@@ -0,0 +1,559 @@
+package proxy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"maps"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// metricsRegistry renders counters in the Prometheus text exposition
+// format. It covers what the proxy exports without pulling in the client
+// library.
+type metricsRegistry struct {
+	mu       sync.Mutex
+	families []*metricFamily
+	// sink also receives every update when set, for pushing metrics to
+	// systems that do not scrape. It is set before anything is recorded.
+	sink metricsSink
+}
+
+// metricsSink receives the updates of a registry: the increment of a
+// counter, the new value of a gauge or an observation of a histogram.
+type metricsSink interface {
+	record(family *metricFamily, labelValues []string, value float64)
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	kind    string
+	labels  []string
+	buckets []float64
+
+	registry *metricsRegistry
+
+	mu     sync.Mutex
+	series map[string]*metricSeries
+}
+
+type metricSeries struct {
+	labelValues []string
+	value       float64
+	// Histograms only: cumulative counts per bucket and the observation
+	// count; value holds the sum.
+	buckets []uint64
+	count   uint64
+}
+
+func newMetricsRegistry() *metricsRegistry {
+	return &metricsRegistry{}
+}
+
+func (m *metricsRegistry) register(family *metricFamily) *metricFamily {
+	family.series = make(map[string]*metricSeries)
+	family.registry = m
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.families = append(m.families, family)
+	return family
+}
+
+// counterVec is a counter partitioned by label values.
+type counterVec struct {
+	family *metricFamily
+}
+
+func (m *metricsRegistry) counter(name, help string, labels ...string) *counterVec {
+	return &counterVec{family: m.register(&metricFamily{name: name, help: help, kind: "counter", labels: labels})}
+}
+
+// inc adds one to the series with the given label values, in the order the
+// labels were declared.
+func (c *counterVec) inc(labelValues ...string) {
+	c.family.add(1, labelValues)
+}
+
+// add adds value to the series with the given label values.
+func (c *counterVec) add(value float64, labelValues ...string) {
+	c.family.add(value, labelValues)
+}
+
+// total sums the series whose leading label values equal prefix.
+func (c *counterVec) total(prefix ...string) float64 {
+	c.family.mu.Lock()
+	defer c.family.mu.Unlock()
+	var sum float64
+	for _, series := range c.family.series {
+		if slices.Equal(series.labelValues[:min(len(prefix), len(series.labelValues))], prefix) {
+			sum += series.value
+		}
+	}
+	return sum
+}
+
+// gaugeVec is a gauge partitioned by label values.
+type gaugeVec struct {
+	family *metricFamily
+}
+
+func (m *metricsRegistry) gauge(name, help string, labels ...string) *gaugeVec {
+	return &gaugeVec{family: m.register(&metricFamily{name: name, help: help, kind: "gauge", labels: labels})}
+}
+
+func (g *gaugeVec) set(value float64, labelValues ...string) {
+	g.family.mu.Lock()
+	g.family.get(labelValues).value = value
+	g.family.mu.Unlock()
+	g.family.publish(labelValues, value)
+}
+
+// histogramVec is a histogram partitioned by label values.
+type histogramVec struct {
+	family *metricFamily
+}
+
+// latencyBuckets suit upstream round trips, from local stdio processes to
+// slow remote servers.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10, 30}
+
+// sizeBuckets suit tool arguments and results, from a few hundred bytes
+// to tens of megabytes.
+var sizeBuckets = []float64{256, 1024, 4096, 16384, 65536, 262144, 1 << 20, 4 << 20, 16 << 20, 64 << 20}
+
+func (m *metricsRegistry) histogram(name, help string, buckets []float64, labels ...string) *histogramVec {
+	return &histogramVec{family: m.register(&metricFamily{name: name, help: help, kind: "histogram", labels: labels, buckets: buckets})}
+}
+
+func (h *histogramVec) observe(value float64, labelValues ...string) {
+	h.family.mu.Lock()
+	series := h.family.get(labelValues)
+	if series.buckets == nil {
+		series.buckets = make([]uint64, len(h.family.buckets))
+	}
+	for i, bound := range h.family.buckets {
+		if value <= bound {
+			series.buckets[i]++
+		}
+	}
+	series.count++
+	series.value += value
+	h.family.mu.Unlock()
+	h.family.publish(labelValues, value)
+}
+
+func (f *metricFamily) add(delta float64, labelValues []string) {
+	f.mu.Lock()
+	f.get(labelValues).value += delta
+	f.mu.Unlock()
+	f.publish(labelValues, delta)
+}
+
+// publish passes an update on to the registry's sink, if any.
+func (f *metricFamily) publish(labelValues []string, value float64) {
+	if f.registry.sink != nil {
+		f.registry.sink.record(f, labelValues, value)
+	}
+}
+
+// get returns the series for labelValues, creating it. f.mu must be held.
+func (f *metricFamily) get(labelValues []string) *metricSeries {
+	key := strings.Join(labelValues, "\xff")
+	series, ok := f.series[key]
+	if !ok {
+		series = &metricSeries{labelValues: slices.Clone(labelValues)}
+		f.series[key] = series
+	}
+	return series
+}
+
+func (m *metricsRegistry) write(w io.Writer) error {
+	m.mu.Lock()
+	families := slices.Clone(m.families)
+	m.mu.Unlock()
+	var b strings.Builder
+	for _, family := range families {
+		family.write(&b)
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func (f *metricFamily) write(b *strings.Builder) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", f.name, f.help, f.name, f.kind)
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	for _, key := range slices.Sorted(maps.Keys(f.series)) {
+		series := f.series[key]
+		if f.kind != "histogram" {
+			writeMetricSample(b, f.name, f.labels, series.labelValues, series.value)
+			continue
+		}
+		labels := append(slices.Clone(f.labels), "le")
+		for i, bound := range f.buckets {
+			le := strconv.FormatFloat(bound, 'g', -1, 64)
+			writeMetricSample(b, f.name+"_bucket", labels, append(slices.Clone(series.labelValues), le), float64(series.buckets[i]))
+		}
+		writeMetricSample(b, f.name+"_bucket", labels, append(slices.Clone(series.labelValues), "+Inf"), float64(series.count))
+		writeMetricSample(b, f.name+"_sum", f.labels, series.labelValues, series.value)
+		writeMetricSample(b, f.name+"_count", f.labels, series.labelValues, float64(series.count))
+	}
+}
+
+func writeMetricSample(b *strings.Builder, name string, labels, labelValues []string, value float64) {
+	b.WriteString(name)
+	writeMetricLabels(b, labels, labelValues)
+	b.WriteByte(' ')
+	b.WriteString(strconv.FormatFloat(value, 'g', -1, 64))
+	b.WriteByte('\n')
+}
+
+var metricLabelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func writeMetricLabels(b *strings.Builder, names, values []string) {
+	if len(names) == 0 {
+		return
+	}
+	b.WriteByte('{')
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		value := ""
+		if i < len(values) {
+			value = values[i]
+		}
+		b.WriteString(name)
+		b.WriteString(`="`)
+		b.WriteString(metricLabelEscaper.Replace(value))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+}
+
+// proxyMetrics are the metrics the proxy records. A nil *proxyMetrics
+// records nothing, so code paths that run without a proxy need no checks.
+type proxyMetrics struct {
+	registry  *metricsRegistry
+	authn     *counterVec
+	apiKeys   *counterVec
+	toolCalls *counterVec
+	requests  *counterVec
+	upstream  *histogramVec
+	pingRTT   *gaugeVec
+	// Client names and versions come from downstream initialize requests;
+	// clientTracker caps how many distinct pairs reach these labels.
+	clientSessions *counterVec
+	clientCalls    *counterVec
+	honeypot       *counterVec
+	// Tool labels are bounded by the tools upstreams register.
+	argumentBytes *histogramVec
+	resultBytes   *histogramVec
+	sizeAlerts    *counterVec
+	// Per-server caps from options.maxSessions and maxRequestsPerMinute.
+	limitRejections *counterVec
+	openSessions    *gaugeVec
+	throttled       *counterVec
+
+	// principals labels calls by caller when identity labels are enabled.
+	principals     *principalLabels
+	principalCalls *counterVec
+}
+
+func newProxyMetrics(conf *MetricsConfig) *proxyMetrics {
+	registry := newMetricsRegistry()
+	m := &proxyMetrics{
+		registry: registry,
+		authn: registry.counter("mcp_proxy_auth_requests_total",
+			"Authentication attempts by server, method, client and outcome.",
+			"server", "method", "client", "outcome"),
+		apiKeys: registry.counter("mcp_proxy_api_key_events_total",
+			"API keys created, rotated and revoked through the admin API.",
+			"event"),
+		// Series are keyed by server rather than request path, so their
+		// number stays bounded by the config, not by what clients send.
+		toolCalls: registry.counter("mcp_proxy_tool_calls_total",
+			"Tool calls by server and outcome: success, error for results the upstream marked as errors, or the code of a failed call.",
+			"server", "outcome"),
+		requests: registry.counter("mcp_proxy_http_requests_total",
+			"HTTP requests to MCP routes by server and status class.",
+			"server", "code"),
+		upstream: registry.histogram("mcp_proxy_upstream_request_duration_seconds",
+			"Duration of requests the proxy makes to upstreams by server and operation: initialize, list_tools or ping.",
+			latencyBuckets, "server", "operation"),
+		pingRTT: registry.gauge("mcp_proxy_upstream_ping_rtt_seconds",
+			"Round trip time of the latest successful ping of each upstream.",
+			"server"),
+		clientSessions: registry.counter("mcp_proxy_client_sessions_total",
+			"Sessions initialized by server and the client name and version the MCP client reported.",
+			"server", "client", "version"),
+		clientCalls: registry.counter("mcp_proxy_client_tool_calls_total",
+			"Tool calls by server and the client name and version of the calling session.",
+			"server", "client", "version"),
+		honeypot: registry.counter("mcp_proxy_honeypot_triggers_total",
+			"Uses of decoy tokens and tools by kind: token or tool.",
+			"kind"),
+		argumentBytes: registry.histogram("mcp_proxy_tool_argument_bytes",
+			"Size of tool call arguments, JSON encoded, by server and tool.",
+			sizeBuckets, "server", "tool"),
+		resultBytes: registry.histogram("mcp_proxy_tool_result_bytes",
+			"Size of tool call results, JSON encoded, by server and tool.",
+			sizeBuckets, "server", "tool"),
+		sizeAlerts: registry.counter("mcp_proxy_tool_size_alerts_total",
+			"Tool results that exceeded the server's options.sizeAlert, by server and tool.",
+			"server", "tool"),
+		limitRejections: registry.counter("mcp_proxy_server_limit_rejections_total",
+			"Requests rejected by a server's options.maxSessions or maxRequestsPerMinute, by server and limit: sessions or requests.",
+			"server", "limit"),
+		openSessions: registry.gauge("mcp_proxy_server_open_sessions",
+			"Sessions open on servers with options.maxSessions.",
+			"server"),
+		throttled: registry.counter("mcp_proxy_server_throttled_seconds_total",
+			"Time responses waited to stay under a server's options.maxBytesPerSecond.",
+			"server"),
+	}
+	if conf.collecting() && conf.IdentityLabels {
+		m.principals = newPrincipalLabels(conf.MaxPrincipals)
+		m.principalCalls = registry.counter("mcp_proxy_principal_tool_calls_total",
+			"Tool calls by server, hashed caller identity and outcome.",
+			"server", "principal", "outcome")
+	}
+	return m
+}
+
+const defaultMaxPrincipals = 100
+
+// principalOther is the label of callers beyond the cap, and principalNone
+// that of calls on routes without auth.
+const (
+	principalOther = "other"
+	principalNone  = "anonymous"
+)
+
+// principalLabels turns caller identities into hashed label values, giving
+// at most limit distinct ones so a flood of API keys cannot blow up the
+// number of series.
+type principalLabels struct {
+	mu    sync.Mutex
+	limit int
+	seen  map[string]struct{}
+}
+
+func newPrincipalLabels(limit int) *principalLabels {
+	if limit <= 0 {
+		limit = defaultMaxPrincipals
+	}
+	return &principalLabels{limit: limit, seen: make(map[string]struct{})}
+}
+
+func (p *principalLabels) label(token *AuthToken) string {
+	if token == nil {
+		return principalNone
+	}
+	identity := token.Name
+	if identity == "" {
+		identity = "token:" + token.Token
+	}
+	sum := sha256.Sum256([]byte(identity))
+	label := hex.EncodeToString(sum[:6])
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, ok := p.seen[label]; ok {
+		return label
+	}
+	if len(p.seen) >= p.limit {
+		return principalOther
+	}
+	p.seen[label] = struct{}{}
+	return label
+}
+
+// Outcomes of an authentication attempt.
+const (
+	authOutcomeSuccess   = "success"
+	authOutcomeMissing   = "missing"
+	authOutcomeInvalid   = "invalid"
+	authOutcomeForbidden = "forbidden"
+	authOutcomeBlocked   = "blocked"
+)
+
+// recordAuth counts an authentication attempt. client is the token, key or
+// user name when the credentials were recognized.
+func (m *proxyMetrics) recordAuth(server, method string, token *AuthToken, outcome string) {
+	if m == nil {
+		return
+	}
+	client := ""
+	if token != nil {
+		client = token.Name
+	}
+	m.authn.inc(server, method, client, outcome)
+}
+
+func (m *proxyMetrics) recordAPIKeyEvent(event string) {
+	if m == nil {
+		return
+	}
+	m.apiKeys.inc(event)
+}
+
+// observeUpstream records how long a request to an upstream took.
+func (m *proxyMetrics) observeUpstream(server, operation string, d time.Duration) {
+	if m == nil {
+		return
+	}
+	m.upstream.observe(d.Seconds(), server, operation)
+	if operation == "ping" {
+		m.pingRTT.set(d.Seconds(), server)
+	}
+}
+
+func (m *proxyMetrics) recordClientSession(server, client, version string) {
+	if m != nil {
+		m.clientSessions.inc(server, client, version)
+	}
+}
+
+func (m *proxyMetrics) recordClientCall(server, client, version string) {
+	if m != nil {
+		m.clientCalls.inc(server, client, version)
+	}
+}
+
+func (m *proxyMetrics) recordHoneypot(kind string) {
+	if m != nil {
+		m.honeypot.inc(kind)
+	}
+}
+
+func (m *proxyMetrics) observeToolSizes(server, tool string, argumentBytes, resultBytes int) {
+	if m != nil {
+		m.argumentBytes.observe(float64(argumentBytes), server, tool)
+		m.resultBytes.observe(float64(resultBytes), server, tool)
+	}
+}
+
+func (m *proxyMetrics) recordSizeAlert(server, tool string) {
+	if m != nil {
+		m.sizeAlerts.inc(server, tool)
+	}
+}
+
+func (m *proxyMetrics) recordLimitRejection(server, limit string) {
+	if m != nil {
+		m.limitRejections.inc(server, limit)
+	}
+}
+
+func (m *proxyMetrics) setOpenSessions(server string, open int64) {
+	if m != nil {
+		m.openSessions.set(float64(open), server)
+	}
+}
+
+func (m *proxyMetrics) recordThrottled(server string, wait time.Duration) {
+	if m != nil {
+		m.throttled.add(wait.Seconds(), server)
+	}
+}
+
+// countToolCalls wraps next so every call, including those rejected by
+// interceptors, is counted under server.
+func (m *proxyMetrics) countToolCalls(next ToolCallFunc) ToolCallFunc {
+	if m == nil {
+		return next
+	}
+	return func(ctx context.Context, server string, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := next(ctx, server, request)
+		outcome := callOutcome(server, result, err)
+		m.toolCalls.inc(server, outcome)
+		if m.principals != nil {
+			m.principalCalls.inc(server, m.principals.label(authTokenFromContext(ctx)), outcome)
+		}
+		return result, err
+	}
+}
+
+// callOutcome is success, error for results the upstream marked as errors,
+// or the ToolError code of a failed call.
+func callOutcome(server string, result *mcp.CallToolResult, err error) string {
+	switch {
+	case err != nil:
+		return classifyToolError(server, err).Code
+	case result != nil && result.IsError:
+		return "error"
+	}
+	return "success"
+}
+
+// countRequests counts the requests to a server's routes by status class.
+func (m *proxyMetrics) countRequests(server string) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if m == nil {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			recorder := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(recorder, r)
+			m.requests.inc(server, strconv.Itoa(recorder.status/100)+"xx")
+		})
+	}
+}
+
+// statusRecorder remembers the status a handler wrote. It passes flushes
+// through, which SSE streams depend on.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+	wrote  bool
+}
+
+func (r *statusRecorder) WriteHeader(status int) {
+	if !r.wrote {
+		r.status, r.wrote = status, true
+	}
+	r.ResponseWriter.WriteHeader(status)
+}
+
+func (r *statusRecorder) Write(b []byte) (int, error) {
+	r.wrote = true
+	return r.ResponseWriter.Write(b)
+}
+
+func (r *statusRecorder) Flush() {
+	if flusher, ok := r.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (r *statusRecorder) Unwrap() http.ResponseWriter {
+	return r.ResponseWriter
+}
+
+// registerMetrics mounts GET /metrics in the Prometheus text format.
+func registerMetrics(mux *http.ServeMux, basePath string, metrics *proxyMetrics, conf *MetricsConfig) {
+	var middlewares []MiddlewareFunc
+	if len(conf.AuthTokens) > 0 {
+		middlewares = append(middlewares, newAuthMiddleware("", newAuthTokens(conf.AuthTokens...), nil))
+	}
+	route := path.Join("/", basePath, "metrics")
+	mux.Handle("GET "+route, chainMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		if err := metrics.registry.write(w); err != nil {
+			log.Printf("Failed to write metrics: %v", err)
+		}
+	}), middlewares...))
+	log.Printf("Metrics enabled at %s", route)
+}
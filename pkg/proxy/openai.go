@@ -0,0 +1,211 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// openAIToolSeparator joins server and tool names into a single OpenAI
+// function name, e.g. "github__create_issue".
+const openAIToolSeparator = "__"
+
+type openAIFunction struct {
+	Name        string `json:"name"`
+	Description string `json:"description,omitempty"`
+	Parameters  any    `json:"parameters"`
+}
+
+type openAITool struct {
+	Type     string         `json:"type"`
+	Function openAIFunction `json:"function"`
+}
+
+type openAIToolCall struct {
+	ID       string `json:"id"`
+	Type     string `json:"type"`
+	Function struct {
+		Name      string `json:"name"`
+		Arguments string `json:"arguments"`
+	} `json:"function"`
+}
+
+type openAIToolMessage struct {
+	Role       string `json:"role"`
+	ToolCallID string `json:"tool_call_id"`
+	Content    string `json:"content"`
+}
+
+// openAIFunctionTarget is the server and tool an OpenAI function name
+// stands for.
+type openAIFunctionTarget struct {
+	entry *apiServerEntry
+	tool  mcp.Tool
+}
+
+// openAIFunctions maps the function names the request may call to their
+// tools. Names are looked up rather than split, since server and tool
+// names may themselves contain the separator.
+func (a *apiServer) openAIFunctions(ctx context.Context) ([]string, map[string]openAIFunctionTarget) {
+	var names []string
+	functions := make(map[string]openAIFunctionTarget)
+	for _, item := range a.catalog(ctx) {
+		function := item.server + openAIToolSeparator + item.tool.Name
+		names = append(names, function)
+		functions[function] = openAIFunctionTarget{entry: item.entry, tool: item.tool}
+	}
+	return names, functions
+}
+
+func (a *apiServer) handleOpenAITools(w http.ResponseWriter, r *http.Request) {
+	names, functions := a.openAIFunctions(r.Context())
+	tools := make([]openAITool, 0, len(names))
+	for _, name := range names {
+		tool := functions[name].tool
+		tools = append(tools, openAITool{
+			Type: "function",
+			Function: openAIFunction{
+				Name:        name,
+				Description: tool.Description,
+				Parameters:  toolInputSchema(tool),
+			},
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"tools": tools})
+}
+
+// handleOpenAICall executes the tool_calls of an assistant message and
+// returns the matching "tool" role messages, ready to append to the chat.
+// The request is authenticated once, by the proxy's own middlewares, and
+// every call is checked against the scopes of that identity.
+func (a *apiServer) handleOpenAICall(w http.ResponseWriter, r *http.Request) {
+	var body struct {
+		ToolCalls []openAIToolCall `json:"tool_calls"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	if len(body.ToolCalls) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "tool_calls is required")
+		return
+	}
+	_, functions := a.openAIFunctions(r.Context())
+	for _, call := range body.ToolCalls {
+		// Functions the caller may not use are reported like unknown
+		// ones, so that they cannot tell which exist.
+		if _, ok := functions[call.Function.Name]; !ok {
+			writeJSONError(w, http.StatusNotFound, "unknown function: "+call.Function.Name)
+			return
+		}
+	}
+	messages := make([]openAIToolMessage, 0, len(body.ToolCalls))
+	for _, call := range body.ToolCalls {
+		target := functions[call.Function.Name]
+		messages = append(messages, openAIToolMessage{
+			Role:       "tool",
+			ToolCallID: call.ID,
+			Content:    callOpenAITool(r, target.entry, target.tool.Name, call.Function.Arguments),
+		})
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"messages": messages})
+}
+
+// callOpenAITool runs a function call behind the target server's
+// middlewares, like a REST call to the server, so that its address
+// filters, limits and metrics hold on the bridge too. Rejections become the
+// error content of the call.
+func callOpenAITool(r *http.Request, entry *apiServerEntry, toolName, rawArguments string) string {
+	// The body was read already, and the result is never streamed.
+	r = r.Clone(r.Context())
+	r.Body = http.NoBody
+	r.Header.Del("Accept")
+	w := &bufferedResponse{header: make(http.Header), status: http.StatusOK}
+	entry.serve(w, r, func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.WriteString(w, openAIToolContent(r.Context(), entry, toolName, rawArguments))
+	})
+	if w.status < http.StatusBadRequest {
+		return w.body.String()
+	}
+	var rejection struct {
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(w.body.Bytes(), &rejection); err == nil && rejection.Error != "" {
+		return "Error: " + rejection.Error
+	}
+	return "Error: " + strings.TrimSpace(w.body.String())
+}
+
+func openAIToolContent(ctx context.Context, entry *apiServerEntry, toolName, rawArguments string) string {
+	var arguments map[string]any
+	if strings.TrimSpace(rawArguments) != "" {
+		if err := json.Unmarshal([]byte(rawArguments), &arguments); err != nil {
+			return "Error: invalid JSON arguments: " + err.Error()
+		}
+	}
+	request := mcp.CallToolRequest{}
+	request.Params.Name = toolName
+	request.Params.Arguments = arguments
+	result, err := entry.client.callTool(ctx, request)
+	if err != nil {
+		return "Error: " + err.Error()
+	}
+	return toolResultText(result)
+}
+
+// bufferedResponse collects what a server's middlewares and a bridge
+// handler write, for the bridge to pass on in a response of its own.
+type bufferedResponse struct {
+	header http.Header
+	status int
+	wrote  bool
+	body   bytes.Buffer
+}
+
+func (w *bufferedResponse) Header() http.Header {
+	return w.header
+}
+
+func (w *bufferedResponse) WriteHeader(status int) {
+	if !w.wrote {
+		w.status, w.wrote = status, true
+	}
+}
+
+func (w *bufferedResponse) Write(b []byte) (int, error) {
+	w.wrote = true
+	return w.body.Write(b)
+}
+
+// toolResultText flattens a tool result into the plain string content that
+// chat-completion style APIs expect.
+func toolResultText(result *mcp.CallToolResult) string {
+	parts := make([]string, 0, len(result.Content))
+	for _, content := range result.Content {
+		if text, ok := mcp.AsTextContent(content); ok {
+			parts = append(parts, text.Text)
+			continue
+		}
+		raw, err := json.Marshal(content)
+		if err != nil {
+			continue
+		}
+		parts = append(parts, string(raw))
+	}
+	// Results that only carry structured data are passed on as its JSON.
+	if len(parts) == 0 && result.StructuredContent != nil {
+		if raw, err := json.Marshal(result.StructuredContent); err == nil {
+			parts = append(parts, string(raw))
+		}
+	}
+	text := strings.Join(parts, "\n")
+	if result.IsError {
+		return "Error: " + text
+	}
+	return text
+}
@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestOpenAICall(t *testing.T) {
+	tokens := []AuthToken{{Token: "full"}, {Token: "scoped", Tools: []string{"echo"}}}
+	baseURL, _ := url.Parse("http://localhost/")
+	api := newAPIServer(baseURL, mcp.Implementation{Name: "test", Version: "1.0.0"})
+	// The separator within the server name must not split it.
+	api.addClient("my__server", newTestClient(t, "my__server"), newRouteAuth("my__server", tokens, nil))
+	api.addClient("private", newTestClient(t, "private"), newRouteAuth("private", []AuthToken{{Token: "other"}}, nil))
+	mux := http.NewServeMux()
+	api.register(mux, &APIConfig{Enabled: true, OpenAI: true}, newAuthMiddleware("", tokens, nil))
+
+	call := func(name, arguments string) string {
+		data, _ := json.Marshal(map[string]any{"id": name, "type": "function", "function": map[string]any{"name": name, "arguments": arguments}})
+		return string(data)
+	}
+	tests := []struct {
+		name       string
+		token      string
+		calls      []string
+		wantStatus int
+		wantText   []string
+	}{
+		{
+			name:       "several calls",
+			token:      "full",
+			calls:      []string{call("my__server__echo", `{"text":"one"}`), call("my__server__echo", `{"text":"two"}`)},
+			wantStatus: http.StatusOK,
+			wantText:   []string{"one", "two"},
+		},
+		{name: "no credentials", calls: []string{call("my__server__echo", `{}`)}, wantStatus: http.StatusUnauthorized},
+		{name: "unknown function", token: "full", calls: []string{call("my__server__missing", `{}`)}, wantStatus: http.StatusNotFound},
+		{name: "tool outside scope", token: "scoped", calls: []string{call("my__server__delete", `{}`)}, wantStatus: http.StatusNotFound},
+		{name: "server with other tokens", token: "full", calls: []string{call("private__echo", `{}`)}, wantStatus: http.StatusNotFound},
+		{
+			name:       "invalid arguments",
+			token:      "full",
+			calls:      []string{call("my__server__echo", `{"text":`)},
+			wantStatus: http.StatusOK,
+			wantText:   []string{"Error: invalid JSON arguments: unexpected end of JSON input"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := `{"tool_calls":[`
+			for i, c := range tt.calls {
+				if i > 0 {
+					body += ","
+				}
+				body += c
+			}
+			body += `]}`
+			w := serveTestRequest(mux, http.MethodPost, "/api/openai/call", tt.token, body)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body)
+			}
+			if tt.wantText == nil {
+				return
+			}
+			var response struct {
+				Messages []openAIToolMessage `json:"messages"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if len(response.Messages) != len(tt.wantText) {
+				t.Fatalf("messages = %+v, want %d", response.Messages, len(tt.wantText))
+			}
+			for i, message := range response.Messages {
+				if message.Role != "tool" || message.Content != tt.wantText[i] {
+					t.Errorf("message %d = %+v, want tool message %q", i, message, tt.wantText[i])
+				}
+			}
+		})
+	}
+}
+
+// TestOpenAICallServerMiddlewares checks that bridge calls pass through the
+// middlewares of the server they target, like REST calls to it.
+func TestOpenAICallServerMiddlewares(t *testing.T) {
+	tokens := []AuthToken{{Token: "full"}}
+	baseURL, _ := url.Parse("http://localhost/")
+	api := newAPIServer(baseURL, mcp.Implementation{Name: "test", Version: "1.0.0"})
+	api.addClient("filtered", newTestClient(t, "filtered"), newRouteAuth("filtered", tokens, nil),
+		newIPFilterMiddleware("filtered", &IPFilterConfig{Allow: []string{"10.0.0.0/8"}}, nil))
+	api.addClient("limited", newTestClient(t, "limited"), newRouteAuth("limited", tokens, nil),
+		newLimitsMiddleware("limited", &OptionsV2{MaxRequestsPerMinute: 1}, nil, nil, false))
+	api.addClient("authed", newTestClient(t, "authed"), newRouteAuth("authed", tokens, nil),
+		newAuthMiddleware("authed", tokens, nil))
+	mux := http.NewServeMux()
+	api.register(mux, &APIConfig{Enabled: true, OpenAI: true}, newAuthMiddleware("", tokens, nil))
+
+	body := func(function string, count int) string {
+		calls := make([]map[string]any, count)
+		for i := range calls {
+			calls[i] = map[string]any{"id": function, "type": "function", "function": map[string]any{"name": function, "arguments": `{"text":"hi"}`}}
+		}
+		data, _ := json.Marshal(map[string]any{"tool_calls": calls})
+		return string(data)
+	}
+	tests := []struct {
+		name     string
+		body     string
+		wantText []string
+	}{
+		{name: "server auth", body: body("authed__echo", 1), wantText: []string{"hi"}},
+		{name: "ip filter", body: body("filtered__echo", 1), wantText: []string{"Error: Forbidden"}},
+		{name: "rate limit", body: body("limited__echo", 2), wantText: []string{"hi", "Error: server limited received more than 1 requests per minute"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := serveTestRequest(mux, http.MethodPost, "/api/openai/call", "full", tt.body)
+			if w.Code != http.StatusOK {
+				t.Fatalf("status = %d: %s", w.Code, w.Body)
+			}
+			var response struct {
+				Messages []openAIToolMessage `json:"messages"`
+			}
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+				t.Fatal(err)
+			}
+			if len(response.Messages) != len(tt.wantText) {
+				t.Fatalf("messages = %+v, want %d", response.Messages, len(tt.wantText))
+			}
+			for i, message := range response.Messages {
+				if message.Content != tt.wantText[i] {
+					t.Errorf("message %d = %q, want %q", i, message.Content, tt.wantText[i])
+				}
+			}
+		})
+	}
+}
+
+func TestOpenAIToolsScoped(t *testing.T) {
+	w := serveTestRequest(newTestAPIWithOpenAI(t), http.MethodGet, "/api/openai/tools", "scoped", "")
+	var response struct {
+		Tools []openAITool `json:"tools"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+	if len(response.Tools) != 1 || response.Tools[0].Function.Name != "github__echo" {
+		t.Errorf("tools = %+v, want only github__echo", response.Tools)
+	}
+}
+
+func newTestAPIWithOpenAI(t *testing.T) *http.ServeMux {
+	t.Helper()
+	tokens := []AuthToken{{Token: "full"}, {Token: "scoped", Tools: []string{"echo"}}}
+	baseURL, _ := url.Parse("http://localhost/")
+	api := newAPIServer(baseURL, mcp.Implementation{Name: "test", Version: "1.0.0"})
+	api.addClient("github", newTestClient(t, "github"), newRouteAuth("github", tokens, nil))
+	mux := http.NewServeMux()
+	api.register(mux, &APIConfig{Enabled: true, OpenAI: true}, newAuthMiddleware("", tokens, nil))
+	return mux
+}
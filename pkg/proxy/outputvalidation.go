@@ -0,0 +1,69 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// compileOutputSchema prepares the output schema of a tool for
+// options.validateOutput.
+func (c *Client) compileOutputSchema(tool mcp.Tool) {
+	if c.options == nil || c.options.ValidateOutput == "" {
+		return
+	}
+	raw, ok := toolSchema(tool, "outputSchema")
+	if !ok {
+		return
+	}
+	schema, err := compileJSONSchema(raw)
+	if err != nil {
+		log.Printf("<%s> Not validating results of %s: %v", c.name, tool.Name, err)
+		return
+	}
+	if c.outputSchemas == nil {
+		c.outputSchemas = make(map[string]*jsonSchema)
+	}
+	c.outputSchemas[tool.Name] = schema
+}
+
+// validateOutput checks the successful results of tools that declare an
+// output schema: they must carry structuredContent that matches it. In
+// reject mode a mismatching result fails the call, so clients never parse
+// structured data of the wrong shape.
+func (c *Client) validateOutput(next ToolCallFunc) ToolCallFunc {
+	if c.options == nil || c.options.ValidateOutput == "" {
+		return next
+	}
+	return func(ctx context.Context, server string, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := next(ctx, server, request)
+		schema := c.outputSchemas[request.Params.Name]
+		if err != nil || result == nil || result.IsError || schema == nil {
+			return result, err
+		}
+		var violations []string
+		if result.StructuredContent == nil {
+			violations = []string{"structuredContent is missing"}
+		} else {
+			violations = schema.validate("structuredContent", result.StructuredContent)
+		}
+		if len(violations) == 0 {
+			return result, nil
+		}
+		message := fmt.Sprintf("%s returned a result that does not match its outputSchema: %s", request.Params.Name, strings.Join(violations, "; "))
+		if c.options.ValidateOutput != ConformanceModeReject {
+			log.Printf("<%s> %s", server, message)
+			return result, nil
+		}
+		log.Printf("<%s> Rejected result: %s", server, message)
+		return nil, &ToolError{
+			Source:  ErrorSourceUpstream,
+			Code:    ErrorCodeUpstreamError,
+			Server:  server,
+			Message: message,
+		}
+	}
+}
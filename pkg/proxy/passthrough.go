@@ -0,0 +1,179 @@
+package proxy
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"path"
+	"strings"
+)
+
+const (
+	// passthroughUpstreamParam carries the upstream message endpoint of an
+	// SSE passthrough session in the endpoint the proxy hands to the client.
+	passthroughUpstreamParam = "upstream"
+	// passthroughSignatureParam signs that endpoint, so clients can only
+	// post to the endpoints the upstream announced.
+	passthroughSignatureParam = "sig"
+)
+
+// newPassthroughHandler reverse-proxies a remote MCP endpoint verbatim: no
+// initialization, no tool registration, so capabilities the re-serving
+// model cannot represent keep working. route is the server's route below
+// the proxy's base URL. signer signs the forwarded requests when the
+// server sets signRequests, and identity is presented when it sets mtls.
+func newPassthroughHandler(name, route string, conf *MCPClientConfigV2, proxyConfig *MCPProxyConfigV2, signer *upstreamSigner, identity *workloadIdentity) (http.Handler, error) {
+	upstream, err := url.Parse(conf.URL)
+	if err != nil {
+		return nil, err
+	}
+	if upstream.Scheme != "http" && upstream.Scheme != "https" {
+		return nil, fmt.Errorf("passthrough requires an http(s) url, got %q", conf.URL)
+	}
+	sse := conf.TransportType != MCPClientTypeStreamable
+	messageEndpoint := strings.TrimSuffix(proxyConfig.BaseURL, "/") + "/" + route + "/message"
+	// Upstream sessions do not outlive the process, so neither need the
+	// signatures of their endpoints.
+	key := make([]byte, 32)
+	_, _ = rand.Read(key)
+	signEndpoint := endpointSigner(key)
+	signedEndpoint := func(r *http.Request) (string, bool) {
+		query := r.URL.Query()
+		endpoint := query.Get(passthroughUpstreamParam)
+		return endpoint, endpoint != "" && hmac.Equal([]byte(query.Get(passthroughSignatureParam)), []byte(signEndpoint(endpoint)))
+	}
+
+	reverseProxy := &httputil.ReverseProxy{
+		// Flush immediately so SSE events and streamed responses are not
+		// held back.
+		FlushInterval: -1,
+		Rewrite: func(r *httputil.ProxyRequest) {
+			target := *upstream
+			if endpoint, ok := signedEndpoint(r.In); sse && ok {
+				if u, pErr := url.Parse(endpoint); pErr == nil {
+					target.Path, target.RawPath, target.RawQuery = u.Path, u.RawPath, u.RawQuery
+				}
+			}
+			r.Out.URL = &target
+			r.Out.Host = target.Host
+			r.Out.Header.Del("Authorization")
+			for key, value := range conf.Headers {
+				r.Out.Header.Set(key, value)
+			}
+			if conf.SignRequests && signer != nil {
+				signer.signRequest(name, r.Out)
+			}
+		},
+		ModifyResponse: func(resp *http.Response) error {
+			if sse && strings.HasPrefix(resp.Header.Get("Content-Type"), "text/event-stream") {
+				resp.Body = newEndpointRewriter(resp.Body, upstream, messageEndpoint, signEndpoint)
+			}
+			return nil
+		},
+		ErrorHandler: func(w http.ResponseWriter, r *http.Request, err error) {
+			log.Printf("<%s> Passthrough request failed: %v", name, err)
+			http.Error(w, "Bad Gateway", http.StatusBadGateway)
+		},
+	}
+	if conf.MTLS != nil && identity != nil {
+		reverseProxy.Transport = identity.httpClient(conf.MTLS.SPIFFEIDs).Transport
+	}
+	if !sse {
+		return reverseProxy, nil
+	}
+	ssePath := "/" + path.Join(route, "sse")
+	messagePath := "/" + path.Join(route, "message")
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Only the two SSE endpoints are forwarded; the message endpoint
+		// must name an upstream endpoint announced to a client, so that it
+		// cannot reach other paths with the server's headers.
+		_, signed := signedEndpoint(r)
+		switch {
+		case strings.HasSuffix(r.URL.Path, ssePath):
+		case strings.HasSuffix(r.URL.Path, messagePath) && signed:
+		default:
+			http.NotFound(w, r)
+			return
+		}
+		reverseProxy.ServeHTTP(w, r)
+	}), nil
+}
+
+// endpointRewriter rewrites the endpoint event of an upstream SSE stream so
+// the client posts its messages back through the proxy, which forwards
+// them to the endpoint the upstream announced.
+type endpointRewriter struct {
+	body            io.ReadCloser
+	reader          *bufio.Reader
+	upstream        *url.URL
+	messageEndpoint string
+	sign            func(endpoint string) string
+	endpointEvent   bool
+	pending         []byte
+}
+
+func newEndpointRewriter(body io.ReadCloser, upstream *url.URL, messageEndpoint string, sign func(string) string) *endpointRewriter {
+	return &endpointRewriter{
+		body:            body,
+		reader:          bufio.NewReader(body),
+		upstream:        upstream,
+		messageEndpoint: messageEndpoint,
+		sign:            sign,
+	}
+}
+
+// endpointSigner returns the signature of an upstream message endpoint
+// under key.
+func endpointSigner(key []byte) func(endpoint string) string {
+	return func(endpoint string) string {
+		mac := hmac.New(sha256.New, key)
+		mac.Write([]byte(endpoint))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+}
+
+func (e *endpointRewriter) Read(p []byte) (int, error) {
+	if len(e.pending) == 0 {
+		line, err := e.reader.ReadBytes('\n')
+		if len(line) == 0 {
+			return 0, err
+		}
+		e.pending = e.rewrite(line)
+	}
+	n := copy(p, e.pending)
+	e.pending = e.pending[n:]
+	return n, nil
+}
+
+func (e *endpointRewriter) rewrite(line []byte) []byte {
+	trimmed := bytes.TrimRight(line, "\r\n")
+	switch {
+	case bytes.HasPrefix(trimmed, []byte("event:")):
+		e.endpointEvent = strings.TrimSpace(string(trimmed[len("event:"):])) == "endpoint"
+	case e.endpointEvent && bytes.HasPrefix(trimmed, []byte("data:")):
+		e.endpointEvent = false
+		endpoint, err := e.upstream.Parse(strings.TrimSpace(string(trimmed[len("data:"):])))
+		if err != nil {
+			return line
+		}
+		uri := endpoint.RequestURI()
+		query := url.Values{passthroughUpstreamParam: {uri}, passthroughSignatureParam: {e.sign(uri)}}
+		return []byte("data: " + e.messageEndpoint + "?" + query.Encode() + "\n")
+	case len(trimmed) == 0:
+		e.endpointEvent = false
+	}
+	return line
+}
+
+func (e *endpointRewriter) Close() error {
+	return e.body.Close()
+}
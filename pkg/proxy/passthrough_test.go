@@ -0,0 +1,75 @@
+package proxy
+
+import (
+	"bufio"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestPassthroughSSEEndpoint(t *testing.T) {
+	var reached []string
+	upstream := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/sse" {
+			w.Header().Set("Content-Type", "text/event-stream")
+			_, _ = w.Write([]byte("event: endpoint\ndata: /messages?session_id=abc\n\n"))
+			return
+		}
+		reached = append(reached, r.URL.RequestURI())
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer upstream.Close()
+	handler, err := newPassthroughHandler("remote", "remote", &MCPClientConfigV2{URL: upstream.URL + "/sse"}, &MCPProxyConfigV2{BaseURL: "http://proxy"}, nil, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/remote/sse", nil))
+	var announced string
+	scanner := bufio.NewScanner(strings.NewReader(w.Body.String()))
+	for scanner.Scan() {
+		if data, ok := strings.CutPrefix(scanner.Text(), "data: "); ok {
+			announced = data
+		}
+	}
+	endpoint, err := url.Parse(announced)
+	if err != nil || endpoint.Path != "/remote/message" {
+		t.Fatalf("announced endpoint = %q, want one at /remote/message", announced)
+	}
+	tampered := endpoint.Query()
+	tampered.Set(passthroughUpstreamParam, "/admin?drop=all")
+	unsigned := endpoint.Query()
+	unsigned.Del(passthroughSignatureParam)
+
+	tests := []struct {
+		name        string
+		method      string
+		target      string
+		wantStatus  int
+		wantReached string
+	}{
+		{name: "announced endpoint", method: http.MethodPost, target: endpoint.RequestURI(), wantStatus: http.StatusAccepted, wantReached: "/messages?session_id=abc"},
+		{name: "other upstream path", method: http.MethodPost, target: "/remote/message?" + tampered.Encode(), wantStatus: http.StatusNotFound},
+		{name: "unsigned endpoint", method: http.MethodPost, target: "/remote/message?" + unsigned.Encode(), wantStatus: http.StatusNotFound},
+		{name: "endpoint on the stream route", method: http.MethodGet, target: "/remote/sse?" + tampered.Encode(), wantStatus: http.StatusOK},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			reached = nil
+			w := httptest.NewRecorder()
+			handler.ServeHTTP(w, httptest.NewRequest(tt.method, tt.target, strings.NewReader("{}")))
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", w.Code, tt.wantStatus)
+			}
+			if tt.wantReached != "" && (len(reached) != 1 || reached[0] != tt.wantReached) {
+				t.Errorf("upstream reached at %q, want %q", reached, tt.wantReached)
+			}
+			if tt.wantReached == "" && len(reached) != 0 {
+				t.Errorf("upstream reached at %q, want only the stream", reached)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	// sizeAlertWarmup is the number of results a tool must have returned
+	// before its average is trusted for sizeAlert.factor.
+	sizeAlertWarmup = 20
+	// sizeAlertSmoothing weighs each new result in a tool's moving average.
+	sizeAlertSmoothing = 0.1
+	// sizeAlertLogInterval limits alert log lines to one per tool per
+	// interval; the alert counter still counts every one.
+	sizeAlertLogInterval = time.Minute
+)
+
+// payloadSizes measures the arguments and results of tool calls and raises
+// an alert when a tool returns far more than its limit or than it usually
+// does, an early sign of runaway scraping or a misconfigured upstream.
+type payloadSizes struct {
+	metrics *proxyMetrics
+	// observe records the size histograms; alerts work without them.
+	observe bool
+
+	mu    sync.Mutex
+	tools map[string]*toolSizes
+}
+
+type toolSizes struct {
+	samples  int
+	average  float64
+	lastLog  time.Time
+	suppress int
+}
+
+func newPayloadSizes(metrics *proxyMetrics, observe bool) *payloadSizes {
+	return &payloadSizes{metrics: metrics, observe: observe, tools: make(map[string]*toolSizes)}
+}
+
+// wrap measures the calls of next. It returns next unchanged when there is
+// nothing to record for the server.
+func (s *payloadSizes) wrap(conf *SizeAlertConfig, next ToolCallFunc) ToolCallFunc {
+	if !s.observe && conf == nil {
+		return next
+	}
+	return func(ctx context.Context, server string, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := next(ctx, server, request)
+		tool := request.Params.Name
+		argumentBytes := jsonSize(request.Params.Arguments)
+		resultBytes := 0
+		if result != nil {
+			resultBytes = jsonSize(result)
+		}
+		if s.observe {
+			s.metrics.observeToolSizes(server, tool, argumentBytes, resultBytes)
+		}
+		if conf != nil && result != nil {
+			s.check(conf, server, tool, resultBytes)
+		}
+		return result, err
+	}
+}
+
+// check compares a result size with the server's limits and folds it into
+// the tool's moving average.
+func (s *payloadSizes) check(conf *SizeAlertConfig, server, tool string, size int) {
+	s.mu.Lock()
+	key := server + "\x00" + tool
+	sizes, ok := s.tools[key]
+	if !ok {
+		sizes = &toolSizes{}
+		s.tools[key] = sizes
+	}
+	var reason string
+	switch {
+	case conf.MaxResultBytes > 0 && size > conf.MaxResultBytes:
+		reason = fmt.Sprintf("above the limit of %s", formatBytes(float64(conf.MaxResultBytes)))
+	case conf.Factor > 0 && sizes.samples >= sizeAlertWarmup && float64(size) > conf.Factor*sizes.average:
+		reason = fmt.Sprintf("%.1fx its average of %s", float64(size)/sizes.average, formatBytes(sizes.average))
+	}
+	if sizes.samples == 0 {
+		sizes.average = float64(size)
+	} else {
+		sizes.average += sizeAlertSmoothing * (float64(size) - sizes.average)
+	}
+	sizes.samples++
+	if reason == "" {
+		s.mu.Unlock()
+		return
+	}
+	now := time.Now()
+	shouldLog := now.Sub(sizes.lastLog) >= sizeAlertLogInterval
+	suppressed := sizes.suppress
+	if shouldLog {
+		sizes.lastLog, sizes.suppress = now, 0
+	} else {
+		sizes.suppress++
+	}
+	s.mu.Unlock()
+
+	s.metrics.recordSizeAlert(server, tool)
+	if !shouldLog {
+		return
+	}
+	if suppressed > 0 {
+		reason += fmt.Sprintf(" (%d more since the last alert)", suppressed)
+	}
+	log.Printf("<%s> Tool %s returned %s, %s", server, tool, formatBytes(float64(size)), reason)
+}
+
+// formatBytes renders n with a binary unit.
+func formatBytes(n float64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%.0f B", n)
+	}
+	exp := 0
+	for n >= unit*unit && exp < 3 {
+		n /= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", n/unit, "KMGT"[exp])
+}
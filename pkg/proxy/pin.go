@@ -0,0 +1,182 @@
+package proxy
+
+import (
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+var errPinMismatch = errors.New("package pin mismatch")
+
+// packageInfo records which package an npx/uvx server runs, as resolved
+// during pre-flight.
+type packageInfo struct {
+	Runner    string `json:"runner"`
+	Package   string `json:"package"`
+	Version   string `json:"version,omitempty"`
+	Integrity string `json:"integrity,omitempty"`
+	Pinned    bool   `json:"pinned"`
+}
+
+// applyPin rewrites the package argument to the pinned version. Arguments
+// that already name a different version are refused rather than overridden.
+func applyPin(name string, conf *MCPClientConfigV2, runner packageRunner, index int, info *packageInfo) error {
+	pin := conf.Pin
+	if pin.Version == "" {
+		return fmt.Errorf("<%s> pin.version is required", name)
+	}
+	if pin.Integrity != "" && runner.inspect == nil {
+		return fmt.Errorf("<%s> pin.integrity is not supported for %s", name, info.Runner)
+	}
+	if info.Version != "" && info.Version != pin.Version {
+		return fmt.Errorf("<%s> %w: arguments reference version %s but the pin requires %s", name, errPinMismatch, info.Version, pin.Version)
+	}
+	args := slices.Clone(conf.Args)
+	args[index] = runner.joinSpec(args, index, info.Package, pin.Version)
+	conf.Args = args
+	info.Version = pin.Version
+	info.Pinned = true
+	return nil
+}
+
+// verifyPin compares what the registry resolved against the pin.
+func verifyPin(name string, pin *PinConfig, info *packageInfo) error {
+	if pin == nil {
+		return nil
+	}
+	if info.Version != pin.Version {
+		return fmt.Errorf("<%s> %w: %s resolved to version %s, pinned %s", name, errPinMismatch, info.Package, info.Version, pin.Version)
+	}
+	if pin.Integrity != "" && info.Integrity != pin.Integrity {
+		return fmt.Errorf("<%s> %w: %s@%s has integrity %s, pinned %s", name, errPinMismatch, info.Package, info.Version, info.Integrity, pin.Integrity)
+	}
+	return nil
+}
+
+// fetchPinnedTarball downloads the tarball of an npm spec into dir with
+// npm pack and checks it against the pinned integrity. npx is then pointed
+// at the returned file, so that what runs is the tarball that was checked
+// rather than whatever the registry serves when the server starts.
+func fetchPinnedTarball(run commandRunner, spec, integrity, dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return "", err
+	}
+	output, err := run("npm", "pack", spec, "--pack-destination", dir, "--json")
+	if err != nil {
+		return "", err
+	}
+	var packed []struct {
+		Filename string `json:"filename"`
+	}
+	if err = json.Unmarshal(output, &packed); err != nil || len(packed) != 1 || packed[0].Filename == "" {
+		return "", fmt.Errorf("unexpected npm pack output: %s", strings.TrimSpace(string(output)))
+	}
+	// Scoped packages are packed as scope-name-version.tgz, never in a
+	// subdirectory.
+	path := filepath.Join(dir, filepath.Base(packed[0].Filename))
+	if err = checkIntegrity(path, integrity); err != nil {
+		_ = os.Remove(path)
+		return "", err
+	}
+	return path, nil
+}
+
+// checkIntegrity verifies a file against a subresource integrity string
+// such as "sha512-<base64>". Of several space-separated hashes, those of the
+// strongest algorithm count, and any of them may match.
+func checkIntegrity(path, integrity string) error {
+	algorithms := []string{"sha512", "sha384", "sha256", "sha1"}
+	best := len(algorithms)
+	var wants []string
+	for _, entry := range strings.Fields(integrity) {
+		algorithm, want, _ := strings.Cut(entry, "-")
+		rank := slices.Index(algorithms, algorithm)
+		switch {
+		case rank < 0 || rank > best:
+		case rank < best:
+			best, wants = rank, []string{want}
+		default:
+			wants = append(wants, want)
+		}
+	}
+	if best == len(algorithms) {
+		return fmt.Errorf("unsupported integrity %q", integrity)
+	}
+	var h hash.Hash
+	switch algorithms[best] {
+	case "sha512":
+		h = sha512.New()
+	case "sha384":
+		h = sha512.New384()
+	case "sha256":
+		h = sha256.New()
+	default:
+		h = sha1.New()
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err = io.Copy(h, f); err != nil {
+		return err
+	}
+	got := base64.StdEncoding.EncodeToString(h.Sum(nil))
+	if !slices.Contains(wants, got) {
+		return fmt.Errorf("%w: %s has integrity %s-%s, pinned %s", errPinMismatch, filepath.Base(path), algorithms[best], got, integrity)
+	}
+	return nil
+}
+
+func splitNPMSpec(spec string) (string, string) {
+	// The leading @ of a scoped package is not a version separator.
+	if i := strings.LastIndex(spec, "@"); i > 0 {
+		return spec[:i], spec[i+1:]
+	}
+	return spec, ""
+}
+
+func splitPythonSpec(spec string) (string, string) {
+	if pkg, version, ok := strings.Cut(spec, "=="); ok {
+		return pkg, version
+	}
+	if i := strings.LastIndex(spec, "@"); i > 0 {
+		return spec[:i], spec[i+1:]
+	}
+	return spec, ""
+}
+
+type npmViewFields struct {
+	Version   string `json:"version"`
+	Integrity string `json:"dist.integrity"`
+}
+
+func inspectNPMPackage(run commandRunner, spec string, info *packageInfo) error {
+	output, err := run("npm", "view", spec, "version", "dist.integrity", "--json")
+	if err != nil {
+		return err
+	}
+	var fields npmViewFields
+	if err = json.Unmarshal(output, &fields); err != nil {
+		// A range matching several versions yields one entry per version,
+		// in ascending order; npx runs the newest.
+		var all []npmViewFields
+		if json.Unmarshal(output, &all) != nil || len(all) == 0 {
+			return fmt.Errorf("unexpected npm view output: %w", err)
+		}
+		fields = all[len(all)-1]
+	}
+	info.Version = fields.Version
+	info.Integrity = fields.Integrity
+	return nil
+}
@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"crypto/sha512"
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFetchPinnedTarball(t *testing.T) {
+	tarball := []byte("package tarball")
+	sum := sha512.Sum512(tarball)
+	integrity := "sha512-" + base64.StdEncoding.EncodeToString(sum[:])
+	tests := []struct {
+		name      string
+		integrity string
+		output    string
+		// packs is false when npm pack fails before writing the tarball.
+		packs    bool
+		wantErr  error
+		wantFile bool
+	}{
+		{name: "match", integrity: integrity, output: `[{"filename":"scope-pkg-1.0.0.tgz"}]`, packs: true, wantFile: true},
+		{name: "one of several hashes", integrity: "sha1-bm90IGl0 " + integrity, output: `[{"filename":"scope-pkg-1.0.0.tgz"}]`, packs: true, wantFile: true},
+		{name: "mismatch", integrity: "sha512-AAAA", output: `[{"filename":"scope-pkg-1.0.0.tgz"}]`, packs: true, wantErr: errPinMismatch},
+		{name: "unexpected output", integrity: integrity, output: `npm notice`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := filepath.Join(t.TempDir(), "pinned")
+			run := func(argv ...string) ([]byte, error) {
+				if len(argv) < 3 || argv[0] != "npm" || argv[1] != "pack" || argv[2] != "@scope/pkg@1.0.0" {
+					t.Fatalf("unexpected command %v", argv)
+				}
+				if !tt.packs {
+					return []byte(tt.output), nil
+				}
+				if err := os.WriteFile(filepath.Join(dir, "scope-pkg-1.0.0.tgz"), tarball, 0o600); err != nil {
+					t.Fatal(err)
+				}
+				return []byte(tt.output), nil
+			}
+			path, err := fetchPinnedTarball(run, "@scope/pkg@1.0.0", tt.integrity, dir)
+			switch {
+			case tt.wantFile && err != nil:
+				t.Fatalf("fetchPinnedTarball() error = %v", err)
+			case !tt.wantFile && err == nil:
+				t.Fatalf("fetchPinnedTarball() = %s, want an error", path)
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+				t.Fatalf("fetchPinnedTarball() error = %v, want %v", err, tt.wantErr)
+			}
+			_, statErr := os.Stat(filepath.Join(dir, "scope-pkg-1.0.0.tgz"))
+			if tt.wantFile != (statErr == nil) || (tt.wantFile && path != filepath.Join(dir, "scope-pkg-1.0.0.tgz")) {
+				t.Errorf("path = %q, tarball kept = %v, want kept = %v", path, statErr == nil, tt.wantFile)
+			}
+		})
+	}
+}
@@ -0,0 +1,278 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+const defaultPreflightTimeout = 5 * time.Minute
+
+var errMissingRuntime = errors.New("missing runtime")
+
+// packageRunner describes a command that downloads and runs a package on
+// demand, such as npx or uvx.
+type packageRunner struct {
+	// runtimes must be on PATH besides the runner itself.
+	runtimes []string
+	// valueFlags take a separate value and are skipped when looking for the
+	// package argument.
+	valueFlags []string
+	// packageFlags name the package explicitly instead of the first argument.
+	packageFlags []string
+	cacheEnv     string
+	cacheSubdir  string
+	// resolve returns the command that fetches pkg into the cache without
+	// starting the server.
+	resolve func(pkg string) []string
+	// splitSpec separates a package spec into name and version; joinSpec
+	// builds the spec for the argument at index in args.
+	splitSpec func(spec string) (string, string)
+	joinSpec  func(args []string, index int, pkg, version string) string
+	// inspect looks up the version and integrity a spec resolves to. It is
+	// nil for runners whose registry does not expose them.
+	inspect func(run commandRunner, spec string, info *packageInfo) error
+	// fetch downloads the package into dir, checks it against a pinned
+	// integrity and returns the argument that runs the checked copy.
+	fetch func(run commandRunner, spec, integrity, dir string) (string, error)
+}
+
+var packageRunners = map[string]packageRunner{
+	"npx": {
+		runtimes:     []string{"node", "npm"},
+		valueFlags:   []string{"-p", "--package", "-c", "--call"},
+		packageFlags: []string{"-p", "--package"},
+		cacheEnv:     "npm_config_cache",
+		cacheSubdir:  "npm",
+		resolve: func(pkg string) []string {
+			return []string{"npm", "cache", "add", pkg}
+		},
+		splitSpec: splitNPMSpec,
+		joinSpec: func(args []string, index int, pkg, version string) string {
+			return pkg + "@" + version
+		},
+		inspect: inspectNPMPackage,
+		fetch:   fetchPinnedTarball,
+	},
+	"uvx": {
+		valueFlags:   []string{"--from", "--with", "--python", "-p", "--index-url", "--extra-index-url"},
+		packageFlags: []string{"--from"},
+		cacheEnv:     "UV_CACHE_DIR",
+		cacheSubdir:  "uv",
+		resolve: func(pkg string) []string {
+			return []string{"uvx", "--from", pkg, "python", "-c", ""}
+		},
+		splitSpec: splitPythonSpec,
+		joinSpec: func(args []string, index int, pkg, version string) string {
+			if index > 0 && args[index-1] == "--from" {
+				return pkg + "==" + version
+			}
+			return pkg + "@" + version
+		},
+	},
+}
+
+var runtimeHints = map[string]string{
+	"node":    "install Node.js",
+	"npm":     "install Node.js",
+	"npx":     "install Node.js",
+	"uv":      "install uv (https://docs.astral.sh/uv/)",
+	"uvx":     "install uv (https://docs.astral.sh/uv/)",
+	"python":  "install Python",
+	"python3": "install Python",
+	"docker":  "install Docker",
+}
+
+// commandRunner runs a helper command and returns its standard output.
+type commandRunner func(argv ...string) ([]byte, error)
+
+// checkRuntime reports a missing executable as a configuration error with a
+// hint, instead of the opaque exec failure the client would produce.
+func checkRuntime(name string, conf *StdioMCPClientConfig, command string) error {
+	if _, err := exec.LookPath(lookStdioCommand(conf, stdioEnv(name, conf), command)); err != nil {
+		if hint, ok := runtimeHints[filepath.Base(command)]; ok {
+			return fmt.Errorf("<%s> %w: %q not found in PATH, %s", name, errMissingRuntime, command, hint)
+		}
+		return fmt.Errorf("<%s> %w: %q not found in PATH", name, errMissingRuntime, command)
+	}
+	return nil
+}
+
+// preflight prepares a stdio server before it is spawned: it verifies the
+// command and the runtime behind it exist, enforces the package pin and,
+// when enabled, resolves the package of an npx/uvx command into the cache so
+// the first start does not pay for the download. It returns what is known
+// about the package, or nil for commands that are not package runners.
+func preflight(ctx context.Context, name string, conf *MCPClientConfigV2, preflightConf *PreflightConfig) (*packageInfo, error) {
+	clientInfo, err := parseMCPClientConfigV2(conf)
+	if err != nil {
+		return nil, err
+	}
+	stdio, ok := clientInfo.(*StdioMCPClientConfig)
+	if !ok {
+		return nil, nil
+	}
+	if stdio.Cwd != "" {
+		if st, statErr := os.Stat(stdio.Cwd); statErr != nil || !st.IsDir() {
+			return nil, fmt.Errorf("<%s> cwd %q is not a directory", name, stdio.Cwd)
+		}
+	}
+	if err = checkRuntime(name, stdio, stdio.Command); err != nil {
+		return nil, err
+	}
+	runnerName := filepath.Base(stdio.Command)
+	runner, ok := packageRunners[runnerName]
+	if !ok {
+		if conf.Pin != nil {
+			return nil, fmt.Errorf("<%s> pin is only supported for npx and uvx commands", name)
+		}
+		return nil, nil
+	}
+	for _, runtime := range runner.runtimes {
+		if err = checkRuntime(name, stdio, runtime); err != nil {
+			return nil, err
+		}
+	}
+	if preflightConf == nil {
+		preflightConf = &PreflightConfig{}
+	}
+	if preflightConf.CacheDir != "" {
+		if _, set := conf.Env[runner.cacheEnv]; !set {
+			if conf.Env == nil {
+				conf.Env = make(map[string]string)
+			}
+			conf.Env[runner.cacheEnv] = filepath.Join(preflightConf.CacheDir, runner.cacheSubdir)
+		}
+	}
+	index := runner.packageArg(stdio.Args)
+	if index < 0 {
+		if conf.Pin != nil || preflightConf.Enabled {
+			return nil, fmt.Errorf("<%s> no package found in %s arguments", name, stdio.Command)
+		}
+		return nil, nil
+	}
+	info := &packageInfo{Runner: runnerName}
+	info.Package, info.Version = runner.splitSpec(stdio.Args[index])
+	if conf.Pin != nil {
+		if err = applyPin(name, conf, runner, index, info); err != nil {
+			return nil, err
+		}
+	}
+	if !preflightConf.Enabled && conf.Pin == nil {
+		return info, nil
+	}
+
+	timeout := preflightConf.Timeout
+	if timeout <= 0 {
+		timeout = defaultPreflightTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	spec := conf.Args[index]
+	stdio.Env = conf.Env
+	run := func(argv ...string) ([]byte, error) {
+		return runPreflightCommand(stdioCommand(ctx, name, stdio, argv[0], argv[1:]))
+	}
+	if runner.inspect != nil {
+		if err = runner.inspect(run, spec, info); err != nil {
+			return nil, preflightError(ctx, name, "inspect", spec, timeout, err)
+		}
+		if err = verifyPin(name, conf.Pin, info); err != nil {
+			return nil, err
+		}
+	}
+	if runner.fetch != nil && conf.Pin != nil && conf.Pin.Integrity != "" {
+		dir := filepath.Join(os.TempDir(), "mcp-proxy-pinned")
+		if preflightConf.CacheDir != "" {
+			dir = filepath.Join(preflightConf.CacheDir, "pinned")
+		}
+		path, fetchErr := runner.fetch(run, spec, conf.Pin.Integrity, dir)
+		if errors.Is(fetchErr, errPinMismatch) {
+			return nil, fmt.Errorf("<%s> %w", name, fetchErr)
+		}
+		if fetchErr != nil {
+			return nil, preflightError(ctx, name, "fetch", spec, timeout, fetchErr)
+		}
+		args := slices.Clone(conf.Args)
+		args[index] = path
+		conf.Args = args
+		// The checked tarball is all there is to resolve.
+		log.Printf("<%s> Running %s from %s, checked against its pinned integrity", name, spec, path)
+		return info, nil
+	}
+	if !preflightConf.Enabled {
+		return info, nil
+	}
+	log.Printf("<%s> Resolving package %s", name, spec)
+	start := time.Now()
+	if _, err = run(runner.resolve(spec)...); err != nil {
+		return nil, preflightError(ctx, name, "resolve", spec, timeout, err)
+	}
+	log.Printf("<%s> Resolved package %s in %s", name, spec, time.Since(start).Round(time.Millisecond))
+	return info, nil
+}
+
+// runPreflightCommand runs a helper command built by stdioCommand, so it sees
+// the same environment, PATH and working directory as the server itself and
+// caches and registry credentials line up.
+func runPreflightCommand(cmd *exec.Cmd) ([]byte, error) {
+	output, err := cmd.Output()
+	if err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			if detail := strings.TrimSpace(string(exitErr.Stderr)); detail != "" {
+				return nil, fmt.Errorf("%w: %s", err, detail)
+			}
+		}
+		return nil, err
+	}
+	return output, nil
+}
+
+func preflightError(ctx context.Context, name, action, spec string, timeout time.Duration, err error) error {
+	if ctx.Err() != nil {
+		return fmt.Errorf("<%s> %s package %s timed out after %s", name, action, spec, timeout)
+	}
+	return fmt.Errorf("<%s> failed to %s package %s: %w", name, action, spec, err)
+}
+
+// packageArg finds the argument holding the package a runner invocation
+// refers to: the value of an explicit package flag, or else the first
+// positional argument. It returns -1 when there is none. The --flag=value
+// form is not recognized since it cannot be rewritten in place.
+func (r packageRunner) packageArg(args []string) int {
+	for i := 0; i < len(args); i++ {
+		for _, flag := range r.packageFlags {
+			if args[i] == flag && i+1 < len(args) {
+				return i + 1
+			}
+		}
+	}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			if i+1 < len(args) {
+				return i + 1
+			}
+			return -1
+		}
+		if !strings.HasPrefix(arg, "-") {
+			return i
+		}
+		for _, flag := range r.valueFlags {
+			if arg == flag {
+				i++
+				break
+			}
+		}
+	}
+	return -1
+}
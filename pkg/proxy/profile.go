@@ -0,0 +1,42 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"path"
+)
+
+// mountProfile serves the connected upstreams again under
+// /profiles/<profile>/<server>/ with the profile's own tool filter and auth,
+// so one proxy can offer differently scoped views to different audiences.
+func mountProfile(ctx context.Context, profile string, conf *ProfileConfig, proxyConfig *MCPProxyConfigV2, registry *clientRegistry, sources *authSources, clients *clientTracker, basePath string, routes *routeTable) {
+	servers := conf.Servers
+	if len(servers) == 0 {
+		servers = registry.names()
+	}
+	prefix := "<" + profile + ">"
+	filterFunc := newToolFilterFunc(profile, conf.ToolFilter)
+	for _, name := range servers {
+		upstream, ok := registry.get(name)
+		if !ok {
+			log.Printf("%s Skipping server %s: not connected", prefix, name)
+			continue
+		}
+		routeName := path.Join("profiles", profile, name)
+		srv, err := newMCPServer(routeName, proxyConfig, &MCPClientConfigV2{Options: conf.Options}, append(upstream.serverOptions(), clients.serverOption(routeName))...)
+		if err != nil {
+			log.Printf("%s Failed to create server for %s: %v", prefix, name, err)
+			continue
+		}
+		for _, tool := range upstream.tools {
+			if filterFunc(tool.Name) {
+				srv.mcpServer.AddTool(tool, translateToolErrors(name, upstream.callTool))
+			}
+		}
+		upstream.addCapabilitiesToServer(ctx, srv.mcpServer)
+
+		mcpRoute := mcpRoutePath(basePath, routeName)
+		log.Printf("%s Handling requests for %s at %s", prefix, name, mcpRoute)
+		routes.Handle(mcpRoute, chainMiddleware(srv.handler, newServerMiddlewares(profile, conf.Options, sources)...))
+	}
+}
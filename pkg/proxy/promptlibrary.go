@@ -0,0 +1,169 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"path"
+	"slices"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// promptLibraryRoute is where the prompt library is served: the JSON view
+// at /prompts and the MCP server at /prompts/mcp or /prompts/sse.
+const promptLibraryRoute = "prompts"
+
+// promptEntry is one prompt of the library.
+type promptEntry struct {
+	// Name is the prompt's name in the library, which is namespaced as
+	// <server>_<prompt> when servers offer different prompts of that name.
+	Name        string               `json:"name"`
+	Server      string               `json:"server"`
+	Prompt      string               `json:"prompt"`
+	Description string               `json:"description,omitempty"`
+	Arguments   []mcp.PromptArgument `json:"arguments,omitempty"`
+	Pinned      bool                 `json:"pinned,omitempty"`
+	// AlsoOn lists the servers with an identical prompt of the same name,
+	// which the library offers only once.
+	AlsoOn []string `json:"alsoOn,omitempty"`
+
+	definition mcp.Prompt
+	upstream   *Client
+}
+
+// buildPromptLibrary collects the prompts of the connected upstreams:
+// pinned prompts first, then the others by server. Identical prompts of
+// the same name are listed once, and different ones are namespaced,
+// except for a pinned one, which keeps the plain name.
+func buildPromptLibrary(conf *PromptLibraryConfig, registry *clientRegistry) []*promptEntry {
+	servers := conf.Servers
+	if len(servers) == 0 {
+		servers = registry.names()
+	}
+	var candidates []*promptEntry
+	seen := make(map[string]bool)
+	add := func(serverName string, prompt mcp.Prompt, upstream *Client, pinned bool) {
+		key := serverName + "/" + prompt.Name
+		if seen[key] {
+			return
+		}
+		seen[key] = true
+		candidates = append(candidates, &promptEntry{
+			Name:        prompt.Name,
+			Server:      serverName,
+			Prompt:      prompt.Name,
+			Description: prompt.Description,
+			Arguments:   prompt.Arguments,
+			Pinned:      pinned,
+			definition:  prompt,
+			upstream:    upstream,
+		})
+	}
+	for _, pin := range conf.Pinned {
+		serverName, promptName, _ := strings.Cut(pin, "/")
+		upstream, ok := registry.get(serverName)
+		if !ok {
+			log.Printf("<%s> Skipping pinned prompt %s: server %s is not connected", promptLibraryRoute, pin, serverName)
+			continue
+		}
+		prompt, ok := upstream.findPrompt(promptName)
+		if !ok {
+			log.Printf("<%s> Skipping pinned prompt %s: not provided by server %s", promptLibraryRoute, pin, serverName)
+			continue
+		}
+		add(serverName, prompt, upstream, true)
+	}
+	for _, serverName := range servers {
+		upstream, ok := registry.get(serverName)
+		if !ok {
+			log.Printf("<%s> Skipping server %s: not connected", promptLibraryRoute, serverName)
+			continue
+		}
+		for _, prompt := range upstream.prompts {
+			add(serverName, prompt, upstream, false)
+		}
+	}
+
+	byName := make(map[string][]*promptEntry)
+	for _, entry := range candidates {
+		byName[entry.Prompt] = append(byName[entry.Prompt], entry)
+	}
+	library := make([]*promptEntry, 0, len(candidates))
+	for _, entry := range candidates {
+		variants := byName[entry.Prompt]
+		if variants == nil {
+			continue
+		}
+		delete(byName, entry.Prompt)
+		// Keep the first of each set of identical variants.
+		var distinct []*promptEntry
+		for _, variant := range variants {
+			i := slices.IndexFunc(distinct, func(kept *promptEntry) bool { return samePrompt(kept, variant) })
+			if i < 0 {
+				distinct = append(distinct, variant)
+				continue
+			}
+			distinct[i].AlsoOn = append(distinct[i].AlsoOn, variant.Server)
+		}
+		for _, variant := range distinct {
+			if (len(distinct) > 1 || conf.Namespace) && !variant.Pinned {
+				variant.Name = variant.Server + "_" + variant.Prompt
+			}
+			library = append(library, variant)
+		}
+	}
+	return library
+}
+
+// samePrompt reports whether two prompts look the same to clients.
+func samePrompt(a, b *promptEntry) bool {
+	left, _ := json.Marshal(a.definition)
+	right, _ := json.Marshal(b.definition)
+	return string(left) == string(right)
+}
+
+// mountPromptLibrary serves the prompts of every upstream in one place, at
+// /prompts as JSON and under /prompts/ as an MCP server, so teams can share
+// a standard set of prompts through the proxy. It must run after the
+// clients have been added to the registry.
+func mountPromptLibrary(conf *PromptLibraryConfig, proxyConfig *MCPProxyConfigV2, registry *clientRegistry, sources *authSources, clients *clientTracker, basePath string, mux *http.ServeMux, routes *routeTable) error {
+	library := buildPromptLibrary(conf, registry)
+	if len(library) == 0 {
+		return errors.New("no prompts available")
+	}
+	srv, err := newMCPServer(promptLibraryRoute, proxyConfig, &MCPClientConfigV2{Options: conf.Options}, clients.serverOption(promptLibraryRoute))
+	if err != nil {
+		return err
+	}
+	used := make(map[string]string)
+	entries := make([]*promptEntry, 0, len(library))
+	for _, entry := range library {
+		if owner, taken := used[entry.Name]; taken {
+			log.Printf("<%s> Skipping prompt %s/%s: %s is already used by %s", promptLibraryRoute, entry.Server, entry.Prompt, entry.Name, owner)
+			continue
+		}
+		used[entry.Name] = entry.Server + "/" + entry.Prompt
+		entries = append(entries, entry)
+		prompt := entry.definition
+		prompt.Name = entry.Name
+		upstream, originalName := entry.upstream, entry.Prompt
+		srv.mcpServer.AddPrompt(prompt, func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			request.Params.Name = originalName
+			return upstream.getPrompt(ctx, request)
+		})
+	}
+	log.Printf("<%s> Serving %d prompts", promptLibraryRoute, len(entries))
+
+	middlewares := newServerMiddlewares(promptLibraryRoute, conf.Options, sources)
+	mux.Handle("GET "+path.Join("/", basePath, promptLibraryRoute), chainMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]any{"prompts": entries})
+	}), middlewares...))
+	mcpRoute := mcpRoutePath(basePath, promptLibraryRoute)
+	log.Printf("<%s> Handling requests at %s", promptLibraryRoute, mcpRoute)
+	routes.Handle(mcpRoute, chainMiddleware(srv.handler, middlewares...))
+	return nil
+}
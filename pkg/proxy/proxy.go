@@ -0,0 +1,720 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"golang.org/x/sync/errgroup"
+)
+
+// BuildVersion is reported to upstreams and downstream clients. The
+// mcp-proxy binary sets it from its linker flags.
+var BuildVersion = "dev"
+
+// Proxy serves a set of upstream MCP servers behind one HTTP handler. It is
+// what the mcp-proxy binary runs, and other programs can embed it instead of
+// shelling out to the binary.
+type Proxy struct {
+	config   *Config
+	baseURL  *url.URL
+	info     mcp.Implementation
+	mux      *http.ServeMux
+	routes   *routeTable
+	registry *clientRegistry
+	sources  *authSources
+	restAPI  *apiServer
+	history  *configHistory
+	metrics  *proxyMetrics
+	slowLog  *slowCallLog
+	sizes    *payloadSizes
+	blobs    *blobStore
+	results  *blobStore
+	calls    *callHistory
+	events   *eventLog
+	statsd   *statsdEmitter
+	hooks    *lifecycleHooks
+	honeypot *honeypot
+	signer   *upstreamSigner
+	identity *workloadIdentity
+	clients  *clientTracker
+	usage    *toolUsage
+	jobs     *asyncQueue
+	bus      *messageBus
+	cluster  *cluster
+
+	// mu guards config.McpServers, which AddServer and RemoveServer keep in
+	// line with the servers actually mounted.
+	mu sync.Mutex
+	// applying serializes rollbacks and pushed configs, so that each is
+	// applied against the servers its plan saw.
+	applying sync.Mutex
+
+	middlewares  []MiddlewareFunc
+	interceptors []ToolInterceptor
+
+	httpServer *http.Server
+	grpcAdmin  *adminGRPCServer
+	errs       chan error
+
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Option customizes a Proxy created by New.
+type Option func(*Proxy)
+
+// ToolCallFunc performs a tool call on the named upstream server.
+type ToolCallFunc func(ctx context.Context, server string, request mcp.CallToolRequest) (*mcp.CallToolResult, error)
+
+// ToolInterceptor wraps the tool calls the proxy forwards, whichever route
+// or bridge they arrive on.
+type ToolInterceptor func(next ToolCallFunc) ToolCallFunc
+
+// WithMiddleware wraps every HTTP route of the proxy in middlewares, outside
+// its own auth. Like the proxy's own chains, the last one runs first.
+func WithMiddleware(middlewares ...MiddlewareFunc) Option {
+	return func(p *Proxy) {
+		p.middlewares = append(p.middlewares, middlewares...)
+	}
+}
+
+// WithToolInterceptor adds interceptors to every tool call, e.g. for
+// custom authorization or telemetry. The last one runs first.
+func WithToolInterceptor(interceptors ...ToolInterceptor) Option {
+	return func(p *Proxy) {
+		p.interceptors = append(p.interceptors, interceptors...)
+	}
+}
+
+// New prepares a proxy for config without connecting to any upstream yet.
+func New(config *Config, opts ...Option) (*Proxy, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	config.setDefaults()
+	baseURL, err := url.Parse(config.McpProxy.BaseURL)
+	if err != nil {
+		return nil, err
+	}
+	p := &Proxy{
+		config:   config,
+		baseURL:  baseURL,
+		info:     mcp.Implementation{Name: config.McpProxy.Name},
+		mux:      http.NewServeMux(),
+		routes:   newRouteTable(),
+		registry: newClientRegistry(),
+		sources:  &authSources{sse: config.McpProxy.Type == MCPServerTypeSSE},
+		metrics:  newProxyMetrics(config.McpProxy.Metrics),
+		errs:     make(chan error, 1),
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+	p.ctx, p.cancel = context.WithCancel(context.Background())
+	p.sources.metrics = p.metrics
+	p.clients = newClientTracker(p.metrics)
+	p.usage, err = newToolUsage(config.McpProxy.Analytics)
+	if err != nil {
+		return nil, err
+	}
+	p.slowLog, err = newSlowCallLog(config.McpProxy.SlowCallLog)
+	if err != nil {
+		return nil, err
+	}
+	p.slowLog.clients = p.clients
+	if config.McpProxy.CallHistory != nil {
+		p.calls, err = newCallHistory(config.McpProxy.CallHistory, p.clients)
+		if err != nil {
+			return nil, err
+		}
+	}
+	p.hooks, err = newLifecycleHooks(config.McpProxy.Hooks)
+	if err != nil {
+		return nil, err
+	}
+	p.events = newEventLog(config.McpProxy.LogSinks, p.clients)
+	p.sources.events = p.events
+	if config.McpProxy.Metrics != nil && config.McpProxy.Metrics.StatsD != nil {
+		p.statsd, err = newStatsdEmitter(config.McpProxy.Metrics.StatsD)
+		if err != nil {
+			return nil, err
+		}
+		p.metrics.registry.sink = p.statsd
+	}
+	p.sizes = newPayloadSizes(p.metrics, config.McpProxy.Metrics.collecting())
+	p.blobs = newBlobStore(baseURL, "blobs", nil, newMemoryBlobs())
+	p.blobs.register(p.mux, baseURL.Path)
+	p.results, err = newResultStore(baseURL, config.McpProxy.ResultStore)
+	if err != nil {
+		return nil, err
+	}
+	if p.results != nil {
+		p.results.register(p.mux, baseURL.Path)
+	}
+	p.mux.Handle("/", p.routes)
+	for routePath, routeConfig := range config.HTTPRoutes {
+		if err = p.mountHTTPRoute(routePath, routeConfig); err != nil {
+			return nil, fmt.Errorf("httpRoutes.%s: %w", routePath, err)
+		}
+	}
+
+	if config.McpProxy.APIKeys != nil && config.McpProxy.APIKeys.Enabled {
+		p.sources.keys, err = newAPIKeyStore(config.McpProxy.APIKeys.File)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("API keys enabled, stored in %s", config.McpProxy.APIKeys.File)
+	}
+	if config.McpProxy.GeoIP != nil && config.McpProxy.GeoIP.Database != "" {
+		p.sources.geo, err = openGeoIPDB(config.McpProxy.GeoIP.Database)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if config.McpProxy.Blocklist != nil && config.McpProxy.Blocklist.Enabled {
+		p.sources.blocks, err = newBlockList(config.McpProxy.Blocklist.File)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Block list enabled, stored in %s", config.McpProxy.Blocklist.File)
+	}
+	if config.McpProxy.Honeypot != nil {
+		p.honeypot = newHoneypot(config.McpProxy.Honeypot, p.sources.blocks, p.metrics)
+	}
+	p.signer, err = newUpstreamSigner(config.McpProxy.UpstreamSigning)
+	if err != nil {
+		return nil, err
+	}
+	p.identity, err = newWorkloadIdentity(config.McpProxy.WorkloadIdentity)
+	if err != nil {
+		return nil, err
+	}
+	if config.McpProxy.HMAC != nil && config.McpProxy.HMAC.Enabled {
+		p.sources.signatures = newSignatureVerifier(config.McpProxy.HMAC)
+		log.Printf("HMAC request signing enabled for %d callers", len(config.McpProxy.HMAC.Callers))
+	}
+	if config.McpProxy.Auth != nil && config.McpProxy.Auth.Mode != "" {
+		p.sources.users, err = newUserAuthenticator(config.McpProxy.Auth)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("User authentication enabled: %s", config.McpProxy.Auth.Mode)
+	}
+	if config.McpProxy.History != nil && config.McpProxy.History.Dir != "" {
+		p.history, err = newConfigHistory(config.McpProxy.History)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(config.McpProxy.Groups) > 0 {
+		p.sources.groups = newGroupIndex(config.McpProxy.Groups)
+	}
+	if config.McpProxy.Cluster != nil {
+		if p.cluster, err = newCluster(config.McpProxy.Cluster, p.registry); err != nil {
+			return nil, fmt.Errorf("mcpProxy.cluster: %w", err)
+		}
+		p.sources.cluster = p.cluster
+	}
+	if resumability := config.McpProxy.Resumability; resumability != nil && resumability.Enabled {
+		p.sources.streams = newStreamStore(resumability)
+	}
+	if config.McpProxy.Admin != nil && config.McpProxy.Admin.Enabled {
+		newAdminServer(p).register(p.mux, baseURL.Path, config.McpProxy.Admin)
+	}
+
+	var proxyMiddlewares []MiddlewareFunc
+	if len(config.McpProxy.Options.AuthTokens) > 0 || p.sources.enabled() {
+		proxyMiddlewares = append(proxyMiddlewares, newAuthMiddleware("", config.McpProxy.Options.AuthTokens, p.sources))
+	}
+	registerStatus(p.mux, baseURL.Path, p.registry, p.cluster, proxyMiddlewares...)
+	registerStatusJSON(p.mux, baseURL.Path, p.registry, p.metrics, time.Now(), proxyMiddlewares...)
+	if config.McpProxy.Metrics != nil && config.McpProxy.Metrics.Enabled {
+		registerMetrics(p.mux, baseURL.Path, p.metrics, config.McpProxy.Metrics)
+	}
+
+	if config.McpProxy.API != nil && config.McpProxy.API.Enabled {
+		p.restAPI = newAPIServer(baseURL, mcp.Implementation{
+			Name:    config.McpProxy.Name,
+			Version: config.McpProxy.Version,
+		})
+		if config.McpProxy.API.Async != nil {
+			if p.jobs, err = newAsyncQueue(config.McpProxy.API.Async, p.restAPI); err != nil {
+				return nil, err
+			}
+			p.restAPI.jobs = p.jobs
+		}
+		p.restAPI.register(p.mux, config.McpProxy.API, proxyMiddlewares...)
+		log.Printf("REST API enabled at %s", path.Join("/", baseURL.Path, "api"))
+	}
+	if config.McpProxy.MessageBus != nil {
+		if p.bus, err = newMessageBus(config.McpProxy.MessageBus, p.registry, p.sources.groups); err != nil {
+			return nil, fmt.Errorf("mcpProxy.messageBus: %w", err)
+		}
+	}
+	if search := config.McpProxy.ToolSearch; search != nil && search.Enabled {
+		if err = mountToolSearch(search, config.McpProxy, p.registry, p.sources, p.clients, baseURL.Path, p.mux, p.routes); err != nil {
+			return nil, fmt.Errorf("mcpProxy.toolSearch: %w", err)
+		}
+	}
+	return p, nil
+}
+
+// Handler returns the handler serving every route of the proxy, for
+// programs that run their own http.Server.
+func (p *Proxy) Handler() http.Handler {
+	blocks := p.sources.blocks.middleware(path.Join("/", p.baseURL.Path, "admin"), p.sources)
+	return chainMiddleware(p.mux, append([]MiddlewareFunc{p.honeypot.middleware(), recordRequestOrigin, blocks}, p.middlewares...)...)
+}
+
+// ServerHandler returns the MCP handler of a single connected server,
+// including its auth and access checks.
+func (p *Proxy) ServerHandler(name string) (http.Handler, bool) {
+	p.mu.Lock()
+	clientConfig, ok := p.config.McpServers[name]
+	p.mu.Unlock()
+	if !ok {
+		return nil, false
+	}
+	handler, ok := p.routes.get(mcpRoutePath(p.baseURL.Path, clientConfig.routes(name)[0]))
+	if !ok {
+		return nil, false
+	}
+	return chainMiddleware(handler, p.middlewares...), true
+}
+
+// Err reports errors that stop the proxy after Start returned: the listener
+// failing, or a server with panicIfInvalid that cannot connect.
+func (p *Proxy) Err() <-chan error {
+	return p.errs
+}
+
+// Start connects the configured servers in the background and, when
+// mcpProxy.addr is set, starts listening on it. Servers become reachable as
+// they finish connecting; virtual servers and profiles are mounted once all
+// of them did.
+func (p *Proxy) Start() error {
+	p.recordConfig("startup")
+	p.cluster.start()
+	var errorGroup errgroup.Group
+	// Servers with dependencies are prepared, which starts stdio processes,
+	// only once their dependencies are up.
+	startups := newServerStartups(slices.Collect(maps.Keys(p.config.McpServers)))
+	// listen is closed once the listener may start, as set by
+	// mcpProxy.options.waitForClients.
+	waitFor := p.config.McpProxy.Options.WaitForClients
+	listen := make(chan struct{})
+	var listenOnce sync.Once
+	ready := func() { listenOnce.Do(func() { close(listen) }) }
+	if waitFor == "" || waitFor == WaitForClientsNone {
+		ready()
+	}
+	prepare := func(name string, clientConfig *MCPClientConfigV2) (*Client, *Server, error) {
+		mcpClient, srv, err := p.prepareServer(p.ctx, name, clientConfig)
+		if err != nil {
+			startups.finish(name, err)
+			if errors.Is(err, errPinMismatch) || clientConfig.Options.PanicIfInvalid.OrElse(false) {
+				return nil, nil, err
+			}
+			log.Printf("<%s> Pre-flight failed, skipping: %v", name, err)
+		}
+		return mcpClient, srv, nil
+	}
+	for name, clientConfig := range p.config.McpServers {
+		if clientConfig.Options.Disabled {
+			log.Printf("<%s> Disabled", name)
+			startups.finish(name, errServerDisabled)
+			continue
+		}
+		if clientConfig.Passthrough {
+			err := p.mountPassthrough(name, clientConfig)
+			startups.finish(name, err)
+			if err == nil && waitFor == WaitForClientsAny {
+				ready()
+			}
+			if err != nil {
+				if clientConfig.Options.PanicIfInvalid.OrElse(false) {
+					return err
+				}
+				log.Printf("<%s> Failed to mount passthrough route, skipping: %v", name, err)
+			}
+			continue
+		}
+		deferred := len(clientConfig.DependsOn) > 0 || clientConfig.WaitFor != nil
+		if deferred {
+			p.mountConnecting(name, clientConfig, serverStateWaiting)
+		} else {
+			p.mountConnecting(name, clientConfig, serverStateConnecting)
+		}
+		errorGroup.Go(func() error {
+			if deferred {
+				if err := p.awaitDependencies(p.ctx, name, clientConfig, startups); err != nil {
+					log.Printf("<%s> Not starting: %v", name, err)
+					startups.finish(name, err)
+					p.unmountRoutes(name, clientConfig)
+					if clientConfig.Options.PanicIfInvalid.OrElse(false) {
+						return fmt.Errorf("%s: %w", name, err)
+					}
+					return nil
+				}
+				p.mountConnecting(name, clientConfig, serverStateConnecting)
+			}
+			// Pre-flight may download the package, so it runs here rather
+			// than hold up the other servers and the listener.
+			mcpClient, srv, err := prepare(name, clientConfig)
+			if err != nil || mcpClient == nil {
+				p.unmountRoutes(name, clientConfig)
+				return err
+			}
+			addErr := p.connectServer(name, clientConfig, mcpClient, srv)
+			startups.finish(name, addErr)
+			if addErr == nil && waitFor == WaitForClientsAny {
+				ready()
+			}
+			if addErr != nil && clientConfig.Options.PanicIfInvalid.OrElse(false) {
+				return addErr
+			}
+			return nil
+		})
+	}
+
+	go func() {
+		// Listen even when no server connected, so that /status and the
+		// admin API can tell why.
+		defer ready()
+		err := errorGroup.Wait()
+		if err != nil {
+			p.fail(fmt.Errorf("failed to add clients: %w", err))
+			return
+		}
+		log.Printf("All clients initialized")
+		for name, virtualConfig := range p.config.VirtualServers {
+			vErr := mountVirtualServer(name, virtualConfig, p.config.McpProxy, p.registry, p.sources, p.clients, p.baseURL.Path, p.routes)
+			if vErr != nil {
+				log.Printf("<%s> Failed to mount virtual server: %v", name, vErr)
+			}
+		}
+		for name, profileConfig := range p.config.Profiles {
+			mountProfile(p.ctx, name, profileConfig, p.config.McpProxy, p.registry, p.sources, p.clients, p.baseURL.Path, p.routes)
+		}
+		if library := p.config.McpProxy.PromptLibrary; library != nil && library.Enabled {
+			lErr := mountPromptLibrary(library, p.config.McpProxy, p.registry, p.sources, p.clients, p.baseURL.Path, p.mux, p.routes)
+			if lErr != nil {
+				log.Printf("<%s> Failed to mount prompt library: %v", promptLibraryRoute, lErr)
+			}
+		}
+	}()
+
+	if admin := p.config.McpProxy.Admin; admin != nil && admin.Enabled && admin.GRPC != nil {
+		var err error
+		if p.grpcAdmin, err = startAdminGRPC(p, admin); err != nil {
+			return fmt.Errorf("admin gRPC API: %w", err)
+		}
+	}
+	if p.config.McpProxy.Addr == "" {
+		return nil
+	}
+	p.httpServer = newHTTPServer(p.config.McpProxy, p.Handler())
+	go func() {
+		select {
+		case <-listen:
+		default:
+			log.Printf("Waiting for %s servers to connect before listening", waitFor)
+			select {
+			case <-listen:
+			case <-p.ctx.Done():
+				return
+			}
+		}
+		log.Printf("Starting %s server", p.config.McpProxy.Type)
+		log.Printf("%s server listening on %s", p.config.McpProxy.Type, p.config.McpProxy.Addr)
+		listener, hErr := listenAddr(p.ctx, p.config.McpProxy)
+		if hErr == nil {
+			hErr = p.httpServer.Serve(listener)
+		}
+		if hErr != nil && !errors.Is(hErr, http.ErrServerClosed) {
+			p.fail(fmt.Errorf("failed to start server: %w", hErr))
+		}
+	}()
+	return nil
+}
+
+// Stop shuts the listener down, if any, and closes every upstream.
+func (p *Proxy) Stop(ctx context.Context) error {
+	var err error
+	if p.httpServer != nil {
+		err = p.httpServer.Shutdown(ctx)
+		if errors.Is(err, http.ErrServerClosed) {
+			err = nil
+		}
+	}
+	// Streams that no client is connected to keep their handlers running
+	// until they expire, so end them too.
+	_ = p.sources.streams.Close()
+	p.grpcAdmin.stop(ctx)
+	// Queued calls stop before their upstreams go away.
+	_ = p.jobs.Close()
+	_ = p.bus.Close()
+	_ = p.cluster.Close()
+	for _, name := range p.registry.names() {
+		if c, ok := p.registry.remove(name); ok {
+			log.Printf("<%s> Shutting down", name)
+			_ = c.Close()
+		}
+	}
+	p.cancel()
+	_ = p.slowLog.Close()
+	_ = p.usage.Close()
+	_ = p.calls.Close()
+	_ = p.events.Close()
+	_ = p.statsd.Close()
+	_ = p.sources.geo.Close()
+	return err
+}
+
+// AddServer connects a server that is not part of the config and mounts it
+// next to the others. Options it leaves unset are inherited from
+// mcpProxy.options as at startup.
+func (p *Proxy) AddServer(ctx context.Context, name string, clientConfig *MCPClientConfigV2) error {
+	if err := p.addServer(ctx, name, clientConfig); err != nil {
+		return err
+	}
+	p.recordConfig("add server " + name)
+	return nil
+}
+
+// RemoveServer unmounts a server and closes its upstream. Virtual servers
+// and profiles built from it fail its tool calls until the proxy restarts.
+func (p *Proxy) RemoveServer(name string) error {
+	if err := p.removeServer(name); err != nil {
+		return err
+	}
+	p.recordConfig("remove server " + name)
+	return nil
+}
+
+func (p *Proxy) addServer(ctx context.Context, name string, clientConfig *MCPClientConfigV2) error {
+	p.mu.Lock()
+	_, exists := p.config.McpServers[name]
+	p.mu.Unlock()
+	if exists {
+		return fmt.Errorf("server %s already exists", name)
+	}
+	for _, route := range clientConfig.routes(name) {
+		if _, taken := p.routes.get(mcpRoutePath(p.baseURL.Path, route)); taken {
+			return fmt.Errorf("route /%s is already in use", route)
+		}
+	}
+	inheritOptions(clientConfig, p.config.McpProxy.Options)
+	if clientConfig.Passthrough && !clientConfig.Options.Disabled {
+		if err := p.mountPassthrough(name, clientConfig); err != nil {
+			return err
+		}
+	} else if !clientConfig.Options.Disabled {
+		p.mountConnecting(name, clientConfig, serverStateWaiting)
+		if err := p.awaitDependencies(ctx, name, clientConfig, nil); err != nil {
+			p.unmountRoutes(name, clientConfig)
+			return err
+		}
+		p.mountConnecting(name, clientConfig, serverStateConnecting)
+		mcpClient, srv, err := p.prepareServer(ctx, name, clientConfig)
+		if err != nil {
+			p.unmountRoutes(name, clientConfig)
+			return err
+		}
+		if err = p.connectServer(name, clientConfig, mcpClient, srv); err != nil {
+			return err
+		}
+	}
+	p.mu.Lock()
+	p.config.McpServers[name] = clientConfig
+	p.mu.Unlock()
+	return nil
+}
+
+func (p *Proxy) removeServer(name string) error {
+	p.mu.Lock()
+	clientConfig, configured := p.config.McpServers[name]
+	delete(p.config.McpServers, name)
+	p.mu.Unlock()
+	if configured {
+		p.unmountRoutes(name, clientConfig)
+	}
+	c, ok := p.registry.remove(name)
+	if !ok {
+		if configured {
+			log.Printf("<%s> Removed", name)
+			return nil
+		}
+		return fmt.Errorf("server %s not found", name)
+	}
+	if p.restAPI != nil {
+		p.restAPI.removeClient(name)
+	}
+	log.Printf("<%s> Removed", name)
+	return c.Close()
+}
+
+// unmountRoutes removes every route of a server.
+func (p *Proxy) unmountRoutes(name string, clientConfig *MCPClientConfigV2) {
+	for _, route := range clientConfig.routes(name) {
+		p.routes.remove(mcpRoutePath(p.baseURL.Path, route))
+	}
+}
+
+// mountPassthrough serves a remote MCP endpoint verbatim behind the
+// server's auth and logging. Passthrough servers have no client, so they
+// are not part of the REST API, status or admin views.
+func (p *Proxy) mountPassthrough(name string, clientConfig *MCPClientConfigV2) error {
+	middlewares := newServerMiddlewares(name, clientConfig.Options, p.sources)
+	for _, route := range clientConfig.routes(name) {
+		handler, err := newPassthroughHandler(name, route, clientConfig, p.config.McpProxy, p.signer, p.identity)
+		if err != nil {
+			return err
+		}
+		mcpRoute := mcpRoutePath(p.baseURL.Path, route)
+		log.Printf("<%s> Passing requests at %s through to %s", name, mcpRoute, clientConfig.URL)
+		p.routes.Handle(mcpRoute, chainMiddleware(handler, middlewares...))
+	}
+	return nil
+}
+
+// prepareServer runs pre-flight and builds the client and downstream
+// server, without connecting yet.
+func (p *Proxy) prepareServer(ctx context.Context, name string, clientConfig *MCPClientConfigV2) (*Client, *Server, error) {
+	pkg, err := preflight(ctx, name, clientConfig, p.config.McpProxy.Preflight)
+	if err != nil {
+		return nil, nil, err
+	}
+	mcpClient, err := newMCPClient(name, clientConfig, p.signer, p.identity)
+	if err != nil {
+		return nil, nil, err
+	}
+	mcpClient.pkg = pkg
+	mcpClient.metrics = p.metrics
+	mcpClient.hooks = p.hooks
+	mcpClient.cluster = p.cluster
+	mcpClient.toolCall = mcpClient.validateOutput(mcpClient.forwardToolCall)
+	mcpClient.toolCall = p.blobs.wrap(clientConfig.Options.BinaryContent, mcpClient.toolCall)
+	mcpClient.toolCall = p.results.offload(clientConfig.Options.OffloadResults, mcpClient.toolCall)
+	for _, interceptor := range p.interceptors {
+		mcpClient.toolCall = interceptor(mcpClient.toolCall)
+	}
+	mcpClient.toolCall = mcpClient.validateArguments(mcpClient.toolCall)
+	mcpClient.toolCall = p.clients.countCalls(mcpClient.toolCall)
+	mcpClient.toolCall = p.usage.countCalls(mcpClient.toolCall)
+	mcpClient.toolCall = p.slowLog.wrap(clientConfig.Options.SlowCallThreshold, mcpClient.toolCall)
+	mcpClient.toolCall = p.sizes.wrap(clientConfig.Options.SizeAlert, mcpClient.toolCall)
+	mcpClient.toolCall = p.calls.wrap(mcpClient.toolCall)
+	mcpClient.toolCall = p.events.wrap(mcpClient.toolCall)
+	mcpClient.toolCall = p.metrics.countToolCalls(mcpClient.toolCall)
+	srv, err := newMCPServer(name, p.config.McpProxy, clientConfig, append(mcpClient.serverOptions(), p.clients.serverOption(name))...)
+	if err != nil {
+		_ = mcpClient.Close()
+		return nil, nil, err
+	}
+	return mcpClient, srv, nil
+}
+
+// connectServer initializes the upstream and mounts it. The connection
+// lives until the server is removed or the proxy stops.
+func (p *Proxy) connectServer(name string, clientConfig *MCPClientConfigV2, mcpClient *Client, srv *Server) error {
+	ctx, cancel := context.WithCancel(p.ctx)
+	mcpClient.stop = cancel
+	log.Printf("<%s> Connecting", name)
+	err := mcpClient.addToMCPServer(ctx, p.info, srv.mcpServer)
+	if err != nil {
+		log.Printf("<%s> Failed to add client to server: %v", name, err)
+		_ = mcpClient.Close()
+		p.hooks.fire(lifecycleEvent{Event: hookServerConnectFailed, Server: name, Error: err.Error()})
+		// Keep GET <route>/diagnose to tell why the server is missing.
+		for _, route := range clientConfig.routes(name) {
+			p.routes.Handle(mcpRoutePath(p.baseURL.Path, route), p.withDiagnose(name, route, clientConfig, mcpClient, http.NotFoundHandler()))
+		}
+		return err
+	}
+	log.Printf("<%s> Connected", name)
+	p.hooks.fire(lifecycleEvent{Event: hookServerConnected, Server: name})
+	p.honeypot.addDecoyTools(name, srv.mcpServer)
+
+	middlewares := newServerMiddlewares(name, clientConfig.Options, p.sources)
+	for _, route := range clientConfig.routes(name) {
+		mcpRoute := mcpRoutePath(p.baseURL.Path, route)
+		log.Printf("<%s> Handling requests at %s", name, mcpRoute)
+		handler := withResourceDownloads(mcpRoute, srv, middlewares, chainMiddleware(srv.handlerAt(route), middlewares...))
+		p.routes.Handle(mcpRoute, p.withDiagnose(name, route, clientConfig, mcpClient, handler))
+	}
+	p.cluster.restoreMaintenance(name, mcpClient)
+	auth := newRouteAuth(name, clientConfig.Options.AuthTokens, p.sources)
+	p.registry.add(name, mcpClient, auth)
+	if p.restAPI != nil {
+		p.restAPI.addClient(name, mcpClient, auth, middlewares...)
+	}
+	return nil
+}
+
+func (p *Proxy) fail(err error) {
+	select {
+	case p.errs <- err:
+	default:
+	}
+}
+
+// routeTable dispatches requests to MCP server handlers by route prefix.
+// Unlike http.ServeMux it lets routes be removed again.
+type routeTable struct {
+	mu     sync.RWMutex
+	routes map[string]http.Handler
+}
+
+func newRouteTable() *routeTable {
+	return &routeTable{routes: make(map[string]http.Handler)}
+}
+
+func (t *routeTable) Handle(route string, handler http.Handler) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.routes[route] = handler
+}
+
+func (t *routeTable) remove(route string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.routes, route)
+}
+
+func (t *routeTable) get(route string) (http.Handler, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+	handler, ok := t.routes[route]
+	return handler, ok
+}
+
+func (t *routeTable) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var (
+		matched string
+		handler http.Handler
+	)
+	t.mu.RLock()
+	for route, h := range t.routes {
+		if strings.HasPrefix(r.URL.Path, route) && len(route) > len(matched) {
+			matched, handler = route, h
+		}
+	}
+	t.mu.RUnlock()
+	if handler == nil {
+		http.NotFound(w, r)
+		return
+	}
+	handler.ServeHTTP(w, r)
+}
@@ -0,0 +1,194 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+	"slices"
+	"strconv"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// maxReplayDifferences caps the differences a replay reports, so that a
+// completely different result does not produce a huge response.
+const maxReplayDifferences = 50
+
+type replayRequest struct {
+	// Confirm must be set; without it the call that would be sent is
+	// returned instead.
+	Confirm bool `json:"confirm"`
+	// AllowWrites replays tools that are not annotated as read-only.
+	AllowWrites bool `json:"allowWrites"`
+}
+
+type replayPreview struct {
+	Server    string          `json:"server"`
+	Tool      string          `json:"tool"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+	ReadOnly  bool            `json:"readOnly"`
+}
+
+type replayResponse struct {
+	ID     int64               `json:"id"`
+	Result *mcp.CallToolResult `json:"result,omitempty"`
+	Error  string              `json:"error,omitempty"`
+	Status string              `json:"status"`
+	// Identical is unset when the recorded result was not stored.
+	Identical   *bool              `json:"identical,omitempty"`
+	Differences []replayDifference `json:"differences,omitempty"`
+}
+
+// replayDifference is a JSON path at which the replayed result differs
+// from the recorded one; a missing side is omitted.
+type replayDifference struct {
+	Path     string `json:"path"`
+	Recorded any    `json:"recorded,omitempty"`
+	Replayed any    `json:"replayed,omitempty"`
+}
+
+// handleReplayCall sends a recorded call to its upstream again and reports
+// how the result differs. Tools not annotated as read-only are only
+// replayed with allowWrites, and nothing is sent without confirm.
+func (a *adminServer) handleReplayCall(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, errCallNotFound.Error())
+		return
+	}
+	var req replayRequest
+	if err = json.NewDecoder(io.LimitReader(r.Body, 1<<20)).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+		writeJSONError(w, http.StatusBadRequest, "invalid request body: "+err.Error())
+		return
+	}
+	call, err := a.calls.get(r.Context(), id)
+	if errors.Is(err, errCallNotFound) {
+		writeJSONError(w, http.StatusNotFound, err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	c, ok := a.registry.get(call.Server)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, "server not found")
+		return
+	}
+	tool, ok := c.findTool(call.Tool)
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, fmt.Sprintf("%s no longer offers tool %s", call.Server, call.Tool))
+		return
+	}
+	hint := tool.Annotations.ReadOnlyHint
+	preview := replayPreview{Server: call.Server, Tool: call.Tool, Arguments: call.Arguments, ReadOnly: hint != nil && *hint}
+	if !preview.ReadOnly && !req.AllowWrites {
+		writeJSON(w, http.StatusConflict, map[string]any{
+			"error": "tool is not annotated as read-only; set allowWrites to replay it anyway",
+			"call":  preview,
+		})
+		return
+	}
+	if !req.Confirm {
+		writeJSON(w, http.StatusPreconditionRequired, map[string]any{
+			"error": "set confirm to send this call to the upstream",
+			"call":  preview,
+		})
+		return
+	}
+
+	request := mcp.CallToolRequest{}
+	request.Params.Name = call.Tool
+	if len(call.Arguments) > 0 {
+		var arguments any
+		if err = json.Unmarshal(call.Arguments, &arguments); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, "recorded arguments: "+err.Error())
+			return
+		}
+		request.Params.Arguments = arguments
+	}
+	log.Printf("<admin> Replaying call %d: %s/%s", id, call.Server, call.Tool)
+	result, err := c.callTool(r.Context(), request)
+	response := replayResponse{ID: id, Result: result, Status: callOutcome(call.Server, result, err)}
+	if err != nil {
+		response.Error = err.Error()
+	}
+	if !call.ResultTruncated {
+		response.Differences = diffReplay(call, result, err)
+		identical := len(response.Differences) == 0
+		response.Identical = &identical
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// diffReplay compares a replayed result or error with the recorded one.
+func diffReplay(call *recordedCall, result *mcp.CallToolResult, err error) []replayDifference {
+	var differences []replayDifference
+	replayedError := ""
+	if err != nil {
+		replayedError = err.Error()
+	}
+	if call.Error != replayedError {
+		differences = append(differences, replayDifference{Path: "error", Recorded: call.Error, Replayed: replayedError})
+	}
+	var recorded, replayed any
+	if len(call.Result) > 0 {
+		_ = json.Unmarshal(call.Result, &recorded)
+	}
+	if result != nil {
+		// Round-trip through JSON so both sides have the same shape.
+		if data, mErr := json.Marshal(result); mErr == nil {
+			_ = json.Unmarshal(data, &replayed)
+		}
+	}
+	return diffJSON("result", recorded, replayed, differences)
+}
+
+// diffJSON appends the paths below path at which the decoded JSON values a
+// and b differ.
+func diffJSON(path string, a, b any, differences []replayDifference) []replayDifference {
+	if len(differences) >= maxReplayDifferences {
+		return differences
+	}
+	switch av := a.(type) {
+	case map[string]any:
+		if bv, ok := b.(map[string]any); ok {
+			keys := make([]string, 0, len(av)+len(bv))
+			for key := range av {
+				keys = append(keys, key)
+			}
+			for key := range bv {
+				if _, seen := av[key]; !seen {
+					keys = append(keys, key)
+				}
+			}
+			slices.Sort(keys)
+			for _, key := range keys {
+				differences = diffJSON(path+"."+key, av[key], bv[key], differences)
+			}
+			return differences
+		}
+	case []any:
+		if bv, ok := b.([]any); ok {
+			for i := range max(len(av), len(bv)) {
+				var ai, bi any
+				if i < len(av) {
+					ai = av[i]
+				}
+				if i < len(bv) {
+					bi = bv[i]
+				}
+				differences = diffJSON(fmt.Sprintf("%s[%d]", path, i), ai, bi, differences)
+			}
+			return differences
+		}
+	}
+	if !reflect.DeepEqual(a, b) {
+		differences = append(differences, replayDifference{Path: path, Recorded: a, Replayed: b})
+	}
+	return differences
+}
@@ -0,0 +1,227 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const replicaCheckInterval = 30 * time.Second
+
+// replica is a read-only copy of an http upstream. It serves resource
+// listings and reads so that they do not load the primary, which keeps
+// every tool call.
+type replica struct {
+	// label is the URL without credentials or query, for logs and status.
+	label string
+	// dial creates a fresh, unstarted connection, since a transport that
+	// failed to start cannot be started again.
+	dial func() (*client.Client, error)
+
+	mu        sync.RWMutex
+	client    *client.Client
+	connected atomic.Bool
+	// failing keeps a replica that stays down from being logged on every
+	// check.
+	failing bool
+}
+
+// replicaSet spreads reads over the connected replicas of a server in turn.
+type replicaSet struct {
+	server   string
+	replicas []*replica
+	next     atomic.Uint64
+}
+
+type replicaStatus struct {
+	URL       string `json:"url"`
+	Connected bool   `json:"connected"`
+}
+
+func newReplicaSet(name string, conf *MCPClientConfigV2, signer *upstreamSigner, identity *workloadIdentity) *replicaSet {
+	set := &replicaSet{server: name}
+	for _, replicaURL := range conf.Replicas {
+		replicaConf := *conf
+		replicaConf.URL = replicaURL
+		replicaConf.Replicas = nil
+		set.replicas = append(set.replicas, &replica{
+			label: replicaLabel(replicaURL),
+			dial: func() (*client.Client, error) {
+				c, err := newMCPClientForConfig(name, &replicaConf, signer, identity)
+				if err != nil {
+					return nil, err
+				}
+				return c.client, nil
+			},
+		})
+	}
+	return set
+}
+
+func replicaLabel(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "replica"
+	}
+	u.User, u.RawQuery, u.Fragment = nil, "", ""
+	return u.String()
+}
+
+// connect makes a first attempt to connect every replica, so that the
+// resource listing at startup can already use them, then keeps them
+// checked until ctx is done: connected replicas are pinged and the others
+// retried.
+func (s *replicaSet) connect(ctx context.Context, clientInfo mcp.Implementation) {
+	if s == nil {
+		return
+	}
+	var wg sync.WaitGroup
+	for _, r := range s.replicas {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			s.check(ctx, r, clientInfo)
+		}()
+	}
+	wg.Wait()
+	for _, r := range s.replicas {
+		go func() {
+			ticker := time.NewTicker(replicaCheckInterval)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case <-ticker.C:
+					s.check(ctx, r, clientInfo)
+				}
+			}
+		}()
+	}
+}
+
+// check pings a connected replica, or connects one that is not.
+func (s *replicaSet) check(ctx context.Context, r *replica, clientInfo mcp.Implementation) {
+	if r.connected.Load() {
+		checkCtx, cancel := context.WithTimeout(ctx, defaultHealthCheckTimeout)
+		err := r.current().Ping(checkCtx)
+		cancel()
+		if err == nil || ctx.Err() != nil {
+			return
+		}
+		log.Printf("<%s> Replica %s failed a ping, reading from the primary until it is back: %v", s.server, r.label, err)
+		r.connected.Store(false)
+	}
+	mcpClient, err := r.dial()
+	if err == nil {
+		err = initializeReplica(ctx, mcpClient, clientInfo)
+		if err != nil {
+			_ = mcpClient.Close()
+		}
+	}
+	if err != nil {
+		if ctx.Err() == nil && !r.failing {
+			log.Printf("<%s> Failed to connect replica %s, retrying every %s: %v", s.server, r.label, replicaCheckInterval, err)
+		}
+		r.failing = true
+		return
+	}
+	r.failing = false
+	r.mu.Lock()
+	old := r.client
+	r.client = mcpClient
+	r.mu.Unlock()
+	if old != nil {
+		_ = old.Close()
+	}
+	r.connected.Store(true)
+	log.Printf("<%s> Replica %s connected", s.server, r.label)
+}
+
+func initializeReplica(ctx context.Context, mcpClient *client.Client, clientInfo mcp.Implementation) error {
+	if err := mcpClient.Start(ctx); err != nil {
+		return err
+	}
+	initRequest := mcp.InitializeRequest{}
+	initRequest.Params.ProtocolVersion = mcp.LATEST_PROTOCOL_VERSION
+	initRequest.Params.ClientInfo = clientInfo
+	result, err := mcpClient.Initialize(ctx, initRequest)
+	if err != nil {
+		return err
+	}
+	if result.Capabilities.Resources == nil {
+		return errors.New("replica does not serve resources")
+	}
+	return nil
+}
+
+func (r *replica) current() *client.Client {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.client
+}
+
+// pick returns the next connected replica, or nil when there is none.
+func (s *replicaSet) pick() *replica {
+	if s == nil {
+		return nil
+	}
+	for range s.replicas {
+		r := s.replicas[s.next.Add(1)%uint64(len(s.replicas))]
+		if r.connected.Load() {
+			return r
+		}
+	}
+	return nil
+}
+
+func (s *replicaSet) status() []replicaStatus {
+	if s == nil {
+		return nil
+	}
+	statuses := make([]replicaStatus, 0, len(s.replicas))
+	for _, r := range s.replicas {
+		statuses = append(statuses, replicaStatus{URL: r.label, Connected: r.connected.Load()})
+	}
+	return statuses
+}
+
+func (s *replicaSet) close() {
+	if s == nil {
+		return
+	}
+	for _, r := range s.replicas {
+		r.connected.Store(false)
+		if mcpClient := r.current(); mcpClient != nil {
+			_ = mcpClient.Close()
+		}
+	}
+}
+
+// resourceReader returns the connection resource listings and reads go
+// to: a connected replica if the server has one, or else the primary.
+func (c *Client) resourceReader() (*client.Client, string) {
+	if r := c.replicas.pick(); r != nil {
+		return r.current(), r.label
+	}
+	return c.current(), ""
+}
+
+// readResource reads from a replica, falling back to the primary when the
+// replica fails, since the primary has every resource a replica has.
+func (c *Client) readResource(ctx context.Context, request mcp.ReadResourceRequest) (*mcp.ReadResourceResult, error) {
+	mcpClient, replicaLabel := c.resourceReader()
+	result, err := mcpClient.ReadResource(ctx, request)
+	if err != nil && replicaLabel != "" && ctx.Err() == nil {
+		log.Printf("<%s> Replica %s failed to read %s, reading from the primary: %v", c.name, replicaLabel, request.Params.URI, err)
+		return c.current().ReadResource(ctx, request)
+	}
+	return result, err
+}
@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"cmp"
+	"encoding/base64"
+	"encoding/json"
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// withResourceDownloads serves GET <route>/resources/<uri>, with the
+// resource URI path-escaped, as a plain HTTP download of the resource, so
+// that people and non-MCP tools can fetch what an agent refers to. The
+// read goes through the route's MCP server, and with it the resources and
+// templates the upstream listed, behind the route's middlewares.
+func withResourceDownloads(mcpRoute string, srv *Server, middlewares []MiddlewareFunc, next http.Handler) http.Handler {
+	prefix := mcpRoute + "resources/"
+	download := chainMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		uri, err := url.PathUnescape(strings.TrimPrefix(r.URL.EscapedPath(), prefix))
+		if err != nil || uri == "" {
+			writeJSONError(w, http.StatusBadRequest, "expected "+prefix+"<path-escaped resource uri>")
+			return
+		}
+		request, _ := json.Marshal(map[string]any{
+			"jsonrpc": mcp.JSONRPC_VERSION,
+			"id":      1,
+			"method":  mcp.MethodResourcesRead,
+			"params":  mcp.ReadResourceParams{URI: uri},
+		})
+		switch response := srv.mcpServer.HandleMessage(r.Context(), request).(type) {
+		case mcp.JSONRPCResponse:
+			result, ok := response.Result.(mcp.ReadResourceResult)
+			if !ok || len(result.Contents) == 0 {
+				writeJSONError(w, http.StatusNotFound, "resource has no contents")
+				return
+			}
+			writeResourceContents(w, r, uri, result.Contents)
+		case mcp.JSONRPCError:
+			status := http.StatusBadGateway
+			switch response.Error.Code {
+			case mcp.RESOURCE_NOT_FOUND, mcp.METHOD_NOT_FOUND:
+				status = http.StatusNotFound
+			case mcp.INVALID_PARAMS:
+				status = http.StatusBadRequest
+			}
+			writeJSONError(w, status, response.Error.Message)
+		default:
+			writeJSONError(w, http.StatusBadGateway, "unexpected response to resources/read")
+		}
+	}), middlewares...)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if (r.Method == http.MethodGet || r.Method == http.MethodHead) && strings.HasPrefix(r.URL.Path, prefix) {
+			download.ServeHTTP(w, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// writeResourceContents answers with the contents for uri, or the first
+// contents when the upstream returned several under other URIs, typed
+// with the MIME type the upstream gave. The contents are sent as an
+// attachment, so that a browser does not render what the upstream
+// returned on the proxy's origin.
+func writeResourceContents(w http.ResponseWriter, r *http.Request, uri string, contents []mcp.ResourceContents) {
+	chosen := contents[0]
+	for _, c := range contents {
+		if text, ok := mcp.AsTextResourceContents(c); ok && text.URI == uri {
+			chosen = c
+			break
+		}
+		if blob, ok := mcp.AsBlobResourceContents(c); ok && blob.URI == uri {
+			chosen = c
+			break
+		}
+	}
+	var body []byte
+	var mimeType string
+	if text, ok := mcp.AsTextResourceContents(chosen); ok {
+		body, mimeType = []byte(text.Text), text.MIMEType
+		if mimeType == "" {
+			mimeType = "text/plain; charset=utf-8"
+		}
+	} else if blob, ok := mcp.AsBlobResourceContents(chosen); ok {
+		data, err := base64.StdEncoding.DecodeString(blob.Blob)
+		if err != nil {
+			writeJSONError(w, http.StatusBadGateway, "upstream returned invalid base64")
+			return
+		}
+		body, mimeType = data, blob.MIMEType
+		if mimeType == "" {
+			mimeType = "application/octet-stream"
+		}
+	} else {
+		writeJSONError(w, http.StatusBadGateway, "unsupported resource contents")
+		return
+	}
+	w.Header().Set("Content-Type", mimeType)
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	setAttachmentHeaders(w, resourceFilename(uri))
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = w.Write(body)
+}
+
+// setAttachmentHeaders makes content from upstreams a download named
+// filename. Served inline, HTML or SVG would run as script on the proxy's
+// origin, with the credentials of whoever opened it; the sandbox keeps it
+// from doing so even when a browser displays it anyway.
+func setAttachmentHeaders(w http.ResponseWriter, filename string) {
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": filename}))
+	w.Header().Set("Content-Security-Policy", "sandbox")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+}
+
+// resourceFilename names the download of uri after the last segment of its
+// path, e.g. report.pdf for file:///tmp/report.pdf.
+func resourceFilename(uri string) string {
+	name := uri
+	if u, err := url.Parse(uri); err == nil {
+		name = cmp.Or(u.Opaque, u.Path)
+	}
+	name = path.Base(strings.TrimRight(name, "/"))
+	if name == "." || name == "/" || name == "" {
+		return "resource"
+	}
+	return name
+}
@@ -0,0 +1,60 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestWriteResourceContentsAttachment(t *testing.T) {
+	tests := []struct {
+		name            string
+		contents        mcp.ResourceContents
+		wantType        string
+		wantDisposition string
+	}{
+		{
+			name:            "html",
+			contents:        mcp.TextResourceContents{URI: "https://example.com/pages/index.html", MIMEType: "text/html", Text: "<script>alert(1)</script>"},
+			wantType:        "text/html",
+			wantDisposition: `attachment; filename=index.html`,
+		},
+		{
+			name:            "svg",
+			contents:        mcp.BlobResourceContents{URI: "file:///icons/logo.svg", MIMEType: "image/svg+xml", Blob: "PHN2Zy8+"},
+			wantType:        "image/svg+xml",
+			wantDisposition: `attachment; filename=logo.svg`,
+		},
+		{
+			name:            "no path",
+			contents:        mcp.TextResourceContents{URI: "memo://", Text: "hi"},
+			wantType:        "text/plain; charset=utf-8",
+			wantDisposition: `attachment; filename=resource`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/github/resources/x", nil)
+			uri := ""
+			switch c := tt.contents.(type) {
+			case mcp.TextResourceContents:
+				uri = c.URI
+			case mcp.BlobResourceContents:
+				uri = c.URI
+			}
+			writeResourceContents(w, r, uri, []mcp.ResourceContents{tt.contents})
+			if got := w.Header().Get("Content-Type"); got != tt.wantType {
+				t.Errorf("Content-Type = %q, want %q", got, tt.wantType)
+			}
+			if got := w.Header().Get("Content-Disposition"); got != tt.wantDisposition {
+				t.Errorf("Content-Disposition = %q, want %q", got, tt.wantDisposition)
+			}
+			if got := w.Header().Get("Content-Security-Policy"); got != "sandbox" {
+				t.Errorf("Content-Security-Policy = %q, want sandbox", got)
+			}
+		})
+	}
+}
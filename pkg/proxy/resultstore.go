@@ -0,0 +1,351 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	defaultResultTTL = 24 * time.Hour
+	// offloadKeepBytes is the size below which text blocks stay in an
+	// offloaded result, so that short summaries next to a large payload
+	// still reach the model.
+	offloadKeepBytes = 1024
+	// localSweepInterval is how often a local store looks for expired
+	// results.
+	localSweepInterval = time.Minute
+	s3Timeout          = 30 * time.Second
+)
+
+// newResultStore returns the store options.offloadResults uploads to, or
+// nil when conf is nil.
+func newResultStore(baseURL *url.URL, conf *ResultStoreConfig) (*blobStore, error) {
+	if conf == nil {
+		return nil, nil
+	}
+	var backend blobBackend
+	switch conf.Type {
+	case ResultStoreLocal:
+		if err := os.MkdirAll(conf.Dir, 0o700); err != nil {
+			return nil, fmt.Errorf("resultStore.dir: %w", err)
+		}
+		backend = &localBlobs{dir: conf.Dir}
+	case ResultStoreS3:
+		s3, err := newS3Blobs(conf.S3)
+		if err != nil {
+			return nil, fmt.Errorf("resultStore.s3: %w", err)
+		}
+		backend = s3
+	default:
+		return nil, fmt.Errorf("resultStore.type: must be local or s3")
+	}
+	log.Printf("Offloading large tool results to %s storage", conf.Type)
+	store := newBlobStore(baseURL, "results", []byte(conf.SigningKey), backend)
+	store.ttl = conf.TTL
+	if store.ttl <= 0 {
+		store.ttl = defaultResultTTL
+	}
+	return store, nil
+}
+
+// offload uploads the content of results larger than conf.MinBytes to the
+// store and replaces it with resource links served by the proxy, keeping
+// large file outputs out of the SSE stream. Content that fails to upload
+// is left in the result.
+func (s *blobStore) offload(conf *OffloadResultsConfig, next ToolCallFunc) ToolCallFunc {
+	if s == nil || conf == nil || conf.MinBytes <= 0 {
+		return next
+	}
+	return func(ctx context.Context, server string, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		result, err := next(ctx, server, request)
+		if err != nil || result == nil || result.IsError {
+			return result, err
+		}
+		if data, mErr := json.Marshal(result); mErr != nil || len(data) < conf.MinBytes {
+			return result, nil
+		}
+		offloaded := 0
+		for i, content := range result.Content {
+			payload, mimeType, ok := offloadablePayload(content)
+			if !ok || len(payload) < offloadKeepBytes {
+				continue
+			}
+			link, expires, pErr := s.put(ctx, payload, mimeType, s.ttl)
+			if pErr != nil {
+				log.Printf("<%s> Failed to offload result of %s: %v", server, request.Params.Name, pErr)
+				continue
+			}
+			description := fmt.Sprintf("%d bytes of %s output, offloaded by the proxy; available until %s", len(payload), request.Params.Name, expires.UTC().Format(time.RFC3339))
+			result.Content[i] = mcp.NewResourceLink(link, fmt.Sprintf("%s-%d", request.Params.Name, i+1), description, mimeType)
+			offloaded++
+		}
+		if offloaded > 0 {
+			log.Printf("<%s> Offloaded %d content blocks of %s", server, offloaded, request.Params.Name)
+		}
+		return result, nil
+	}
+}
+
+// offloadablePayload returns the bytes and MIME type of a text, binary or
+// embedded resource content block.
+func offloadablePayload(content mcp.Content) ([]byte, string, bool) {
+	if text, ok := mcp.AsTextContent(content); ok {
+		return []byte(text.Text), "text/plain; charset=utf-8", true
+	}
+	if resource, ok := mcp.AsEmbeddedResource(content); ok {
+		if text, ok := mcp.AsTextResourceContents(resource.Resource); ok {
+			mimeType := text.MIMEType
+			if mimeType == "" {
+				mimeType = "text/plain; charset=utf-8"
+			}
+			return []byte(text.Text), mimeType, true
+		}
+	}
+	if _, mimeType, data, ok := binaryContent(content); ok {
+		decoded, err := base64.StdEncoding.DecodeString(data)
+		return decoded, mimeType, err == nil
+	}
+	return nil, "", false
+}
+
+// localBlobs keeps results as files in a directory, each with its MIME
+// type in a .type file next to it. Expired files are removed as new ones
+// are written.
+type localBlobs struct {
+	dir string
+
+	mu        sync.Mutex
+	lastSweep time.Time
+}
+
+func (l *localBlobs) put(_ context.Context, name string, data []byte, mimeType string, expires time.Time) error {
+	l.sweep()
+	file := filepath.Join(l.dir, name)
+	if err := os.WriteFile(file+".type", []byte(mimeType), 0o600); err != nil {
+		return err
+	}
+	if err := os.WriteFile(file, data, 0o600); err != nil {
+		return err
+	}
+	// The modification time records the expiry for sweep.
+	return os.Chtimes(file, time.Time{}, expires)
+}
+
+func (l *localBlobs) get(_ context.Context, name string) (io.ReadCloser, string, error) {
+	file := filepath.Join(l.dir, filepath.Base(name))
+	f, err := os.Open(file)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, "", errBlobNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	mimeType, _ := os.ReadFile(file + ".type")
+	return f, string(mimeType), nil
+}
+
+// sweep removes the results that expired, at most once a minute.
+func (l *localBlobs) sweep() {
+	l.mu.Lock()
+	now := time.Now()
+	if now.Sub(l.lastSweep) < localSweepInterval {
+		l.mu.Unlock()
+		return
+	}
+	l.lastSweep = now
+	l.mu.Unlock()
+	entries, err := os.ReadDir(l.dir)
+	if err != nil {
+		log.Printf("Failed to sweep result store: %v", err)
+		return
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || strings.HasSuffix(entry.Name(), ".type") {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil || info.ModTime().After(now) {
+			continue
+		}
+		file := filepath.Join(l.dir, entry.Name())
+		_ = os.Remove(file)
+		_ = os.Remove(file + ".type")
+	}
+}
+
+// s3Blobs keeps results in an S3 compatible bucket, such as AWS S3 or
+// MinIO, with requests signed with AWS Signature Version 4. Expired
+// objects are not deleted by the proxy; use a lifecycle rule on the bucket
+// or prefix for that.
+type s3Blobs struct {
+	endpoint  *url.URL
+	bucket    string
+	prefix    string
+	region    string
+	pathStyle bool
+	accessKey string
+	secretKey string
+	session   string
+	client    *http.Client
+}
+
+func newS3Blobs(conf *S3StoreConfig) (*s3Blobs, error) {
+	if conf == nil || conf.Bucket == "" {
+		return nil, errors.New("bucket is required")
+	}
+	region := conf.Region
+	if region == "" {
+		region = "us-east-1"
+	}
+	endpoint := conf.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	u, err := url.Parse(endpoint)
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid endpoint %q", endpoint)
+	}
+	s := &s3Blobs{
+		endpoint:  u,
+		bucket:    conf.Bucket,
+		prefix:    conf.Prefix,
+		region:    region,
+		pathStyle: conf.PathStyle,
+		accessKey: conf.AccessKeyID,
+		secretKey: conf.SecretAccessKey,
+		session:   conf.SessionToken,
+		client:    &http.Client{Timeout: s3Timeout},
+	}
+	if s.accessKey == "" {
+		s.accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		s.secretKey = os.Getenv("AWS_SECRET_ACCESS_KEY")
+		s.session = os.Getenv("AWS_SESSION_TOKEN")
+	}
+	if s.accessKey == "" || s.secretKey == "" {
+		return nil, errors.New("credentials are required, in the config or AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY")
+	}
+	return s, nil
+}
+
+func (s *s3Blobs) objectURL(name string) *url.URL {
+	u := *s.endpoint
+	key := s.prefix + name
+	if s.pathStyle {
+		return u.JoinPath(s.bucket, key)
+	}
+	u.Host = s.bucket + "." + u.Host
+	return u.JoinPath(key)
+}
+
+func (s *s3Blobs) put(ctx context.Context, name string, data []byte, mimeType string, _ time.Time) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, s.objectURL(name).String(), bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", mimeType)
+	s.sign(req, data)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("PUT %s: %s: %s", name, resp.Status, strings.TrimSpace(string(body)))
+	}
+	return nil
+}
+
+func (s *s3Blobs) get(ctx context.Context, name string) (io.ReadCloser, string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.objectURL(name).String(), nil)
+	if err != nil {
+		return nil, "", err
+	}
+	s.sign(req, nil)
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, "", err
+	}
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		_ = resp.Body.Close()
+		return nil, "", errBlobNotFound
+	case resp.StatusCode/100 != 2:
+		_ = resp.Body.Close()
+		return nil, "", fmt.Errorf("GET %s: %s", name, resp.Status)
+	}
+	return resp.Body, resp.Header.Get("Content-Type"), nil
+}
+
+// sign adds an AWS Signature Version 4 Authorization header to req, whose
+// body is payload.
+func (s *s3Blobs) sign(req *http.Request, payload []byte) {
+	now := time.Now().UTC()
+	amzDate := now.Format("20060102T150405Z")
+	date := now.Format("20060102")
+	payloadHash := sha256.Sum256(payload)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", hex.EncodeToString(payloadHash[:]))
+	if s.session != "" {
+		req.Header.Set("X-Amz-Security-Token", s.session)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(req.Header.Get(name))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		hex.EncodeToString(payloadHash[:]),
+	}, "\n")
+	scope := date + "/" + s.region + "/s3/aws4_request"
+	requestHash := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(requestHash[:])
+
+	key := hmacSHA256([]byte("AWS4"+s.secretKey), date)
+	key = hmacSHA256(key, s.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s", s.accessKey, scope, signedHeaders, signature))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
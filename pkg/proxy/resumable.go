@@ -0,0 +1,515 @@
+package proxy
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultResumabilityTTL       = 5 * time.Minute
+	defaultResumabilityMaxEvents = 100
+	// maxResumableBodyBytes caps the streamable HTTP requests read to find
+	// their JSON-RPC id.
+	maxResumableBodyBytes = 10 << 20
+)
+
+// streamStore keeps the SSE streams of MCP routes so that clients which
+// lose their connection can reconnect with Last-Event-ID and receive what
+// they missed. A stream's handler runs apart from the request that
+// started it: it keeps going while no client is connected, for up to ttl,
+// and its events are buffered meanwhile.
+type streamStore struct {
+	ttl       time.Duration
+	maxEvents int
+
+	mu      sync.Mutex
+	streams map[string]*sseStream
+}
+
+// sseStream is the buffered output of one SSE response. Events are
+// numbered from 1 and sent with the id <stream>-<number>.
+type sseStream struct {
+	store  *streamStore
+	id     string
+	server string
+	// owner is the caller that started the stream; only it may resume.
+	owner  string
+	cancel context.CancelFunc
+
+	mu      sync.Mutex
+	events  []sseEvent
+	seq     int
+	done    bool
+	changed chan struct{}
+	clients int
+	idle    *time.Timer
+	// released is set once the stream's end was delivered.
+	released bool
+}
+
+type sseEvent struct {
+	seq  int
+	data []byte
+}
+
+func newStreamStore(conf *ResumabilityConfig) *streamStore {
+	s := &streamStore{
+		ttl:       conf.TTL,
+		maxEvents: conf.MaxEvents,
+		streams:   make(map[string]*sseStream),
+	}
+	if s.ttl <= 0 {
+		s.ttl = defaultResumabilityTTL
+	}
+	if s.maxEvents <= 0 {
+		s.maxEvents = defaultResumabilityMaxEvents
+	}
+	return s
+}
+
+func (s *streamStore) open(server, owner string, cancel context.CancelFunc) *sseStream {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+	stream := &sseStream{
+		store:   s,
+		id:      hex.EncodeToString(id),
+		server:  server,
+		owner:   owner,
+		cancel:  cancel,
+		changed: make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.streams[stream.id] = stream
+	s.mu.Unlock()
+	return stream
+}
+
+// lookup finds the stream of a Last-Event-ID. ok is false for IDs this
+// proxy did not hand out, which are left to the handler.
+func (s *streamStore) lookup(lastEventID string) (stream *sseStream, seq int, ok bool) {
+	id, number, found := strings.Cut(lastEventID, "-")
+	if !found || len(id) != 32 {
+		return nil, 0, false
+	}
+	seq, err := strconv.Atoi(number)
+	if err != nil || seq < 0 {
+		return nil, 0, false
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.streams[id], seq, true
+}
+
+func (s *streamStore) remove(id string) {
+	s.mu.Lock()
+	delete(s.streams, id)
+	s.mu.Unlock()
+}
+
+// Close ends the handlers of every stream.
+func (s *streamStore) Close() error {
+	if s == nil {
+		return nil
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for id, stream := range s.streams {
+		stream.cancel()
+		delete(s.streams, id)
+	}
+	return nil
+}
+
+// add appends an event, given without its trailing blank line. Its id
+// lines are replaced by the stream's own.
+func (s *sseStream) add(block []byte) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.seq++
+	var data bytes.Buffer
+	fmt.Fprintf(&data, "id: %s-%d\n", s.id, s.seq)
+	for line := range strings.SplitSeq(string(block), "\n") {
+		if line == "id" || strings.HasPrefix(line, "id:") {
+			continue
+		}
+		data.WriteString(line)
+		data.WriteByte('\n')
+	}
+	data.WriteByte('\n')
+	s.events = append(s.events, sseEvent{seq: s.seq, data: data.Bytes()})
+	if len(s.events) > s.store.maxEvents {
+		s.events = s.events[len(s.events)-s.store.maxEvents:]
+	}
+	s.notify()
+}
+
+func (s *sseStream) finish() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.done = true
+	s.notify()
+	if s.clients == 0 {
+		s.startIdle()
+	}
+}
+
+func (s *sseStream) notify() {
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// since returns the events after seq, and how many were dropped from the
+// buffer before they could be sent.
+func (s *sseStream) since(seq int) (events []sseEvent, dropped int, done bool, changed <-chan struct{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for i, event := range s.events {
+		if event.seq > seq {
+			events = s.events[i:]
+			dropped = event.seq - seq - 1
+			break
+		}
+	}
+	return events, dropped, s.done, s.changed
+}
+
+func (s *sseStream) attach() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients++
+	if s.idle != nil {
+		s.idle.Stop()
+		s.idle = nil
+	}
+}
+
+func (s *sseStream) detach() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.clients--
+	if s.clients == 0 {
+		s.startIdle()
+	}
+}
+
+func (s *sseStream) startIdle() {
+	if s.released {
+		return
+	}
+	if s.idle != nil {
+		s.idle.Stop()
+	}
+	s.idle = time.AfterFunc(s.store.ttl, s.expire)
+}
+
+// release drops a stream whose end was delivered.
+func (s *sseStream) release() {
+	s.mu.Lock()
+	s.released = true
+	if s.idle != nil {
+		s.idle.Stop()
+		s.idle = nil
+	}
+	s.mu.Unlock()
+	s.store.remove(s.id)
+}
+
+// expire drops a stream no client reconnected to within the TTL, and ends
+// its handler if it is still running.
+func (s *sseStream) expire() {
+	s.mu.Lock()
+	if s.clients > 0 {
+		s.mu.Unlock()
+		return
+	}
+	done := s.done
+	s.mu.Unlock()
+	if !done {
+		log.Printf("<%s> Closing stream %s, no client reconnected within %s", s.server, s.id, s.store.ttl)
+	}
+	s.cancel()
+	s.store.remove(s.id)
+}
+
+// follow sends the events after seq to w, and the new ones as they come,
+// until the stream ends or the client goes away. A stream the client
+// received to its end has nothing left to resume, so it is dropped at once
+// rather than kept for the TTL.
+func (s *sseStream) follow(w http.ResponseWriter, r *http.Request, seq int) {
+	s.attach()
+	defer s.detach()
+	flusher, _ := w.(http.Flusher)
+	for {
+		events, dropped, done, changed := s.since(seq)
+		if dropped > 0 {
+			log.Printf("<%s> Stream %s dropped %d events before they could be sent", s.server, s.id, dropped)
+		}
+		for _, event := range events {
+			if _, err := w.Write(event.data); err != nil {
+				return
+			}
+			seq = event.seq
+		}
+		if flusher != nil {
+			flusher.Flush()
+		}
+		if done {
+			s.release()
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// middleware makes the SSE streams of a server's routes resumable:
+//   - GET requests that accept text/event-stream, such as SSE sessions, run
+//     apart from the connection and are buffered if they turn out to
+//     stream.
+//   - Streamable HTTP requests for a JSON-RPC method, other than initialize,
+//     are answered with a stream whose first event carries an id, so that
+//     a client that loses the connection during a long call can still
+//     fetch its result.
+//   - GET requests with the Last-Event-ID of a buffered stream replay the
+//     events after it and follow the stream from there.
+//
+// Other requests are passed on untouched.
+func (s *streamStore) middleware(name string) MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			owner := callerName(authTokenFromContext(r.Context()))
+			if r.Method == http.MethodGet {
+				if stream, seq, ok := s.lookup(r.Header.Get("Last-Event-ID")); ok {
+					s.resume(w, r, name, owner, stream, seq)
+					return
+				}
+			}
+			if !strings.Contains(r.Header.Get("Accept"), "text/event-stream") {
+				next.ServeHTTP(w, r)
+				return
+			}
+			var requestID json.RawMessage
+			switch r.Method {
+			case http.MethodGet:
+			case http.MethodPost:
+				data, err := io.ReadAll(io.LimitReader(r.Body, maxResumableBodyBytes+1))
+				if err != nil {
+					writeJSONError(w, http.StatusBadRequest, err.Error())
+					return
+				}
+				if len(data) > maxResumableBodyBytes {
+					writeJSONError(w, http.StatusRequestEntityTooLarge, "request body is too large")
+					return
+				}
+				r.Body = io.NopCloser(bytes.NewReader(data))
+				var message struct {
+					JSONRPC string          `json:"jsonrpc"`
+					ID      json.RawMessage `json:"id"`
+					Method  string          `json:"method"`
+				}
+				// Requests to SSE sessions are answered on the session's
+				// stream, which is resumable itself.
+				if r.URL.Query().Has("sessionId") || json.Unmarshal(data, &message) != nil || message.JSONRPC != "2.0" ||
+					len(message.ID) == 0 || message.Method == "" || message.Method == "initialize" {
+					next.ServeHTTP(w, r)
+					return
+				}
+				requestID = message.ID
+			default:
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			ctx, cancel := context.WithCancel(context.WithoutCancel(r.Context()))
+			stream := s.open(name, owner, cancel)
+			sw := &streamWriter{header: make(http.Header), stream: stream, requestID: requestID, ready: make(chan struct{})}
+			if requestID != nil {
+				// An empty event with an id lets the client resume even if
+				// the connection drops before the result.
+				stream.add([]byte("data: "))
+			}
+			// The handler holds its maxSessions slot for as long as it runs.
+			release := keepSessionSlot(r.Context())
+			handlerDone := make(chan struct{})
+			go func() {
+				defer release()
+				defer close(handlerDone)
+				defer cancel()
+				defer sw.finish()
+				next.ServeHTTP(sw, r.WithContext(ctx))
+			}()
+
+			if requestID != nil {
+				setSSEHeaders(w.Header())
+				w.WriteHeader(http.StatusOK)
+				stream.follow(w, r, 0)
+				return
+			}
+			select {
+			case <-sw.ready:
+			case <-r.Context().Done():
+				cancel()
+				return
+			}
+			status, header, isStream := sw.response()
+			for key, values := range header {
+				w.Header()[key] = values
+			}
+			if isStream {
+				w.WriteHeader(status)
+				stream.follow(w, r, 0)
+				return
+			}
+			// Not a stream after all, so there is nothing to resume.
+			s.remove(stream.id)
+			select {
+			case <-handlerDone:
+			case <-r.Context().Done():
+				cancel()
+				return
+			}
+			w.WriteHeader(status)
+			_, _ = w.Write(sw.body.Bytes())
+		})
+	}
+}
+
+func (s *streamStore) resume(w http.ResponseWriter, r *http.Request, name, owner string, stream *sseStream, seq int) {
+	if stream == nil || stream.server != name || stream.owner != owner {
+		writeJSONError(w, http.StatusNotFound, "stream not found; it may have expired")
+		return
+	}
+	log.Printf("<%s> Resuming stream %s after event %d", name, stream.id, seq)
+	setSSEHeaders(w.Header())
+	w.WriteHeader(http.StatusOK)
+	stream.follow(w, r, seq)
+}
+
+func setSSEHeaders(header http.Header) {
+	header.Set("Content-Type", "text/event-stream")
+	header.Set("Cache-Control", "no-cache")
+	header.Set("Connection", "keep-alive")
+}
+
+// streamWriter is the ResponseWriter of a handler run apart from its
+// request. Event stream responses are split into events for the stream;
+// other responses are kept in body, and for requests answered with a
+// stream turned into an event when the handler returns.
+type streamWriter struct {
+	stream *sseStream
+	// requestID is set for requests answered with a stream from the start.
+	requestID json.RawMessage
+	ready     chan struct{}
+
+	mu          sync.Mutex
+	header      http.Header
+	sent        http.Header
+	status      int
+	wroteHeader bool
+	isStream    bool
+	body        bytes.Buffer
+	pending     []byte
+}
+
+func (w *streamWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *streamWriter) WriteHeader(status int) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writeHeaderLocked(status)
+}
+
+func (w *streamWriter) writeHeaderLocked(status int) {
+	if w.wroteHeader {
+		return
+	}
+	w.wroteHeader = true
+	w.status = status
+	w.sent = w.header.Clone()
+	w.isStream = strings.HasPrefix(w.sent.Get("Content-Type"), "text/event-stream")
+	close(w.ready)
+}
+
+func (w *streamWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writeHeaderLocked(http.StatusOK)
+	if !w.isStream {
+		return w.body.Write(p)
+	}
+	w.pending = bytes.ReplaceAll(append(w.pending, p...), []byte("\r\n"), []byte("\n"))
+	for {
+		block, rest, found := bytes.Cut(w.pending, []byte("\n\n"))
+		if !found {
+			break
+		}
+		if len(bytes.TrimSpace(block)) > 0 {
+			w.stream.add(block)
+		}
+		w.pending = rest
+	}
+	return len(p), nil
+}
+
+func (w *streamWriter) Flush() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.writeHeaderLocked(http.StatusOK)
+}
+
+func (w *streamWriter) response() (int, http.Header, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.status, w.sent, w.isStream
+}
+
+// finish ends the stream once the handler returned. A plain response to a
+// request that was answered with a stream becomes its last event: the
+// result as a message, or a JSON-RPC error for a failed request.
+func (w *streamWriter) finish() {
+	w.mu.Lock()
+	w.writeHeaderLocked(http.StatusOK)
+	switch {
+	case w.isStream:
+		if len(bytes.TrimSpace(w.pending)) > 0 {
+			w.stream.add(w.pending)
+		}
+	case w.requestID != nil:
+		var message bytes.Buffer
+		if w.status == http.StatusAccepted {
+			break
+		}
+		if w.status == http.StatusOK && json.Compact(&message, w.body.Bytes()) == nil {
+			w.stream.add(append([]byte("event: message\ndata: "), message.Bytes()...))
+			break
+		}
+		text := strings.TrimSpace(w.body.String())
+		if text == "" {
+			text = http.StatusText(w.status)
+		}
+		data, _ := json.Marshal(map[string]any{
+			"jsonrpc": "2.0",
+			"id":      w.requestID,
+			"error":   map[string]any{"code": -32603, "message": text},
+		})
+		w.stream.add(append([]byte("event: message\ndata: "), data...))
+	}
+	w.mu.Unlock()
+	w.stream.finish()
+}
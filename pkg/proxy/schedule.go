@@ -0,0 +1,204 @@
+package proxy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// schedule decides whether a server accepts calls at a given time. A server
+// is active when the current minute matches one of the enable expressions (or
+// there are none) and matches none of the disable expressions.
+type schedule struct {
+	enable   []*cronExpr
+	disable  []*cronExpr
+	location *time.Location
+}
+
+func newSchedule(conf *ScheduleConfig) (*schedule, error) {
+	s := &schedule{location: time.Local}
+	if conf.Timezone != "" {
+		location, err := time.LoadLocation(conf.Timezone)
+		if err != nil {
+			return nil, err
+		}
+		s.location = location
+	}
+	for _, spec := range conf.Enable {
+		expr, err := parseCronExpr(spec)
+		if err != nil {
+			return nil, err
+		}
+		s.enable = append(s.enable, expr)
+	}
+	for _, spec := range conf.Disable {
+		expr, err := parseCronExpr(spec)
+		if err != nil {
+			return nil, err
+		}
+		s.disable = append(s.disable, expr)
+	}
+	return s, nil
+}
+
+func (s *schedule) active(now time.Time) bool {
+	now = now.In(s.location)
+	enabled := len(s.enable) == 0
+	for _, expr := range s.enable {
+		if expr.matches(now) {
+			enabled = true
+			break
+		}
+	}
+	if !enabled {
+		return false
+	}
+	for _, expr := range s.disable {
+		if expr.matches(now) {
+			return false
+		}
+	}
+	return true
+}
+
+// scheduleLookahead bounds the search for the next active minute; schedules
+// repeat at least weekly in practice.
+const scheduleLookahead = 8 * 24 * time.Hour
+
+// nextActive returns the start of the next minute after now in which the
+// schedule is active, if there is one within scheduleLookahead.
+func (s *schedule) nextActive(now time.Time) (time.Time, bool) {
+	t := now.Truncate(time.Minute)
+	for end := now.Add(scheduleLookahead); t.Before(end); {
+		t = t.Add(time.Minute)
+		if s.active(t) {
+			return t, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// cronExpr is a standard five field cron expression:
+// minute hour day-of-month month day-of-week.
+type cronExpr struct {
+	minute, hour, dom, month, dow uint64
+	domAny, dowAny                bool
+}
+
+type cronField struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	cronMonthNames = map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}
+	cronDayNames = map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}
+	cronFields = []cronField{
+		{min: 0, max: 59},
+		{min: 0, max: 23},
+		{min: 1, max: 31},
+		{min: 1, max: 12, names: cronMonthNames},
+		{min: 0, max: 7, names: cronDayNames},
+	}
+)
+
+func parseCronExpr(spec string) (*cronExpr, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != len(cronFields) {
+		return nil, fmt.Errorf("cron expression %q must have 5 fields", spec)
+	}
+	var bits [5]uint64
+	for i, part := range parts {
+		b, err := parseCronField(part, cronFields[i])
+		if err != nil {
+			return nil, fmt.Errorf("cron expression %q: %w", spec, err)
+		}
+		bits[i] = b
+	}
+	// Sunday may be written as 0 or 7.
+	if bits[4]&(1<<7) != 0 {
+		bits[4] |= 1
+	}
+	return &cronExpr{
+		minute: bits[0],
+		hour:   bits[1],
+		dom:    bits[2],
+		month:  bits[3],
+		dow:    bits[4],
+		domAny: parts[2] == "*",
+		dowAny: parts[4] == "*",
+	}, nil
+}
+
+func parseCronField(field string, spec cronField) (uint64, error) {
+	var bits uint64
+	for item := range strings.SplitSeq(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(item, "/")
+		step := 1
+		if hasStep {
+			n, err := strconv.Atoi(stepPart)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("invalid step %q", stepPart)
+			}
+			step = n
+		}
+		start, end := spec.min, spec.max
+		if rangePart != "*" {
+			lo, hi, isRange := strings.Cut(rangePart, "-")
+			var err error
+			if start, err = parseCronValue(lo, spec); err != nil {
+				return 0, err
+			}
+			end = start
+			if isRange {
+				if end, err = parseCronValue(hi, spec); err != nil {
+					return 0, err
+				}
+			} else if hasStep {
+				end = spec.max
+			}
+			if start > end {
+				return 0, fmt.Errorf("invalid range %q", rangePart)
+			}
+		}
+		for v := start; v <= end; v += step {
+			bits |= 1 << uint(v)
+		}
+	}
+	return bits, nil
+}
+
+func parseCronValue(value string, spec cronField) (int, error) {
+	if n, ok := spec.names[strings.ToLower(value)]; ok {
+		return n, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	if n < spec.min || n > spec.max {
+		return 0, fmt.Errorf("value %d out of range", n)
+	}
+	return n, nil
+}
+
+func (e *cronExpr) matches(t time.Time) bool {
+	if e.minute&(1<<uint(t.Minute())) == 0 ||
+		e.hour&(1<<uint(t.Hour())) == 0 ||
+		e.month&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+	domMatch := e.dom&(1<<uint(t.Day())) != 0
+	dowMatch := e.dow&(1<<uint(t.Weekday())) != 0
+	// Like cron, when both day fields are restricted either may match.
+	if !e.domAny && !e.dowAny {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
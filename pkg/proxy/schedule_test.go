@@ -0,0 +1,147 @@
+package proxy
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronExprMatches(t *testing.T) {
+	// 2026-01-04 is a Sunday.
+	sunday := time.Date(2026, 1, 4, 9, 30, 0, 0, time.UTC)
+	monday := time.Date(2026, 1, 5, 9, 30, 0, 0, time.UTC)
+	tuesday := time.Date(2026, 1, 6, 9, 30, 0, 0, time.UTC)
+	firstOfFebruary := time.Date(2026, 2, 1, 9, 30, 0, 0, time.UTC)
+	tests := []struct {
+		spec string
+		at   time.Time
+		want bool
+	}{
+		{spec: "30 9 * * *", at: monday, want: true},
+		{spec: "31 9 * * *", at: monday, want: false},
+		{spec: "25-35 * * * *", at: monday, want: true},
+		{spec: "0-29 * * * *", at: monday, want: false},
+		{spec: "0,15,30,45 * * * *", at: monday, want: true},
+
+		{spec: "*/15 * * * *", at: monday, want: true},
+		{spec: "*/20 * * * *", at: monday, want: false},
+		{spec: "10/20 * * * *", at: monday, want: true},
+		{spec: "0-40/15 * * * *", at: monday, want: true},
+		{spec: "0-20/15 * * * *", at: monday, want: false},
+
+		{spec: "* * * jan *", at: monday, want: true},
+		{spec: "* * * FEB-dec *", at: monday, want: false},
+		{spec: "* 8-17 * * mon-fri", at: monday, want: true},
+		{spec: "* * * * sat,sun", at: monday, want: false},
+
+		{spec: "* * * * 0", at: sunday, want: true},
+		{spec: "* * * * 7", at: sunday, want: true},
+		{spec: "* * * * sun", at: sunday, want: true},
+		{spec: "* * * * 5-7", at: sunday, want: true},
+		{spec: "* * * * 1-6", at: sunday, want: false},
+
+		// When both day fields are restricted, either may match.
+		{spec: "* * 1 * mon", at: monday, want: true},
+		{spec: "* * 1 * mon", at: firstOfFebruary, want: true},
+		{spec: "* * 1 * mon", at: tuesday, want: false},
+		{spec: "* * 5 * sun", at: monday, want: true},
+		// Otherwise both must.
+		{spec: "* * 1 * *", at: monday, want: false},
+		{spec: "* * * * mon", at: tuesday, want: false},
+		{spec: "* * */2 * *", at: monday, want: true},
+		{spec: "* * */2 * *", at: sunday, want: false},
+	}
+	for _, tt := range tests {
+		expr, err := parseCronExpr(tt.spec)
+		if err != nil {
+			t.Fatalf("parseCronExpr(%q): %v", tt.spec, err)
+		}
+		if got := expr.matches(tt.at); got != tt.want {
+			t.Errorf("%q matches %s = %v, want %v", tt.spec, tt.at.Format("Mon 2006-01-02 15:04"), got, tt.want)
+		}
+	}
+}
+
+func TestParseCronExprErrors(t *testing.T) {
+	for _, spec := range []string{
+		"",
+		"* * * *",
+		"* * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"*/x * * * *",
+		"x * * * *",
+		"* * * foo *",
+		"* * * * mon-",
+	} {
+		if _, err := parseCronExpr(spec); err == nil {
+			t.Errorf("parseCronExpr(%q) succeeded", spec)
+		}
+	}
+}
+
+func TestScheduleActive(t *testing.T) {
+	s, err := newSchedule(&ScheduleConfig{
+		Enable:   []string{"* 9-17 * * mon-fri", "* 23 * * fri"},
+		Disable:  []string{"* 12 * * *"},
+		Timezone: "America/New_York",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name string
+		at   time.Time
+		want bool
+	}{
+		{name: "working hours", at: time.Date(2026, 1, 5, 14, 30, 0, 0, time.UTC), want: true},
+		{name: "disable wins over enable", at: time.Date(2026, 1, 5, 17, 30, 0, 0, time.UTC), want: false},
+		{name: "before working hours", at: time.Date(2026, 1, 5, 9, 30, 0, 0, time.UTC), want: false},
+		{name: "monday evening is tuesday in UTC", at: time.Date(2026, 1, 6, 3, 0, 0, 0, time.UTC), want: false},
+		{name: "friday night is saturday in UTC", at: time.Date(2026, 1, 10, 4, 30, 0, 0, time.UTC), want: true},
+		{name: "weekend", at: time.Date(2026, 1, 10, 15, 0, 0, 0, time.UTC), want: false},
+	}
+	for _, tt := range tests {
+		if got := s.active(tt.at); got != tt.want {
+			t.Errorf("%s: active(%s) = %v, want %v", tt.name, tt.at, got, tt.want)
+		}
+	}
+
+	onlyDisable, err := newSchedule(&ScheduleConfig{Disable: []string{"* * * * sat,sun"}, Timezone: "UTC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !onlyDisable.active(time.Date(2026, 1, 5, 3, 0, 0, 0, time.UTC)) {
+		t.Error("schedule without enable expressions is not active on a weekday")
+	}
+	if onlyDisable.active(time.Date(2026, 1, 4, 3, 0, 0, 0, time.UTC)) {
+		t.Error("schedule is active on a disabled day")
+	}
+
+	if _, err := newSchedule(&ScheduleConfig{Timezone: "Nowhere/Special"}); err == nil {
+		t.Error("newSchedule accepted an unknown timezone")
+	}
+}
+
+func TestScheduleNextActive(t *testing.T) {
+	s, err := newSchedule(&ScheduleConfig{Enable: []string{"0 9 * * mon"}, Timezone: "UTC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next, ok := s.nextActive(time.Date(2026, 1, 4, 10, 15, 30, 0, time.UTC))
+	if want := time.Date(2026, 1, 5, 9, 0, 0, 0, time.UTC); !ok || !next.Equal(want) {
+		t.Errorf("nextActive = %s, %v, want %s", next, ok, want)
+	}
+
+	never, err := newSchedule(&ScheduleConfig{Enable: []string{"* * 31 2 *"}, Timezone: "UTC"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next, ok := never.nextActive(time.Date(2026, 1, 4, 0, 0, 0, 0, time.UTC)); ok {
+		t.Errorf("nextActive = %s for a schedule that never matches", next)
+	}
+}
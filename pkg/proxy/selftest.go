@@ -0,0 +1,130 @@
+package proxy
+
+import (
+	"context"
+	"maps"
+	"slices"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// SelfTestResult is the outcome of testing one configured server.
+type SelfTestResult struct {
+	Server  string `json:"server"`
+	Skipped string `json:"skipped,omitempty"`
+	Error   string `json:"error,omitempty"`
+	// Step is the step that failed: preflight, connect, initialize,
+	// list_tools or call_tool.
+	Step  string `json:"step,omitempty"`
+	Tools int    `json:"tools"`
+	Tool  string `json:"tool,omitempty"`
+	// Timings of the steps; JSON reports them in milliseconds.
+	Connect     time.Duration `json:"-"`
+	ListTools   time.Duration `json:"-"`
+	CallTool    time.Duration `json:"-"`
+	ConnectMs   float64       `json:"connectMs"`
+	ListToolsMs float64       `json:"listToolsMs"`
+	CallToolMs  float64       `json:"callToolMs,omitempty"`
+}
+
+// Passed reports whether the server passed or was skipped.
+func (r *SelfTestResult) Passed() bool {
+	return r.Error == ""
+}
+
+// SelfTest connects to every enabled server of config in turn, lists its
+// tools and, when options.healthCheck names a tool, calls it. Each server
+// gets at most timeout. Nothing is served; the proxy's own listener is not
+// involved.
+func SelfTest(ctx context.Context, config *Config, timeout time.Duration) []SelfTestResult {
+	results := make([]SelfTestResult, 0, len(config.McpServers))
+	for _, name := range slices.Sorted(maps.Keys(config.McpServers)) {
+		clientConfig := config.McpServers[name]
+		result := SelfTestResult{Server: name}
+		switch {
+		case clientConfig.Options != nil && clientConfig.Options.Disabled:
+			result.Skipped = "disabled"
+		case clientConfig.Passthrough:
+			result.Skipped = "passthrough"
+		default:
+			serverCtx, cancel := context.WithTimeout(ctx, timeout)
+			selfTestServer(serverCtx, name, clientConfig, config.McpProxy, &result)
+			cancel()
+		}
+		result.ConnectMs = milliseconds(result.Connect)
+		result.ListToolsMs = milliseconds(result.ListTools)
+		result.CallToolMs = milliseconds(result.CallTool)
+		results = append(results, result)
+	}
+	return results
+}
+
+func selfTestServer(ctx context.Context, name string, clientConfig *MCPClientConfigV2, proxyConfig *MCPProxyConfigV2, result *SelfTestResult) {
+	fail := func(step string, err error) {
+		result.Step, result.Error = step, err.Error()
+	}
+	if _, err := preflight(ctx, name, clientConfig, proxyConfig.Preflight); err != nil {
+		fail("preflight", err)
+		return
+	}
+	start := time.Now()
+	var signer *upstreamSigner
+	var identity *workloadIdentity
+	var err error
+	if clientConfig.SignRequests {
+		if signer, err = newUpstreamSigner(proxyConfig.UpstreamSigning); err != nil {
+			fail("connect", err)
+			return
+		}
+	}
+	if clientConfig.MTLS != nil {
+		if identity, err = newWorkloadIdentity(proxyConfig.WorkloadIdentity); err != nil {
+			fail("connect", err)
+			return
+		}
+	}
+	c, err := newMCPClientForConfig(name, clientConfig, signer, identity)
+	if err != nil {
+		fail("connect", err)
+		return
+	}
+	defer func() { _ = c.Close() }()
+	c.clientInfo = mcp.Implementation{Name: proxyConfig.Name, Version: proxyConfig.Version}
+	if _, err = c.initialize(ctx, c.current()); err != nil {
+		fail("initialize", err)
+		return
+	}
+	result.Connect = time.Since(start)
+
+	start = time.Now()
+	request := mcp.ListToolsRequest{}
+	for {
+		tools, lErr := c.current().ListTools(ctx, request)
+		if lErr != nil {
+			fail("list_tools", lErr)
+			return
+		}
+		result.Tools += len(tools.Tools)
+		if tools.NextCursor == "" {
+			break
+		}
+		request.Params.Cursor = tools.NextCursor
+	}
+	result.ListTools = time.Since(start)
+
+	check := clientConfig.Options.HealthCheck
+	if check == nil || check.Tool == "" {
+		return
+	}
+	result.Tool = check.Tool
+	start = time.Now()
+	if err = c.checkHealth(ctx, c.current(), check); err != nil {
+		fail("call_tool", err)
+	}
+	result.CallTool = time.Since(start)
+}
+
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
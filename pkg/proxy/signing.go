@@ -0,0 +1,131 @@
+package proxy
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	signatureHeader          = "X-MCP-Signature"
+	signatureCallerHeader    = "X-MCP-Caller"
+	signatureTimestampHeader = "X-MCP-Timestamp"
+
+	defaultSignatureMaxSkew = 5 * time.Minute
+	maxSignedBodyBytes      = 10 << 20
+)
+
+// signatureVerifier authenticates requests signed with a per-caller shared
+// secret. The signature is the hex HMAC-SHA256 of
+//
+//	timestamp + "\n" + method + "\n" + request URI + "\n" + hex(sha256(body))
+//
+// and is accepted once, within maxSkew of the timestamp.
+type signatureVerifier struct {
+	callers map[string]*signatureCaller
+	maxSkew time.Duration
+
+	mu        sync.Mutex
+	seen      map[string]time.Time
+	lastPrune time.Time
+}
+
+type signatureCaller struct {
+	secret []byte
+	token  *AuthToken
+}
+
+func newSignatureVerifier(conf *HMACConfig) *signatureVerifier {
+	v := &signatureVerifier{
+		callers: make(map[string]*signatureCaller, len(conf.Callers)),
+		maxSkew: conf.MaxSkew,
+		seen:    make(map[string]time.Time),
+	}
+	if v.maxSkew <= 0 {
+		v.maxSkew = defaultSignatureMaxSkew
+	}
+	for _, caller := range conf.Callers {
+		v.callers[caller.ID] = &signatureCaller{
+			secret: []byte(caller.Secret),
+			token: &AuthToken{
+				Name:     caller.ID,
+				Servers:  caller.Servers,
+				Tools:    caller.Tools,
+				ReadOnly: caller.ReadOnly,
+			},
+		}
+	}
+	return v
+}
+
+// verify checks the signature headers of r. The body is read to compute
+// its hash and replaced so that the next handler can still consume it.
+func (v *signatureVerifier) verify(r *http.Request) (*AuthToken, bool) {
+	callerID := r.Header.Get(signatureCallerHeader)
+	caller, ok := v.callers[callerID]
+	if !ok {
+		return nil, false
+	}
+	timestamp := r.Header.Get(signatureTimestampHeader)
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return nil, false
+	}
+	now := time.Now()
+	signedAt := time.Unix(seconds, 0)
+	if signedAt.Before(now.Add(-v.maxSkew)) || signedAt.After(now.Add(v.maxSkew)) {
+		log.Printf("<auth> Rejected signature from %s: timestamp outside the allowed skew", callerID)
+		return nil, false
+	}
+	signature, err := hex.DecodeString(strings.TrimPrefix(r.Header.Get(signatureHeader), "sha256="))
+	if err != nil {
+		return nil, false
+	}
+
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxSignedBodyBytes+1))
+	if err != nil || len(body) > maxSignedBodyBytes {
+		return nil, false
+	}
+	_ = r.Body.Close()
+	r.Body = io.NopCloser(bytes.NewReader(body))
+
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, caller.secret)
+	mac.Write([]byte(timestamp + "\n" + r.Method + "\n" + r.URL.RequestURI() + "\n" + hex.EncodeToString(bodyHash[:])))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return nil, false
+	}
+	if !v.remember(callerID+":"+hex.EncodeToString(signature), signedAt.Add(v.maxSkew), now) {
+		log.Printf("<auth> Rejected replayed signature from %s", callerID)
+		return nil, false
+	}
+	return caller.token, true
+}
+
+// remember records a signature until it expires and reports whether it was
+// new. Expired entries are dropped at most once a minute.
+func (v *signatureVerifier) remember(key string, expires, now time.Time) bool {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	if now.Sub(v.lastPrune) > time.Minute {
+		for k, exp := range v.seen {
+			if now.After(exp) {
+				delete(v.seen, k)
+			}
+		}
+		v.lastPrune = now
+	}
+	if exp, ok := v.seen[key]; ok && !now.After(exp) {
+		return false
+	}
+	v.seen[key] = expires
+	return true
+}
@@ -0,0 +1,127 @@
+package proxy
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func signRequest(r *http.Request, caller, secret string, signedAt time.Time, body string) {
+	timestamp := strconv.FormatInt(signedAt.Unix(), 10)
+	bodyHash := sha256.Sum256([]byte(body))
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "\n" + r.Method + "\n" + r.URL.RequestURI() + "\n" + hex.EncodeToString(bodyHash[:])))
+	r.Header.Set(signatureCallerHeader, caller)
+	r.Header.Set(signatureTimestampHeader, timestamp)
+	r.Header.Set(signatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+}
+
+func TestSignatureVerifier(t *testing.T) {
+	const body = `{"jsonrpc":"2.0","id":1,"method":"tools/list"}`
+	now := time.Now()
+	tests := []struct {
+		name   string
+		modify func(r *http.Request)
+		want   bool
+	}{
+		{name: "valid", modify: func(r *http.Request) {}, want: true},
+		{name: "unknown caller", modify: func(r *http.Request) {
+			signRequest(r, "mallory", "s3cret", now, body)
+		}},
+		{name: "wrong secret", modify: func(r *http.Request) {
+			signRequest(r, "ci", "guess", now, body)
+		}},
+		{name: "tampered body", modify: func(r *http.Request) {
+			r.Body = io.NopCloser(strings.NewReader(strings.Replace(body, "list", "call", 1)))
+		}},
+		{name: "other path", modify: func(r *http.Request) {
+			r.URL.Path = "/other/mcp"
+		}},
+		{name: "other method", modify: func(r *http.Request) {
+			r.Method = http.MethodPut
+		}},
+		{name: "timestamp too old", modify: func(r *http.Request) {
+			signRequest(r, "ci", "s3cret", now.Add(-2*time.Minute), body)
+		}},
+		{name: "timestamp in the future", modify: func(r *http.Request) {
+			signRequest(r, "ci", "s3cret", now.Add(2*time.Minute), body)
+		}},
+		{name: "malformed signature", modify: func(r *http.Request) {
+			r.Header.Set(signatureHeader, "sha256=zz")
+		}},
+		{name: "missing timestamp", modify: func(r *http.Request) {
+			r.Header.Del(signatureTimestampHeader)
+		}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := newSignatureVerifier(&HMACConfig{
+				Callers: []HMACCallerConfig{{ID: "ci", Secret: "s3cret", Servers: []string{"github"}}},
+				MaxSkew: time.Minute,
+			})
+			r := httptest.NewRequest(http.MethodPost, "/github/mcp?x=1", strings.NewReader(body))
+			signRequest(r, "ci", "s3cret", now, body)
+			tt.modify(r)
+			token, ok := v.verify(r)
+			if ok != tt.want {
+				t.Fatalf("verify() = %v, want %v", ok, tt.want)
+			}
+			if !ok {
+				return
+			}
+			if token.Name != "ci" || !token.allowsServer("github") || token.allowsServer("slack") {
+				t.Errorf("verify() token = %+v, want the scoped token of ci", token)
+			}
+			if data, _ := io.ReadAll(r.Body); string(data) != body {
+				t.Errorf("body after verify = %q, want %q", data, body)
+			}
+		})
+	}
+}
+
+func TestSignatureVerifierReplay(t *testing.T) {
+	const body = `{}`
+	v := newSignatureVerifier(&HMACConfig{Callers: []HMACCallerConfig{{ID: "ci", Secret: "s3cret"}}})
+	now := time.Now()
+	first := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+	signRequest(first, "ci", "s3cret", now, body)
+	if _, ok := v.verify(first); !ok {
+		t.Fatal("first request rejected")
+	}
+	replay := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+	replay.Header = first.Header.Clone()
+	if _, ok := v.verify(replay); ok {
+		t.Error("replayed request accepted")
+	}
+	// A new timestamp makes a new signature for the same request.
+	again := httptest.NewRequest(http.MethodPost, "/mcp", strings.NewReader(body))
+	signRequest(again, "ci", "s3cret", now.Add(time.Second), body)
+	if _, ok := v.verify(again); !ok {
+		t.Error("request with a fresh signature rejected")
+	}
+}
+
+func TestSignatureVerifierRemember(t *testing.T) {
+	v := newSignatureVerifier(&HMACConfig{})
+	now := time.Unix(1000, 0)
+	if !v.remember("ci:a", now.Add(time.Minute), now) {
+		t.Fatal("new signature reported as seen")
+	}
+	if v.remember("ci:a", now.Add(time.Minute), now.Add(30*time.Second)) {
+		t.Error("signature accepted twice before it expired")
+	}
+	later := now.Add(2 * time.Minute)
+	if !v.remember("ci:a", later.Add(time.Minute), later) {
+		t.Error("expired signature not forgotten")
+	}
+	if _, ok := v.seen["ci:a"]; !ok || len(v.seen) != 1 {
+		t.Errorf("seen = %v, want only the renewed entry", v.seen)
+	}
+}
@@ -0,0 +1,113 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// slowCallLog records tool calls that took longer than their server's
+// options.slowCallThreshold. It is kept apart from the access log so slow
+// upstream tools can be found without wading through every request.
+type slowCallLog struct {
+	mu   sync.Mutex
+	file *os.File
+	// clients names the downstream client of each call; it may be nil.
+	clients *clientTracker
+}
+
+type slowCallEntry struct {
+	Time          time.Time `json:"time"`
+	Server        string    `json:"server"`
+	Tool          string    `json:"tool"`
+	DurationMs    float64   `json:"durationMs"`
+	ArgumentBytes int       `json:"argumentBytes"`
+	ResultBytes   int       `json:"resultBytes"`
+	Outcome       string    `json:"outcome"`
+	Client        string    `json:"client"`
+}
+
+// newSlowCallLog appends entries to file as JSON lines, or writes them to
+// the proxy's log when file is empty.
+func newSlowCallLog(file string) (*slowCallLog, error) {
+	l := &slowCallLog{}
+	if file == "" {
+		return l, nil
+	}
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, fmt.Errorf("open slow call log: %w", err)
+	}
+	l.file = f
+	log.Printf("Logging slow tool calls to %s", file)
+	return l, nil
+}
+
+// wrap logs the calls of next that take longer than threshold. A zero
+// threshold disables the log for the server.
+func (l *slowCallLog) wrap(threshold time.Duration, next ToolCallFunc) ToolCallFunc {
+	if threshold <= 0 {
+		return next
+	}
+	return func(ctx context.Context, server string, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+		start := time.Now()
+		result, err := next(ctx, server, request)
+		if elapsed := time.Since(start); elapsed >= threshold {
+			l.record(ctx, start, elapsed, server, request, result, err)
+		}
+		return result, err
+	}
+}
+
+func (l *slowCallLog) record(ctx context.Context, start time.Time, elapsed time.Duration, server string, request mcp.CallToolRequest, result *mcp.CallToolResult, err error) {
+	entry := slowCallEntry{
+		Time:          start,
+		Server:        server,
+		Tool:          request.Params.Name,
+		DurationMs:    milliseconds(elapsed),
+		ArgumentBytes: jsonSize(request.Params.Arguments),
+		Outcome:       callOutcome(server, result, err),
+		Client:        l.clients.fromContext(ctx).String(),
+	}
+	if result != nil {
+		entry.ResultBytes = jsonSize(result)
+	}
+	if l.file == nil {
+		log.Printf("<%s> Slow tool call %s from %s: %s, %d argument bytes, %d result bytes, %s",
+			server, entry.Tool, entry.Client, elapsed.Round(time.Millisecond), entry.ArgumentBytes, entry.ResultBytes, entry.Outcome)
+		return
+	}
+	line, mErr := json.Marshal(entry)
+	if mErr != nil {
+		return
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, wErr := l.file.Write(append(line, '\n')); wErr != nil {
+		log.Printf("<%s> Failed to write slow call log: %v", server, wErr)
+	}
+}
+
+// Close closes the log file, if any.
+func (l *slowCallLog) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
+}
+
+// jsonSize is the length of v encoded as JSON, or 0 when it cannot be
+// encoded.
+func jsonSize(v any) int {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return len(data)
+}
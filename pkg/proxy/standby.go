@@ -0,0 +1,116 @@
+package proxy
+
+import (
+	"context"
+	"log"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/client"
+)
+
+// standbyPool keeps a number of already initialized upstream processes
+// around so that a restart can swap one in instead of waiting for a slow
+// cold start (npx/uvx installs, interpreter startup and the like).
+type standbyPool struct {
+	name  string
+	size  int
+	spawn func(ctx context.Context) (*client.Client, error)
+
+	mu      sync.Mutex
+	ready   []*client.Client
+	filling bool
+	closed  bool
+}
+
+func newStandbyPool(name string, size int, spawn func(ctx context.Context) (*client.Client, error)) *standbyPool {
+	return &standbyPool{
+		name:  name,
+		size:  size,
+		spawn: spawn,
+	}
+}
+
+// fill starts processes until the pool is full. Only one fill runs at a
+// time; concurrent calls return immediately.
+func (p *standbyPool) fill(ctx context.Context) {
+	p.mu.Lock()
+	if p.filling || p.closed {
+		p.mu.Unlock()
+		return
+	}
+	p.filling = true
+	p.mu.Unlock()
+	defer func() {
+		p.mu.Lock()
+		p.filling = false
+		p.mu.Unlock()
+	}()
+
+	for {
+		p.mu.Lock()
+		need := !p.closed && len(p.ready) < p.size
+		p.mu.Unlock()
+		if !need {
+			return
+		}
+		mcpClient, err := p.spawn(ctx)
+		if err != nil {
+			log.Printf("<%s> Failed to start standby process: %v", p.name, err)
+			return
+		}
+		p.mu.Lock()
+		if p.closed {
+			p.mu.Unlock()
+			_ = mcpClient.Close()
+			return
+		}
+		p.ready = append(p.ready, mcpClient)
+		count := len(p.ready)
+		p.mu.Unlock()
+		log.Printf("<%s> Standby process ready (%d/%d)", p.name, count, p.size)
+	}
+}
+
+// take hands out a ready standby, skipping any that died while waiting, and
+// falls back to a cold start when none is left. The pool is refilled in the
+// background either way.
+func (p *standbyPool) take(ctx context.Context) (*client.Client, error) {
+	defer func() {
+		go p.fill(context.Background())
+	}()
+	for {
+		p.mu.Lock()
+		if len(p.ready) == 0 {
+			p.mu.Unlock()
+			break
+		}
+		mcpClient := p.ready[0]
+		p.ready = p.ready[1:]
+		p.mu.Unlock()
+		if err := mcpClient.Ping(ctx); err != nil {
+			log.Printf("<%s> Discarding dead standby process: %v", p.name, err)
+			_ = mcpClient.Close()
+			continue
+		}
+		return mcpClient, nil
+	}
+	log.Printf("<%s> No standby process available, starting a new one", p.name)
+	return p.spawn(ctx)
+}
+
+func (p *standbyPool) available() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.ready)
+}
+
+func (p *standbyPool) close() {
+	p.mu.Lock()
+	p.closed = true
+	ready := p.ready
+	p.ready = nil
+	p.mu.Unlock()
+	for _, mcpClient := range ready {
+		_ = mcpClient.Close()
+	}
+}
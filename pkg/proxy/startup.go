@@ -0,0 +1,171 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"maps"
+	"os/exec"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	defaultWaitForInterval = 2 * time.Second
+	defaultWaitForTimeout  = 2 * time.Minute
+)
+
+// serverStartup is the outcome of starting one server, which the servers
+// that depend on it wait for.
+type serverStartup struct {
+	done chan struct{}
+	err  error
+}
+
+type serverStartups map[string]*serverStartup
+
+func newServerStartups(names []string) serverStartups {
+	startups := make(serverStartups, len(names))
+	for _, name := range names {
+		startups[name] = &serverStartup{done: make(chan struct{})}
+	}
+	return startups
+}
+
+// finish records the outcome of starting name and releases its dependents.
+// It must be called exactly once per server.
+func (s serverStartups) finish(name string, err error) {
+	if startup, ok := s[name]; ok {
+		startup.err = err
+		close(startup.done)
+	}
+}
+
+var errServerDisabled = errors.New("server is disabled")
+
+// awaitDependencies blocks until the servers name depends on have started
+// and its waitFor command has succeeded. It fails as soon as one of the
+// dependencies failed to start. At startup the outcomes come from
+// startups; servers added at runtime require their dependencies to be up.
+func (p *Proxy) awaitDependencies(ctx context.Context, name string, conf *MCPClientConfigV2, startups serverStartups) error {
+	for _, dependency := range conf.DependsOn {
+		startup, ok := startups[dependency]
+		if !ok {
+			if !p.serverUp(dependency) {
+				return fmt.Errorf("dependency %s is not running", dependency)
+			}
+			continue
+		}
+		select {
+		case <-startup.done:
+		default:
+			log.Printf("<%s> Waiting for %s", name, dependency)
+			select {
+			case <-startup.done:
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		}
+		if startup.err != nil {
+			return fmt.Errorf("dependency %s failed to start: %w", dependency, startup.err)
+		}
+	}
+	if conf.WaitFor != nil {
+		return runWaitFor(ctx, name, conf.WaitFor)
+	}
+	return nil
+}
+
+// serverUp reports whether name is connected or mounted as passthrough.
+func (p *Proxy) serverUp(name string) bool {
+	if _, ok := p.registry.get(name); ok {
+		return true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	conf, ok := p.config.McpServers[name]
+	return ok && conf.Passthrough
+}
+
+// runWaitFor runs the waitFor command until it exits successfully or the
+// timeout expires.
+func runWaitFor(ctx context.Context, name string, conf *WaitForConfig) error {
+	interval := conf.Interval
+	if interval <= 0 {
+		interval = defaultWaitForInterval
+	}
+	timeout := conf.Timeout
+	if timeout <= 0 {
+		timeout = defaultWaitForTimeout
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+	log.Printf("<%s> Waiting for %s to succeed", name, strings.Join(conf.Command, " "))
+	for {
+		output, err := exec.CommandContext(ctx, conf.Command[0], conf.Command[1:]...).CombinedOutput()
+		if err == nil {
+			return nil
+		}
+		select {
+		case <-ctx.Done():
+			if len(output) > hookOutputLimit {
+				output = output[:hookOutputLimit]
+			}
+			return fmt.Errorf("waitFor did not succeed within %s: %w: %s", timeout, err, strings.TrimSpace(string(output)))
+		case <-time.After(interval):
+		}
+	}
+}
+
+// validateDependencies checks that dependsOn names enabled servers and
+// has no cycles.
+func validateDependencies(servers map[string]*MCPClientConfigV2) error {
+	for _, name := range slices.Sorted(maps.Keys(servers)) {
+		for _, dependency := range servers[name].DependsOn {
+			target, ok := servers[dependency]
+			switch {
+			case !ok:
+				return fmt.Errorf("mcpServers.%s: dependsOn names unknown server %s", name, dependency)
+			case target.Options != nil && target.Options.Disabled:
+				return fmt.Errorf("mcpServers.%s: dependsOn names disabled server %s", name, dependency)
+			}
+		}
+	}
+	// Depth-first search; a server met again while still on the path
+	// closes a cycle.
+	const (
+		unvisited = iota
+		visiting
+		visited
+	)
+	state := make(map[string]int, len(servers))
+	var path []string
+	var visit func(name string) error
+	visit = func(name string) error {
+		switch state[name] {
+		case visiting:
+			cycle := append(path[slices.Index(path, name):], name)
+			return fmt.Errorf("mcpServers: dependency cycle %s", strings.Join(cycle, " -> "))
+		case visited:
+			return nil
+		}
+		state[name] = visiting
+		path = append(path, name)
+		for _, dependency := range servers[name].DependsOn {
+			if err := visit(dependency); err != nil {
+				return err
+			}
+		}
+		path = path[:len(path)-1]
+		state[name] = visited
+		return nil
+	}
+	for _, name := range slices.Sorted(maps.Keys(servers)) {
+		if err := visit(name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,117 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+const maxStateBytes = 4 << 20
+
+// desiredState is the body of PUT /admin/state: every server the proxy
+// should run. serverTemplates may be sent along for them to use.
+type desiredState struct {
+	McpServers map[string]*MCPClientConfigV2 `json:"mcpServers"`
+}
+
+// stateResponse is the diff PUT /admin/state answers with.
+type stateResponse struct {
+	*configChanges
+	DryRun bool `json:"dryRun,omitempty"`
+}
+
+// handlePutState reconciles the running servers with a complete desired
+// set: servers missing from it are removed, new ones added and changed ones
+// reconnected. Putting the same state again changes nothing, so tools
+// such as Terraform can apply it on every run. With ?dryRun=true only the
+// diff is returned.
+func (a *adminServer) handlePutState(w http.ResponseWriter, r *http.Request) {
+	dryRun := false
+	if value := r.URL.Query().Get("dryRun"); value != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(value); err != nil {
+			writeJSONError(w, http.StatusBadRequest, "dryRun must be true or false")
+			return
+		}
+	}
+	data, err := io.ReadAll(io.LimitReader(r.Body, maxStateBytes+1))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if len(data) > maxStateBytes {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, "state is too large")
+		return
+	}
+	target, err := a.proxy.desiredConfig(data)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if dryRun {
+		writeJSON(w, http.StatusOK, stateResponse{configChanges: a.proxy.planConfig(target), DryRun: true})
+		return
+	}
+	result, err := a.proxy.applyConfig(r.Context(), target, "state applied via admin API")
+	if err != nil {
+		log.Printf("<admin> State was applied incompletely: %v", err)
+		writeJSON(w, http.StatusBadGateway, map[string]any{"error": err.Error(), "result": result})
+		return
+	}
+	writeJSON(w, http.StatusOK, stateResponse{configChanges: result})
+}
+
+// desiredConfig returns the running config with its servers replaced by
+// those of a desired state, checked like a loaded config.
+func (p *Proxy) desiredConfig(data []byte) (*Config, error) {
+	findings, err := unknownConfigKeys(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(findings) > 0 {
+		return nil, fmt.Errorf("invalid state:\n  %s", strings.Join(findings, "\n  "))
+	}
+	var keys map[string]json.RawMessage
+	if err = json.Unmarshal(data, &keys); err != nil {
+		return nil, err
+	}
+	for key := range keys {
+		if key != "mcpServers" && key != "serverTemplates" {
+			return nil, fmt.Errorf("unknown key %q: the state holds only mcpServers and serverTemplates", key)
+		}
+	}
+	if data, err = expandServerTemplates(data); err != nil {
+		return nil, err
+	}
+	var state desiredState
+	if err = json.Unmarshal(data, &state); err != nil {
+		return nil, err
+	}
+	if state.McpServers == nil {
+		return nil, errors.New("mcpServers is required; send {\"mcpServers\": {}} to remove every server")
+	}
+	// Round-trip so the target does not share state with the live config.
+	p.mu.Lock()
+	current, err := json.Marshal(p.config)
+	p.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	var target Config
+	if err = json.Unmarshal(current, &target); err != nil {
+		return nil, err
+	}
+	target.McpServers = state.McpServers
+	if err = target.Validate(); err != nil {
+		return nil, err
+	}
+	for _, clientConfig := range target.McpServers {
+		inheritOptions(clientConfig, target.McpProxy.Options)
+	}
+	return &target, nil
+}
@@ -0,0 +1,92 @@
+package proxy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+)
+
+// State files such as the API key store and the block list are rewritten
+// after every change. They are replaced atomically, so a crash mid-write
+// leaves the previous version in place, and the version before each write
+// is kept next to the file as <file>.bak to recover from a file damaged by
+// other means.
+
+// writeFileAtomic writes data to a temporary file in the directory of path
+// and renames it over path once it is synced.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if err != nil {
+			_ = os.Remove(tmp.Name())
+		}
+	}()
+	if _, err = tmp.Write(data); err == nil {
+		err = tmp.Chmod(perm)
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if cErr := tmp.Close(); err == nil {
+		err = cErr
+	}
+	if err != nil {
+		return err
+	}
+	err = os.Rename(tmp.Name(), path)
+	return err
+}
+
+// saveStateFile writes v as JSON to path, holding an exclusive lock on
+// <path>.lock so that processes sharing the file do not interleave writes.
+func saveStateFile(path string, v any) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	unlock, err := lockFile(path + ".lock")
+	if err != nil {
+		return fmt.Errorf("lock %s: %w", path, err)
+	}
+	defer unlock()
+	// A damaged file is not kept, so the backup it was recovered from stays.
+	backup := path + ".bak"
+	if current, rErr := os.ReadFile(path); rErr == nil && json.Valid(current) {
+		_ = os.Remove(backup)
+		if lErr := os.Link(path, backup); lErr != nil {
+			log.Printf("Warning: could not keep a backup of %s: %v", path, lErr)
+		}
+	}
+	return writeFileAtomic(path, data, 0o600)
+}
+
+// loadStateFile reads the JSON state at path into v. A missing file leaves v
+// untouched. When the file cannot be parsed, the backup written by the
+// previous save is used instead; without a usable backup loading fails
+// rather than silently starting from an empty state.
+func loadStateFile(path string, v any) error {
+	err := readJSONFile(path, v)
+	if err == nil || errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	backup := path + ".bak"
+	if bErr := readJSONFile(backup, v); bErr != nil {
+		return fmt.Errorf("invalid %s: %w", path, err)
+	}
+	log.Printf("Warning: %s is damaged (%v), recovered the previous version from %s", path, err, backup)
+	return nil
+}
+
+func readJSONFile(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,9 @@
+//go:build !unix
+
+package proxy
+
+// lockFile is a no-op where flock is not available; writes from one
+// process are still serialized by the stores' own mutexes.
+func lockFile(string) (func(), error) {
+	return func() {}, nil
+}
@@ -0,0 +1,151 @@
+package proxy
+
+import (
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io/fs"
+	"mime"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+var promptArgumentPattern = regexp.MustCompile(`\{\{\s*([A-Za-z_][A-Za-z0-9_]*)\s*\}\}`)
+
+// newStaticMCPServer builds an in-process MCP server that publishes the files
+// under conf.Root as resources and the markdown files under conf.Prompts as
+// prompts. Files are read on every request so edits show up without restart.
+func newStaticMCPServer(name string, conf *StaticMCPClientConfig) (*server.MCPServer, error) {
+	mcpServer := server.NewMCPServer(
+		name,
+		BuildVersion,
+		server.WithResourceCapabilities(false, false),
+		server.WithPromptCapabilities(false),
+		// The proxy always lists tools, so advertise an empty tool set.
+		server.WithToolCapabilities(false),
+	)
+	if conf.Root != "" {
+		if err := addStaticResources(name, conf.Root, mcpServer); err != nil {
+			return nil, err
+		}
+	}
+	if conf.Prompts != "" {
+		if err := addStaticPrompts(conf.Prompts, mcpServer); err != nil {
+			return nil, err
+		}
+	}
+	return mcpServer, nil
+}
+
+func addStaticResources(name, root string, mcpServer *server.MCPServer) error {
+	return filepath.WalkDir(root, func(filePath string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		rel, err := filepath.Rel(root, filePath)
+		if err != nil {
+			return err
+		}
+		uri := fmt.Sprintf("static://%s/%s", name, filepath.ToSlash(rel))
+		mimeType := staticMimeType(filePath)
+		resource := mcp.NewResource(uri, filepath.ToSlash(rel), mcp.WithMIMEType(mimeType))
+		mcpServer.AddResource(resource, func(ctx context.Context, request mcp.ReadResourceRequest) ([]mcp.ResourceContents, error) {
+			data, rErr := os.ReadFile(filePath)
+			if rErr != nil {
+				return nil, rErr
+			}
+			if isTextMimeType(mimeType) {
+				return []mcp.ResourceContents{mcp.TextResourceContents{
+					URI:      uri,
+					MIMEType: mimeType,
+					Text:     string(data),
+				}}, nil
+			}
+			return []mcp.ResourceContents{mcp.BlobResourceContents{
+				URI:      uri,
+				MIMEType: mimeType,
+				Blob:     base64.StdEncoding.EncodeToString(data),
+			}}, nil
+		})
+		return nil
+	})
+}
+
+func addStaticPrompts(dir string, mcpServer *server.MCPServer) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() || !strings.EqualFold(filepath.Ext(entry.Name()), ".md") {
+			continue
+		}
+		filePath := filepath.Join(dir, entry.Name())
+		data, rErr := os.ReadFile(filePath)
+		if rErr != nil {
+			return rErr
+		}
+		promptName := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		options := []mcp.PromptOption{mcp.WithPromptDescription(promptDescription(string(data)))}
+		seen := make(map[string]struct{})
+		for _, match := range promptArgumentPattern.FindAllStringSubmatch(string(data), -1) {
+			if _, ok := seen[match[1]]; ok {
+				continue
+			}
+			seen[match[1]] = struct{}{}
+			options = append(options, mcp.WithArgument(match[1]))
+		}
+		mcpServer.AddPrompt(mcp.NewPrompt(promptName, options...), func(ctx context.Context, request mcp.GetPromptRequest) (*mcp.GetPromptResult, error) {
+			content, gErr := os.ReadFile(filePath)
+			if gErr != nil {
+				return nil, gErr
+			}
+			text := promptArgumentPattern.ReplaceAllStringFunc(string(content), func(placeholder string) string {
+				key := promptArgumentPattern.FindStringSubmatch(placeholder)[1]
+				if value, ok := request.Params.Arguments[key]; ok {
+					return value
+				}
+				return placeholder
+			})
+			return mcp.NewGetPromptResult(
+				promptDescription(text),
+				[]mcp.PromptMessage{mcp.NewPromptMessage(mcp.RoleUser, mcp.NewTextContent(text))},
+			), nil
+		})
+	}
+	return nil
+}
+
+// promptDescription uses the first markdown heading (or first line) of a
+// prompt file as its description.
+func promptDescription(text string) string {
+	line, _, _ := strings.Cut(strings.TrimSpace(text), "\n")
+	return strings.TrimSpace(strings.TrimLeft(line, "# "))
+}
+
+func staticMimeType(filePath string) string {
+	switch strings.ToLower(filepath.Ext(filePath)) {
+	case ".md", ".markdown":
+		return "text/markdown"
+	}
+	if mimeType := mime.TypeByExtension(filepath.Ext(filePath)); mimeType != "" {
+		return mimeType
+	}
+	return "application/octet-stream"
+}
+
+func isTextMimeType(mimeType string) bool {
+	mediaType, _, _ := strings.Cut(mimeType, ";")
+	return strings.HasPrefix(mediaType, "text/") ||
+		mediaType == "application/json" ||
+		mediaType == "application/xml" ||
+		mediaType == "application/yaml"
+}
@@ -0,0 +1,195 @@
+package proxy
+
+import (
+	"fmt"
+	"log"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	statsdFlavorDogStatsD = "dogstatsd"
+	statsdFlavorStatsD    = "statsd"
+
+	defaultStatsdPrefix        = "mcp_proxy."
+	defaultStatsdFlushInterval = time.Second
+	// statsdMaxPacket keeps packets below the common Ethernet MTU, so
+	// they are not fragmented on the way to the agent.
+	statsdMaxPacket = 1432
+)
+
+// statsdEmitter is a metricsSink that sends every update to a statsd or
+// DogStatsD agent over UDP. Lines are buffered into packets and flushed
+// when a packet is full or every flush interval. Names drop the mcp_proxy_
+// prefix and _total suffix of the Prometheus names; durations are sent in
+// milliseconds.
+type statsdEmitter struct {
+	conf     StatsDConfig
+	conn     net.Conn
+	tags     string
+	interval time.Duration
+
+	mu     sync.Mutex
+	buffer []byte
+	failed bool
+
+	done chan struct{}
+}
+
+func newStatsdEmitter(conf *StatsDConfig) (*statsdEmitter, error) {
+	conn, err := net.Dial("udp", conf.Address)
+	if err != nil {
+		return nil, fmt.Errorf("statsd: %w", err)
+	}
+	e := &statsdEmitter{conf: *conf, conn: conn, interval: conf.FlushInterval, done: make(chan struct{})}
+	if e.conf.Flavor == "" {
+		e.conf.Flavor = statsdFlavorDogStatsD
+	}
+	if e.conf.Prefix == "" {
+		e.conf.Prefix = defaultStatsdPrefix
+	}
+	if e.interval <= 0 {
+		e.interval = defaultStatsdFlushInterval
+	}
+	names := make([]string, 0, len(conf.Tags))
+	for name := range conf.Tags {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		e.tags += "," + statsdTag(name) + ":" + statsdTag(conf.Tags[name])
+	}
+	go e.run()
+	log.Printf("Sending %s metrics to %s", e.conf.Flavor, conf.Address)
+	return e, nil
+}
+
+func (e *statsdEmitter) record(family *metricFamily, labelValues []string, value float64) {
+	name := strings.TrimSuffix(strings.TrimPrefix(family.name, "mcp_proxy_"), "_total")
+	var kind string
+	switch family.kind {
+	case "counter":
+		kind = "c"
+	case "gauge":
+		kind = "g"
+	default:
+		kind = "h"
+		if e.conf.Flavor == statsdFlavorStatsD {
+			kind = "ms"
+		}
+	}
+	if base, ok := strings.CutSuffix(name, "_seconds"); ok {
+		name, value = base+"_ms", value*1000
+	}
+
+	var line strings.Builder
+	line.WriteString(e.conf.Prefix)
+	line.WriteString(name)
+	var tags strings.Builder
+	for i, label := range family.labels {
+		if i >= len(labelValues) || labelValues[i] == "" {
+			continue
+		}
+		if renamed, ok := e.conf.TagNames[label]; ok {
+			label = renamed
+		}
+		if e.conf.Flavor == statsdFlavorStatsD {
+			line.WriteByte('.')
+			line.WriteString(statsdNameSegment(labelValues[i]))
+			continue
+		}
+		tags.WriteByte(',')
+		tags.WriteString(statsdTag(label))
+		tags.WriteByte(':')
+		tags.WriteString(statsdTag(labelValues[i]))
+	}
+	line.WriteByte(':')
+	line.WriteString(strconv.FormatFloat(value, 'f', -1, 64))
+	line.WriteByte('|')
+	line.WriteString(kind)
+	if e.conf.Flavor == statsdFlavorDogStatsD {
+		if all := tags.String() + e.tags; all != "" {
+			line.WriteString("|#")
+			line.WriteString(all[1:])
+		}
+	}
+	e.write(line.String())
+}
+
+// write appends a line to the current packet, sending it first when the
+// line does not fit.
+func (e *statsdEmitter) write(line string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if len(e.buffer) > 0 && len(e.buffer)+1+len(line) > statsdMaxPacket {
+		e.flushLocked()
+	}
+	if len(e.buffer) > 0 {
+		e.buffer = append(e.buffer, '\n')
+	}
+	e.buffer = append(e.buffer, line...)
+}
+
+// flushLocked sends the buffered packet. e.mu must be held. Send errors are
+// logged once until a send succeeds again, since a missing agent would
+// otherwise flood the log.
+func (e *statsdEmitter) flushLocked() {
+	if len(e.buffer) == 0 {
+		return
+	}
+	_, err := e.conn.Write(e.buffer)
+	e.buffer = e.buffer[:0]
+	if err != nil && !e.failed {
+		log.Printf("Failed to send metrics to %s: %v", e.conf.Address, err)
+	}
+	e.failed = err != nil
+}
+
+func (e *statsdEmitter) run() {
+	ticker := time.NewTicker(e.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			e.mu.Lock()
+			e.flushLocked()
+			e.mu.Unlock()
+		case <-e.done:
+			return
+		}
+	}
+}
+
+// Close sends what is buffered and closes the connection.
+func (e *statsdEmitter) Close() error {
+	if e == nil {
+		return nil
+	}
+	close(e.done)
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.flushLocked()
+	return e.conn.Close()
+}
+
+var statsdTagReplacer = strings.NewReplacer(",", "_", "|", "_", "#", "_", "\n", "_")
+
+// statsdTag replaces the characters DogStatsD reserves in tags.
+func statsdTag(s string) string {
+	return statsdTagReplacer.Replace(s)
+}
+
+// statsdNameSegment keeps a label value that becomes part of a plain statsd
+// metric name from adding segments or breaking the line format.
+func statsdNameSegment(s string) string {
+	return strings.Map(func(r rune) rune {
+		if r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' || r == '_' || r == '-' {
+			return r
+		}
+		return '_'
+	}, s)
+}
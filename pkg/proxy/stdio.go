@@ -0,0 +1,129 @@
+package proxy
+
+import (
+	"context"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/mark3labs/mcp-go/client/transport"
+)
+
+// stdioEnv returns the environment for a stdio server: the inherited part
+// of the proxy's environment, then proxy metadata, then the configured env,
+// with later entries taking precedence. extraPath is prepended to whatever
+// PATH results.
+func stdioEnv(name string, conf *StdioMCPClientConfig) []string {
+	env := make([]string, 0)
+	for _, kv := range os.Environ() {
+		key, _, _ := strings.Cut(kv, "=")
+		if inheritsEnv(conf.InheritEnv, key) && !matchEnvNames(conf.EnvDeny, key) {
+			env = append(env, kv)
+		}
+	}
+	env = append(env, "MCP_PROXY_SERVER_NAME="+name)
+	for k, v := range conf.Env {
+		env = append(env, k+"="+v)
+	}
+	if len(conf.ExtraPath) > 0 {
+		dirs := make([]string, 0, len(conf.ExtraPath)+1)
+		for _, dir := range conf.ExtraPath {
+			if !filepath.IsAbs(dir) && conf.Cwd != "" {
+				dir = filepath.Join(conf.Cwd, dir)
+			}
+			if abs, err := filepath.Abs(dir); err == nil {
+				dir = abs
+			}
+			dirs = append(dirs, dir)
+		}
+		if current := envValue(env, "PATH"); current != "" {
+			dirs = append(dirs, current)
+		}
+		env = append(env, "PATH="+strings.Join(dirs, string(os.PathListSeparator)))
+	}
+	return env
+}
+
+// envValue returns the effective value of key in env, i.e. its last entry.
+func envValue(env []string, key string) string {
+	for i := len(env) - 1; i >= 0; i-- {
+		if value, ok := strings.CutPrefix(env[i], key+"="); ok {
+			return value
+		}
+	}
+	return ""
+}
+
+// lookStdioCommand resolves a bare command name against the child's PATH
+// rather than the proxy's, so binaries from extraPath or a PATH set in env
+// are found. Anything it cannot resolve is returned unchanged for the usual
+// lookup.
+func lookStdioCommand(conf *StdioMCPClientConfig, env []string, command string) string {
+	if strings.ContainsRune(command, os.PathSeparator) || strings.ContainsRune(command, '/') {
+		if !filepath.IsAbs(command) && conf.Cwd != "" {
+			// Absolute, since exec would resolve a relative path against
+			// cmd.Dir a second time.
+			if abs, err := filepath.Abs(filepath.Join(conf.Cwd, command)); err == nil {
+				return abs
+			}
+		}
+		return command
+	}
+	for _, dir := range filepath.SplitList(envValue(env, "PATH")) {
+		if dir == "" {
+			continue
+		}
+		if path, err := exec.LookPath(filepath.Join(dir, command)); err == nil {
+			return path
+		}
+	}
+	return command
+}
+
+func inheritsEnv(inherit *EnvInheritance, key string) bool {
+	if inherit == nil {
+		return true
+	}
+	if inherit.Names != nil {
+		return matchEnvNames(inherit.Names, key)
+	}
+	return inherit.All
+}
+
+func matchEnvNames(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if prefix, ok := strings.CutSuffix(pattern, "*"); ok {
+			if strings.HasPrefix(key, prefix) {
+				return true
+			}
+		} else if pattern == key {
+			return true
+		}
+	}
+	return false
+}
+
+// stdioCommand builds a process the way a stdio server is run: with its
+// environment, PATH and working directory.
+func stdioCommand(ctx context.Context, name string, conf *StdioMCPClientConfig, command string, args []string) *exec.Cmd {
+	env := stdioEnv(name, conf)
+	cmd := exec.CommandContext(ctx, lookStdioCommand(conf, env, command), args...)
+	cmd.Env = env
+	cmd.Dir = conf.Cwd
+	return cmd
+}
+
+// newStdioCommandFunc builds the child process for a stdio server. The
+// environment is computed here rather than by the transport, which would
+// otherwise always pass the proxy's full environment through. A non-nil
+// gateway overrides the proxy variables, last so that env cannot undo it.
+func newStdioCommandFunc(name string, conf *StdioMCPClientConfig, gateway *egressGateway) transport.CommandFunc {
+	return func(ctx context.Context, command string, _ []string, args []string) (*exec.Cmd, error) {
+		cmd := stdioCommand(ctx, name, conf, command, args)
+		if gateway != nil {
+			cmd.Env = append(cmd.Env, gateway.env()...)
+		}
+		return cmd, nil
+	}
+}
@@ -0,0 +1,165 @@
+package proxy
+
+import (
+	"encoding/json"
+	"fmt"
+	"maps"
+	"reflect"
+	"slices"
+	"strings"
+)
+
+// commonConfigMistakes maps keys users often write to the ones the config
+// actually uses, where edit distance alone would not find them.
+var commonConfigMistakes = map[string]string{
+	"authToken":   "authTokens",
+	"token":       "authTokens",
+	"tokens":      "authTokens",
+	"servers":     "mcpServers",
+	"transport":   "transportType",
+	"environment": "env",
+}
+
+// unknownConfigKeys walks a raw JSON config alongside FullConfig and
+// returns one finding per key the config types do not declare, with its
+// path and a suggestion where a likely intended key exists.
+func unknownConfigKeys(data []byte) ([]string, error) {
+	var raw any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	var findings []string
+	checkConfigKeys("", reflect.TypeFor[FullConfig](), raw, &findings)
+	return findings, nil
+}
+
+func checkConfigKeys(path string, t reflect.Type, v any, findings *[]string) {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		object, ok := v.(map[string]any)
+		if !ok {
+			return
+		}
+		fields := jsonFields(t)
+		if len(fields) == 0 {
+			// Types such as optional.Field decode themselves from scalars.
+			return
+		}
+		for _, key := range slices.Sorted(maps.Keys(object)) {
+			field, ok := fields[key]
+			if !ok {
+				if key == "$schema" {
+					continue
+				}
+				*findings = append(*findings, unknownKeyFinding(joinConfigPath(path, key), key, fields))
+				continue
+			}
+			checkConfigKeys(joinConfigPath(path, key), field, object[key], findings)
+		}
+	case reflect.Map:
+		object, ok := v.(map[string]any)
+		if !ok {
+			return
+		}
+		for _, key := range slices.Sorted(maps.Keys(object)) {
+			checkConfigKeys(joinConfigPath(path, key), t.Elem(), object[key], findings)
+		}
+	case reflect.Slice, reflect.Array:
+		items, ok := v.([]any)
+		if !ok {
+			return
+		}
+		for i, item := range items {
+			checkConfigKeys(fmt.Sprintf("%s[%d]", path, i), t.Elem(), item, findings)
+		}
+	}
+}
+
+// jsonFields returns the JSON keys of a struct type, including those of
+// embedded structs that encoding/json flattens.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		tag := field.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name, _, _ := strings.Cut(tag, ",")
+		if field.Anonymous && name == "" {
+			embedded := field.Type
+			for embedded.Kind() == reflect.Pointer {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				for key, fieldType := range jsonFields(embedded) {
+					fields[key] = fieldType
+				}
+				continue
+			}
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		fields[name] = field.Type
+	}
+	return fields
+}
+
+func unknownKeyFinding(path, key string, fields map[string]reflect.Type) string {
+	if suggestion := suggestConfigKey(key, fields); suggestion != "" {
+		return fmt.Sprintf("unknown key %s, did you mean %q?", path, suggestion)
+	}
+	return fmt.Sprintf("unknown key %s", path)
+}
+
+func suggestConfigKey(key string, fields map[string]reflect.Type) string {
+	if fix, ok := commonConfigMistakes[key]; ok {
+		if _, exists := fields[fix]; exists {
+			return fix
+		}
+	}
+	best, bestDistance := "", 3
+	for _, candidate := range slices.Sorted(maps.Keys(fields)) {
+		if strings.EqualFold(candidate, key) {
+			return candidate
+		}
+		if d := editDistance(strings.ToLower(key), strings.ToLower(candidate)); d < bestDistance && d < len(candidate)/2 {
+			best, bestDistance = candidate, d
+		}
+	}
+	return best
+}
+
+func editDistance(a, b string) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+func joinConfigPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,98 @@
+package proxy
+
+import (
+	"slices"
+	"testing"
+)
+
+func TestUnknownConfigKeys(t *testing.T) {
+	tests := []struct {
+		name   string
+		config string
+		want   []string
+	}{
+		{
+			name: "known keys",
+			config: `{
+				"$schema": "https://example.com/schema.json",
+				"mcpProxy": {"addr": ":9090", "options": {"logEnabled": true, "authTokens": ["a", {"token": "b", "servers": ["github"]}]}},
+				"mcpServers": {"github": {"command": "npx", "args": ["-y"], "options": {"schedule": {"enable": ["* 9-17 * * mon-fri"]}}}}
+			}`,
+		},
+		{
+			name:   "typo",
+			config: `{"mcpProxy": {"adr": ":9090"}}`,
+			want:   []string{`unknown key mcpProxy.adr, did you mean "addr"?`},
+		},
+		{
+			name:   "common mistake",
+			config: `{"servers": {}}`,
+			want:   []string{`unknown key servers, did you mean "mcpServers"?`},
+		},
+		{
+			name:   "common mistake in a map value",
+			config: `{"mcpServers": {"github": {"options": {"authToken": ["a"]}}}}`,
+			want:   []string{`unknown key mcpServers.github.options.authToken, did you mean "authTokens"?`},
+		},
+		{
+			name:   "case",
+			config: `{"mcpServers": {"github": {"COMMAND": "npx"}}}`,
+			want:   []string{`unknown key mcpServers.github.COMMAND, did you mean "command"?`},
+		},
+		{
+			name:   "slice element",
+			config: `{"mcpProxy": {"options": {"authTokens": ["a", {"tokn": "b"}]}}}`,
+			want:   []string{`unknown key mcpProxy.options.authTokens[1].tokn, did you mean "token"?`},
+		},
+		{
+			name:   "no suggestion",
+			config: `{"mcpServers": {"github": {"xyzzy": 1, "args": []}}}`,
+			want:   []string{"unknown key mcpServers.github.xyzzy"},
+		},
+		{
+			name:   "sorted findings",
+			config: `{"mcpServers": {"b": {"zz": 1}, "a": {"zz": 1, "yy": 1}}}`,
+			want:   []string{"unknown key mcpServers.a.yy", "unknown key mcpServers.a.zz", "unknown key mcpServers.b.zz"},
+		},
+		{
+			name:   "value of the wrong type",
+			config: `{"mcpProxy": "not an object", "mcpServers": {"github": {"args": "x"}}}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := unknownConfigKeys([]byte(tt.config))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if _, err := unknownConfigKeys([]byte(`{"mcpProxy":`)); err == nil {
+		t.Error("unknownConfigKeys accepted invalid JSON")
+	}
+}
+
+func TestEditDistance(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want int
+	}{
+		{"", "", 0},
+		{"abc", "", 3},
+		{"", "abc", 3},
+		{"addr", "addr", 0},
+		{"adr", "addr", 1},
+		{"addr", "adr", 1},
+		{"flaw", "lawn", 2},
+		{"kitten", "sitting", 3},
+	}
+	for _, tt := range tests {
+		if got := editDistance(tt.a, tt.b); got != tt.want {
+			t.Errorf("editDistance(%q, %q) = %d, want %d", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"maps"
+	"slices"
+	"strings"
+	"text/template"
+)
+
+// expandServerTemplates replaces the mcpServers entries that name one of
+// serverTemplates with the template, merged with the entry's own fields and
+// with {{.var}} placeholders filled from the template's and the entry's
+// vars. It works on the raw config so that only the fields an entry sets
+// override the template. Configs without templated entries are returned
+// unchanged.
+func expandServerTemplates(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var raw map[string]any
+	if err := decoder.Decode(&raw); err != nil {
+		return nil, err
+	}
+	templates, _ := raw["serverTemplates"].(map[string]any)
+	servers, _ := raw["mcpServers"].(map[string]any)
+	expanded := false
+	for _, name := range slices.Sorted(maps.Keys(servers)) {
+		instance, ok := servers[name].(map[string]any)
+		if !ok {
+			continue
+		}
+		templateName, ok := instance["template"]
+		if !ok {
+			continue
+		}
+		server, err := instantiateTemplate(templates, templateName, instance)
+		if err != nil {
+			return nil, fmt.Errorf("mcpServers.%s: %w", name, err)
+		}
+		servers[name] = server
+		expanded = true
+	}
+	if !expanded {
+		return data, nil
+	}
+	return json.Marshal(raw)
+}
+
+func instantiateTemplate(templates map[string]any, templateName any, instance map[string]any) (map[string]any, error) {
+	name, ok := templateName.(string)
+	if !ok {
+		return nil, fmt.Errorf("template must be a string")
+	}
+	base, ok := templates[name].(map[string]any)
+	if !ok {
+		return nil, fmt.Errorf("unknown template %q", name)
+	}
+	vars := make(map[string]string)
+	for _, source := range []any{base["vars"], instance["vars"]} {
+		values, _ := source.(map[string]any)
+		for key, value := range values {
+			vars[key] = fmt.Sprint(value)
+		}
+	}
+	// Round-trip the template so the instance does not share maps with it.
+	data, err := json.Marshal(base)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var server map[string]any
+	if err = decoder.Decode(&server); err != nil {
+		return nil, err
+	}
+	mergeJSONObjects(server, instance)
+	delete(server, "template")
+	delete(server, "vars")
+	rendered, err := renderTemplateValue(server, vars)
+	if err != nil {
+		return nil, fmt.Errorf("template %s: %w", name, err)
+	}
+	return rendered.(map[string]any), nil
+}
+
+// mergeJSONObjects sets the fields of over on base, merging nested objects
+// and replacing everything else, arrays included.
+func mergeJSONObjects(base, over map[string]any) {
+	for key, value := range over {
+		if overObject, ok := value.(map[string]any); ok {
+			if baseObject, ok := base[key].(map[string]any); ok {
+				mergeJSONObjects(baseObject, overObject)
+				continue
+			}
+		}
+		base[key] = value
+	}
+}
+
+// renderTemplateValue fills the placeholders in every string of v. A
+// placeholder without a var fails, so a typo does not leave an empty token.
+func renderTemplateValue(v any, vars map[string]string) (any, error) {
+	switch value := v.(type) {
+	case string:
+		if !strings.Contains(value, "{{") {
+			return value, nil
+		}
+		tmpl, err := template.New("").Option("missingkey=error").Parse(value)
+		if err != nil {
+			return nil, err
+		}
+		var b strings.Builder
+		if err = tmpl.Execute(&b, vars); err != nil {
+			return nil, err
+		}
+		return b.String(), nil
+	case map[string]any:
+		for key, item := range value {
+			rendered, err := renderTemplateValue(item, vars)
+			if err != nil {
+				return nil, err
+			}
+			value[key] = rendered
+		}
+	case []any:
+		for i, item := range value {
+			rendered, err := renderTemplateValue(item, vars)
+			if err != nil {
+				return nil, err
+			}
+			value[i] = rendered
+		}
+	}
+	return v, nil
+}
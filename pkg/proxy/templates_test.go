@@ -0,0 +1,135 @@
+package proxy
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestExpandServerTemplates(t *testing.T) {
+	const templates = `"serverTemplates": {
+		"github": {
+			"command": "npx",
+			"args": ["-y", "github-mcp"],
+			"env": {"TOKEN": "{{.token}}", "ORG": "{{.org}}"},
+			"vars": {"org": "acme"},
+			"options": {"logEnabled": true, "toolFilter": {"mode": "allow", "list": ["search"]}}
+		},
+		"remote": {"url": "http://localhost:{{.port}}/mcp", "vars": {"port": 8080}, "options": {"standby": 2}}
+	}`
+	tests := []struct {
+		name   string
+		config string
+		// want is the expanded mcpServers.
+		want    string
+		wantErr string
+	}{
+		{
+			name:   "vars",
+			config: `{` + templates + `, "mcpServers": {"work": {"template": "github", "vars": {"token": "t1"}}}}`,
+			want: `{"work": {
+				"command": "npx", "args": ["-y", "github-mcp"],
+				"env": {"TOKEN": "t1", "ORG": "acme"},
+				"options": {"logEnabled": true, "toolFilter": {"mode": "allow", "list": ["search"]}}
+			}}`,
+		},
+		{
+			name: "instance overrides",
+			config: `{` + templates + `, "mcpServers": {"personal": {
+				"template": "github",
+				"vars": {"token": "t2", "org": "me"},
+				"args": ["github-mcp"],
+				"options": {"toolFilter": {"list": ["issues"]}}
+			}}}`,
+			want: `{"personal": {
+				"command": "npx", "args": ["github-mcp"],
+				"env": {"TOKEN": "t2", "ORG": "me"},
+				"options": {"logEnabled": true, "toolFilter": {"mode": "allow", "list": ["issues"]}}
+			}}`,
+		},
+		{
+			name:   "numbers",
+			config: `{` + templates + `, "mcpServers": {"local": {"template": "remote"}, "other": {"template": "remote", "vars": {"port": 9090}}}}`,
+			want: `{
+				"local": {"url": "http://localhost:8080/mcp", "options": {"standby": 2}},
+				"other": {"url": "http://localhost:9090/mcp", "options": {"standby": 2}}
+			}`,
+		},
+		{
+			name:   "entries without a template",
+			config: `{` + templates + `, "mcpServers": {"work": {"template": "github", "vars": {"token": "t1"}}, "plain": {"command": "{{.token}}"}}}`,
+			want: `{
+				"work": {"command": "npx", "args": ["-y", "github-mcp"], "env": {"TOKEN": "t1", "ORG": "acme"}, "options": {"logEnabled": true, "toolFilter": {"mode": "allow", "list": ["search"]}}},
+				"plain": {"command": "{{.token}}"}
+			}`,
+		},
+		{
+			name:    "unknown template",
+			config:  `{` + templates + `, "mcpServers": {"work": {"template": "gitlab"}}}`,
+			wantErr: `mcpServers.work: unknown template "gitlab"`,
+		},
+		{
+			name:    "template name not a string",
+			config:  `{` + templates + `, "mcpServers": {"work": {"template": 1}}}`,
+			wantErr: "mcpServers.work: template must be a string",
+		},
+		{
+			name:    "missing var",
+			config:  `{` + templates + `, "mcpServers": {"work": {"template": "github"}}}`,
+			wantErr: `mcpServers.work: template github: `,
+		},
+		{
+			name:    "invalid placeholder",
+			config:  `{` + templates + `, "mcpServers": {"work": {"template": "remote", "url": "{{.port"}}}`,
+			wantErr: "mcpServers.work: template remote: ",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data, err := expandServerTemplates([]byte(tt.config))
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("got error %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got struct {
+				McpServers      map[string]any `json:"mcpServers"`
+				ServerTemplates map[string]any `json:"serverTemplates"`
+			}
+			if err = json.Unmarshal(data, &got); err != nil {
+				t.Fatal(err)
+			}
+			var want map[string]any
+			if err = json.Unmarshal([]byte(tt.want), &want); err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got.McpServers, want) {
+				t.Errorf("got %v, want %v", got.McpServers, want)
+			}
+			// Instances must not share maps with the template.
+			github := got.ServerTemplates["github"].(map[string]any)
+			if env := github["env"].(map[string]any); env["TOKEN"] != "{{.token}}" {
+				t.Errorf("template was modified: %v", github)
+			}
+		})
+	}
+}
+
+func TestExpandServerTemplatesUnchanged(t *testing.T) {
+	config := []byte(`{"mcpServers": {"plain": {"command": "{{.token}}"}},   "serverTemplates": {}}`)
+	data, err := expandServerTemplates(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != string(config) {
+		t.Errorf("got %s, want the config unchanged", data)
+	}
+	if _, err = expandServerTemplates([]byte(`{"mcpServers":`)); err == nil {
+		t.Error("expandServerTemplates accepted invalid JSON")
+	}
+}
@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"context"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// toolRanking remembers when each tool of a route was last called, so a
+// capped tool listing can keep the tools clients actually use.
+type toolRanking struct {
+	mu         sync.Mutex
+	lastCalled map[string]time.Time
+}
+
+// toolCapOptions limits the tools a route lists to conf.Limit, either by
+// paginating tools/list or by listing only the most recently called tools.
+// Tools left out of a ranked listing can still be called, which ranks them
+// up. The options must come after any other tool filter, so that the cap
+// applies to the tools the client would otherwise see.
+func toolCapOptions(conf *ToolCapConfig) []server.ServerOption {
+	if conf == nil || conf.Limit <= 0 {
+		return nil
+	}
+	if conf.Mode != ToolCapModeRank {
+		// Prompts and resources are paginated alike, as mcp-go applies one
+		// limit to every listing.
+		return []server.ServerOption{server.WithPaginationLimit(conf.Limit)}
+	}
+	ranking := &toolRanking{lastCalled: make(map[string]time.Time)}
+	return []server.ServerOption{
+		server.WithToolFilter(func(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+			return ranking.top(tools, conf.Limit)
+		}),
+		server.WithToolHandlerMiddleware(func(next server.ToolHandlerFunc) server.ToolHandlerFunc {
+			return func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+				ranking.called(request.Params.Name)
+				return next(ctx, request)
+			}
+		}),
+	}
+}
+
+func (r *toolRanking) called(name string) {
+	r.mu.Lock()
+	r.lastCalled[name] = time.Now()
+	r.mu.Unlock()
+}
+
+// top returns the limit most recently called of tools, most recent first.
+// Tools never called keep their order after those that were.
+func (r *toolRanking) top(tools []mcp.Tool, limit int) []mcp.Tool {
+	if len(tools) <= limit {
+		return tools
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	ranked := slices.Clone(tools)
+	slices.SortStableFunc(ranked, func(a, b mcp.Tool) int {
+		return r.lastCalled[b.Name].Compare(r.lastCalled[a.Name])
+	})
+	return ranked[:limit]
+}
@@ -0,0 +1,419 @@
+package proxy
+
+import (
+	"bytes"
+	"cmp"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"path"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+const (
+	// toolSearchRoute is where tool search is served: the JSON endpoint at
+	// /search and the meta-tools at /search/mcp or /search/sse.
+	toolSearchRoute        = "search"
+	defaultToolSearchLimit = 10
+	maxToolSearchLimit     = 50
+	// maxCachedEmbeddings bounds the embeddings kept for tool texts; the
+	// cache starts over when it is exceeded.
+	maxCachedEmbeddings = 10000
+	embeddingsTimeout   = 30 * time.Second
+)
+
+// toolSearch finds the tools of the connected upstreams that match a
+// free-text query, so agents can discover tools on demand instead of being
+// handed the whole catalog. It ranks with BM25 over server names, tool
+// names and descriptions, or by embedding similarity when an embeddings
+// provider is configured.
+type toolSearch struct {
+	registry   *clientRegistry
+	embeddings *embeddingsClient
+}
+
+// toolSearchResult is one match of a search.
+type toolSearchResult struct {
+	Server      string  `json:"server"`
+	Tool        string  `json:"tool"`
+	Description string  `json:"description,omitempty"`
+	Score       float64 `json:"score"`
+	InputSchema any     `json:"inputSchema"`
+}
+
+type searchableTool struct {
+	server string
+	tool   mcp.Tool
+	text   string
+}
+
+func newToolSearch(conf *ToolSearchConfig, registry *clientRegistry) *toolSearch {
+	s := &toolSearch{registry: registry}
+	if conf.Embeddings != nil {
+		s.embeddings = &embeddingsClient{
+			conf:   conf.Embeddings,
+			client: &http.Client{Timeout: embeddingsTimeout},
+			cache:  make(map[string][]float64),
+		}
+	}
+	return s
+}
+
+// candidates are the tools the request may see and call: those of servers
+// that would accept its credentials and are not under maintenance.
+func (s *toolSearch) candidates(ctx context.Context) []searchableTool {
+	var tools []searchableTool
+	for _, name := range s.registry.names() {
+		c, ok := s.registry.get(name)
+		if !ok || c.maintenance.Load() || !s.registry.accepts(name, authTokenFromContext(ctx)) {
+			continue
+		}
+		for _, tool := range visibleTools(ctx, name, c) {
+			tools = append(tools, searchableTool{
+				server: name,
+				tool:   tool,
+				text:   name + " " + tool.Name + " " + tool.Name + " " + tool.Description,
+			})
+		}
+	}
+	return tools
+}
+
+// search returns up to limit tools matching query, best first.
+func (s *toolSearch) search(ctx context.Context, query string, limit int) []toolSearchResult {
+	tools := s.candidates(ctx)
+	if len(tools) == 0 {
+		return make([]toolSearchResult, 0)
+	}
+	texts := make([]string, len(tools))
+	for i, tool := range tools {
+		texts[i] = tool.text
+	}
+	var scores []float64
+	if s.embeddings != nil {
+		var err error
+		scores, err = s.embeddings.similarities(ctx, query, texts)
+		if err != nil {
+			log.Printf("<%s> Embeddings failed, falling back to BM25: %v", toolSearchRoute, err)
+			scores = nil
+		}
+	}
+	if scores == nil {
+		scores = bm25Scores(query, texts)
+	}
+	results := make([]toolSearchResult, 0)
+	for i, tool := range tools {
+		if scores[i] <= 0 {
+			continue
+		}
+		results = append(results, toolSearchResult{
+			Server:      tool.server,
+			Tool:        tool.tool.Name,
+			Description: tool.tool.Description,
+			Score:       math.Round(scores[i]*1000) / 1000,
+			InputSchema: toolInputSchema(tool.tool),
+		})
+	}
+	slices.SortStableFunc(results, func(a, b toolSearchResult) int {
+		return cmp.Compare(b.Score, a.Score)
+	})
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	return results
+}
+
+// searchTerms lowercases text and splits it into words, breaking up
+// snake_case, kebab-case and camelCase identifiers.
+func searchTerms(text string) []string {
+	var terms []string
+	var word []rune
+	flush := func() {
+		if len(word) > 1 {
+			terms = append(terms, strings.ToLower(string(word)))
+		}
+		word = word[:0]
+	}
+	runes := []rune(text)
+	for i, r := range runes {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+			flush()
+			continue
+		}
+		if unicode.IsUpper(r) && i > 0 && unicode.IsLower(runes[i-1]) {
+			flush()
+		}
+		word = append(word, r)
+	}
+	flush()
+	return terms
+}
+
+// bm25Scores scores each document against query with Okapi BM25.
+func bm25Scores(query string, documents []string) []float64 {
+	const k1, b = 1.2, 0.75
+	scores := make([]float64, len(documents))
+	if len(documents) == 0 {
+		return scores
+	}
+	frequencies := make([]map[string]int, len(documents))
+	lengths := make([]int, len(documents))
+	documentFrequency := make(map[string]int)
+	total := 0
+	for i, document := range documents {
+		frequencies[i] = make(map[string]int)
+		for _, term := range searchTerms(document) {
+			if frequencies[i][term] == 0 {
+				documentFrequency[term]++
+			}
+			frequencies[i][term]++
+			lengths[i]++
+		}
+		total += lengths[i]
+	}
+	averageLength := math.Max(float64(total)/float64(len(documents)), 1)
+	n := float64(len(documents))
+	for _, term := range slices.Compact(slices.Sorted(slices.Values(searchTerms(query)))) {
+		df := float64(documentFrequency[term])
+		if df == 0 {
+			continue
+		}
+		idf := math.Log(1 + (n-df+0.5)/(df+0.5))
+		for i := range documents {
+			tf := float64(frequencies[i][term])
+			if tf == 0 {
+				continue
+			}
+			scores[i] += idf * tf * (k1 + 1) / (tf + k1*(1-b+b*float64(lengths[i])/averageLength))
+		}
+	}
+	return scores
+}
+
+// embeddingsClient computes embeddings through an OpenAI compatible
+// /embeddings endpoint and caches those of tool texts.
+type embeddingsClient struct {
+	conf   *EmbeddingsConfig
+	client *http.Client
+	mu     sync.Mutex
+	cache  map[string][]float64
+}
+
+// similarities returns the cosine similarity of query to each text.
+func (e *embeddingsClient) similarities(ctx context.Context, query string, texts []string) ([]float64, error) {
+	// missing lists the query and the texts without a cached embedding;
+	// position maps them to their index.
+	missing := []string{query}
+	position := map[string]int{query: 0}
+	e.mu.Lock()
+	for _, text := range texts {
+		if _, cached := e.cache[text]; cached {
+			continue
+		}
+		if _, listed := position[text]; !listed {
+			position[text] = len(missing)
+			missing = append(missing, text)
+		}
+	}
+	e.mu.Unlock()
+	vectors, err := e.embed(ctx, missing)
+	if err != nil {
+		return nil, err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	scores := make([]float64, len(texts))
+	for i, text := range texts {
+		vector := e.cache[text]
+		if index, listed := position[text]; listed {
+			vector = vectors[index]
+		}
+		scores[i] = cosine(vectors[0], vector)
+	}
+	if len(e.cache)+len(missing) > maxCachedEmbeddings {
+		e.cache = make(map[string][]float64)
+	}
+	for i, text := range missing[1:] {
+		e.cache[text] = vectors[i+1]
+	}
+	return scores, nil
+}
+
+func (e *embeddingsClient) embed(ctx context.Context, inputs []string) ([][]float64, error) {
+	body, err := json.Marshal(map[string]any{"model": e.conf.Model, "input": inputs})
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.conf.URL, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if e.conf.APIKey != "" {
+		req.Header.Set("Authorization", "Bearer "+e.conf.APIKey)
+	}
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("embeddings provider answered %s", resp.Status)
+	}
+	var decoded struct {
+		Data []struct {
+			Index     int       `json:"index"`
+			Embedding []float64 `json:"embedding"`
+		} `json:"data"`
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&decoded); err != nil {
+		return nil, fmt.Errorf("invalid embeddings response: %w", err)
+	}
+	vectors := make([][]float64, len(inputs))
+	for _, item := range decoded.Data {
+		if item.Index >= 0 && item.Index < len(vectors) {
+			vectors[item.Index] = item.Embedding
+		}
+	}
+	if slices.ContainsFunc(vectors, func(vector []float64) bool { return len(vector) == 0 }) {
+		return nil, errors.New("embeddings response is missing inputs")
+	}
+	return vectors, nil
+}
+
+func cosine(a, b []float64) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+	var dot, normA, normB float64
+	for i := range a {
+		dot += a[i] * b[i]
+		normA += a[i] * a[i]
+		normB += b[i] * b[i]
+	}
+	if normA == 0 || normB == 0 {
+		return 0
+	}
+	return dot / math.Sqrt(normA*normB)
+}
+
+// searchLimit parses the limit parameter of a search, defaulting to
+// defaultToolSearchLimit and capped at maxToolSearchLimit.
+func searchLimit(value string) (int, error) {
+	if value == "" {
+		return defaultToolSearchLimit, nil
+	}
+	limit, err := strconv.Atoi(value)
+	if err != nil || limit <= 0 {
+		return 0, errors.New("limit must be a positive integer")
+	}
+	return min(limit, maxToolSearchLimit), nil
+}
+
+func (s *toolSearch) handleSearch(w http.ResponseWriter, r *http.Request) {
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+	if query == "" {
+		writeJSONError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+	limit, err := searchLimit(r.URL.Query().Get("limit"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, map[string]any{"query": query, "results": s.search(r.Context(), query, limit)})
+}
+
+// handleSearchTool is the search_tools meta-tool.
+func (s *toolSearch) handleSearchTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	query, err := request.RequireString("query")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	limit := defaultToolSearchLimit
+	if value := request.GetInt("limit", 0); value > 0 {
+		limit = min(value, maxToolSearchLimit)
+	}
+	results := s.search(ctx, query, limit)
+	if len(results) == 0 {
+		return mcp.NewToolResultText("No matching tools."), nil
+	}
+	data, err := json.MarshalIndent(results, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return mcp.NewToolResultText(string(data)), nil
+}
+
+// handleCallTool is the call_tool meta-tool, which calls a tool found with
+// search_tools under the same credential and scope checks as the tool's
+// own server route. The call does not pass through that route, so it runs
+// under the search route's ipFilter and limits rather than the server's,
+// like the tools of virtual servers.
+func (s *toolSearch) handleCallTool(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+	serverName, err := request.RequireString("server")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	toolName, err := request.RequireString("tool")
+	if err != nil {
+		return mcp.NewToolResultError(err.Error()), nil
+	}
+	upstream, ok := s.registry.get(serverName)
+	if !ok || !s.registry.accepts(serverName, authTokenFromContext(ctx)) {
+		return mcp.NewToolResultError("unknown server " + serverName), nil
+	}
+	if !slices.ContainsFunc(visibleTools(ctx, serverName, upstream), func(tool mcp.Tool) bool { return tool.Name == toolName }) {
+		return mcp.NewToolResultError(fmt.Sprintf("unknown tool %s on server %s", toolName, serverName)), nil
+	}
+	forwarded := mcp.CallToolRequest{}
+	forwarded.Params.Name = toolName
+	if arguments, ok := request.GetArguments()["arguments"].(map[string]any); ok {
+		forwarded.Params.Arguments = arguments
+	}
+	return translateToolErrors(serverName, upstream.callTool)(ctx, forwarded)
+}
+
+// mountToolSearch serves tool search at /search and, with conf.MetaTool,
+// the search_tools and call_tool meta-tools at /search/mcp or /search/sse.
+func mountToolSearch(conf *ToolSearchConfig, proxyConfig *MCPProxyConfigV2, registry *clientRegistry, sources *authSources, clients *clientTracker, basePath string, mux *http.ServeMux, routes *routeTable) error {
+	search := newToolSearch(conf, registry)
+	middlewares := newServerMiddlewares(toolSearchRoute, conf.Options, sources)
+	mux.Handle("GET "+path.Join("/", basePath, toolSearchRoute), chainMiddleware(http.HandlerFunc(search.handleSearch), middlewares...))
+	log.Printf("<%s> Tool search enabled at %s", toolSearchRoute, path.Join("/", basePath, toolSearchRoute))
+	if !conf.MetaTool {
+		return nil
+	}
+	srv, err := newMCPServer(toolSearchRoute, proxyConfig, &MCPClientConfigV2{Options: conf.Options}, clients.serverOption(toolSearchRoute))
+	if err != nil {
+		return err
+	}
+	srv.mcpServer.AddTool(mcp.NewTool("search_tools",
+		mcp.WithDescription("Searches the tools of every server behind this proxy by what they do, and returns the best matches with their server and input schema. Call a match with call_tool."),
+		mcp.WithString("query", mcp.Required(), mcp.Description("What the tool should do, e.g. \"create a github issue\"")),
+		mcp.WithNumber("limit", mcp.Description(fmt.Sprintf("Maximum number of matches, %d by default", defaultToolSearchLimit)), mcp.Min(1), mcp.Max(maxToolSearchLimit)),
+		mcp.WithReadOnlyHintAnnotation(true),
+		mcp.WithOpenWorldHintAnnotation(false),
+	), search.handleSearchTool)
+	srv.mcpServer.AddTool(mcp.NewTool("call_tool",
+		mcp.WithDescription("Calls a tool found with search_tools."),
+		mcp.WithString("server", mcp.Required(), mcp.Description("Server of the tool, as returned by search_tools")),
+		mcp.WithString("tool", mcp.Required(), mcp.Description("Name of the tool")),
+		mcp.WithObject("arguments", mcp.Description("Arguments matching the tool's input schema")),
+	), search.handleCallTool)
+	mcpRoute := mcpRoutePath(basePath, toolSearchRoute)
+	log.Printf("<%s> Handling requests at %s", toolSearchRoute, mcpRoute)
+	routes.Handle(mcpRoute, chainMiddleware(srv.handler, middlewares...))
+	return nil
+}
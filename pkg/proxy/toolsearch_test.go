@@ -0,0 +1,79 @@
+package proxy
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+func TestToolSearchServerAuth(t *testing.T) {
+	sources := &authSources{blocks: &blockList{entries: []*blockEntry{{Kind: blockKindUser, Value: "mallory"}}}}
+	tokens := []AuthToken{{Token: "alice", Name: "alice"}, {Token: "mallory", Name: "mallory"}}
+	registry := newClientRegistry()
+	registry.add("github", newTestClient(t, "github"), newRouteAuth("github", tokens, sources))
+	registry.add("private", newTestClient(t, "private"), newRouteAuth("private", []AuthToken{{Token: "other"}}, sources))
+	search := newToolSearch(&ToolSearchConfig{Options: &OptionsV2{}}, registry)
+
+	tests := []struct {
+		name        string
+		token       *AuthToken
+		server      string
+		wantReached bool
+	}{
+		{name: "accepted", token: &tokens[0], server: "github", wantReached: true},
+		{name: "blocked identity", token: &tokens[1], server: "github"},
+		{name: "server with other tokens", token: &tokens[0], server: "private"},
+		{name: "no credentials", server: "github"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			if tt.token != nil {
+				ctx = withAuthToken(ctx, tt.token)
+			}
+			found := false
+			for _, tool := range search.candidates(ctx) {
+				found = found || tool.server == tt.server
+			}
+			if found != tt.wantReached {
+				t.Errorf("%s searchable = %v, want %v", tt.server, found, tt.wantReached)
+			}
+			request := mcp.CallToolRequest{}
+			request.Params.Arguments = map[string]any{"server": tt.server, "tool": "echo", "arguments": map[string]any{"text": "hi"}}
+			result, err := search.handleCallTool(ctx, request)
+			if err != nil {
+				t.Fatal(err)
+			}
+			text := toolResultText(result)
+			if tt.wantReached && text != "hi" {
+				t.Errorf("call_tool = %s, want hi", text)
+			}
+			if !tt.wantReached && !strings.Contains(text, "unknown server "+tt.server) {
+				t.Errorf("call_tool = %s, want the server reported unknown", text)
+			}
+		})
+	}
+}
+
+// TestToolSearchCallToolRouteLimits checks that call_tool is held to the
+// search route's own ipFilter, as it does not pass through the route of
+// the server it calls.
+func TestToolSearchCallToolRouteLimits(t *testing.T) {
+	registry := newClientRegistry()
+	registry.add("github", newTestClient(t, "github"), newRouteAuth("github", nil, nil))
+	conf := &ToolSearchConfig{MetaTool: true, Options: &OptionsV2{IPFilter: &IPFilterConfig{Allow: []string{"10.0.0.0/8"}}}}
+	proxyConfig := &MCPProxyConfigV2{Type: MCPServerTypeStreamable, Version: "1.0.0"}
+	mux := http.NewServeMux()
+	routes := newRouteTable()
+	if err := mountToolSearch(conf, proxyConfig, registry, nil, newClientTracker(nil), "/", mux, routes); err != nil {
+		t.Fatal(err)
+	}
+	body := `{"jsonrpc":"2.0","id":1,"method":"tools/call","params":{"name":"call_tool","arguments":{"server":"github","tool":"echo"}}}`
+	w := serveTestRequest(routes, http.MethodPost, "/search/mcp", "", body)
+	if w.Code != http.StatusForbidden {
+		t.Errorf("status = %d, want %d: %s", w.Code, http.StatusForbidden, w.Body)
+	}
+}
@@ -0,0 +1,141 @@
+package proxy
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+
+	"github.com/mark3labs/mcp-go/client"
+	"github.com/mark3labs/mcp-go/client/transport"
+	"github.com/mark3labs/mcp-go/mcp"
+)
+
+// newUpstreamClient returns a client whose messages pass through tap and,
+// when set, the conformance checker.
+func newUpstreamClient(inner transport.Interface, tap *wireTap, conformance *conformanceChecker) *client.Client {
+	return client.NewClient(&upstreamTransport{Interface: inner, tap: tap, conformance: conformance, toolSchemas: make(map[string]rawToolSchemas)})
+}
+
+// rawToolSchemas are the schemas of a tool exactly as the upstream listed
+// them.
+type rawToolSchemas struct {
+	Input  json.RawMessage `json:"inputSchema"`
+	Output json.RawMessage `json:"outputSchema"`
+}
+
+// upstreamTransport wraps the transport of an upstream connection to trace
+// its messages and check its responses against the MCP spec. It forwards
+// the optional transport interfaces the mcp-go client looks for when the
+// wrapped transport implements them.
+type upstreamTransport struct {
+	transport.Interface
+	tap         *wireTap
+	conformance *conformanceChecker
+
+	// toolSchemas keeps the listed tool schemas, which mcp-go decodes into
+	// a struct that drops every keyword but type, properties, required,
+	// additionalProperties and $defs.
+	mu          sync.Mutex
+	toolSchemas map[string]rawToolSchemas
+}
+
+func (t *upstreamTransport) SendRequest(ctx context.Context, request transport.JSONRPCRequest) (*transport.JSONRPCResponse, error) {
+	t.tap.record(wireSend, request)
+	response, err := t.Interface.SendRequest(ctx, request)
+	if response == nil {
+		return response, err
+	}
+	t.tap.record(wireReceive, response)
+	if rejected := t.conformance.check(request.Method, request.Params, response); rejected != nil {
+		response = rejected
+	}
+	if request.Method == string(mcp.MethodToolsList) && response.Error == nil {
+		t.recordToolSchemas(response.Result)
+	}
+	return response, err
+}
+
+func (t *upstreamTransport) recordToolSchemas(result json.RawMessage) {
+	var list struct {
+		Tools []struct {
+			Name string `json:"name"`
+			rawToolSchemas
+		} `json:"tools"`
+	}
+	if json.Unmarshal(result, &list) != nil {
+		return
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, tool := range list.Tools {
+		t.toolSchemas[tool.Name] = tool.rawToolSchemas
+	}
+}
+
+// withUpstreamSchemas returns tool with the schemas the upstream listed for
+// it, so that they are advertised and validated against in full.
+func withUpstreamSchemas(mcpClient *client.Client, tool mcp.Tool) mcp.Tool {
+	t, ok := mcpClient.GetTransport().(*upstreamTransport)
+	if !ok {
+		return tool
+	}
+	t.mu.Lock()
+	schemas, ok := t.toolSchemas[tool.Name]
+	t.mu.Unlock()
+	if !ok {
+		return tool
+	}
+	if isJSONObject(schemas.Input) {
+		tool.InputSchema = mcp.ToolInputSchema{}
+		tool.RawInputSchema = schemas.Input
+	}
+	if isJSONObject(schemas.Output) {
+		tool.OutputSchema = mcp.ToolOutputSchema{}
+		tool.RawOutputSchema = schemas.Output
+	}
+	return tool
+}
+
+func isJSONObject(data json.RawMessage) bool {
+	var object map[string]json.RawMessage
+	return json.Unmarshal(data, &object) == nil && object != nil
+}
+
+func (t *upstreamTransport) SendNotification(ctx context.Context, notification mcp.JSONRPCNotification) error {
+	t.tap.record(wireSend, notification)
+	return t.Interface.SendNotification(ctx, notification)
+}
+
+func (t *upstreamTransport) SetNotificationHandler(handler func(notification mcp.JSONRPCNotification)) {
+	t.Interface.SetNotificationHandler(func(notification mcp.JSONRPCNotification) {
+		t.tap.record(wireReceive, notification)
+		handler(notification)
+	})
+}
+
+func (t *upstreamTransport) SetRequestHandler(handler transport.RequestHandler) {
+	bidirectional, ok := t.Interface.(transport.BidirectionalInterface)
+	if !ok {
+		return
+	}
+	bidirectional.SetRequestHandler(func(ctx context.Context, request transport.JSONRPCRequest) (*transport.JSONRPCResponse, error) {
+		t.tap.record(wireReceive, request)
+		response, err := handler(ctx, request)
+		if response != nil {
+			t.tap.record(wireSend, response)
+		}
+		return response, err
+	})
+}
+
+func (t *upstreamTransport) SetProtocolVersion(version string) {
+	if conn, ok := t.Interface.(transport.HTTPConnection); ok {
+		conn.SetProtocolVersion(version)
+	}
+}
+
+func (t *upstreamTransport) SetConnectionLostHandler(handler func(error)) {
+	if setter, ok := t.Interface.(interface{ SetConnectionLostHandler(func(error)) }); ok {
+		setter.SetConnectionLostHandler(handler)
+	}
+}
@@ -0,0 +1,216 @@
+package proxy
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+const (
+	defaultAssertionHeader = "X-MCP-Proxy-Assertion"
+	defaultAssertionTTL    = time.Minute
+)
+
+// upstreamSigner issues the short-lived JWTs attached to requests to
+// upstreams with signRequests set. Each token names the proxy as issuer,
+// the server as audience and, when the request came from an authenticated
+// caller, that caller as subject.
+type upstreamSigner struct {
+	issuer string
+	keyID  string
+	header string
+	ttl    time.Duration
+	alg    string
+	sign   func(signingInput []byte) ([]byte, error)
+}
+
+type assertionClaims struct {
+	Issuer    string   `json:"iss"`
+	Subject   string   `json:"sub,omitempty"`
+	Audience  string   `json:"aud"`
+	IssuedAt  int64    `json:"iat"`
+	NotBefore int64    `json:"nbf"`
+	ExpiresAt int64    `json:"exp"`
+	ID        string   `json:"jti"`
+	Groups    []string `json:"groups,omitempty"`
+}
+
+func newUpstreamSigner(conf *UpstreamSigningConfig) (*upstreamSigner, error) {
+	if conf == nil {
+		return nil, nil
+	}
+	s := &upstreamSigner{
+		issuer: conf.Issuer,
+		keyID:  conf.KeyID,
+		header: conf.Header,
+		ttl:    conf.TTL,
+	}
+	if s.header == "" {
+		s.header = defaultAssertionHeader
+	}
+	if s.ttl <= 0 {
+		s.ttl = defaultAssertionTTL
+	}
+	if conf.Secret != "" {
+		secret := []byte(conf.Secret)
+		s.alg = "HS256"
+		s.sign = func(signingInput []byte) ([]byte, error) {
+			mac := hmac.New(sha256.New, secret)
+			mac.Write(signingInput)
+			return mac.Sum(nil), nil
+		}
+		return s, nil
+	}
+	data, err := os.ReadFile(conf.KeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("upstream signing key: %w", err)
+	}
+	key, err := parsePrivateKey(data)
+	if err != nil {
+		return nil, fmt.Errorf("upstream signing key %s: %w", conf.KeyFile, err)
+	}
+	switch k := key.(type) {
+	case *rsa.PrivateKey:
+		s.alg = "RS256"
+		s.sign = func(signingInput []byte) ([]byte, error) {
+			digest := sha256.Sum256(signingInput)
+			return rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:])
+		}
+	case *ecdsa.PrivateKey:
+		if k.Curve != elliptic.P256() {
+			return nil, fmt.Errorf("upstream signing key %s: only P-256 EC keys are supported", conf.KeyFile)
+		}
+		s.alg = "ES256"
+		s.sign = func(signingInput []byte) ([]byte, error) {
+			digest := sha256.Sum256(signingInput)
+			r, sv, sErr := ecdsa.Sign(rand.Reader, k, digest[:])
+			if sErr != nil {
+				return nil, sErr
+			}
+			signature := make([]byte, 64)
+			r.FillBytes(signature[:32])
+			sv.FillBytes(signature[32:])
+			return signature, nil
+		}
+	case ed25519.PrivateKey:
+		s.alg = "EdDSA"
+		s.sign = func(signingInput []byte) ([]byte, error) {
+			return ed25519.Sign(k, signingInput), nil
+		}
+	default:
+		return nil, fmt.Errorf("upstream signing key %s: unsupported key type %T", conf.KeyFile, key)
+	}
+	return s, nil
+}
+
+// parsePrivateKey reads the first PEM block of data as a PKCS#8, PKCS#1 or
+// SEC 1 private key.
+func parsePrivateKey(data []byte) (any, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM block found")
+	}
+	if key, err := x509.ParsePKCS8PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	if key, err := x509.ParseECPrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	return nil, errors.New("not a PKCS#8, PKCS#1 or EC private key")
+}
+
+// token returns a JWT for a request to server made on behalf of the caller
+// in ctx, if any.
+func (s *upstreamSigner) token(ctx context.Context, server string) (string, error) {
+	now := time.Now()
+	jti := make([]byte, 16)
+	if _, err := rand.Read(jti); err != nil {
+		return "", err
+	}
+	claims := assertionClaims{
+		Issuer:    s.issuer,
+		Audience:  server,
+		IssuedAt:  now.Unix(),
+		NotBefore: now.Unix(),
+		ExpiresAt: now.Add(s.ttl).Unix(),
+		ID:        hex.EncodeToString(jti),
+	}
+	if caller := authTokenFromContext(ctx); caller != nil {
+		claims.Subject = callerName(caller)
+		claims.Groups = caller.Groups
+	}
+	header := map[string]string{"alg": s.alg, "typ": "JWT"}
+	if s.keyID != "" {
+		header["kid"] = s.keyID
+	}
+	headerJSON, err := json.Marshal(header)
+	if err != nil {
+		return "", err
+	}
+	claimsJSON, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(headerJSON) + "." + base64.RawURLEncoding.EncodeToString(claimsJSON)
+	signature, err := s.sign([]byte(signingInput))
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// headerValue formats a token for the configured header, as a bearer
+// credential when that header is Authorization.
+func (s *upstreamSigner) headerValue(token string) string {
+	if strings.EqualFold(s.header, "Authorization") {
+		return "Bearer " + token
+	}
+	return token
+}
+
+// headerFunc returns the transport hook that signs every request to
+// server, or nil when the signer is not configured.
+func (s *upstreamSigner) headerFunc(server string) func(context.Context) map[string]string {
+	if s == nil {
+		return nil
+	}
+	return func(ctx context.Context) map[string]string {
+		token, err := s.token(ctx, server)
+		if err != nil {
+			log.Printf("<%s> Failed to sign upstream request: %v", server, err)
+			return nil
+		}
+		return map[string]string{s.header: s.headerValue(token)}
+	}
+}
+
+// signRequest sets the assertion header on an outgoing passthrough request.
+func (s *upstreamSigner) signRequest(server string, r *http.Request) {
+	token, err := s.token(r.Context(), server)
+	if err != nil {
+		log.Printf("<%s> Failed to sign upstream request: %v", server, err)
+		return
+	}
+	r.Header.Set(s.header, s.headerValue(token))
+}
@@ -0,0 +1,137 @@
+package proxy
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"strings"
+)
+
+const defaultProxyUserHeader = "X-Forwarded-User"
+
+// userAuthenticator identifies users either by HTTP basic auth against the
+// configured users, or by a username header set by a trusted SSO proxy in
+// front of mcp-proxy.
+type userAuthenticator struct {
+	mode           AuthMode
+	users          map[string]string
+	header         string
+	groupsHeader   string
+	trustedProxies []*net.IPNet
+}
+
+func newUserAuthenticator(conf *AuthConfig) (*userAuthenticator, error) {
+	a := &userAuthenticator{
+		mode:         conf.Mode,
+		users:        conf.Users,
+		header:       conf.Header,
+		groupsHeader: conf.GroupsHeader,
+	}
+	switch conf.Mode {
+	case AuthModeBasic:
+		if len(conf.Users) == 0 {
+			return nil, fmt.Errorf("auth mode %s requires users", conf.Mode)
+		}
+	case AuthModeProxyHeader:
+		if a.header == "" {
+			a.header = defaultProxyUserHeader
+		}
+		for _, cidr := range conf.TrustedProxies {
+			if !strings.Contains(cidr, "/") {
+				if strings.Contains(cidr, ":") {
+					cidr += "/128"
+				} else {
+					cidr += "/32"
+				}
+			}
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				return nil, fmt.Errorf("invalid trusted proxy %q: %w", cidr, err)
+			}
+			a.trustedProxies = append(a.trustedProxies, network)
+		}
+		if len(a.trustedProxies) == 0 {
+			// Anyone who can reach the port could otherwise claim to be
+			// any user.
+			if !conf.InsecureTrustAnyClient {
+				return nil, fmt.Errorf("auth mode %s requires trustedProxies, or insecureTrustAnyClient when the proxy is only reachable through the SSO proxy", conf.Mode)
+			}
+			log.Printf("Warning: trusting %s from any client; set mcpProxy.auth.trustedProxies unless the proxy is unreachable except through the SSO proxy", a.header)
+		}
+	default:
+		return nil, fmt.Errorf("unknown auth mode: %s", conf.Mode)
+	}
+	return a, nil
+}
+
+// authenticate returns the identity of r, or false when the request does
+// not carry valid credentials for this mode.
+func (a *userAuthenticator) authenticate(r *http.Request) (*AuthToken, bool) {
+	switch a.mode {
+	case AuthModeBasic:
+		username, password, hasBasic := r.BasicAuth()
+		if !hasBasic {
+			return nil, false
+		}
+		if expected, exists := a.users[username]; exists && checkPassword(expected, password) {
+			return &AuthToken{Name: username}, true
+		}
+		return nil, false
+	case AuthModeProxyHeader:
+		username := strings.TrimSpace(r.Header.Get(a.header))
+		if username == "" || !a.trusted(r) {
+			return nil, false
+		}
+		token := &AuthToken{Name: username}
+		if a.groupsHeader != "" {
+			for _, group := range strings.Split(r.Header.Get(a.groupsHeader), ",") {
+				if group = strings.TrimSpace(group); group != "" {
+					token.Groups = append(token.Groups, group)
+				}
+			}
+		}
+		return token, true
+	}
+	return nil, false
+}
+
+func (a *userAuthenticator) trusted(r *http.Request) bool {
+	if len(a.trustedProxies) == 0 {
+		return true
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+	for _, network := range a.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// challenge asks browsers to prompt for credentials.
+func (a *userAuthenticator) challenge(w http.ResponseWriter) {
+	if a.mode == AuthModeBasic {
+		w.Header().Set("WWW-Authenticate", `Basic realm="mcp-proxy", charset="UTF-8"`)
+	}
+}
+
+// checkPassword compares a password against a configured value, which is
+// either the plain password or "sha256:" followed by its hex digest.
+func checkPassword(expected, password string) bool {
+	if digest, ok := strings.CutPrefix(expected, "sha256:"); ok {
+		sum := sha256.Sum256([]byte(password))
+		return subtle.ConstantTimeCompare([]byte(strings.ToLower(digest)), []byte(hex.EncodeToString(sum[:]))) == 1
+	}
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(password)) == 1
+}
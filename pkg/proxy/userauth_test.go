@@ -0,0 +1,96 @@
+package proxy
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNewUserAuthenticator(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    AuthConfig
+		wantErr bool
+	}{
+		{name: "basic", conf: AuthConfig{Mode: AuthModeBasic, Users: map[string]string{"alice": "pw"}}},
+		{name: "basic without users", conf: AuthConfig{Mode: AuthModeBasic}, wantErr: true},
+		{name: "proxy header", conf: AuthConfig{Mode: AuthModeProxyHeader, TrustedProxies: []string{"10.0.0.0/8"}}},
+		{name: "proxy header without trusted proxies", conf: AuthConfig{Mode: AuthModeProxyHeader}, wantErr: true},
+		{name: "proxy header trusting any client", conf: AuthConfig{Mode: AuthModeProxyHeader, InsecureTrustAnyClient: true}},
+		{name: "invalid trusted proxy", conf: AuthConfig{Mode: AuthModeProxyHeader, TrustedProxies: []string{"proxy"}}, wantErr: true},
+		{name: "unknown mode", conf: AuthConfig{Mode: "ldap"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newUserAuthenticator(&tt.conf); (err != nil) != tt.wantErr {
+				t.Errorf("newUserAuthenticator() error = %v, want error %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestUserAuthenticatorProxyHeader(t *testing.T) {
+	a, err := newUserAuthenticator(&AuthConfig{
+		Mode:           AuthModeProxyHeader,
+		GroupsHeader:   "X-Forwarded-Groups",
+		TrustedProxies: []string{"10.0.0.0/8", "192.168.1.5"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		remoteAddr string
+		user       string
+		wantOK     bool
+	}{
+		{name: "trusted network", remoteAddr: "10.1.2.3:5000", user: "alice", wantOK: true},
+		{name: "trusted host", remoteAddr: "192.168.1.5:5000", user: "alice", wantOK: true},
+		{name: "untrusted client", remoteAddr: "192.168.1.6:5000", user: "alice"},
+		{name: "no header", remoteAddr: "10.1.2.3:5000"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.user != "" {
+				r.Header.Set(defaultProxyUserHeader, tt.user)
+				r.Header.Set("X-Forwarded-Groups", "ops, dev")
+			}
+			token, ok := a.authenticate(r)
+			if ok != tt.wantOK {
+				t.Fatalf("authenticate() = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && (token.Name != tt.user || len(token.Groups) != 2 || token.Groups[1] != "dev") {
+				t.Errorf("authenticate() token = %+v", token)
+			}
+		})
+	}
+}
+
+func TestUserAuthenticatorBasic(t *testing.T) {
+	a, err := newUserAuthenticator(&AuthConfig{Mode: AuthModeBasic, Users: map[string]string{
+		"alice": "secret",
+		// sha256 of "secret".
+		"bob": "sha256:2bb80d537b1da3e38bd30361aa855686bde0eacd7162fef6a25fe97bf527a25b",
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		user, password string
+		want           bool
+	}{
+		{user: "alice", password: "secret", want: true},
+		{user: "bob", password: "secret", want: true},
+		{user: "alice", password: "guess"},
+		{user: "carol", password: "secret"},
+	}
+	for _, tt := range tests {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		r.SetBasicAuth(tt.user, tt.password)
+		if _, ok := a.authenticate(r); ok != tt.want {
+			t.Errorf("authenticate(%s, %s) = %v, want %v", tt.user, tt.password, ok, tt.want)
+		}
+	}
+}
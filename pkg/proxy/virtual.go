@@ -0,0 +1,67 @@
+package proxy
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/mark3labs/mcp-go/mcp"
+	"github.com/mark3labs/mcp-go/server"
+)
+
+// mountVirtualServer exposes a curated set of tools picked from already
+// connected upstreams as a single route. It must run after the referenced
+// clients have been added to the registry.
+func mountVirtualServer(name string, conf *VirtualServerConfig, proxyConfig *MCPProxyConfigV2, registry *clientRegistry, sources *authSources, clients *clientTracker, basePath string, routes *routeTable) error {
+	owners := make(map[string]*Client)
+	hideUnavailable := server.WithToolFilter(func(ctx context.Context, tools []mcp.Tool) []mcp.Tool {
+		visible := make([]mcp.Tool, 0, len(tools))
+		for _, tool := range tools {
+			if owner, ok := owners[tool.Name]; !ok || !owner.maintenance.Load() {
+				visible = append(visible, tool)
+			}
+		}
+		return visible
+	})
+	srv, err := newMCPServer(name, proxyConfig, &MCPClientConfigV2{Options: conf.Options}, hideUnavailable, clients.serverOption(name))
+	if err != nil {
+		return err
+	}
+	added := 0
+	for _, toolConfig := range conf.Tools {
+		upstream, ok := registry.get(toolConfig.Server)
+		if !ok {
+			log.Printf("<%s> Skipping tool %s: server %s is not connected", name, toolConfig.Tool, toolConfig.Server)
+			continue
+		}
+		tool, ok := upstream.findTool(toolConfig.Tool)
+		if !ok {
+			log.Printf("<%s> Skipping tool %s: not provided by server %s", name, toolConfig.Tool, toolConfig.Server)
+			continue
+		}
+		originalName := tool.Name
+		if toolConfig.As != "" {
+			tool.Name = toolConfig.As
+		}
+		log.Printf("<%s> Adding tool %s from %s/%s", name, tool.Name, toolConfig.Server, originalName)
+		owners[tool.Name] = upstream
+		srv.mcpServer.AddTool(tool, translateToolErrors(toolConfig.Server, func(ctx context.Context, request mcp.CallToolRequest) (*mcp.CallToolResult, error) {
+			request.Params.Name = originalName
+			return upstream.callTool(ctx, request)
+		}))
+		added++
+	}
+	added += addMacroTools(name, conf.Macros, registry, srv.mcpServer)
+	for _, metaTool := range conf.MetaTools {
+		log.Printf("<%s> Adding meta-tool %s", name, metaTool)
+		srv.mcpServer.AddTools(metaTools[metaTool](registry))
+		added++
+	}
+	if added == 0 {
+		return errors.New("no tools available")
+	}
+	mcpRoute := mcpRoutePath(basePath, name)
+	log.Printf("<%s> Handling requests at %s", name, mcpRoute)
+	routes.Handle(mcpRoute, chainMiddleware(srv.handler, newServerMiddlewares(name, conf.Options, sources)...))
+	return nil
+}
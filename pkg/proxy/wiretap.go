@@ -0,0 +1,178 @@
+package proxy
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"regexp"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	wireSend    = "send"
+	wireReceive = "receive"
+
+	defaultTraceMaxBytes = 4096
+	// wireSubscriberBuffer is the number of messages a slow trace stream
+	// may fall behind before messages are dropped for it.
+	wireSubscriberBuffer = 256
+	redactedValue        = "[REDACTED]"
+)
+
+// defaultRedactKeys are hidden when traceWire does not list its own.
+var defaultRedactKeys = []string{
+	"authorization", "cookie", "password", "secret", "token",
+	"access_token", "refresh_token", "api_key", "apikey", "client_secret",
+}
+
+// wireMessage is one traced JSON-RPC message, as streamed by the admin API.
+type wireMessage struct {
+	Time   time.Time `json:"time"`
+	Server string    `json:"server"`
+	// Direction is send for messages to the upstream and receive for
+	// messages from it.
+	Direction string          `json:"direction"`
+	Message   json.RawMessage `json:"message"`
+}
+
+// wireTap sees every JSON-RPC message exchanged with one upstream. It logs
+// them while enabled and streams them to admin subscribers; with neither
+// it only costs an atomic load per message.
+type wireTap struct {
+	server         string
+	enabled        atomic.Bool
+	redactKeys     map[string]bool
+	redactPatterns []*regexp.Regexp
+	maxBytes       int
+
+	mu          sync.Mutex
+	subscribers map[chan wireMessage]struct{}
+	watched     atomic.Bool
+}
+
+func newWireTap(server string, conf *TraceWireConfig) (*wireTap, error) {
+	t := &wireTap{
+		server:      server,
+		redactKeys:  make(map[string]bool),
+		maxBytes:    defaultTraceMaxBytes,
+		subscribers: make(map[chan wireMessage]struct{}),
+	}
+	keys := defaultRedactKeys
+	if conf != nil {
+		if len(conf.RedactKeys) > 0 {
+			keys = conf.RedactKeys
+		}
+		for _, pattern := range conf.RedactPatterns {
+			re, err := regexp.Compile(pattern)
+			if err != nil {
+				return nil, fmt.Errorf("traceWire.redactPatterns: %w", err)
+			}
+			t.redactPatterns = append(t.redactPatterns, re)
+		}
+		if conf.MaxBytes > 0 {
+			t.maxBytes = conf.MaxBytes
+		}
+		t.enabled.Store(conf.Enabled)
+	}
+	for _, key := range keys {
+		t.redactKeys[strings.ToLower(key)] = true
+	}
+	return t, nil
+}
+
+// setEnabled turns logging on or off and reports whether it changed.
+func (t *wireTap) setEnabled(enabled bool) bool {
+	return t.enabled.Swap(enabled) != enabled
+}
+
+// subscribe streams the messages seen from now on until cancel is called.
+func (t *wireTap) subscribe() (<-chan wireMessage, func()) {
+	ch := make(chan wireMessage, wireSubscriberBuffer)
+	t.mu.Lock()
+	t.subscribers[ch] = struct{}{}
+	t.watched.Store(true)
+	t.mu.Unlock()
+	return ch, func() {
+		t.mu.Lock()
+		delete(t.subscribers, ch)
+		t.watched.Store(len(t.subscribers) > 0)
+		t.mu.Unlock()
+	}
+}
+
+func (t *wireTap) record(direction string, message any) {
+	if t == nil || (!t.enabled.Load() && !t.watched.Load()) {
+		return
+	}
+	data, err := t.redact(message)
+	if err != nil {
+		log.Printf("<%s> Failed to trace message: %v", t.server, err)
+		return
+	}
+	if t.enabled.Load() {
+		arrow := "-->"
+		if direction == wireReceive {
+			arrow = "<--"
+		}
+		logged := string(data)
+		if len(logged) > t.maxBytes {
+			logged = strings.ToValidUTF8(logged[:t.maxBytes], "") + fmt.Sprintf("... [%d bytes]", len(data))
+		}
+		log.Printf("<%s> %s %s", t.server, arrow, logged)
+	}
+	if !t.watched.Load() {
+		return
+	}
+	traced := wireMessage{Time: time.Now(), Server: t.server, Direction: direction, Message: data}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for ch := range t.subscribers {
+		select {
+		case ch <- traced:
+		default:
+		}
+	}
+}
+
+// redact encodes message with the values of redacted keys and the matches
+// of redacted patterns replaced.
+func (t *wireTap) redact(message any) ([]byte, error) {
+	data, err := json.Marshal(message)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var v any
+	if err = decoder.Decode(&v); err != nil {
+		return nil, err
+	}
+	return json.Marshal(t.redactValue(v))
+}
+
+func (t *wireTap) redactValue(v any) any {
+	switch value := v.(type) {
+	case map[string]any:
+		for key, item := range value {
+			if t.redactKeys[strings.ToLower(key)] {
+				value[key] = redactedValue
+				continue
+			}
+			value[key] = t.redactValue(item)
+		}
+	case []any:
+		for i, item := range value {
+			value[i] = t.redactValue(item)
+		}
+	case string:
+		for _, re := range t.redactPatterns {
+			value = re.ReplaceAllString(value, redactedValue)
+		}
+		return value
+	}
+	return v
+}
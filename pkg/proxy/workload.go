@@ -0,0 +1,172 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"slices"
+	"sync"
+	"time"
+)
+
+const defaultWorkloadReloadInterval = 30 * time.Second
+
+// workloadIdentity holds the proxy's X.509 SVID and trust bundle, as
+// written to disk by the SPIRE agent or a helper like spiffe-helper. The
+// files are checked for changes at most once per reload interval, during
+// TLS handshakes, so rotated certificates are picked up without a restart.
+type workloadIdentity struct {
+	conf     *WorkloadIdentityConfig
+	interval time.Duration
+
+	mu        sync.Mutex
+	cert      *tls.Certificate
+	bundle    *x509.CertPool
+	modTime   time.Time
+	lastCheck time.Time
+}
+
+func newWorkloadIdentity(conf *WorkloadIdentityConfig) (*workloadIdentity, error) {
+	if conf == nil {
+		return nil, nil
+	}
+	w := &workloadIdentity{conf: conf, interval: conf.ReloadInterval}
+	if w.interval <= 0 {
+		w.interval = defaultWorkloadReloadInterval
+	}
+	modTime, err := w.latestModTime()
+	if err != nil {
+		return nil, err
+	}
+	if err = w.load(modTime); err != nil {
+		return nil, err
+	}
+	return w, nil
+}
+
+// latestModTime returns the newest modification time of the identity
+// files, so that a rotation touching any of them triggers a reload.
+func (w *workloadIdentity) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, file := range []string{w.conf.CertFile, w.conf.KeyFile, w.conf.BundleFile} {
+		info, err := os.Stat(file)
+		if err != nil {
+			return time.Time{}, fmt.Errorf("workload identity: %w", err)
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// load reads the identity files. Callers hold w.mu or own w exclusively.
+func (w *workloadIdentity) load(modTime time.Time) error {
+	cert, err := tls.LoadX509KeyPair(w.conf.CertFile, w.conf.KeyFile)
+	if err != nil {
+		return fmt.Errorf("workload identity: %w", err)
+	}
+	bundleData, err := os.ReadFile(w.conf.BundleFile)
+	if err != nil {
+		return fmt.Errorf("workload identity: %w", err)
+	}
+	bundle := x509.NewCertPool()
+	if !bundle.AppendCertsFromPEM(bundleData) {
+		return fmt.Errorf("workload identity: no certificates in %s", w.conf.BundleFile)
+	}
+	w.cert, w.bundle, w.modTime = &cert, bundle, modTime
+	id := "<no SPIFFE ID>"
+	if ids := spiffeIDs(cert.Leaf); len(ids) > 0 {
+		id = ids[0]
+	}
+	log.Printf("Loaded workload identity %s, valid until %s", id, cert.Leaf.NotAfter.Format(time.RFC3339))
+	return nil
+}
+
+// current returns the certificate and bundle, reloading them first when
+// the files changed since they were last read. A failed reload keeps the
+// previous identity so that a half-written rotation does not break
+// connections.
+func (w *workloadIdentity) current() (*tls.Certificate, *x509.CertPool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if now := time.Now(); now.Sub(w.lastCheck) >= w.interval {
+		w.lastCheck = now
+		modTime, err := w.latestModTime()
+		if err == nil && !modTime.Equal(w.modTime) {
+			err = w.load(modTime)
+		}
+		if err != nil {
+			log.Printf("Failed to reload workload identity, keeping the current one: %v", err)
+		}
+	}
+	return w.cert, w.bundle
+}
+
+// httpClient returns a client that presents the SVID and accepts upstreams
+// whose certificate chains to the trust bundle and, when ids is not empty,
+// carries one of those SPIFFE IDs. Host names are not checked: SPIFFE
+// server certificates identify workloads, not hosts.
+func (w *workloadIdentity) httpClient(ids []string) *http.Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		// The chain is verified against the current bundle below.
+		InsecureSkipVerify: true,
+		GetClientCertificate: func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			cert, _ := w.current()
+			return cert, nil
+		},
+		VerifyConnection: func(state tls.ConnectionState) error {
+			return w.verifyPeer(state.PeerCertificates, ids)
+		},
+	}
+	return &http.Client{Transport: transport}
+}
+
+func (w *workloadIdentity) verifyPeer(certs []*x509.Certificate, ids []string) error {
+	if len(certs) == 0 {
+		return errors.New("upstream presented no certificate")
+	}
+	_, bundle := w.current()
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         bundle,
+		Intermediates: intermediates,
+		KeyUsages:     []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	})
+	if err != nil {
+		return fmt.Errorf("upstream certificate: %w", err)
+	}
+	if len(ids) == 0 {
+		return nil
+	}
+	peerIDs := spiffeIDs(certs[0])
+	for _, id := range peerIDs {
+		if slices.Contains(ids, id) {
+			return nil
+		}
+	}
+	return fmt.Errorf("upstream SPIFFE ID %v is not one of %v", peerIDs, ids)
+}
+
+// spiffeIDs returns the spiffe:// URI SANs of cert.
+func spiffeIDs(cert *x509.Certificate) []string {
+	var ids []string
+	if cert == nil {
+		return nil
+	}
+	for _, uri := range cert.URIs {
+		if uri.Scheme == "spiffe" {
+			ids = append(ids, uri.String())
+		}
+	}
+	return ids
+}
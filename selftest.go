@@ -0,0 +1,76 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"github.com/tbxark/mcp-proxy/pkg/proxy"
+)
+
+// runSelftest implements `mcp-proxy selftest`, which checks every upstream
+// of a config without serving it, e.g. in CI before rolling out a change.
+func runSelftest(args []string) error {
+	flags := flag.NewFlagSet("selftest", flag.ExitOnError)
+	conf := flags.String("config", "config.json", "path to config file or a http(s) url")
+	expandEnv := flags.Bool("expand-env", true, "expand environment variables in config file")
+	timeout := flags.Duration("timeout", 60*time.Second, "time allowed per server")
+	asJSON := flags.Bool("json", false, "print the report as JSON")
+	_ = flags.Parse(args)
+
+	config, err := proxy.LoadConfig(*conf, false, *expandEnv, "", 10, true)
+	if err != nil {
+		return err
+	}
+	results := proxy.SelfTest(context.Background(), config, *timeout)
+
+	failed := 0
+	for _, result := range results {
+		if !result.Passed() {
+			failed++
+		}
+	}
+	if *asJSON {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		if err = encoder.Encode(results); err != nil {
+			return err
+		}
+	} else {
+		printSelftestReport(results)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d of %d servers failed", failed, len(results))
+	}
+	return nil
+}
+
+func printSelftestReport(results []proxy.SelfTestResult) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	_, _ = fmt.Fprintln(w, "SERVER\tRESULT\tTOOLS\tCONNECT\tLIST\tCALL\tDETAIL")
+	for _, r := range results {
+		status, detail := "pass", ""
+		switch {
+		case r.Skipped != "":
+			status, detail = "skip", r.Skipped
+		case !r.Passed():
+			status, detail = "FAIL", r.Step+": "+r.Error
+		case r.Tool != "":
+			detail = "called " + r.Tool
+		}
+		_, _ = fmt.Fprintf(w, "%s\t%s\t%d\t%s\t%s\t%s\t%s\n", r.Server, status, r.Tools,
+			formatSelftestDuration(r.Connect), formatSelftestDuration(r.ListTools), formatSelftestDuration(r.CallTool), detail)
+	}
+	_ = w.Flush()
+}
+
+func formatSelftestDuration(d time.Duration) string {
+	if d == 0 {
+		return "-"
+	}
+	return d.Round(100 * time.Microsecond).String()
+}